@@ -1,7 +1,10 @@
 package base58
 
 
-import "math/big"
+import (
+	"errors"
+	"math/big"
+)
 
 //Useful materials:
 //https://en.bitcoin.it/wiki/Base_58_Encoding
@@ -9,6 +12,12 @@ import "math/big"
 //alphabet used by Bitcoins
 var alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
 
+//ErrEmpty is returned when decoding an empty string, which encodes nothing
+var ErrEmpty = errors.New("base58: empty string")
+
+//ErrInvalidCharacter is returned when decoding a string holding a character outside the alphabet
+var ErrInvalidCharacter = errors.New("base58: invalid character")
+
 //Base58 holds the Base58 string
 type Base58 string
 
@@ -32,18 +41,26 @@ func (b Base58) ToBig() *big.Int {
 	return answer
 }
 
-//ToHex converts base58 to hex bytes
-func (b Base58) ToHex() []byte {
+//ToHex converts base58 to hex bytes, each leading '1' becoming a zero byte
+func (b Base58) ToHex() ([]byte, error) {
+	if len(b) == 0 {
+		return nil, ErrEmpty
+	}
+	for i := 0; i < len(b); i++ {
+		if _, ok := revalp[string(b[i:i+1])]; !ok {
+			return nil, ErrInvalidCharacter
+		}
+	}
 	value := b.ToBig() //convert to big.Int
 	oneCount := 0
-	for string(b)[oneCount] == '1' {
+	for oneCount < len(b) && b[oneCount] == '1' {
 		oneCount++
 	}
-	return append(make([]byte, oneCount), value.Bytes()...) //convert big.Int to bytes
+	return append(make([]byte, oneCount), value.Bytes()...), nil //convert big.Int to bytes
 }
 
 //ToHex convert base58 to hex bytes
-func ToHex(b string) []byte {
+func ToHex(b string) ([]byte, error) {
 	return Base58(b).ToHex()
 }
 
@@ -86,21 +103,33 @@ func BigToBase58(val *big.Int) Base58 {
 	return Base58(answer) //returns
 }
 
-//HexToBase58 encodes hex bytes into base58
+//HexToBase58 encodes hex bytes into base58. The digits are worked out by long division on a byte slice, which
+//address encoding does for every output, rather than through big.Int.
 func HexToBase58(val []byte) (string) {
-	tmp := BigToBase58(HexToBig(val)) //encoding of the number without zeroes in front
-
-	//looking for zeros at the beginning
-	i := 0
-	for i = 0; val[i] == 0 && i < len(val); i++ {
+	zeros := 0 //leading zero bytes are each written as the zero digit
+	for zeros < len(val) && val[zeros] == 0 {
+		zeros++
 	}
-	answer := ""
-	for j := 0; j < i; j++ { //adds zeroes from the front
-		answer += alphabet[0:1]
+	digits := make([]byte, (len(val)-zeros)*138/100+1) //log(256)/log(58) is below 1.38
+	length := 0
+	for _, b := range val[zeros:] {
+		carry := int(b)
+		i := 0
+		for ; i < length || carry != 0; i++ { //digits holds the base58 value so far, least significant first
+			carry += 256 * int(digits[i])
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		length = i
 	}
-	answer += string(tmp) //concatenates
-
-	return string(answer) //returns
+	answer := make([]byte, zeros+length)
+	for i := 0; i < zeros; i++ {
+		answer[i] = alphabet[0]
+	}
+	for i := 0; i < length; i++ {
+		answer[zeros+i] = alphabet[digits[length-1-i]]
+	}
+	return string(answer)
 }
 
 //HexToBig encodes hex representation to big.int
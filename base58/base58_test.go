@@ -0,0 +1,65 @@
+package base58_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/tgebhart/goparsebtc/base58"
+)
+
+func TestToHex(t *testing.T) {
+	tests := []struct {
+		in  string
+		hex string
+		err error
+	}{
+		//the genesis coinbase address is version 0, its hash160 and a checksum
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "0062e907b15cbf27d5425399ebf6f0fb50ebb88f18c29b7d93", nil},
+		{"1", "00", nil},
+		{"111", "000000", nil},
+		{"2", "01", nil},
+		{"", "", base58.ErrEmpty},
+		{"10", "", base58.ErrInvalidCharacter},
+		{"1I", "", base58.ErrInvalidCharacter},
+	}
+	for _, test := range tests {
+		got, err := base58.ToHex(test.in)
+		if err != test.err || hex.EncodeToString(got) != test.hex {
+			t.Errorf("ToHex(%q) = %x, %v, want %s, %v", test.in, got, err, test.hex, test.err)
+		}
+	}
+}
+
+//FuzzToHex checks that decoding never panics and that whatever decodes encodes back to the same string
+func FuzzToHex(f *testing.F) {
+	for _, seed := range []string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "1", "111", "", "0"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		b, err := base58.ToHex(s)
+		if err != nil {
+			return
+		}
+		if got := base58.HexToBase58(b); got != s {
+			t.Fatalf("%q decodes to %x, which encodes as %q", s, b, got)
+		}
+	})
+}
+
+//FuzzHexToBase58 checks that every byte string decodes from its encoding, leading zeros included
+func FuzzHexToBase58(f *testing.F) {
+	f.Add([]byte{0})
+	f.Add([]byte{0, 0, 1, 2, 3})
+	f.Add(bytes.Repeat([]byte{0xff}, 25))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if len(b) == 0 {
+			return
+		}
+		s := base58.HexToBase58(b)
+		got, err := base58.ToHex(s)
+		if err != nil || !bytes.Equal(got, b) {
+			t.Fatalf("%x encodes as %q, which decodes to %x, %v", b, s, got, err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package bech32
+
+import (
+    "errors"
+    "strings"
+)
+
+//ErrBadProgram is returned when a witness version or program cannot be made into an address
+var ErrBadProgram = errors.New("bech32: invalid witness version or program")
+
+//charset maps five bit values to the characters of the encoding
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+//checksum constants of BIP173 bech32, used for version 0 programs, and BIP350 bech32m, used for later versions
+const (
+  bech32Const = 1
+  bech32mConst = 0x2bc830a3
+)
+
+func polymod(values []byte) (uint32) {
+  generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+  chk := uint32(1)
+  for _, v := range values {
+    top := chk >> 25
+    chk = (chk & 0x1ffffff) << 5 ^ uint32(v)
+    for i := 0; i < 5; i++ {
+      if (top >> i) & 1 == 1 {
+        chk ^= generator[i]
+      }
+    }
+  }
+  return chk
+}
+
+//hrpExpand spreads the human readable part over five bit values for the checksum
+func hrpExpand(hrp string) ([]byte) {
+  ret := make([]byte, 0, len(hrp) * 2 + 1)
+  for i := 0; i < len(hrp); i++ {
+    ret = append(ret, hrp[i] >> 5)
+  }
+  ret = append(ret, 0)
+  for i := 0; i < len(hrp); i++ {
+    ret = append(ret, hrp[i] & 31)
+  }
+  return ret
+}
+
+//Encode encodes the five bit values data behind hrp with a bech32 checksum, or a bech32m checksum when m is set
+func Encode(hrp string, data []byte, m bool) (string) {
+  constant := uint32(bech32Const)
+  if m {
+    constant = bech32mConst
+  }
+  values := append(hrpExpand(hrp), data...)
+  mod := polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ constant
+  var sb strings.Builder
+  sb.WriteString(hrp)
+  sb.WriteByte('1')
+  for _, d := range data {
+    sb.WriteByte(charset[d])
+  }
+  for i := 0; i < 6; i++ {
+    sb.WriteByte(charset[(mod >> (5 * (5 - i))) & 31])
+  }
+  return sb.String()
+}
+
+//toFiveBits regroups bytes into five bit values, padding the last with zeros
+func toFiveBits(data []byte) ([]byte) {
+  var ret []byte
+  acc, bits := 0, 0
+  for _, b := range data {
+    acc = acc << 8 | int(b)
+    bits += 8
+    for bits >= 5 {
+      bits -= 5
+      ret = append(ret, byte(acc >> bits) & 31)
+    }
+  }
+  if bits > 0 {
+    ret = append(ret, byte(acc << (5 - bits)) & 31)
+  }
+  return ret
+}
+
+//SegwitAddress returns the address of a witness program, checksummed with bech32 for version 0 and bech32m after
+func SegwitAddress(hrp string, version int, program []byte) (string, error) {
+  if version < 0 || version > 16 || len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+    return "", ErrBadProgram
+  }
+  data := append([]byte{byte(version)}, toFiveBits(program)...)
+  return Encode(hrp, data, version > 0), nil
+}
@@ -0,0 +1,36 @@
+package bech32
+
+import (
+    "encoding/hex"
+    "testing"
+)
+
+func TestSegwitAddress(t *testing.T) {
+  //valid addresses from BIP173 and BIP350
+  tests := []struct {
+    hrp string
+    version int
+    program string
+    address string
+  }{
+    {"bc", 0, "751e76e8199196d454941c45d1b3a323f1433bd6", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+    {"tb", 0, "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"},
+    {"bc", 1, "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+    {"bc", 16, "751e", "bc1sw50qgdz25j"},
+  }
+  for _, test := range tests {
+    program, _ := hex.DecodeString(test.program)
+    address, err := SegwitAddress(test.hrp, test.version, program)
+    if err != nil || address != test.address {
+      t.Errorf("SegwitAddress(%s, %d, %s) = %s, %v, want %s", test.hrp, test.version, test.program, address, err, test.address)
+    }
+  }
+  for _, bad := range []struct {
+    version int
+    length int
+  }{{0, 21}, {1, 1}, {1, 41}, {17, 32}} {
+    if _, err := SegwitAddress("bc", bad.version, make([]byte, bad.length)); err != ErrBadProgram {
+      t.Errorf("version %d program of %d bytes returned %v", bad.version, bad.length, err)
+    }
+  }
+}
@@ -1,30 +1,31 @@
 package block
 
+import (
+    "encoding/hex"
+)
+
 
 //NullHash serves as default error hash when searching for RipeMD in output scripts
 const NullHash string = "0000000000000000000000000000000000000000"
 
-//MaxMultiSig holds the approximated maximum number of signatures in an output
-const MaxMultiSig uint32 = 10
-
-//Block holds fields for each new block
+//Block holds fields for each new block. Raw holds the serialized block, without the magic number and length
+//that prefix it in blk files; the scripts and witnesses of its transactions point into it.
 type Block struct {
   MagicNumber uint32
   BlockLength uint32
   Header Header
-  BlockHash string
+  BlockHash Hash
   TransactionCount uint64
   Transactions []Transaction
   HashBlock HashBlock
+  Raw []byte
 }
 
 //HashBlock holds a compressed version of a block to hash to our blockchain
 type HashBlock struct {
   FileEndpoint string
-  CompressedBlockHash string
-  BlockHash string
-  PreviousCompressedBlockHash string
-  PreviousBlockHash string
+  BlockHash Hash
+  PreviousBlockHash Hash
   TimeStamp uint32
   ByteOffset int
   LengthRead int
@@ -35,67 +36,91 @@ type HashBlock struct {
 //Header holds the interpreted Header fields read from the byte stream
 type Header struct {
   FormatVersion uint32
-  ByteFormatVersion []byte
-  PreviousBlockHash string
-  BytePreviousBlockHash []byte
-  MerkleRoot string
-  ByteMerkleRoot []byte
+  PreviousBlockHash Hash
+  MerkleRoot Hash
   TimeStamp uint32
-  ByteTimeStamp []byte
   TargetValue uint32
-  ByteTargetValue []byte
   Nonce uint32
-  ByteNonce []byte
 }
 
-//Transaction holds the interpreted Transaction fields read from the byte stream
+//Transaction holds the interpreted Transaction fields read from the byte stream. Raw spans the
+//transaction's serialization, witness included, within its block's Raw
 type Transaction struct {
-  TransactionHash string
+  TransactionHash Hash
   TransactionVersionNumber uint32
-  ByteTransactionVersionNumber []byte
   InputCount uint64
-  ByteInputCount []byte
   Inputs []Input
   OutputCount uint64
-  ByteOutputCount []byte
   Outputs []Output
   TransactionLockTime uint32
-  ByteTransactionLockTime []byte
+  Raw []byte
 }
 
 //Input holds the interpreted Input fields read from the byte stream
 type Input struct {
-  TransactionHash string
-  ByteTransactionHash []byte
+  TransactionHash Hash
   TransactionIndex uint32
-  ByteTransactionIndex []byte
-  InputScriptLength uint64
-  ByteInputScriptLength []byte
-  InputScript string
-  ByteInputScript []byte
+  InputScript []byte
   SequenceNumber uint32
-  ByteSequenceNumber []byte
+  Witness [][]byte
+}
+
+//InputScriptHex returns the input script as hex
+func (in *Input) InputScriptHex() (string) {
+  return hex.EncodeToString(in.InputScript)
 }
 
 //Output holds the interpreted Output fields read from the byte stream
 type Output struct {
   OutputValue uint64
-  ByteOutputValue []byte
-  ChallengeScriptLength uint64
-  ByteChallengeScriptLength []byte
-  ChallengeScript string
-  ChallengeScriptBytes []byte
+  ChallengeScript []byte
   KeyType string
-  Addresses [MaxMultiSig]Address
+  //Addresses holds the addresses the output script pays to, one for each key of a multisig output
+  Addresses []Address
+  //NullData holds what an OP_RETURN output carries, and is nil for other outputs
+  NullData *NullData
+}
+
+//NullData holds the data an OP_RETURN output carries. Payloads point into the output script.
+type NullData struct {
+  //Protocol names the protocol the data belongs to, or is empty when it is not recognized
+  Protocol string
+  //Payloads holds the data of each push after the OP_RETURN
+  Payloads [][]byte
+}
+
+//Data returns the payloads joined together
+func (n *NullData) Data() ([]byte) {
+  var b []byte
+  for _, p := range n.Payloads {
+    b = append(b, p...)
+  }
+  return b
+}
+
+//ChallengeScriptHex returns the output script as hex
+func (out *Output) ChallengeScriptHex() (string) {
+  return hex.EncodeToString(out.ChallengeScript)
 }
 
-//Address holds information for a given bitcoin address
+//Address holds information for a given bitcoin address. PublicKeyBytes and Hash160 may point into the output
+//script the address was found in.
 type Address struct {
   Address string
-  PublicKey string
+  //PublicKeyBytes holds the public key paid to by pay to public key and multisig outputs
   PublicKeyBytes []byte
-  RipeMD160 string
-  Transactions []Transaction
+  //Hash160 holds the RIPEMD160 of the SHA256 of the public key or script the address encodes
+  Hash160 []byte
+}
+
+//PublicKey returns the public key as hex
+func (a *Address) PublicKey() (string) {
+  return hex.EncodeToString(a.PublicKeyBytes)
+}
+
+//RipeMD160 returns the hash160 as hex
+func (a *Address) RipeMD160() (string) {
+  return hex.EncodeToString(a.Hash160)
 }
 
 //ResponseBlock holds the blockchain.info response json when querying a block through
@@ -0,0 +1,73 @@
+package block
+
+import (
+    "encoding/hex"
+    "errors"
+)
+
+//HashLength is the size in bytes of a double SHA256 hash
+const HashLength = 32
+
+//ErrHashLength is returned when parsing a hash that is not 32 bytes long
+var ErrHashLength = errors.New("block: hash must be 32 bytes")
+
+//Hash holds a block hash, txid or merkle root in internal byte order, the order it is serialized and computed in.
+//String and ParseHash use the reversed display order of the RPC interface and block explorers. Hashes compare
+//with == and can be used as map keys.
+type Hash [HashLength]byte
+
+//String returns the hash as hex in display order
+func (h Hash) String() (string) {
+  var r Hash
+  for i := range h {
+    r[i] = h[HashLength-1-i]
+  }
+  return hex.EncodeToString(r[:])
+}
+
+//IsZero reports whether every byte of the hash is zero, as in the previous block hash of the genesis block
+//and the previous txid of coinbase inputs
+func (h Hash) IsZero() (bool) {
+  return h == Hash{}
+}
+
+//MarshalText encodes the hash as display order hex
+func (h Hash) MarshalText() ([]byte, error) {
+  return []byte(h.String()), nil
+}
+
+//UnmarshalText decodes display order hex
+func (h *Hash) UnmarshalText(text []byte) (error) {
+  parsed, err := ParseHash(string(text))
+  if err != nil {
+    return err
+  }
+  *h = parsed
+  return nil
+}
+
+//ParseHash parses a hash written as hex in display order
+func ParseHash(s string) (Hash, error) {
+  var h Hash
+  if len(s) != 2*HashLength {
+    return h, ErrHashLength
+  }
+  _, err := hex.Decode(h[:], []byte(s))
+  if err != nil {
+    return h, err
+  }
+  for i := 0; i < HashLength/2; i++ {
+    h[i], h[HashLength-1-i] = h[HashLength-1-i], h[i]
+  }
+  return h, nil
+}
+
+//NewHash copies a hash held in internal byte order, as it appears in serialized blocks and digests
+func NewHash(b []byte) (Hash, error) {
+  var h Hash
+  if len(b) != HashLength {
+    return h, ErrHashLength
+  }
+  copy(h[:], b)
+  return h, nil
+}
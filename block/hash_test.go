@@ -0,0 +1,80 @@
+package block
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "testing"
+)
+
+//hashVectors pairs hashes as they are serialized in blocks with the display order explorers and the RPC interface use
+var hashVectors = []struct {
+  name string
+  internal string
+  display string
+}{
+  {"genesis block hash", "6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000", "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"},
+  {"genesis coinbase txid", "3ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a", "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"},
+  {"block 1 merkle root", "982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e", "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"},
+  {"block 9 coinbase txid", "c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704", "0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9"},
+}
+
+func TestHashDisplayOrder(t *testing.T) {
+  for _, v := range hashVectors {
+    t.Run(v.name, func(t *testing.T) {
+      internal, _ := hex.DecodeString(v.internal)
+      h, err := NewHash(internal)
+      if err != nil {
+        t.Fatalf("NewHash: %v", err)
+      }
+      if h.String() != v.display {
+        t.Errorf("String() = %s, want %s", h, v.display)
+      }
+      parsed, err := ParseHash(v.display)
+      if err != nil {
+        t.Fatalf("ParseHash: %v", err)
+      }
+      if parsed != h {
+        t.Errorf("ParseHash(%s) = %x in internal order, want %s", v.display, parsed[:], v.internal)
+      }
+      text, err := h.MarshalText()
+      if err != nil || string(text) != v.display {
+        t.Errorf("MarshalText() = %s, %v, want %s", text, err, v.display)
+      }
+      var unmarshaled Hash
+      err = unmarshaled.UnmarshalText([]byte(v.display))
+      if err != nil || unmarshaled != h {
+        t.Errorf("UnmarshalText(%s) = %x, %v, want %s", v.display, unmarshaled[:], err, v.internal)
+      }
+    })
+  }
+}
+
+func TestHashJSON(t *testing.T) {
+  h, _ := ParseHash(hashVectors[0].display)
+  encoded, err := json.Marshal(map[Hash]Hash{h: h})
+  if err != nil {
+    t.Fatalf("json.Marshal: %v", err)
+  }
+  want := `{"` + hashVectors[0].display + `":"` + hashVectors[0].display + `"}`
+  if string(encoded) != want {
+    t.Fatalf("json.Marshal = %s, want %s", encoded, want)
+  }
+  var decoded map[Hash]Hash
+  err = json.Unmarshal(encoded, &decoded)
+  if err != nil || decoded[h] != h {
+    t.Fatalf("json.Unmarshal = %v, %v, want the hash mapped to itself", decoded, err)
+  }
+}
+
+func TestParseHashErrors(t *testing.T) {
+  for _, s := range []string{"", "00", hashVectors[0].display + "00", "zz" + hashVectors[0].display[2:]} {
+    _, err := ParseHash(s)
+    if err == nil {
+      t.Errorf("ParseHash(%q) succeeded", s)
+    }
+  }
+  _, err := NewHash(make([]byte, HashLength-1))
+  if err != ErrHashLength {
+    t.Errorf("NewHash of 31 bytes returned %v, want ErrHashLength", err)
+  }
+}
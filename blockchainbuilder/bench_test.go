@@ -0,0 +1,77 @@
+package blockchainbuilder_test
+
+import (
+    "bytes"
+    "io"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//benchmarkBlock returns a block of 1000 transactions shaped like a typical mainnet block: mostly one input spending
+//a P2PKH output to two P2PKH outputs, with every fourth transaction spending a P2WPKH output instead
+func benchmarkBlock() (*block.Block) {
+  p2pkh := append(append([]byte{0x76, 0xa9, 0x14}, bytes.Repeat([]byte{0x11}, 20)...), 0x88, 0xac)
+  signature := bytes.Repeat([]byte{0x30}, 72)
+  key := append([]byte{0x02}, bytes.Repeat([]byte{0x22}, 32)...)
+  scriptSig := append(append([]byte{byte(len(signature))}, signature...), append([]byte{byte(len(key))}, key...)...)
+
+  c := chaintest.NewChain()
+  var txs []block.Transaction
+  for i := 0; i < 1000; i++ {
+    in := chaintest.In(block.Hash{byte(i), byte(i >> 8)}, uint32(i % 3))
+    if i % 4 == 0 {
+      in.Witness = [][]byte{signature, key}
+    } else {
+      in.InputScript = scriptSig
+    }
+    txs = append(txs, chaintest.Tx([]block.Input{in}, chaintest.Out(uint64(i), p2pkh), chaintest.Out(1000, p2pkh)))
+  }
+  return c.Mine(c.Tip, "", 0, txs...)
+}
+
+func BenchmarkDecodeBlockBytes(b *testing.B) {
+  raw := benchmarkBlock().Raw
+  options := []struct {
+    name string
+    options blockchainbuilder.DecodeOptions
+  }{
+    {"default", blockchainbuilder.DefaultDecodeOptions},
+    {"hashes", blockchainbuilder.DecodeOptions{ComputeHashes: true}},
+    {"fields", blockchainbuilder.DecodeOptions{}},
+  }
+  for _, o := range options {
+    b.Run(o.name, func(b *testing.B) {
+      b.ReportAllocs()
+      b.SetBytes(int64(len(raw)))
+      for i := 0; i < b.N; i++ {
+        var Block block.Block
+        err := blockchainbuilder.DecodeBlockBytes(raw, &Block, o.options)
+        if err != nil {
+          b.Fatal(err)
+        }
+      }
+    })
+  }
+}
+
+func BenchmarkDecoder(b *testing.B) {
+  bl := benchmarkBlock()
+  file := chaintest.AppendBlk(nil, bl, bl, bl, bl)
+  b.ReportAllocs()
+  b.SetBytes(int64(len(file)))
+  for i := 0; i < b.N; i++ {
+    d := blockchainbuilder.NewDecoder(bytes.NewReader(file), blockchainbuilder.DefaultDecodeOptions)
+    for {
+      var Block block.Block
+      err := d.Decode(&Block)
+      if err == io.EOF {
+        break
+      }
+      if err != nil {
+        b.Fatal(err)
+      }
+    }
+  }
+}
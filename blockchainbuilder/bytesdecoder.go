@@ -0,0 +1,323 @@
+package blockchainbuilder
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/nulldata"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//ErrTruncated is wrapped in a DecodeError when a serialized block or transaction ends early
+var ErrTruncated = errors.New("blockchainbuilder: unexpected end of data")
+//ErrTrailingBytes is wrapped in a DecodeError when bytes remain after the last transaction of a block
+var ErrTrailingBytes = errors.New("blockchainbuilder: bytes left over after the last transaction")
+//ErrBadWitnessFlag is wrapped in a DecodeError when a segwit marker is followed by a flag other than 1
+var ErrBadWitnessFlag = errors.New("blockchainbuilder: unknown segwit flag")
+//ErrSuperfluousWitness is wrapped in a DecodeError when a transaction in the segwit serialization has no witness
+//data, which bitcoind rejects since the same transaction has a shorter serialization without the marker
+var ErrSuperfluousWitness = errors.New("blockchainbuilder: segwit serialization without witnesses")
+
+//DecodeError reports the field and byte position at which a serialized block or transaction failed to decode
+type DecodeError struct {
+  Offset int
+  Field string
+  Err error
+}
+
+func (e *DecodeError) Error() (string) {
+  return fmt.Sprintf("%v: %s at byte %d", e.Err, e.Field, e.Offset)
+}
+
+//Unwrap returns the underlying sentinel error
+func (e *DecodeError) Unwrap() (error) {
+  return e.Err
+}
+
+//minimum serialized sizes, used to reject counts the remaining bytes cannot hold before allocating for them
+const (
+  minInputLength = 41
+  minOutputLength = 9
+  minTransactionLength = 60
+)
+
+//byteCursor walks a serialized block. Every slice it hands out is capped at its own length so
+//appending to it copies rather than overwriting the buffer.
+type byteCursor struct {
+  b []byte
+  pos int
+}
+
+func (c *byteCursor) errorAt(pos int, field string, err error) (error) {
+  return &DecodeError{Offset: pos, Field: field, Err: err}
+}
+
+func (c *byteCursor) next(n uint64, field string) ([]byte, error) {
+  if n > uint64(len(c.b) - c.pos) {
+    return nil, c.errorAt(c.pos, field, ErrTruncated)
+  }
+  end := c.pos + int(n)
+  s := c.b[c.pos:end:end]
+  c.pos = end
+  return s, nil
+}
+
+func (c *byteCursor) uint32(field string) (uint32, error) {
+  s, err := c.next(4, field)
+  if err != nil {
+    return 0, err
+  }
+  return binary.LittleEndian.Uint32(s), nil
+}
+
+func (c *byteCursor) uint64(field string) (uint64, error) {
+  s, err := c.next(8, field)
+  if err != nil {
+    return 0, err
+  }
+  return binary.LittleEndian.Uint64(s), nil
+}
+
+//hash reads a 32 byte hash
+func (c *byteCursor) hash(field string) (block.Hash, error) {
+  s, err := c.next(block.HashLength, field)
+  if err != nil {
+    return block.Hash{}, err
+  }
+  return block.Hash(s), nil
+}
+
+//compactSize reads a CompactSize integer, rejecting encodings longer than the value needs
+func (c *byteCursor) compactSize(field string) (uint64, error) {
+  n, length, err := blockserializer.CompactSize(c.b[c.pos:])
+  if err == io.ErrUnexpectedEOF {
+    return 0, c.errorAt(c.pos, field, ErrTruncated)
+  }
+  if err != nil {
+    return 0, c.errorAt(c.pos, field, err)
+  }
+  c.pos += length
+  return n, nil
+}
+
+//count reads a CompactSize element count and rejects counts the remaining bytes cannot hold
+func (c *byteCursor) count(field string, minLength int) (uint64, error) {
+  start := c.pos
+  n, err := c.compactSize(field)
+  if err != nil {
+    return 0, err
+  }
+  if n > uint64((len(c.b) - c.pos) / minLength) {
+    return 0, c.errorAt(start, field, ErrTruncated)
+  }
+  return n, nil
+}
+
+//varBytes reads a CompactSize length followed by that many bytes
+func (c *byteCursor) varBytes(field string) ([]byte, error) {
+  n, err := c.compactSize(field + " length")
+  if err != nil {
+    return nil, err
+  }
+  return c.next(n, field)
+}
+
+//DecodeBlockBytes decodes a serialized block held in raw, such as the hex of RPC getblock, the payload of a P2P
+//block message or a test vector. raw may also start with the magic number and length that prefix blocks in blk
+//files. Block.Raw and the scripts and witnesses of the result point into raw rather than copying it, so raw must
+//not be modified while Block is in use. Errors are DecodeErrors giving the byte position of the failure within raw.
+func DecodeBlockBytes(raw []byte, Block *block.Block, options DecodeOptions) (error) {
+  if len(raw) >= 8 && blockvalidation.ValidateMagicNumber(binary.LittleEndian.Uint32(raw)) {
+    Block.MagicNumber = binary.LittleEndian.Uint32(raw)
+    Block.BlockLength = binary.LittleEndian.Uint32(raw[4:])
+    if uint64(Block.BlockLength) > uint64(len(raw) - 8) {
+      return &DecodeError{Offset: 8, Field: "block", Err: ErrTruncated}
+    }
+    err := decodeBlockBody(raw[8:8+int(Block.BlockLength)], Block, options)
+    var de *DecodeError
+    if errors.As(err, &de) {
+      de.Offset += 8
+    }
+    return err
+  }
+  Block.MagicNumber = network.Active.Magic
+  Block.BlockLength = uint32(len(raw))
+  return decodeBlockBody(raw, Block, options)
+}
+
+//decodeBlockBody decodes the header and transactions that make up the whole of body
+func decodeBlockBody(body []byte, Block *block.Block, options DecodeOptions) (error) {
+  c := &byteCursor{b: body}
+  Block.Raw = body[:len(body):len(body)]
+  h := &Block.Header
+  var err error
+  h.FormatVersion, err = c.uint32("format version")
+  if err != nil {
+    return err
+  }
+  h.PreviousBlockHash, err = c.hash("previous block hash")
+  if err != nil {
+    return err
+  }
+  h.MerkleRoot, err = c.hash("merkle root")
+  if err != nil {
+    return err
+  }
+  h.TimeStamp, err = c.uint32("timestamp")
+  if err != nil {
+    return err
+  }
+  h.TargetValue, err = c.uint32("target value")
+  if err != nil {
+    return err
+  }
+  h.Nonce, err = c.uint32("nonce")
+  if err != nil {
+    return err
+  }
+
+  finishHeader(Block, options)
+
+  Block.TransactionCount, err = c.count("transaction count", minTransactionLength)
+  if err != nil {
+    return err
+  }
+  Block.Transactions = make([]block.Transaction, Block.TransactionCount)
+  for t := range Block.Transactions {
+    err = decodeTransactionBytes(c, &Block.Transactions[t], options)
+    if err != nil {
+      return err
+    }
+  }
+  if c.pos != len(c.b) {
+    return c.errorAt(c.pos, "block", ErrTrailingBytes)
+  }
+  return nil
+}
+
+//DecodeTransactionBytes decodes the transaction at the start of raw and returns the number of bytes it occupies.
+//Like DecodeBlockBytes, tx.Raw and the scripts and witnesses of tx point into raw.
+func DecodeTransactionBytes(raw []byte, tx *block.Transaction, options DecodeOptions) (int, error) {
+  c := &byteCursor{b: raw}
+  err := decodeTransactionBytes(c, tx, options)
+  if err != nil {
+    return 0, err
+  }
+  return c.pos, nil
+}
+
+func decodeTransactionBytes(c *byteCursor, tx *block.Transaction, options DecodeOptions) (error) {
+  start := c.pos
+  var err error
+  tx.TransactionVersionNumber, err = c.uint32("transaction version")
+  if err != nil {
+    return err
+  }
+
+  //a zero input count cannot start a valid transaction, so it marks the segwit serialization
+  segwit := c.pos + 1 < len(c.b) && c.b[c.pos] == 0
+  if segwit {
+    if c.b[c.pos+1] != 1 {
+      return c.errorAt(c.pos + 1, "segwit flag", ErrBadWitnessFlag)
+    }
+    c.pos += 2
+  }
+
+  tx.InputCount, err = c.count("input count", minInputLength)
+  if err != nil {
+    return err
+  }
+  tx.Inputs = make([]block.Input, tx.InputCount)
+  for i := range tx.Inputs {
+    in := &tx.Inputs[i]
+    in.TransactionHash, err = c.hash("input previous txid")
+    if err != nil {
+      return err
+    }
+    in.TransactionIndex, err = c.uint32("input previous output index")
+    if err != nil {
+      return err
+    }
+    in.InputScript, err = c.varBytes("input script")
+    if err != nil {
+      return err
+    }
+    in.SequenceNumber, err = c.uint32("input sequence number")
+    if err != nil {
+      return err
+    }
+  }
+
+  tx.OutputCount, err = c.count("output count", minOutputLength)
+  if err != nil {
+    return err
+  }
+  tx.Outputs = make([]block.Output, tx.OutputCount)
+  for o := range tx.Outputs {
+    out := &tx.Outputs[o]
+    out.OutputValue, err = c.uint64("output value")
+    if err != nil {
+      return err
+    }
+    out.ChallengeScript, err = c.varBytes("output script")
+    if err != nil {
+      return err
+    }
+    if options.DecodeScripts {
+      //an output script is opaque to the serialization, so one the classifier does not understand is recorded as
+      //nonstandard rather than failing the block. An empty script is valid.
+      _, kerr := blockvalidation.ParseOutputScript(out)
+      if kerr != nil && kerr != blockvalidation.ErrZeroOutputScript {
+        slog.Debug("unclassified output script", "script", out.ChallengeScriptHex(), logging.KeyError, kerr)
+      }
+      if out.KeyType == script.NullData {
+        out.NullData = nulldata.Parse(out.ChallengeScript, tx.Inputs)
+      }
+    }
+  }
+
+  witnessStart := c.pos
+  if segwit {
+    for i := range tx.Inputs {
+      items, err := c.count("witness item count", 1)
+      if err != nil {
+        return err
+      }
+      tx.Inputs[i].Witness = make([][]byte, items)
+      for w := range tx.Inputs[i].Witness {
+        tx.Inputs[i].Witness[w], err = c.varBytes("witness item")
+        if err != nil {
+          return err
+        }
+      }
+    }
+    if !blockserializer.HasWitness(tx) {
+      return c.errorAt(witnessStart, "witness", ErrSuperfluousWitness)
+    }
+  }
+
+  tx.TransactionLockTime, err = c.uint32("lock time")
+  if err != nil {
+    return err
+  }
+  tx.Raw = c.b[start:c.pos:c.pos]
+
+  //the txid is hashed straight from the serialized bytes; a segwit transaction's txid leaves out the marker, flag
+  //and witnesses, which are the bytes between its version and inputs and between its outputs and lock time
+  if options.ComputeHashes {
+    if segwit {
+      tx.TransactionHash = btchashing.DoubleSha256(c.b[start:start+4], c.b[start+6:witnessStart], c.b[c.pos-4:c.pos])
+    } else {
+      tx.TransactionHash = btchashing.DoubleSha256(tx.Raw)
+    }
+  }
+  return nil
+}
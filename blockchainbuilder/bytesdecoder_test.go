@@ -0,0 +1,85 @@
+package blockchainbuilder_test
+
+import (
+    "errors"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//unclassifiable starts with OP_NOP and ends in OP_CHECKMULTISIG without the key count ParseOutputScript looks for
+var unclassifiable = append(append([]byte{0x61}, make([]byte, 24)...), 0xae)
+
+func TestDecodeKeepsUnclassifiedScripts(t *testing.T) {
+  c := chaintest.NewChain()
+  coinbase := c.Branch(c.Tip)[0].Transactions[0].TransactionHash
+  tx := chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)},
+    chaintest.Out(1, []byte{}), chaintest.Out(2, unclassifiable), chaintest.Out(3, chaintest.OpTrue))
+  b := c.Mine(c.Tip, "", 0, tx)
+
+  var decoded block.Block
+  err := blockchainbuilder.DecodeBlockBytes(b.Raw, &decoded, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatalf("DecodeBlockBytes: %v", err)
+  }
+  if decoded.BlockHash != b.BlockHash {
+    t.Fatalf("block hash %s, want %s", decoded.BlockHash, b.BlockHash)
+  }
+  outputs := decoded.Transactions[1].Outputs
+  if len(outputs) != 3 {
+    t.Fatalf("%d outputs, want 3", len(outputs))
+  }
+  if outputs[0].KeyType != script.NonStandard {
+    t.Errorf("empty script key type %q, want %q", outputs[0].KeyType, script.NonStandard)
+  }
+  if outputs[1].KeyType != script.NonStandard {
+    t.Errorf("unclassifiable script key type %q, want %q", outputs[1].KeyType, script.NonStandard)
+  }
+  if outputs[2].OutputValue != 3 {
+    t.Errorf("output after the unclassifiable script has value %d, want 3", outputs[2].OutputValue)
+  }
+}
+
+func TestDecodeAcceptsProtocolValues(t *testing.T) {
+  //values the protocol allows that the parser once rejected: versions other than 1, sequence numbers just below
+  //final, any lock time and output indexes above 10000
+  c := chaintest.NewChain()
+  coinbase := c.Branch(c.Tip)[0].Transactions[0].TransactionHash
+  tx := chaintest.Tx([]block.Input{chaintest.In(coinbase, 20000)}, chaintest.Out(1, chaintest.OpTrue))
+  tx.TransactionVersionNumber = 0xffffffff
+  tx.Inputs[0].SequenceNumber = 0xfffffffe
+  tx.TransactionLockTime = 16777216
+  tx = chaintest.Finish(tx)
+  b := c.Mine(c.Tip, "", 0, tx)
+
+  var decoded block.Block
+  err := blockchainbuilder.DecodeBlockBytes(b.Raw, &decoded, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatalf("DecodeBlockBytes: %v", err)
+  }
+  got := decoded.Transactions[1]
+  if got.TransactionHash != tx.TransactionHash || got.TransactionVersionNumber != 0xffffffff || got.Inputs[0].SequenceNumber != 0xfffffffe ||
+    got.TransactionLockTime != 16777216 || got.Inputs[0].TransactionIndex != 20000 {
+    t.Errorf("decoded %+v, want %+v", got, tx)
+  }
+}
+
+func TestDecodeRejectsNonCanonicalCounts(t *testing.T) {
+  c := chaintest.NewChain()
+  coinbase := c.Branch(c.Tip)[0].Transactions[0].TransactionHash
+  b := c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)}, chaintest.Out(1, chaintest.OpTrue)))
+  if b.Raw[blockserializer.HeaderLength] != 2 {
+    t.Fatalf("transaction count byte %x, want 02", b.Raw[blockserializer.HeaderLength])
+  }
+  //the same count of two written in three bytes
+  raw := append(append(append([]byte{}, b.Raw[:blockserializer.HeaderLength]...), 0xfd, 2, 0), b.Raw[blockserializer.HeaderLength+1:]...)
+  var decoded block.Block
+  err := blockchainbuilder.DecodeBlockBytes(raw, &decoded, blockchainbuilder.DefaultDecodeOptions)
+  var de *blockchainbuilder.DecodeError
+  if !errors.Is(err, blockserializer.ErrNonCanonical) || !errors.As(err, &de) {
+    t.Errorf("DecodeBlockBytes = %v, want a DecodeError wrapping ErrNonCanonical", err)
+  }
+}
@@ -0,0 +1,176 @@
+package blockchainbuilder
+
+import (
+    "context"
+    "errors"
+    "io"
+    "log/slog"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/logging"
+)
+
+//DecodeOptions selects the work a Decoder does beyond reading each field
+type DecodeOptions struct {
+  //ExactMagic fails with ErrBadMagic when the magic number is not at the current position, even where the rest of
+  //the file is zero
+  ExactMagic bool
+  //Recover skips a block whose body breaks the serialization by its declared length and resyncs to the next block
+  //when the magic number or length is damaged, recording each skip in the Decoder's Corruptions instead of returning
+  //an error. Without it only the zeros at the end of a blk file are passed over.
+  Recover bool
+  //ComputeHashes computes the block hash and every transaction hash
+  ComputeHashes bool
+  //DecodeScripts classifies output scripts and derives their addresses
+  DecodeScripts bool
+  //PopulateHashBlock fills in the HashBlock used to link blocks into the main chain. It implies the block hash is computed
+  PopulateHashBlock bool
+}
+
+//DefaultDecodeOptions does all of the optional work
+var DefaultDecodeOptions = DecodeOptions{ComputeHashes: true, DecodeScripts: true, PopulateHashBlock: true}
+
+//Decoder reads consecutive blocks from a blk file or any other seekable stream of serialized blocks.
+//Every entry point in blockchainbuilder decodes through it.
+type Decoder struct {
+  Options DecodeOptions
+  //Corruptions lists the damaged stretches skipped so far, in file order
+  Corruptions []Corruption
+  //Offset is the position of the block last decoded, or of the damage that stopped decoding
+  Offset int64
+  r io.ReadSeeker
+  name string
+  //zeroFrom is where the file's trailing zeros started when it was zeroSize bytes long
+  zeroFrom int64
+  zeroSize int64
+}
+
+//NewDecoder returns a Decoder reading from r
+func NewDecoder(r io.ReadSeeker, options DecodeOptions) (*Decoder) {
+  d := &Decoder{Options: options, r: r}
+  if f, ok := r.(interface{ Name() string }); ok {
+    d.name = f.Name()
+  }
+  return d
+}
+
+//Decode reads the next block into Block and leaves the reader at the end of the block's declared length.
+//It returns io.EOF once no block remains, leaving the reader where the next block would start, before any
+//preallocated zeros, and ErrPartialBlock with the reader at the block's start when the file ends inside the block
+//or the block's body is zero from where it stops decoding, as when bitcoind is still writing it.
+//Every field is logged at debug level.
+func (d *Decoder) Decode(Block *block.Block) (error) {
+
+  file := d.r
+  log := slog.Default()
+  if d.name != "" {
+    log = log.With(logging.KeyFile, d.name)
+  }
+
+  var offset int64
+  var body []byte
+  for {
+    var err error
+    offset, err = file.Seek(0, io.SeekCurrent)
+    if err != nil {
+      return err
+    }
+    d.Offset = offset
+    body, err = d.readBlock(Block, offset)
+    if err == nil {
+      err = decodeBlockBody(body, Block, d.Options)
+      if err == nil {
+        break
+      }
+      //only a body that breaks the serialization is damage; anything else is returned as it is
+      var de *DecodeError
+      if !errors.As(err, &de) {
+        log.Debug("error decoding block", logging.KeyOffset, offset, logging.KeyError, err)
+        return err
+      }
+      //a block bitcoind has reserved space for but not finished writing ends in zeros
+      if unwritten(body, de) {
+        return d.partial(offset)
+      }
+      if d.Options.Recover {
+        //the framing was sound, so the next block starts where this one's declared length ends
+        next := offset + prefixLength + int64(Block.BlockLength)
+        d.skip(offset, err, next - offset)
+        _, err = file.Seek(next, io.SeekStart)
+        if err != nil {
+          return err
+        }
+        *Block = block.Block{}
+        continue
+      }
+      log.Debug("error decoding block", logging.KeyOffset, offset, logging.KeyError, err)
+      return err
+    }
+    if err == errResynced {
+      *Block = block.Block{}
+      continue
+    }
+    if err != io.EOF {
+      log.Debug("error reading block", logging.KeyOffset, offset, logging.KeyError, err)
+    }
+    return err
+  }
+  log = log.With(logging.KeyOffset, offset)
+  if !Block.BlockHash.IsZero() {
+    log = log.With(logging.KeyBlockHash, Block.BlockHash)
+  }
+  if d.Options.PopulateHashBlock {
+    Block.HashBlock.ByteOffset = int(offset)
+  }
+
+  log.Debug("block header", "magic_number", Block.MagicNumber, "block_length", Block.BlockLength,
+    "format_version", Block.Header.FormatVersion, "previous_block_hash", Block.Header.PreviousBlockHash,
+    "merkle_root", Block.Header.MerkleRoot,
+    "time_stamp", blockvalidation.ConvertUnixEpochToDate(Block.Header.TimeStamp), "target_value", Block.Header.TargetValue,
+    "nonce", Block.Header.Nonce, "transaction_count", Block.TransactionCount)
+  if log.Enabled(context.Background(), slog.LevelDebug) {
+    for t := range Block.Transactions {
+      logTransaction(&Block.Transactions[t], log.With("transaction", t))
+    }
+  }
+  return nil
+
+}
+
+//logTransaction logs every input and output of tx at debug level
+func logTransaction(tx *block.Transaction, log *slog.Logger) {
+  for i := range tx.Inputs {
+    in := &tx.Inputs[i]
+    log.Debug("input", "input", i, "previous_txid", in.TransactionHash, "previous_index", in.TransactionIndex,
+      "script", in.InputScriptHex(), "sequence_number", in.SequenceNumber)
+  }
+  for o := range tx.Outputs {
+    out := &tx.Outputs[o]
+    var address block.Address
+    if len(out.Addresses) > 0 {
+      address = out.Addresses[0]
+    }
+    log.Debug("output", "output", o, "value", out.OutputValue, "script", out.ChallengeScriptHex(), "key_type", out.KeyType,
+      "hash160", address.RipeMD160(), "address", address.Address, "public_key", address.PublicKey())
+  }
+  log.Debug("transaction", logging.KeyTransaction, tx.TransactionHash,
+    "version", tx.TransactionVersionNumber, "inputs", tx.InputCount, "outputs", tx.OutputCount, "lock_time", tx.TransactionLockTime)
+}
+
+//finishHeader computes the block hash and fills in the HashBlock once the header fields are read
+func finishHeader(Block *block.Block, options DecodeOptions) {
+  if !options.ComputeHashes && !options.PopulateHashBlock {
+    return
+  }
+  Block.BlockHash = btchashing.ComputeBlockHash(Block)
+  if options.PopulateHashBlock {
+    //ParsedBlockLength tracks where in the file the block ends
+    Block.HashBlock.ParsedBlockLength = Block.BlockLength
+    Block.HashBlock.TimeStamp = Block.Header.TimeStamp
+    //the previous block hash links blocks into the main chain
+    Block.HashBlock.PreviousBlockHash = Block.Header.PreviousBlockHash
+    Block.HashBlock.BlockHash = Block.BlockHash
+  }
+}
+
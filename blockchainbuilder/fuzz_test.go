@@ -0,0 +1,64 @@
+package blockchainbuilder_test
+
+import (
+    "bytes"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//fuzzBlocks seeds the block fuzzer with main network blocks 0 and 1, a block holding the BIP143 segwit example and
+//the genesis block behind its blk file prefix
+func fuzzBlocks() ([][]byte) {
+  var tx block.Transaction
+  if _, err := blockchainbuilder.DecodeTransactionBytes(chaintest.MustHex(chaintest.BIP143P2WPKHHex), &tx, blockchainbuilder.DefaultDecodeOptions); err != nil {
+    panic(err)
+  }
+  g := chaintest.Genesis()
+  segwit := chaintest.NewBlock(g.BlockHash, g.Header.TimeStamp + chaintest.BlockInterval, g.Transactions[0], tx)
+  return [][]byte{chaintest.MustHex(chaintest.GenesisHex), chaintest.MustHex(chaintest.Block1Hex), segwit.Raw, chaintest.AppendBlk(nil, g)}
+}
+
+//FuzzDecodeBlockBytes checks that decoding never panics and that a block which decodes serializes back to the bytes
+//it came from under the hash of its header
+func FuzzDecodeBlockBytes(f *testing.F) {
+  for _, seed := range fuzzBlocks() {
+    f.Add(seed)
+  }
+  f.Fuzz(func(t *testing.T, raw []byte) {
+    var b block.Block
+    if err := blockchainbuilder.DecodeBlockBytes(raw, &b, blockchainbuilder.DefaultDecodeOptions); err != nil {
+      return
+    }
+    if got := blockserializer.SerializeBlock(&b); !bytes.Equal(got, b.Raw) {
+      t.Fatalf("block %x serializes as %x", b.Raw, got)
+    }
+    if hash := btchashing.DoubleSha256(b.Raw[:blockserializer.HeaderLength]); hash != b.BlockHash {
+      t.Fatalf("block hash %s, header hashes to %s", b.BlockHash, hash)
+    }
+  })
+}
+
+//FuzzDecodeTransactionBytes checks that decoding never panics and that a transaction which decodes serializes back
+//to the bytes it took, with a txid over its serialization without witnesses
+func FuzzDecodeTransactionBytes(f *testing.F) {
+  for _, seed := range []string{chaintest.Tx170Hex, chaintest.BIP143P2WPKHHex, chaintest.GenesisHex[2*blockserializer.HeaderLength+2:]} {
+    f.Add(chaintest.MustHex(seed))
+  }
+  f.Fuzz(func(t *testing.T, raw []byte) {
+    var tx block.Transaction
+    n, err := blockchainbuilder.DecodeTransactionBytes(raw, &tx, blockchainbuilder.DefaultDecodeOptions)
+    if err != nil {
+      return
+    }
+    if got := blockserializer.SerializeTransaction(&tx); !bytes.Equal(got, raw[:n]) {
+      t.Fatalf("transaction %x serializes as %x", raw[:n], got)
+    }
+    if txid := btchashing.DoubleSha256(blockserializer.SerializeTransactionNoWitness(&tx)); txid != tx.TransactionHash {
+      t.Fatalf("txid %s, want %s", tx.TransactionHash, txid)
+    }
+  })
+}
@@ -0,0 +1,178 @@
+package blockchainbuilder_test
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/hex"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/consensus"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//goldenBlock is a main network block with facts about it known from elsewhere. Blocks other than the first two are
+//read from testdata/golden, gzipped as the hex bitcoin-cli getblock prints at verbosity 0; a missing file fails the
+//test. Blocks 9 and 170 come from btcd's database/testdata/blocks1-256.bz2 and block 277647 from its
+//blockchain/testdata/277647.dat.bz2.
+type goldenBlock struct {
+  name string
+  raw string
+  file string
+  hash string
+  merkle string
+  transactions int
+  //txids holds the txids of the first transactions of the block, in order
+  txids []string
+  check func(*testing.T, *block.Block)
+}
+
+var goldenBlocks = []goldenBlock{
+  {name: "genesis", raw: chaintest.GenesisHex, hash: "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+    merkle: "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", transactions: 1,
+    txids: []string{"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"},
+    check: payTo(0, 0, script.PubKey, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")},
+  {name: "block 1", raw: chaintest.Block1Hex, hash: chaintest.Block1Hash,
+    merkle: "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098", transactions: 1,
+    txids: []string{"0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"},
+    check: payTo(0, 0, script.PubKey, "12c6DSiU4Rq3P4ZxziKxzrL5LmMBrzjrJX")},
+  //the coinbase the first transaction between two people spent
+  {name: "block 9", file: "9.hex.gz", hash: "000000008d9dc510f23c2657fc4f67bea30078cc05a90eb89e84cc475c080805",
+    merkle: "0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9", transactions: 1,
+    txids: []string{"0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9"},
+    check: payTo(0, 0, script.PubKey, "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S")},
+  //Satoshi Nakamoto's payment of 10 bitcoin to Hal Finney
+  {name: "block 170", file: "170.hex.gz", hash: "00000000d1145790a8694403d4063f323d499e655c83426834d4ce2f8dd4a2ee",
+    merkle: "7dac2c5666815c17a3b36427de37bb9d2e2c5ccec3f8633eb91a4205cb4c10ff", transactions: 2,
+    txids: []string{"b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082",
+      "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"},
+    check: func(t *testing.T, b *block.Block) {
+      payTo(0, 0, script.PubKey, "1PSSGeFHDnKNxiEyFrD1wcEaHr9hrQDDWc")(t, b)
+      payTo(1, 0, script.PubKey, "1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3")(t, b)
+      payTo(1, 1, script.PubKey, "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S")(t, b)
+      spendsCoinbaseOf(t, b, "9.hex.gz")
+    }},
+  //a block of 213 transactions from early 2014, all paying to public key hashes, whose coinbase commits to its height
+  {name: "block 277647", file: "277647.hex.gz", hash: "0000000000000000054a714e580b16c583701712ab91060e92dbde6eb1e052a8",
+    merkle: "36ac31298eb05c23be1f775d635104705e4560c6532b95c158023c6dc9af06c3", transactions: 213,
+    txids: []string{"0fc1f998e6fc1fa43a879cea4a54fe9947e02b925ebc46237a2406c50e0f07ea",
+      "d1e594eabe8c582dc01a8768cb01679aea6956165806f69f40e22e5e352b3bd1",
+      "d88bca3658a3ca6a2fe7fd2b1ad19da2793fcf24617003eacad813322035e5a1"},
+    check: func(t *testing.T, b *block.Block) {
+      payTo(0, 0, script.PubKeyHash, "14cZMQk89mRYQkDEj8Rn25AnGoBi5H6uer")(t, b)
+      payTo(1, 0, script.PubKeyHash, "1586yAuW4UH9y6YbTx9p6U8xBPSX1fBmSi")(t, b)
+      payTo(2, 1, script.PubKeyHash, "1KpeK4KKYaR2WZ8urtuswH8FKjsFgsSsUi")(t, b)
+      //BIP34: a push of the height, 277647, in three little endian bytes
+      if s := b.Transactions[0].Inputs[0].InputScript; !bytes.HasPrefix(s, []byte{0x03, 0x8f, 0x3c, 0x04}) {
+        t.Errorf("coinbase script %x does not start with the height 277647", s)
+      }
+    }},
+}
+
+//goldenRaw returns the serialization of v, failing the test when its file is missing
+func goldenRaw(t *testing.T, v goldenBlock) ([]byte) {
+  if v.raw != "" {
+    return chaintest.MustHex(v.raw)
+  }
+  f, err := os.Open(filepath.Join("testdata", "golden", v.file))
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  z, err := gzip.NewReader(f)
+  if err != nil {
+    t.Fatalf("%s: %v", v.file, err)
+  }
+  contents, err := io.ReadAll(z)
+  if err != nil {
+    t.Fatalf("%s: %v", v.file, err)
+  }
+  raw, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+  if err != nil {
+    t.Fatalf("%s: %v", v.file, err)
+  }
+  return raw
+}
+
+//goldenDecode decodes the block v
+func goldenDecode(t *testing.T, v goldenBlock) (*block.Block, []byte) {
+  raw := goldenRaw(t, v)
+  var b block.Block
+  if err := blockchainbuilder.DecodeBlockBytes(raw, &b, blockchainbuilder.DefaultDecodeOptions); err != nil {
+    t.Fatalf("DecodeBlockBytes: %v", err)
+  }
+  return &b, raw
+}
+
+func TestGoldenBlocks(t *testing.T) {
+  for _, v := range goldenBlocks {
+    v := v
+    t.Run(v.name, func(t *testing.T) {
+      b, raw := goldenDecode(t, v)
+      if b.BlockHash.String() != v.hash {
+        t.Errorf("block hash %s, want %s", b.BlockHash, v.hash)
+      }
+      if b.Header.MerkleRoot.String() != v.merkle {
+        t.Errorf("merkle root %s, want %s", b.Header.MerkleRoot, v.merkle)
+      }
+      if len(b.Transactions) != v.transactions {
+        t.Fatalf("%d transactions, want %d", len(b.Transactions), v.transactions)
+      }
+      for tx, txid := range v.txids {
+        if b.Transactions[tx].TransactionHash.String() != txid {
+          t.Errorf("transaction %d has txid %s, want %s", tx, b.Transactions[tx].TransactionHash, txid)
+        }
+      }
+      for tx := range b.Transactions {
+        if txid := btchashing.DoubleSha256(blockserializer.SerializeTransactionNoWitness(&b.Transactions[tx])); txid != b.Transactions[tx].TransactionHash {
+          t.Errorf("transaction %d has txid %s, its serialization hashes to %s", tx, b.Transactions[tx].TransactionHash, txid)
+        }
+      }
+      if !bytes.Equal(blockserializer.SerializeBlock(b), raw) {
+        t.Error("block does not serialize back to its bytes")
+      }
+      //proof of work, the merkle root over the txids, size and the legacy rules for each transaction
+      for _, violation := range consensus.CheckBlock(b) {
+        t.Errorf("%s: %s", violation.Rule, violation.Detail)
+      }
+      if v.check != nil {
+        v.check(t, b)
+      }
+    })
+  }
+}
+
+//payTo checks that output out of transaction tx pays a script of the given type to address
+func payTo(tx int, out int, kind string, address string) (func(*testing.T, *block.Block)) {
+  return func(t *testing.T, b *block.Block) {
+    o := b.Transactions[tx].Outputs[out]
+    if got := script.Classify(o.ChallengeScript); got != kind || o.KeyType != kind {
+      t.Errorf("output %d:%d pays a %s script classified as %s, want %s", tx, out, got, o.KeyType, kind)
+    }
+    if len(o.Addresses) != 1 || o.Addresses[0].Address != address {
+      t.Errorf("output %d:%d pays %+v, want %s", tx, out, o.Addresses, address)
+    }
+  }
+}
+
+//spendsCoinbaseOf checks that the second transaction of b spends the coinbase of the block in file, with a valid
+//signature
+func spendsCoinbaseOf(t *testing.T, b *block.Block, file string) {
+  spent, _ := goldenDecode(t, goldenBlock{file: file})
+  coinbase := &spent.Transactions[0]
+  tx := &b.Transactions[1]
+  if in := tx.Inputs[0]; in.TransactionHash != coinbase.TransactionHash || in.TransactionIndex != 0 {
+    t.Fatalf("transaction 1 spends %s:%d, want %s:0", in.TransactionHash, in.TransactionIndex, coinbase.TransactionHash)
+  }
+  prevouts := []script.Prevout{{Value: coinbase.Outputs[0].OutputValue, Script: coinbase.Outputs[0].ChallengeScript}}
+  if err := script.VerifyInput(tx, 0, prevouts, script.VerifyNone); err != nil {
+    t.Errorf("signature of transaction 1: %v", err)
+  }
+}
@@ -0,0 +1,243 @@
+package blockchainbuilder
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io"
+    "log/slog"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/network"
+)
+
+//ErrBadBlockLength is returned when the length before a block is too small or too large to hold a block
+var ErrBadBlockLength = errors.New("blockchainbuilder: implausible block length")
+//ErrPartialBlock is returned when the last block of a file is incomplete, as when bitcoind is still writing it.
+//The reader is left at the start of the block so decoding can be retried once more has been written.
+var ErrPartialBlock = errors.New("blockchainbuilder: last block of the file is incomplete")
+
+//errResynced tells Decode that damaged data was skipped and the reader now sits at the next plausible block
+var errResynced = errors.New("blockchainbuilder: resynced")
+
+//MaxBlockLength is the largest serialized block the consensus rules allow
+const MaxBlockLength = 4000000
+
+const (
+  //prefixLength is the size of the magic number and length written before every block in a blk file
+  prefixLength = 8
+  //minBlockLength holds a header, a transaction count and the smallest possible coinbase
+  minBlockLength = blockserializer.HeaderLength + 1 + minTransactionLength
+  //earliestTimeStamp is the time of the main network genesis block; no network has older blocks
+  earliestTimeStamp = 1231006505
+  //resyncChunk is how much of the file is searched for a magic number per read
+  resyncChunk = 1 << 16
+)
+
+//Corruption records a damaged stretch of a blk file that decoding skipped
+type Corruption struct {
+  File string `json:"file"`
+  Offset int64 `json:"offset"`
+  Reason string `json:"reason"`
+  BytesSkipped int64 `json:"bytes_skipped"`
+}
+
+//readBlock reads the magic number, length and body of the block at offset. When damaged framing is skipped,
+//errResynced is returned with the reader at the next plausible block.
+func (d *Decoder) readBlock(Block *block.Block, offset int64) ([]byte, error) {
+  prefix := make([]byte, prefixLength)
+  _, err := io.ReadFull(d.r, prefix)
+  if err == io.ErrUnexpectedEOF {
+    return nil, d.partial(offset)
+  }
+  if err != nil {
+    return nil, err
+  }
+
+  Block.MagicNumber = binary.LittleEndian.Uint32(prefix)
+  if !blockvalidation.ValidateMagicNumber(Block.MagicNumber) {
+    if d.Options.ExactMagic {
+      return nil, ErrBadMagic
+    }
+    zero := bytes.Equal(prefix, make([]byte, prefixLength))
+    //a tailed file sits at the same run of trailing zeros on every poll, which need not be searched again
+    //until the file grows
+    if offset == d.zeroFrom && d.zeroSize > 0 && zero {
+      size, err := d.r.Seek(0, io.SeekEnd)
+      if err != nil {
+        return nil, err
+      }
+      if size == d.zeroSize {
+        _, err = d.r.Seek(offset, io.SeekStart)
+        if err != nil {
+          return nil, err
+        }
+        return nil, io.EOF
+      }
+    }
+    if d.Options.Recover {
+      return nil, d.resync(offset, ErrBadMagic, prefix[0] == 0)
+    }
+    //outside recover mode only the zeros bitcoind preallocates at the end of the file are passed over; anything
+    //else is damage that would lose the blocks it hides
+    if zero {
+      next, found, err := d.findBlock(offset + 1)
+      if err != nil {
+        return nil, err
+      }
+      if !found && next == offset + 1 {
+        d.zeroFrom = offset
+        _, err = d.r.Seek(offset, io.SeekStart)
+        if err != nil {
+          return nil, err
+        }
+        return nil, io.EOF
+      }
+    }
+    return nil, ErrBadMagic
+  }
+
+  Block.BlockLength = binary.LittleEndian.Uint32(prefix[4:])
+  if Block.BlockLength < minBlockLength || Block.BlockLength > MaxBlockLength {
+    if d.Options.Recover {
+      return nil, d.resync(offset, ErrBadBlockLength, false)
+    }
+    return nil, ErrBadBlockLength
+  }
+
+  //the whole body is read once and decoded in place; scripts and witnesses point into Block.Raw
+  body := make([]byte, Block.BlockLength)
+  _, err = io.ReadFull(d.r, body)
+  if err == io.EOF || err == io.ErrUnexpectedEOF {
+    //a length that runs over blocks written after it is damaged, not a block still being written
+    _, found, err := d.findBlock(offset + 1)
+    if err != nil {
+      return nil, err
+    }
+    if !found {
+      return nil, d.partial(offset)
+    }
+    if d.Options.Recover {
+      return nil, d.resync(offset, ErrBadBlockLength, false)
+    }
+    return nil, ErrBadBlockLength
+  }
+  if err != nil {
+    return nil, err
+  }
+  return body, nil
+}
+
+//partial returns the reader to the start of the block at offset, which the file ends before the end of or which
+//ends in zeros bitcoind has not yet written over, and returns ErrPartialBlock
+func (d *Decoder) partial(offset int64) (error) {
+  _, err := d.r.Seek(offset, io.SeekStart)
+  if err != nil {
+    return err
+  }
+  return ErrPartialBlock
+}
+
+//unwritten reports whether body is zero from the position at which it failed to decode, as the body of a block
+//bitcoind has reserved space for but not yet finished writing is. A body that runs out is not unwritten; its
+//declared length is wrong.
+func unwritten(body []byte, de *DecodeError) (bool) {
+  if de.Offset < 0 || de.Offset >= len(body) {
+    return false
+  }
+  for _, b := range body[de.Offset:] {
+    if b != 0 {
+      return false
+    }
+  }
+  return true
+}
+
+//resync skips from the damaged data at offset to the next plausible block, recording the skipped bytes, and
+//returns errResynced. When no block follows it stops at the zeros bitcoind preallocates at the end of blk files
+//and returns io.EOF; if the zeros start at offset, zeroAtOffset is set and nothing is recorded.
+func (d *Decoder) resync(offset int64, reason error, zeroAtOffset bool) (error) {
+  next, found, err := d.findBlock(offset + 1)
+  if err != nil {
+    return err
+  }
+  if !found && zeroAtOffset && next == offset + 1 {
+    next = offset
+    d.zeroFrom = offset
+  }
+  if next > offset {
+    d.skip(offset, reason, next - offset)
+  }
+  _, err = d.r.Seek(next, io.SeekStart)
+  if err != nil {
+    return err
+  }
+  if !found {
+    return io.EOF
+  }
+  return errResynced
+}
+
+//findBlock searches byte by byte from from for the network's magic number followed by a plausible length and
+//header, returning its offset. When there is none it returns the offset at which the file's trailing zeros start,
+//or from if the whole rest of the file is zero, and remembers it with the file's size for readBlock.
+func (d *Decoder) findBlock(from int64) (int64, bool, error) {
+  size, err := d.r.Seek(0, io.SeekEnd)
+  if err != nil {
+    return 0, false, err
+  }
+  magic := binary.LittleEndian.AppendUint32(nil, network.Active.Magic)
+  //the window overlaps the next chunk far enough to check the header of a match near its end
+  window := make([]byte, resyncChunk + prefixLength + blockserializer.HeaderLength)
+  zeroFrom := from
+  for pos := from; pos < size; pos += resyncChunk {
+    _, err = d.r.Seek(pos, io.SeekStart)
+    if err != nil {
+      return 0, false, err
+    }
+    n, err := io.ReadFull(d.r, window)
+    if err != nil && err != io.ErrUnexpectedEOF {
+      return 0, false, err
+    }
+    for i := 0; i < resyncChunk && i < n; i++ {
+      found := bytes.Index(window[i:n], magic)
+      if found < 0 || i + found >= resyncChunk {
+        break
+      }
+      i += found
+      if plausibleBlock(window[i:n], pos + int64(i), size) {
+        return pos + int64(i), true, nil
+      }
+    }
+    for i := min(n, resyncChunk) - 1; i >= 0; i-- {
+      if window[i] != 0 {
+        zeroFrom = pos + int64(i) + 1
+        break
+      }
+    }
+  }
+  d.zeroFrom, d.zeroSize = zeroFrom, size
+  return zeroFrom, false, nil
+}
+
+//plausibleBlock reports whether b, found at offset in a file of size bytes, starts with a length that fits the file
+//and a header no older than the genesis block. b is known to start with the magic number.
+func plausibleBlock(b []byte, offset int64, size int64) (bool) {
+  if len(b) < prefixLength + blockserializer.HeaderLength {
+    return false
+  }
+  length := binary.LittleEndian.Uint32(b[4:])
+  if length < minBlockLength || length > MaxBlockLength || offset + prefixLength + int64(length) > size {
+    return false
+  }
+  //the timestamp follows the version, previous block hash and merkle root
+  return binary.LittleEndian.Uint32(b[prefixLength+68:]) >= earliestTimeStamp
+}
+
+//skip records a damaged stretch of the file
+func (d *Decoder) skip(offset int64, reason error, skipped int64) {
+  d.Corruptions = append(d.Corruptions, Corruption{File: d.name, Offset: offset, Reason: reason.Error(), BytesSkipped: skipped})
+  slog.Warn("skipped damaged data", logging.KeyFile, d.name, logging.KeyOffset, offset, "bytes_skipped", skipped, logging.KeyError, reason)
+}
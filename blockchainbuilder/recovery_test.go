@@ -0,0 +1,143 @@
+package blockchainbuilder_test
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//decodeAll decodes blocks from d until it fails, returning their hashes and the error that stopped it
+func decodeAll(d *blockchainbuilder.Decoder) ([]block.Hash, error) {
+  var hashes []block.Hash
+  for {
+    var b block.Block
+    err := d.Decode(&b)
+    if err != nil {
+      return hashes, err
+    }
+    hashes = append(hashes, b.BlockHash)
+  }
+}
+
+//damagedFile returns a blk file of four blocks whose third has a transaction count its body cannot hold. The second
+//holds outputs the script classifier cannot place, which must not be mistaken for damage.
+func damagedFile() ([]byte, []*block.Block) {
+  c := chaintest.NewChain()
+  coinbase := c.Order[0].Transactions[0].TransactionHash
+  unusual := chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)}, chaintest.Out(1, []byte{}), chaintest.Out(2, unclassifiable))
+  c.Mine(c.Tip, "", 0, unusual)
+  c.Extend(2, "")
+  file := chaintest.AppendBlk(nil, c.Order...)
+  //the transaction count follows the 8 byte prefix and 80 byte header of the third block
+  third := 2*8 + len(c.Order[0].Raw) + len(c.Order[1].Raw) + 8 + 80
+  file[third] = 0x05
+  return file, c.Order
+}
+
+func TestRecoverSkipsOnlyDamage(t *testing.T) {
+  file, blocks := damagedFile()
+  options := blockchainbuilder.DefaultDecodeOptions
+  options.Recover = true
+  d := blockchainbuilder.NewDecoder(bytes.NewReader(file), options)
+  hashes, err := decodeAll(d)
+  if err != io.EOF {
+    t.Fatalf("decoding stopped with %v, want io.EOF", err)
+  }
+  want := []block.Hash{blocks[0].BlockHash, blocks[1].BlockHash, blocks[3].BlockHash}
+  if len(hashes) != len(want) {
+    t.Fatalf("decoded %d blocks, want %d", len(hashes), len(want))
+  }
+  for i := range want {
+    if hashes[i] != want[i] {
+      t.Errorf("block %d is %s, want %s", i, hashes[i], want[i])
+    }
+  }
+  if len(d.Corruptions) != 1 {
+    t.Fatalf("%d corruptions recorded, want 1: %+v", len(d.Corruptions), d.Corruptions)
+  }
+  third := int64(2*8 + len(blocks[0].Raw) + len(blocks[1].Raw))
+  if c := d.Corruptions[0]; c.Offset != third || c.BytesSkipped != int64(8 + len(blocks[2].Raw)) {
+    t.Errorf("corruption at %d skipping %d bytes, want the third block at %d", c.Offset, c.BytesSkipped, third)
+  }
+}
+
+func TestDamageStopsWithoutRecover(t *testing.T) {
+  file, _ := damagedFile()
+  d := blockchainbuilder.NewDecoder(bytes.NewReader(file), blockchainbuilder.DefaultDecodeOptions)
+  hashes, err := decodeAll(d)
+  var de *blockchainbuilder.DecodeError
+  if !errors.As(err, &de) {
+    t.Fatalf("decoding stopped with %v, want a DecodeError", err)
+  }
+  if len(hashes) != 2 {
+    t.Fatalf("decoded %d blocks before the damage, want 2", len(hashes))
+  }
+}
+
+func TestRecoverKeepsUnclassifiedScripts(t *testing.T) {
+  file, blocks := damagedFile()
+  options := blockchainbuilder.DefaultDecodeOptions
+  options.Recover = true
+  d := blockchainbuilder.NewDecoder(bytes.NewReader(file), options)
+  var b block.Block
+  for i := 0; i < 2; i++ {
+    b = block.Block{}
+    err := d.Decode(&b)
+    if err != nil {
+      t.Fatalf("Decode: %v", err)
+    }
+  }
+  if b.BlockHash != blocks[1].BlockHash || len(d.Corruptions) != 0 {
+    t.Fatalf("second block %s with %d corruptions, want %s with none", b.BlockHash, len(d.Corruptions), blocks[1].BlockHash)
+  }
+  if kt := b.Transactions[1].Outputs[1].KeyType; kt != script.NonStandard {
+    t.Errorf("unclassified output has key type %q, want %q", kt, script.NonStandard)
+  }
+}
+
+func TestCorruptedMagic(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(3, "")
+  blocks := c.Order
+  third := 2*8 + len(blocks[0].Raw) + len(blocks[1].Raw)
+  tests := []struct {
+    name string
+    magic []byte
+  }{
+    {"garbled", []byte{0xde, 0xad, 0xbe, 0xef}},
+    //zeros followed by a block are not the zeros at the end of the file
+    {"zeroed", []byte{0, 0, 0, 0}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      file := chaintest.AppendBlk(nil, blocks...)
+      copy(file[third:], test.magic)
+
+      d := blockchainbuilder.NewDecoder(bytes.NewReader(file), blockchainbuilder.DefaultDecodeOptions)
+      hashes, err := decodeAll(d)
+      if err != blockchainbuilder.ErrBadMagic || len(hashes) != 2 || len(d.Corruptions) != 0 {
+        t.Fatalf("without recover decoded %d blocks with %d corruptions, stopping with %v; want 2, none and ErrBadMagic",
+          len(hashes), len(d.Corruptions), err)
+      }
+      if d.Offset != int64(third) {
+        t.Errorf("stopped at %d, want the third block at %d", d.Offset, third)
+      }
+
+      options := blockchainbuilder.DefaultDecodeOptions
+      options.Recover = true
+      d = blockchainbuilder.NewDecoder(bytes.NewReader(file), options)
+      hashes, err = decodeAll(d)
+      if err != io.EOF || len(hashes) != 3 || hashes[2] != blocks[3].BlockHash {
+        t.Fatalf("with recover decoded %d blocks stopping with %v, want the blocks around the damage and io.EOF", len(hashes), err)
+      }
+      if len(d.Corruptions) != 1 || d.Corruptions[0].Offset != int64(third) || d.Corruptions[0].BytesSkipped != int64(8 + len(blocks[2].Raw)) {
+        t.Fatalf("corruptions %+v, want the third block at %d", d.Corruptions, third)
+      }
+    })
+  }
+}
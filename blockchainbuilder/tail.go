@@ -0,0 +1,54 @@
+package blockchainbuilder
+
+import (
+    "context"
+    "io"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//DefaultTailInterval is how often Tail looks for newly written blocks
+const DefaultTailInterval = 2 * time.Second
+
+//Tail decodes the blocks of a blk file bitcoind may still be appending to, handing each to fn. At the written end
+//of the file, whether that is the end of the file, the zeros bitcoind preallocates or a block it is halfway through
+//writing, Tail asks finished whether the file is complete, as it is once bitcoind has moved on to the next blk
+//file. If not it waits interval and looks again. Tail returns nil once a finished file has been read to the end,
+//ErrPartialBlock if a finished file ends in an incomplete block, and ctx's error when ctx is done. A nil finished
+//tails until ctx is done.
+func (d *Decoder) Tail(ctx context.Context, interval time.Duration, finished func() (bool), fn func(*block.Block) (error)) (error) {
+  if interval <= 0 {
+    interval = DefaultTailInterval
+  }
+  done := false
+  for {
+    Block := block.Block{}
+    err := d.Decode(&Block)
+    if err == nil {
+      err = fn(&Block)
+      if err != nil {
+        return err
+      }
+      continue
+    }
+    if err != io.EOF && err != ErrPartialBlock {
+      return err
+    }
+    //a file reported finished before this last attempt cannot grow any further
+    if done {
+      if err == io.EOF {
+        return nil
+      }
+      return err
+    }
+    if finished != nil && finished() {
+      done = true
+      continue
+    }
+    select {
+    case <-ctx.Done():
+      return ctx.Err()
+    case <-time.After(interval):
+    }
+  }
+}
@@ -0,0 +1,202 @@
+package blockchainbuilder_test
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//tailChain returns the genesis block and three blocks on it, the last ending in an output with an empty script so
+//its body ends in a run of zeros
+func tailChain() ([]*block.Block) {
+  c := chaintest.NewChain()
+  c.Extend(2, "")
+  coinbase := c.Order[1].Transactions[0].TransactionHash
+  c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)}, chaintest.Out(0, []byte{})))
+  return c.Order
+}
+
+func TestDecodeEndsAtPreallocatedZeros(t *testing.T) {
+  blocks := tailChain()
+  path := filepath.Join(t.TempDir(), "blk00000.dat")
+  err := chaintest.WriteBlkFile(path, 4096, blocks[:3]...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  f, err := os.OpenFile(path, os.O_RDWR, 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  d := blockchainbuilder.NewDecoder(f, blockchainbuilder.DefaultDecodeOptions)
+  hashes, err := decodeAll(d)
+  if err != io.EOF || len(hashes) != 3 || len(d.Corruptions) != 0 {
+    t.Fatalf("decoded %d blocks with %d corruptions, stopping with %v; want 3, none and io.EOF", len(hashes), len(d.Corruptions), err)
+  }
+  end := int64(len(chaintest.AppendBlk(nil, blocks[:3]...)))
+  if pos, _ := f.Seek(0, io.SeekCurrent); pos != end {
+    t.Fatalf("reader left at %d, want the end of the last block at %d", pos, end)
+  }
+  //polling again stops at the zeros, and bitcoind writing the next block into them is picked up
+  var b block.Block
+  if err = d.Decode(&b); err != io.EOF {
+    t.Fatalf("second Decode at the zeros returned %v, want io.EOF", err)
+  }
+  _, err = f.WriteAt(chaintest.AppendBlk(nil, blocks[3]), end)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err = d.Decode(&b); err != nil || b.BlockHash != blocks[3].BlockHash {
+    t.Fatalf("Decode after the block was written returned %s, %v; want %s", b.BlockHash, err, blocks[3].BlockHash)
+  }
+  if out := b.Transactions[1].Outputs[0]; len(out.ChallengeScript) != 0 || out.OutputValue != 0 {
+    t.Fatalf("empty output decoded as value %d script %x", out.OutputValue, out.ChallengeScript)
+  }
+}
+
+func TestDecodePartialBlock(t *testing.T) {
+  blocks := tailChain()
+  complete := chaintest.AppendBlk(nil, blocks[:3]...)
+  last := chaintest.AppendBlk(nil, blocks[3])
+  tests := []struct {
+    name string
+    file []byte
+  }{
+    {"prefix cut off", append(append([]byte{}, complete...), last[:5]...)},
+    {"body cut off", append(append([]byte{}, complete...), last[:len(last)/2]...)},
+    //bitcoind writes the length before the body, into space that is already zero
+    {"body not yet written", append(append(append([]byte{}, complete...), last[:len(last)/2]...), make([]byte, len(last) - len(last)/2 + 4096)...)},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      for _, recover := range []bool{false, true} {
+        options := blockchainbuilder.DefaultDecodeOptions
+        options.Recover = recover
+        r := bytes.NewReader(test.file)
+        d := blockchainbuilder.NewDecoder(r, options)
+        hashes, err := decodeAll(d)
+        if err != blockchainbuilder.ErrPartialBlock || len(hashes) != 3 || len(d.Corruptions) != 0 {
+          t.Fatalf("recover %v: decoded %d blocks with %d corruptions, stopping with %v; want 3, none and ErrPartialBlock",
+            recover, len(hashes), len(d.Corruptions), err)
+        }
+        if pos, _ := r.Seek(0, io.SeekCurrent); pos != int64(len(complete)) {
+          t.Fatalf("recover %v: reader left at %d, want the start of the partial block at %d", recover, pos, len(complete))
+        }
+      }
+    })
+  }
+}
+
+func TestDecodeDamageBeforeZeros(t *testing.T) {
+  blocks := tailChain()
+  file := chaintest.AppendBlk(nil, blocks...)
+  last := len(file) - len(blocks[3].Raw)
+  //a transaction count of three where the body holds two, with zeros preallocated after the block
+  file[last + 80] = 0x03
+  file = append(file, make([]byte, 4096)...)
+
+  d := blockchainbuilder.NewDecoder(bytes.NewReader(file), blockchainbuilder.DefaultDecodeOptions)
+  _, err := decodeAll(d)
+  var de *blockchainbuilder.DecodeError
+  if !errors.As(err, &de) {
+    t.Fatalf("without recover decoding stopped with %v, want a DecodeError", err)
+  }
+
+  options := blockchainbuilder.DefaultDecodeOptions
+  options.Recover = true
+  d = blockchainbuilder.NewDecoder(bytes.NewReader(file), options)
+  hashes, err := decodeAll(d)
+  if err != io.EOF || len(hashes) != 3 {
+    t.Fatalf("with recover decoded %d blocks stopping with %v, want 3 and io.EOF", len(hashes), err)
+  }
+  if len(d.Corruptions) != 1 || d.Corruptions[0].Offset != int64(last - 8) {
+    t.Fatalf("corruptions %+v, want the last block at %d", d.Corruptions, last - 8)
+  }
+}
+
+func TestDecodeOverlongLength(t *testing.T) {
+  blocks := tailChain()
+  file := chaintest.AppendBlk(nil, blocks...)
+  second := 8 + len(blocks[0].Raw)
+  //a length that reaches past the end of the file swallows the blocks after it
+  binary.LittleEndian.PutUint32(file[second+4:], 3000000)
+
+  d := blockchainbuilder.NewDecoder(bytes.NewReader(file), blockchainbuilder.DefaultDecodeOptions)
+  hashes, err := decodeAll(d)
+  if err != blockchainbuilder.ErrBadBlockLength || len(hashes) != 1 {
+    t.Fatalf("without recover decoded %d blocks stopping with %v, want 1 and ErrBadBlockLength", len(hashes), err)
+  }
+
+  options := blockchainbuilder.DefaultDecodeOptions
+  options.Recover = true
+  d = blockchainbuilder.NewDecoder(bytes.NewReader(file), options)
+  hashes, err = decodeAll(d)
+  if err != io.EOF || len(hashes) != 3 || hashes[1] != blocks[2].BlockHash {
+    t.Fatalf("with recover decoded %d blocks stopping with %v, want the blocks after the damage and io.EOF", len(hashes), err)
+  }
+  if len(d.Corruptions) != 1 || d.Corruptions[0].Offset != int64(second) || d.Corruptions[0].BytesSkipped != int64(8 + len(blocks[1].Raw)) {
+    t.Fatalf("corruptions %+v, want the second block at %d", d.Corruptions, second)
+  }
+}
+
+func TestTail(t *testing.T) {
+  blocks := tailChain()
+  path := filepath.Join(t.TempDir(), "blk00000.dat")
+  err := chaintest.WriteBlkFile(path, 0, blocks[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  var written atomic.Bool
+  go func() {
+    w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+    if err != nil {
+      written.Store(true)
+      return
+    }
+    defer w.Close()
+    //each block is written in two halves, so Tail sees it partial before it sees it whole
+    for _, b := range blocks[1:] {
+      raw := chaintest.AppendBlk(nil, b)
+      w.Write(raw[:len(raw)/2])
+      time.Sleep(10 * time.Millisecond)
+      w.Write(raw[len(raw)/2:])
+      time.Sleep(10 * time.Millisecond)
+    }
+    written.Store(true)
+  }()
+
+  f, err := os.Open(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+  defer cancel()
+  var hashes []block.Hash
+  err = blockchainbuilder.NewDecoder(f, blockchainbuilder.DefaultDecodeOptions).Tail(ctx, time.Millisecond, written.Load,
+    func(b *block.Block) (error) {
+      hashes = append(hashes, b.BlockHash)
+      return nil
+    })
+  if err != nil {
+    t.Fatalf("Tail: %v", err)
+  }
+  if len(hashes) != len(blocks) {
+    t.Fatalf("Tail handed over %d blocks, want %d", len(hashes), len(blocks))
+  }
+  for i, b := range blocks {
+    if hashes[i] != b.BlockHash {
+      t.Errorf("block %d is %s, want %s", i, hashes[i], b.BlockHash)
+    }
+  }
+}
@@ -3,11 +3,14 @@ package blockchainreader
 import (
     "errors"
     "fmt"
+    "log/slog"
     "os"
     "github.com/tgebhart/goparsebtc/block"
   //  "github.com/tgebhart/goparsebtc/filefunctions"
     "github.com/tgebhart/goparsebtc/blockchainbuilder"
     "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/network"
     "encoding/csv"
     "strconv"
     //"github.com/aws/aws-sdk-go/aws"
@@ -36,7 +39,7 @@ func NewReadChain() *ReadChain {
 }
 //ReadBlock holds row information from csv file
 type ReadBlock struct {
-  BlockHash string
+  BlockHash block.Hash
   FileEndpoint string
   ByteOffset int
   BlockLength int
@@ -44,6 +47,15 @@ type ReadBlock struct {
   TimeStamp int
 }
 
+//IndexedBlock holds a main chain block hash alongside its height and the location of the block in the .dat files
+type IndexedBlock struct {
+  Height int
+  BlockHash block.Hash
+  FileEndpoint string
+  ByteOffset int
+  BlockLength int
+}
+
 //ErrCompareHashes is thrown when the block hashes of the two sources do not match
 var ErrCompareHashes = errors.New("Error comparing read file and dat file block hashes")
 //ErrHashExists is thrown when trying to add a block to blockchain and its key already exists
@@ -70,7 +82,10 @@ func ReadReferenceFile(r *ReadChain, location string) (error) {
   var tempChain []ReadBlock
 
   for _, each := range rawCSV {
-    tempBlock.BlockHash = each[0]
+    tempBlock.BlockHash, err = block.ParseHash(each[0])
+    if err != nil {
+      return fmt.Errorf("blockchainreader: reference hash %q: %v", each[0], err)
+    }
     tempBlock.FileEndpoint = each[1]
     tempBlock.ByteOffset, _ = strconv.Atoi(each[2])
     tempBlock.BlockLength, _ = strconv.Atoi(each[3])
@@ -83,6 +98,90 @@ func ReadReferenceFile(r *ReadChain, location string) (error) {
   return nil
 }
 
+//IndexByHeight orders the blocks of a reference file from genesis to tip. The
+//reference file is written from the tip backwards and each row carries the file
+//location of the block's parent, so the location of the block in row i is found
+//in row i-1. The tip has no recorded location and is left out.
+func IndexByHeight(r *ReadChain) ([]IndexedBlock) {
+  n := len(r.ReadBlocks)
+  var ret []IndexedBlock
+  for h := 0; h < n; h++ {
+    i := n - h
+    loc := r.ReadBlocks[i-1]
+    hash := network.Active.GenesisBlockHash
+    if i < n {
+      hash = r.ReadBlocks[i].BlockHash
+    }
+    ret = append(ret, IndexedBlock{Height: h, BlockHash: hash, FileEndpoint: loc.FileEndpoint, ByteOffset: loc.ByteOffset, BlockLength: loc.BlockLength})
+  }
+  return ret
+}
+
+//ErrStopWalk can be returned by a WalkChain callback to end the walk early without error
+var ErrStopWalk = errors.New("blockchainreader: stop walk")
+
+//WalkChain parses the main chain blocks in readchain with heights from to to, inclusive,
+//and hands them to fn in height order. A negative to walks through to the tip. Each
+//block's hash is checked against the reference file, and a mismatch ends the walk with
+//an error wrapping ErrCompareHashes.
+func WalkChain(readchain *ReadChain, datLocation string, from int, to int, fn func(IndexedBlock, *block.Block) error) (error) {
+  return WalkBlocks(readchain, datLocation, from, to, func(ib IndexedBlock, b *block.Block) (error) {
+    if b.BlockHash != ib.BlockHash {
+      return fmt.Errorf("blockchainreader: height %d: %w: reference file has %s, %s holds %s", ib.Height, ErrCompareHashes, ib.BlockHash, ib.FileEndpoint, b.BlockHash)
+    }
+    return fn(ib, b)
+  })
+}
+
+//WalkBlocks walks like WalkChain but leaves comparing each block's hash with the reference
+//file to fn, for callers that report mismatches rather than stop at them
+func WalkBlocks(readchain *ReadChain, datLocation string, from int, to int, fn func(IndexedBlock, *block.Block) error) (error) {
+  var file *os.File
+  var datEndpoint string
+  var err error
+  defer func() {
+    if file != nil {
+      file.Close()
+    }
+  }()
+
+  for _, ib := range IndexByHeight(readchain) {
+    if ib.Height < from {
+      continue
+    }
+    if to >= 0 && ib.Height > to {
+      break
+    }
+    if ib.FileEndpoint != datEndpoint {
+      if file != nil {
+        file.Close()
+      }
+      file, err = os.Open(datLocation + ib.FileEndpoint)
+      if err != nil {
+        return err
+      }
+      datEndpoint = ib.FileEndpoint
+    }
+
+    b := new(block.Block)
+    err = ScanBlock(b, ib.ByteOffset, ib.BlockLength, file)
+    if err != nil {
+      return fmt.Errorf("blockchainreader: height %d (%s): %v", ib.Height, ib.BlockHash, err)
+    }
+    b.HashBlock.FileEndpoint = ib.FileEndpoint
+    b.HashBlock.ByteOffset = ib.ByteOffset
+
+    err = fn(ib, b)
+    if err == ErrStopWalk {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
 //LoadChain populates the Blockchain hashmap by reading in all files designated
 //in the readChain struct. Requires location of .dat files
 func LoadChain(chain *Blockchain, readchain *ReadChain, datLocation string) (error) {
@@ -99,7 +198,7 @@ func LoadChain(chain *Blockchain, readchain *ReadChain, datLocation string) (err
     nextEndpoint := b.FileEndpoint
 
     if nextEndpoint == "" || readchain.ReadBlocks[i-1].ByteOffset == 0 {
-      fmt.Println("briding with blockchain.info 1")
+      slog.Info("bridging with blockchain.info", logging.KeyBlockHash, b.BlockHash)
       err := blockvalidation.BridgeWithBlockchainInfo(&dBlock, b.BlockHash)
       if err != nil {
         return err
@@ -118,7 +217,7 @@ func LoadChain(chain *Blockchain, readchain *ReadChain, datLocation string) (err
       err := ScanBlock(&fBlock, readchain.ReadBlocks[i-1].ByteOffset, readchain.ReadBlocks[i-1].BlockLength, file)
       if err != nil {
         if err == blockchainbuilder.ErrBadMagic {
-          fmt.Println("briding with blockchain.info 2")
+          slog.Info("bridging with blockchain.info", logging.KeyBlockHash, b.BlockHash, logging.KeyError, err)
           err = blockvalidation.BridgeWithBlockchainInfo(&dBlock, b.BlockHash)
           if err != nil {
             return err
@@ -129,7 +228,7 @@ func LoadChain(chain *Blockchain, readchain *ReadChain, datLocation string) (err
         }
       }
 
-      if fBlock.BlockHash != "" {
+      if !fBlock.BlockHash.IsZero() {
 
         if fBlock.BlockHash != b.BlockHash {
           return ErrCompareHashes
@@ -208,10 +307,10 @@ func MapBlockToDBlock(b *block.Block, d *block.DBlock) (error) {
 
   d.MagicNumber = int(b.MagicNumber)
   d.BlockLength = int(b.BlockLength)
-  d.BlockHash = b.BlockHash
+  d.BlockHash = b.BlockHash.String()
   d.FormatVersion = int(b.Header.FormatVersion)
-  d.PreviousBlockHash = b.Header.PreviousBlockHash
-  d.MerkleRoot = b.Header.MerkleRoot
+  d.PreviousBlockHash = b.Header.PreviousBlockHash.String()
+  d.MerkleRoot = b.Header.MerkleRoot.String()
   d.TimeStamp = int(b.Header.TimeStamp)
   d.TargetValue = int(b.Header.TargetValue)
   d.Nonce = int(b.Header.Nonce)
@@ -226,7 +325,7 @@ func MapBlockToDBlock(b *block.Block, d *block.DBlock) (error) {
 
     tx.TransactionIndex = 0
     tx.Time = d.TimeStamp
-    tx.TransactionHash = b.Transactions[t].TransactionHash
+    tx.TransactionHash = b.Transactions[t].TransactionHash.String()
     tx.TransactionVersionNumber = int(b.Transactions[t].TransactionVersionNumber)
     tx.InputCount = int(b.Transactions[t].InputCount)
 
@@ -234,10 +333,10 @@ func MapBlockToDBlock(b *block.Block, d *block.DBlock) (error) {
 
       var in block.DInput
 
-      in.TransactionHash = b.Transactions[t].Inputs[i].TransactionHash
+      in.TransactionHash = b.Transactions[t].Inputs[i].TransactionHash.String()
       in.TransactionIndex = int(b.Transactions[t].Inputs[i].TransactionIndex)
-      in.InputScriptLength = int(b.Transactions[t].Inputs[i].InputScriptLength)
-      in.InputScript = b.Transactions[t].Inputs[i].InputScript
+      in.InputScriptLength = len(b.Transactions[t].Inputs[i].InputScript)
+      in.InputScript = b.Transactions[t].Inputs[i].InputScriptHex()
       in.SequenceNumber = int(b.Transactions[t].Inputs[i].SequenceNumber)
 
       dIns = append(dIns, in)
@@ -251,8 +350,8 @@ func MapBlockToDBlock(b *block.Block, d *block.DBlock) (error) {
       var out block.DOutput
 
       out.OutputValue = int(b.Transactions[t].Outputs[o].OutputValue)
-      out.ChallengeScriptLength = int(b.Transactions[t].Outputs[o].ChallengeScriptLength)
-      out.ChallengeScript = b.Transactions[t].Outputs[o].ChallengeScript
+      out.ChallengeScriptLength = len(b.Transactions[t].Outputs[o].ChallengeScript)
+      out.ChallengeScript = b.Transactions[t].Outputs[o].ChallengeScriptHex()
       out.KeyType = b.Transactions[t].Outputs[o].KeyType
       out.NumAddresses = len(b.Transactions[t].Outputs[o].Addresses)
 
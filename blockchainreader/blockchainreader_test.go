@@ -0,0 +1,80 @@
+package blockchainreader_test
+
+import (
+    "errors"
+    "path/filepath"
+    "strings"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//writeChain writes blocks to a blk file in a new directory and returns it with the reference rows the index
+//command would write for them: tip first, each row holding a block's hash and its parent's location
+func writeChain(t *testing.T, blocks []*block.Block) (string, *blockchainreader.ReadChain) {
+  dir := t.TempDir()
+  err := chaintest.WriteBlkFile(filepath.Join(dir, "blk00000.dat"), 0, blocks...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  offsets := make([]int, len(blocks))
+  for i := 1; i < len(blocks); i++ {
+    offsets[i] = offsets[i-1] + 8 + len(blocks[i-1].Raw)
+  }
+  readchain := blockchainreader.NewReadChain()
+  for i := len(blocks) - 1; i > 0; i-- {
+    readchain.ReadBlocks = append(readchain.ReadBlocks, blockchainreader.ReadBlock{BlockHash: blocks[i].BlockHash,
+      FileEndpoint: "blk00000.dat", ByteOffset: offsets[i-1], BlockLength: len(blocks[i-1].Raw), RawBlockNumber: i - 1})
+  }
+  return dir + string(filepath.Separator), readchain
+}
+
+func TestWalkChain(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(4, "")
+  blocks := c.Branch(c.Tip)
+  dir, readchain := writeChain(t, blocks)
+
+  var heights []int
+  err := blockchainreader.WalkChain(readchain, dir, 1, -1, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    if b.BlockHash != blocks[ib.Height].BlockHash {
+      t.Errorf("height %d holds %s", ib.Height, b.BlockHash)
+    }
+    heights = append(heights, ib.Height)
+    return nil
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  //the reference file cannot locate the tip
+  if len(heights) != 3 || heights[0] != 1 || heights[2] != 3 {
+    t.Fatalf("walked heights %v, want 1 to 3", heights)
+  }
+}
+
+func TestWalkChainHashMismatch(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(4, "")
+  dir, readchain := writeChain(t, c.Branch(c.Tip))
+  //the row naming height 2 is third from the tip
+  readchain.ReadBlocks[2].BlockHash = block.Hash{1}
+
+  err := blockchainreader.WalkChain(readchain, dir, 0, -1, func(blockchainreader.IndexedBlock, *block.Block) (error) {
+    return nil
+  })
+  if !errors.Is(err, blockchainreader.ErrCompareHashes) || !strings.Contains(err.Error(), "height 2") {
+    t.Fatalf("got %v, want ErrCompareHashes at height 2", err)
+  }
+
+  var mismatched []int
+  err = blockchainreader.WalkBlocks(readchain, dir, 0, -1, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    if b.BlockHash != ib.BlockHash {
+      mismatched = append(mismatched, ib.Height)
+    }
+    return nil
+  })
+  if err != nil || len(mismatched) != 1 || mismatched[0] != 2 {
+    t.Fatalf("WalkBlocks reported mismatches at %v, %v", mismatched, err)
+  }
+}
@@ -0,0 +1,96 @@
+package blockserializer
+
+import (
+    "encoding/binary"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//HeaderLength is the serialized size of a block header
+const HeaderLength = 80
+
+//appendScript appends a script preceded by its length
+func appendScript(b []byte, script []byte) ([]byte) {
+  b = AppendCompactSize(b, uint64(len(script)))
+  return append(b, script...)
+}
+
+//AppendHeader appends the 80 byte serialization of h
+func AppendHeader(b []byte, h *block.Header) ([]byte) {
+  b = binary.LittleEndian.AppendUint32(b, h.FormatVersion)
+  b = append(b, h.PreviousBlockHash[:]...)
+  b = append(b, h.MerkleRoot[:]...)
+  b = binary.LittleEndian.AppendUint32(b, h.TimeStamp)
+  b = binary.LittleEndian.AppendUint32(b, h.TargetValue)
+  return binary.LittleEndian.AppendUint32(b, h.Nonce)
+}
+
+//SerializeHeader returns the 80 byte serialization of h, the bytes hashed for the block hash
+func SerializeHeader(h *block.Header) ([]byte) {
+  return AppendHeader(make([]byte, 0, HeaderLength), h)
+}
+
+//HasWitness reports whether any input of tx carries witness data, which selects the segwit serialization
+func HasWitness(tx *block.Transaction) (bool) {
+  for i := range tx.Inputs {
+    if len(tx.Inputs[i].Witness) > 0 {
+      return true
+    }
+  }
+  return false
+}
+
+//AppendTransaction appends the serialization of tx. With witness set and witness data present the BIP144
+//segwit serialization is written, otherwise the legacy serialization that txids are computed over.
+//Counts and script lengths are taken from the slices and scripts themselves.
+func AppendTransaction(b []byte, tx *block.Transaction, witness bool) ([]byte) {
+  witness = witness && HasWitness(tx)
+  b = binary.LittleEndian.AppendUint32(b, tx.TransactionVersionNumber)
+  if witness {
+    b = append(b, 0x00, 0x01)
+  }
+  b = AppendCompactSize(b, uint64(len(tx.Inputs)))
+  for i := range tx.Inputs {
+    in := &tx.Inputs[i]
+    b = append(b, in.TransactionHash[:]...)
+    b = binary.LittleEndian.AppendUint32(b, in.TransactionIndex)
+    b = appendScript(b, in.InputScript)
+    b = binary.LittleEndian.AppendUint32(b, in.SequenceNumber)
+  }
+  b = AppendCompactSize(b, uint64(len(tx.Outputs)))
+  for o := range tx.Outputs {
+    out := &tx.Outputs[o]
+    b = binary.LittleEndian.AppendUint64(b, out.OutputValue)
+    b = appendScript(b, out.ChallengeScript)
+  }
+  if witness {
+    for i := range tx.Inputs {
+      b = AppendCompactSize(b, uint64(len(tx.Inputs[i].Witness)))
+      for _, item := range tx.Inputs[i].Witness {
+        b = AppendCompactSize(b, uint64(len(item)))
+        b = append(b, item...)
+      }
+    }
+  }
+  return binary.LittleEndian.AppendUint32(b, tx.TransactionLockTime)
+}
+
+//SerializeTransaction returns the wire serialization of tx, including witness data when it has any
+func SerializeTransaction(tx *block.Transaction) ([]byte) {
+  return AppendTransaction(nil, tx, true)
+}
+
+//SerializeTransactionNoWitness returns the legacy serialization of tx, the bytes hashed for its txid
+func SerializeTransactionNoWitness(tx *block.Transaction) ([]byte) {
+  return AppendTransaction(nil, tx, false)
+}
+
+//SerializeBlock returns the wire serialization of b: its header, transaction count and transactions.
+//The magic number and length that prefix blocks in blk files are not included.
+func SerializeBlock(b *block.Block) ([]byte) {
+  raw := AppendHeader(make([]byte, 0, HeaderLength + int(b.BlockLength)), &b.Header)
+  raw = AppendCompactSize(raw, uint64(len(b.Transactions)))
+  for t := range b.Transactions {
+    raw = AppendTransaction(raw, &b.Transactions[t], true)
+  }
+  return raw
+}
@@ -0,0 +1,106 @@
+package blockserializer_test
+
+import (
+    "bytes"
+    "reflect"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//segwitBlock returns a block mined on the genesis block holding the BIP143 segwit example after its coinbase
+func segwitBlock(t *testing.T) ([]byte) {
+  var tx block.Transaction
+  _, err := blockchainbuilder.DecodeTransactionBytes(chaintest.MustHex(chaintest.BIP143P2WPKHHex), &tx, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatalf("DecodeTransactionBytes: %v", err)
+  }
+  c := chaintest.NewChain()
+  return c.Mine(c.Tip, "", 0, tx).Raw
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+  tests := []struct {
+    name string
+    raw []byte
+    hash string
+  }{
+    {"genesis", chaintest.MustHex(chaintest.GenesisHex), "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"},
+    {"block 1", chaintest.MustHex(chaintest.Block1Hex), chaintest.Block1Hash},
+    {"segwit", segwitBlock(t), ""},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var decoded block.Block
+      err := blockchainbuilder.DecodeBlockBytes(test.raw, &decoded, blockchainbuilder.DefaultDecodeOptions)
+      if err != nil {
+        t.Fatalf("DecodeBlockBytes: %v", err)
+      }
+      if test.hash != "" && decoded.BlockHash.String() != test.hash {
+        t.Fatalf("block hash %s, want %s", decoded.BlockHash, test.hash)
+      }
+      //encode(decode(raw)) == raw
+      encoded := blockserializer.SerializeBlock(&decoded)
+      if !bytes.Equal(encoded, test.raw) {
+        t.Fatalf("serialized block differs from the decoded bytes:\n got %x\nwant %x", encoded, test.raw)
+      }
+      //decode(encode(x)) == x
+      var again block.Block
+      err = blockchainbuilder.DecodeBlockBytes(encoded, &again, blockchainbuilder.DefaultDecodeOptions)
+      if err != nil {
+        t.Fatalf("DecodeBlockBytes of the serialized block: %v", err)
+      }
+      if !reflect.DeepEqual(again, decoded) {
+        t.Fatalf("block decoded from its serialization differs:\n got %+v\nwant %+v", again, decoded)
+      }
+    })
+  }
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+  tests := []struct {
+    name string
+    raw []byte
+    txid string
+    witness bool
+  }{
+    {"block 170", chaintest.MustHex(chaintest.Tx170Hex), chaintest.Tx170ID, false},
+    {"bip143 p2wpkh", chaintest.MustHex(chaintest.BIP143P2WPKHHex), "", true},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var tx block.Transaction
+      n, err := blockchainbuilder.DecodeTransactionBytes(test.raw, &tx, blockchainbuilder.DefaultDecodeOptions)
+      if err != nil {
+        t.Fatalf("DecodeTransactionBytes: %v", err)
+      }
+      if n != len(test.raw) {
+        t.Fatalf("decoded %d bytes of %d", n, len(test.raw))
+      }
+      if blockserializer.HasWitness(&tx) != test.witness {
+        t.Fatalf("HasWitness = %v, want %v", !test.witness, test.witness)
+      }
+      if test.txid != "" && tx.TransactionHash.String() != test.txid {
+        t.Fatalf("txid %s, want %s", tx.TransactionHash, test.txid)
+      }
+      if btchashing.DoubleSha256(blockserializer.SerializeTransactionNoWitness(&tx)) != tx.TransactionHash {
+        t.Fatalf("txid %s is not the hash of the legacy serialization", tx.TransactionHash)
+      }
+      encoded := blockserializer.SerializeTransaction(&tx)
+      if !bytes.Equal(encoded, test.raw) {
+        t.Fatalf("serialized transaction differs from the decoded bytes:\n got %x\nwant %x", encoded, test.raw)
+      }
+      var again block.Transaction
+      _, err = blockchainbuilder.DecodeTransactionBytes(encoded, &again, blockchainbuilder.DefaultDecodeOptions)
+      if err != nil {
+        t.Fatalf("DecodeTransactionBytes of the serialized transaction: %v", err)
+      }
+      if !reflect.DeepEqual(again, tx) {
+        t.Fatalf("transaction decoded from its serialization differs:\n got %+v\nwant %+v", again, tx)
+      }
+    })
+  }
+}
@@ -0,0 +1,113 @@
+package blockserializer
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+)
+
+//ErrNonCanonical is returned when a CompactSize integer is not in its shortest encoding, which bitcoind rejects
+var ErrNonCanonical = errors.New("blockserializer: non-canonical CompactSize encoding")
+
+//AppendCompactSize appends n in the CompactSize encoding used for counts and lengths
+func AppendCompactSize(b []byte, n uint64) ([]byte) {
+  switch {
+  case n < 0xfd:
+    return append(b, byte(n))
+  case n <= 0xffff:
+    return binary.LittleEndian.AppendUint16(append(b, 0xfd), uint16(n))
+  case n <= 0xffffffff:
+    return binary.LittleEndian.AppendUint32(append(b, 0xfe), uint32(n))
+  }
+  return binary.LittleEndian.AppendUint64(append(b, 0xff), n)
+}
+
+//CompactSizeLength returns the number of bytes AppendCompactSize writes for n
+func CompactSizeLength(n uint64) (int) {
+  switch {
+  case n < 0xfd:
+    return 1
+  case n <= 0xffff:
+    return 3
+  case n <= 0xffffffff:
+    return 5
+  }
+  return 9
+}
+
+//compactSizeValue decodes the little endian value after a CompactSize prefix and checks it needed that prefix
+func compactSizeValue(v []byte) (uint64, error) {
+  var n, min uint64
+  switch len(v) {
+  case 2:
+    n, min = uint64(binary.LittleEndian.Uint16(v)), 0xfd
+  case 4:
+    n, min = uint64(binary.LittleEndian.Uint32(v)), 0x10000
+  default:
+    n, min = binary.LittleEndian.Uint64(v), 0x100000000
+  }
+  if n < min {
+    return 0, ErrNonCanonical
+  }
+  return n, nil
+}
+
+//prefixLength returns how many bytes follow a CompactSize prefix
+func prefixLength(prefix byte) (int) {
+  switch prefix {
+  case 0xfd:
+    return 2
+  case 0xfe:
+    return 4
+  case 0xff:
+    return 8
+  }
+  return 0
+}
+
+//CompactSize decodes the CompactSize integer at the start of b and returns it with the number of bytes it takes:
+//one byte below 0xfd, otherwise a 0xfd, 0xfe or 0xff prefix followed by a 2, 4 or 8 byte little endian value.
+//Encodings longer than needed return ErrNonCanonical and b ending early io.ErrUnexpectedEOF.
+func CompactSize(b []byte) (uint64, int, error) {
+  if len(b) == 0 {
+    return 0, 0, io.ErrUnexpectedEOF
+  }
+  n := prefixLength(b[0])
+  if n == 0 {
+    return uint64(b[0]), 1, nil
+  }
+  if len(b) < 1 + n {
+    return 0, 0, io.ErrUnexpectedEOF
+  }
+  v, err := compactSizeValue(b[1:1+n])
+  if err != nil {
+    return 0, 0, err
+  }
+  return v, 1 + n, nil
+}
+
+//ReadCompactSize reads a CompactSize integer from r as CompactSize decodes it, returning the number of bytes read.
+//A stream that ends before the first byte returns io.EOF, and one that ends within the integer io.ErrUnexpectedEOF.
+func ReadCompactSize(r io.Reader) (uint64, int, error) {
+  var buf [9]byte
+  _, err := io.ReadFull(r, buf[:1])
+  if err != nil {
+    return 0, 0, err
+  }
+  n := prefixLength(buf[0])
+  if n == 0 {
+    return uint64(buf[0]), 1, nil
+  }
+  read, err := io.ReadFull(r, buf[1:1+n])
+  if err == io.EOF {
+    err = io.ErrUnexpectedEOF
+  }
+  if err != nil {
+    return 0, 1 + read, err
+  }
+  v, err := compactSizeValue(buf[1:1+n])
+  if err != nil {
+    return 0, 1 + n, err
+  }
+  return v, 1 + n, nil
+}
@@ -0,0 +1,107 @@
+package blockserializer_test
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "testing"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+func TestCompactSize(t *testing.T) {
+  tests := []struct {
+    hex string
+    value uint64
+    length int
+    err error
+  }{
+    {"00", 0, 1, nil},
+    {"fc", 0xfc, 1, nil},
+    {"fdfd00", 0xfd, 3, nil},
+    {"fdffff", 0xffff, 3, nil},
+    {"fe00000100", 0x10000, 5, nil},
+    {"feffffffff", 0xffffffff, 5, nil},
+    {"ff0000000001000000", 0x100000000, 9, nil},
+    {"ffffffffffffffffff", 0xffffffffffffffff, 9, nil},
+    //trailing bytes are left for the caller
+    {"0102", 1, 1, nil},
+    //values that fit a shorter encoding
+    {"fd0000", 0, 0, blockserializer.ErrNonCanonical},
+    {"fdfc00", 0, 0, blockserializer.ErrNonCanonical},
+    {"feffff0000", 0, 0, blockserializer.ErrNonCanonical},
+    {"ffffffffff00000000", 0, 0, blockserializer.ErrNonCanonical},
+    //ending within the integer
+    {"", 0, 0, io.ErrUnexpectedEOF},
+    {"fd01", 0, 0, io.ErrUnexpectedEOF},
+    {"fe010000", 0, 0, io.ErrUnexpectedEOF},
+    {"ff01", 0, 0, io.ErrUnexpectedEOF},
+  }
+  for _, test := range tests {
+    b := chaintest.MustHex(test.hex)
+    value, length, err := blockserializer.CompactSize(b)
+    if value != test.value || length != test.length || !errors.Is(err, test.err) {
+      t.Errorf("CompactSize(%s) = %d, %d, %v, want %d, %d, %v", test.hex, value, length, err, test.value, test.length, test.err)
+    }
+    value, _, err = blockserializer.ReadCompactSize(bytes.NewReader(b))
+    want := test.err
+    if test.hex == "" {
+      want = io.EOF
+    }
+    if value != test.value || !errors.Is(err, want) {
+      t.Errorf("ReadCompactSize(%s) = %d, %v, want %d, %v", test.hex, value, err, test.value, want)
+    }
+    if test.err == nil {
+      if got := blockserializer.AppendCompactSize(nil, test.value); !bytes.Equal(got, b[:test.length]) {
+        t.Errorf("AppendCompactSize(%d) = %x, want %s", test.value, got, test.hex)
+      }
+      if got := blockserializer.CompactSizeLength(test.value); got != test.length {
+        t.Errorf("CompactSizeLength(%d) = %d, want %d", test.value, got, test.length)
+      }
+    }
+  }
+}
+
+//FuzzCompactSize checks that the slice and stream decoders agree, and that whatever decodes is the one encoding
+//AppendCompactSize writes for the value
+func FuzzCompactSize(f *testing.F) {
+  for _, seed := range []string{"00", "fc", "fdfd00", "fd0000", "fe00000100", "feffff0000", "ff0000000001000000", "ffffffffff00000000", "fd01"} {
+    f.Add(chaintest.MustHex(seed))
+  }
+  f.Fuzz(func(t *testing.T, b []byte) {
+    value, length, err := blockserializer.CompactSize(b)
+    streamValue, streamLength, streamErr := blockserializer.ReadCompactSize(bytes.NewReader(b))
+    if len(b) == 0 {
+      if err != io.ErrUnexpectedEOF || streamErr != io.EOF {
+        t.Fatalf("empty input: %v and %v", err, streamErr)
+      }
+      return
+    }
+    if err != streamErr || value != streamValue {
+      t.Fatalf("CompactSize(%x) = %d, %v but ReadCompactSize = %d, %v", b, value, err, streamValue, streamErr)
+    }
+    if err != nil {
+      return
+    }
+    if length != streamLength {
+      t.Fatalf("CompactSize(%x) took %d bytes, ReadCompactSize %d", b, length, streamLength)
+    }
+    if encoded := blockserializer.AppendCompactSize(nil, value); !bytes.Equal(encoded, b[:length]) {
+      t.Fatalf("CompactSize(%x) = %d, which encodes as %x", b[:length], value, encoded)
+    }
+  })
+}
+
+//FuzzCompactSizeRoundTrip checks that every value decodes from its encoding
+func FuzzCompactSizeRoundTrip(f *testing.F) {
+  for _, seed := range []uint64{0, 0xfc, 0xfd, 0xffff, 0x10000, 0xffffffff, 0x100000000, 0xffffffffffffffff} {
+    f.Add(seed)
+  }
+  f.Fuzz(func(t *testing.T, n uint64) {
+    encoded := blockserializer.AppendCompactSize(nil, n)
+    value, length, err := blockserializer.CompactSize(encoded)
+    if err != nil || value != n || length != len(encoded) || length != blockserializer.CompactSizeLength(n) {
+      t.Fatalf("%d encodes as %x, which decodes to %d, %d, %v", n, encoded, value, length, err)
+    }
+  })
+}
@@ -3,40 +3,28 @@ package blockvalidation
 import (
   "github.com/tgebhart/goparsebtc/block"
   "github.com/tgebhart/goparsebtc/btchashing"
+  "github.com/tgebhart/goparsebtc/logging"
+  "github.com/tgebhart/goparsebtc/network"
+  "github.com/tgebhart/goparsebtc/script"
+  "math/bits"
   "net/http"
   //"bytes"
-  "fmt"
   "io/ioutil"
+  "log/slog"
   "encoding/json"
   "errors"
   //"log"
   "time"
 )
 
-//MaxReasonableTransactionIndex holds the upper bound for transaction index
-const MaxReasonableTransactionIndex uint32 = 10000
-
-//SatoshiConst is Satoshi's transaction index for the genesis block
-const SatoshiConst uint32 = 4294967295
-
 //ErrMultiSig is thrown when we cannot read multisig output script
 var ErrMultiSig = errors.New("unable to parse multisig")
 //ErrReplacementKey is thrown when blockchain.info validation cannot find previous block key
 var ErrReplacementKey = errors.New("could not find replacement key")
 //ErrZeroOutputScript is thrown when zero length output script is present
 var ErrZeroOutputScript = errors.New("block may have zero length outputs script")
-
-//public key types
-const (
-  UncompressedPublicKey = "UNCOMPRESSED_PUBLIC_KEY"
-  StealthKey = "STEALTH"
-  CompressedPublicKey = "COMPRESSED_PUBLIC_KEY"
-  TruncatedCompressedKey = "TRUNCATED_COMPRESSED_KEY"
-  ScriptHashKey = "SCRIPT_HASH"
-  RipeMD160Key = "RIPEMD160"
-  MultiSigKey = "MULTISIG"
-  NullKey = block.NullHash
-)
+//ErrPublicKey is returned when a pay to public key script holds bytes that are not a public key
+var ErrPublicKey = errors.New("pay to public key script without a valid public key")
 
 
 //challenge script op codes
@@ -169,33 +157,9 @@ var APICode = "865c2783-0c23-45b7-a808-29dbca5435df"
 //REQUESTTYPE denotes the variable type when using http call
 var REQUESTTYPE = "string"
 
-//ValidateMagicNumber checks for correct magic number. Can take one of two values
+//ValidateMagicNumber checks for the active network's magic number in either byte order
 func ValidateMagicNumber(magicNumber uint32) (bool) {
-  if magicNumber == 3652501241 || magicNumber == 4190024921 {
-    return true
-  }
-  return false
-}
-
-//ValidateBlockLength checks block length.  Should be less than maximum possible block length
-func ValidateBlockLength(blockLength uint32) (bool) {
-  if blockLength <= 4294967295 && blockLength > 0 { //2^32 -1 ~ 4GB or maximum possible block length
-    return true
-  }
-  return false
-}
-
-//ValidateFormatVersion checks the block's format version (should be 1 for now)
-func ValidateFormatVersion(formatVersion uint32) (bool) {
-  if formatVersion == 1 || formatVersion == 2 || formatVersion == 3 || formatVersion == 4 {  //format version should still be 1 for now
-    return true
-  }
-  return false
-}
-
-//ValidateTimeStamp checks for block timeStamp to be between timestamp of genesis block and maximum integer value
-func ValidateTimeStamp(timeStamp uint32) (bool) {
-  if timeStamp >= 1231006505 && timeStamp <= 4294967295 {  //genesis block UNIX epoch time && maximum value for unsigned integer
+  if magicNumber == network.Active.Magic || magicNumber == bits.ReverseBytes32(network.Active.Magic) {
     return true
   }
   return false
@@ -208,235 +172,106 @@ func ConvertUnixEpochToDate(timeStamp uint32) (time.Time) {
   return ret
 }
 
-//ValidateTransactionVersion checks transaction version. Should be equal to 1 currently
-func ValidateTransactionVersion(transactionVersion uint32) (bool) {
-  if transactionVersion == 1 {  //current transaction version
-    return true
-  }
-  return false
-}
-
-//ValidateTransactionIndex checks the transaction index to make sure number is reasonable
-func ValidateTransactionIndex(transactionIndex uint32) (bool) {
-  if transactionIndex < MaxReasonableTransactionIndex || transactionIndex == SatoshiConst {
-    return true
+//ParseOutputScript sets the output's key type to the script.Classify type of its script and fills in its addresses:
+//those of the key, hash or witness program a standard script pays to, and of the key or key hash in the nonstandard
+//forms some early scripts took. Empty scripts return ErrZeroOutputScript, pay to public key scripts without a well
+//formed key ErrPublicKey and multisig scripts without well formed keys ErrMultiSig; none is an error in the block, as
+//output scripts are opaque to the serialization.
+func ParseOutputScript(output *block.Output) (string, error) {
+  s := output.ChallengeScript
+  n := len(s)
+  output.KeyType = script.Classify(s)
+  switch output.KeyType {
+  case script.PubKey:
+    //Classify checks only the prefix and length of the key
+    if !keyAddress(s[1:n-1], addressAt(output, 0)) {
+      return badKey(output, ErrPublicKey)
+    }
+  case script.PubKeyHash:
+    btchashing.BitcoinRipeMD160ToAddress(s[3:23], addressAt(output, 0))
+  case script.ScriptHash:
+    btchashing.BitcoinScriptHashToAddress(s[2:22], addressAt(output, 0))
+  case script.Multisig:
+    _, keys, _ := script.ParseMultisig(s)
+    for i, key := range keys {
+      if !keyAddress(key, addressAt(output, i)) {
+        slog.Debug("malformed public key in multisig script", "script", output.ChallengeScriptHex())
+        return badKey(output, ErrMultiSig)
+      }
+    }
+  case script.WitnessPubKeyHash, script.WitnessScriptHash, script.Taproot, script.WitnessUnknown:
+    //version 0 programs take a bech32 address and later versions bech32m; Classify has checked the program fits
+    //its version
+    version, program, _ := script.WitnessProgram(s)
+    btchashing.WitnessProgramToAddress(version, program, addressAt(output, 0))
+  case script.NonStandard:
+    return nonStandardAddresses(output)
   }
-  return false
+  return output.KeyType, nil
 }
 
-//ValidateSequenceNumber checks to make sure sequence number is below the maximum integer value
-func ValidateSequenceNumber(b []byte) (bool) {
-  if b[0] == 255 && b[1] == 255 && b[2] == 255 && b[3] != 255 {  //current largest sequence number
-    return false
+//nonStandardAddresses fills in the addresses of a nonstandard output script that pays a key or key hash in a form
+//Classify does not take as standard
+func nonStandardAddresses(output *block.Output) (string, error) {
+  s := output.ChallengeScript
+  n := len(s)
+  switch {
+  case n == 0:
+    return output.KeyType, ErrZeroOutputScript
+  case (n == 67 && s[0] == 65 && s[66] == OPCHECKSIG) || (n == 35 && s[0] == 33 && s[34] == OPCHECKSIG):
+    //a pay to public key script whose key has neither prefix
+    return badKey(output, ErrPublicKey)
+  case n == 66 && s[65] == OPCHECKSIG:
+    //a bare key without its push, as a few early scripts were written
+    if !keyAddress(s[:65], addressAt(output, 0)) {
+      return badKey(output, ErrPublicKey)
+    }
+  case n == 33 && s[0] == 0x20:
+    //32 bytes of a compressed key missing its parity byte, taken as even
+    btchashing.BitcoinCompressedPublicKeyToAddress(append([]byte{0x02}, s[1:]...), addressAt(output, 0))
+  case n >= 25 && s[0] == OPDUP && s[1] == OPHASH160 && s[2] == 20:
+    btchashing.BitcoinRipeMD160ToAddress(s[3:23], addressAt(output, 0))
+  case n == 5 && s[0] == OPDUP && s[1] == OPHASH160 && s[2] == OP0 && s[3] == OPEQUALVERIFY && s[4] == OPCHECKSIG:
+    slog.Warn("unusual but expected output script", "script", output.ChallengeScriptHex())
+  case s[n-1] == OPCHECKMULTISIG:
+    slog.Debug("no public key in multisig script", "script", output.ChallengeScriptHex())
+    return output.KeyType, ErrMultiSig
+  default:
+    //scan for a pay to public key hash pattern inside a longer script: OP_DUP OP_HASH160 <20 bytes> OP_EQUALVERIFY
+    //OP_CHECKSIG
+    for i := 0; i + 25 <= n; i++ {
+      scan := s[i:i+25]
+      if scan[0] == OPDUP && scan[1] == OPHASH160 && scan[2] == 20 && scan[23] == OPEQUALVERIFY && scan[24] == OPCHECKSIG {
+        btchashing.BitcoinRipeMD160ToAddress(scan[3:23], addressAt(output, 0))
+      }
+    }
   }
-  return true
+  return output.KeyType, nil
 }
 
-//ValidateOutputValue checks to see if the parsed output value is withing a reasonable range. If not, could be a read error.
-func ValidateOutputValue(outputValue uint64) (bool) {
-  if outputValue < 1501439850948224747 { //stupid-ass error number returned while debugging
-    return true
+//keyAddress derives the address of a 33 byte compressed or 65 byte uncompressed public key, reporting whether key
+//is either
+func keyAddress(key []byte, address *block.Address) (bool) {
+  if len(key) == 33 {
+    return btchashing.BitcoinCompressedPublicKeyToAddress(key, address) != nil
   }
-  return false
+  _, _, err := btchashing.BitcoinPublicKeyToAddress(key, address)
+  return err == nil
 }
 
-//ValidateTransactionLockTime checks transaction lock time is equal to 0
-func ValidateTransactionLockTime(transactionLockTime uint32) (bool) {
-  if transactionLockTime <= SatoshiConst && transactionLockTime != 16777216 {
-    return true
-  }
-  return false
+//badKey drops the addresses derived so far from a script whose keys turned out malformed, which makes it nonstandard
+func badKey(output *block.Output, err error) (string, error) {
+  output.Addresses = nil
+  output.KeyType = script.NonStandard
+  return output.KeyType, err
 }
 
-// ParseOutputScript iterates an output script and validates interior op_codes. Returns keytype
-func ParseOutputScript(output *block.Output) (string, error) {
-  var multiSigFormat int
-  var keytype string
-
-  if output.ChallengeScript != "" {
-    lastInstruction := output.ChallengeScriptBytes[output.ChallengeScriptLength - 1]
-    if output.ChallengeScriptLength == 67 && output.ChallengeScriptBytes[0] == 65 && output.ChallengeScriptBytes[66] == OPCHECKSIG {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[1:output.ChallengeScriptLength-1]
-      keytype = UncompressedPublicKey
-    }
-    if output.ChallengeScriptLength == 40 && output.ChallengeScriptBytes[0] == OPRETURN {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[1:]
-      output.KeyType = StealthKey
-    } else if output.ChallengeScriptLength == 66 && output.ChallengeScriptBytes[65] == OPCHECKSIG {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[:]
-      keytype = UncompressedPublicKey
-    } else if output.ChallengeScriptLength == 35 && output.ChallengeScriptBytes[34] == OPCHECKSIG {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[1:]
-      keytype = CompressedPublicKey
-    } else if output.ChallengeScriptLength == 33 && output.ChallengeScriptBytes[0] == 0x20 {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[1:]
-      keytype = TruncatedCompressedKey
-    } else if output.ChallengeScriptLength == 23 && output.ChallengeScriptBytes[0] == OPHASH160 && output.ChallengeScriptBytes[1] == 20 && output.ChallengeScriptBytes[22] == OPEQUAL {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[2:output.ChallengeScriptLength-1]
-      keytype = ScriptHashKey
-    } else if output.ChallengeScriptLength >= 25 && output.ChallengeScriptBytes[0] == OPDUP && output.ChallengeScriptBytes[1] == OPHASH160 && output.ChallengeScriptBytes[2] == 20 {
-      output.Addresses[0].PublicKeyBytes = output.ChallengeScriptBytes[3:23]
-      keytype = RipeMD160Key
-    } else if output.ChallengeScriptLength == 5 && output.ChallengeScriptBytes[0] == OPDUP && output.ChallengeScriptBytes[1] == OPHASH160 && output.ChallengeScriptBytes[2] == OP0 && output.ChallengeScriptBytes[3] == OPEQUALVERIFY && output.ChallengeScriptBytes[4] == OPCHECKSIG {
-      fmt.Println("WARNING : Encountered unusual but expected output script. ")
-      keytype = NullKey
-    } else if lastInstruction == OPCHECKMULTISIG && output.ChallengeScriptLength > 25 { //effin multisig
-      scanIndex := 0
-      scanbegin := output.ChallengeScriptBytes[scanIndex]
-      scanend := output.ChallengeScriptBytes[output.ChallengeScriptLength - 2]
-      expectedPrefix := false
-      expectedSuffix := false
-      switch scanbegin {
-      case OP0:
-        expectedPrefix = true
-        break
-      case OP1:
-        expectedPrefix = true
-        break
-      case OP2:
-        expectedPrefix = true
-        break
-      case OP3:
-        expectedPrefix = true
-        break
-      case OP4:
-        expectedPrefix = true
-        break
-      case OP5:
-        expectedPrefix = true
-        break
-      default:
-        //unexpected
-        break
-      }
-
-      switch scanend {
-      case OP1:
-        expectedSuffix = true
-        break
-      case OP2:
-        expectedSuffix = true
-        break
-      case OP3:
-        expectedSuffix = true
-        break
-      case OP4:
-        expectedSuffix = true
-        break
-      case OP5:
-        expectedSuffix = true
-        break
-      default:
-        //unexpected
-        break
-      }
-
-      if expectedPrefix && expectedSuffix {
-        scanIndex++
-        scanbegin = output.ChallengeScriptBytes[scanIndex]
-        var keyIndex uint8
-        for keyIndex < 5 && scanbegin < scanend {
-          if scanbegin == 0x21 {
-            output.KeyType = MultiSigKey
-            scanIndex++
-            scanbegin = output.ChallengeScriptBytes[scanIndex]
-            output.Addresses[keyIndex].PublicKeyBytes = output.ChallengeScriptBytes[scanIndex:]
-            scanbegin += 0x21
-            bitMask := 1<<keyIndex
-            multiSigFormat|=bitMask
-            keyIndex++
-          } else if scanbegin == 0x41 {
-            output.KeyType = MultiSigKey
-            scanIndex++
-            scanbegin = output.ChallengeScriptBytes[scanIndex]
-            output.Addresses[keyIndex].PublicKeyBytes = output.ChallengeScriptBytes[scanIndex:]
-            scanbegin += 0x41
-            keyIndex++
-          } else {
-            break
-          }
-        }
-      }
-      if output.Addresses[0].PublicKeyBytes == nil {
-        fmt.Println("&&&&&&&&&&&&&&&&&&&&&&&&&&& error multisig &&&&&&&&&&&&&&&&&&&&&&&&&&&&&&&&&&")
-        return "", ErrMultiSig
-      }
-    } else { //scan for pattern OP_DUP, OP_HASH160, 0x14, 20 bytes, 0x88, 0xac
-      if output.ChallengeScriptLength > 25 {
-        endIndex := output.ChallengeScriptLength - 25
-        for i := 0; i < int(endIndex); i++ {
-          scan := output.ChallengeScriptBytes[i:]
-          if scan[0] == OPDUP && scan[1] == OPHASH160 && scan[2] == 20 && scan[23] == OPEQUALVERIFY && scan[24] == OPCHECKSIG {
-            output.Addresses[0].PublicKeyBytes = scan[3:]
-            output.KeyType = RipeMD160Key
-            //fmt.Println("WARNING: Unusual output script in scan")
-
-          }
-        }
-      }
-    }
-    //if output.Addresses[0].PublicKey == "" {
-    //  fmt.Println("FAILED TO LOCATE PUBLIC KEY")
-    //}
-  } else {
-    output.KeyType = NullKey
-    return output.KeyType ,ErrZeroOutputScript
-  }
-
-  if output.Addresses[0].PublicKey == "" {
-    if output.ChallengeScriptLength == 0 {
-      output.Addresses[0].PublicKey = NullKey
-    } else {
-      output.Addresses[0].PublicKey = NullKey
-    }
-    output.KeyType = RipeMD160Key
-    //fmt.Println("WARNING : Failed to decode public key in output script ")
-  }
-
-  switch keytype {
-  case RipeMD160Key:
-    btchashing.BitcoinRipeMD160ToAddress(output.Addresses[0].PublicKeyBytes, &output.Addresses[0])
-    output.KeyType = keytype
-    return output.KeyType, nil
-  case ScriptHashKey:
-    btchashing.BitcoinRipeMD160ToAddress(output.Addresses[0].PublicKeyBytes, &output.Addresses[0])
-    output.KeyType = keytype
-    return output.KeyType, nil
-  case StealthKey:
-    btchashing.BitcoinRipeMD160ToAddress(output.Addresses[0].PublicKeyBytes, &output.Addresses[0])
-    output.KeyType = keytype
-  case UncompressedPublicKey:
-    btchashing.BitcoinPublicKeyToAddress(output.Addresses[0].PublicKeyBytes, &output.Addresses[0])
-    output.KeyType = keytype
-    return output.KeyType, nil
-  case CompressedPublicKey:
-    btchashing.BitcoinCompressedPublicKeyToAddress(output.Addresses[0].PublicKeyBytes, &output.Addresses[0])
-    output.KeyType = keytype
-    return output.KeyType, nil
-  case TruncatedCompressedKey:
-    tempkey := make([]byte, 1)
-    tempkey[0] = 0x2
-    key := append(tempkey[:], output.Addresses[0].PublicKey[:] ...)
-    btchashing.BitcoinCompressedPublicKeyToAddress(key, &output.Addresses[0])
-    output.KeyType = keytype
-    return output.KeyType, nil
-  case MultiSigKey:
-    var i uint32
-    for i = 0; i < block.MaxMultiSig; i++ {
-      key := output.Addresses[i].PublicKey
-      if key == "" {
-        break
-      }
-      mask := 1<<i
-      if multiSigFormat & mask != 0 {
-        btchashing.BitcoinCompressedPublicKeyToAddress([]byte(output.Addresses[i].PublicKey), &output.Addresses[i])
-      } else {
-         btchashing.BitcoinPublicKeyToAddress([]byte(output.Addresses[i].PublicKey), &output.Addresses[i])
-      }
-    }
-    output.KeyType = keytype
+//addressAt returns the i'th address of output, growing Addresses to hold it
+func addressAt(output *block.Output, i int) (*block.Address) {
+  for len(output.Addresses) <= i {
+    output.Addresses = append(output.Addresses, block.Address{})
   }
-  return keytype, nil
+  return &output.Addresses[i]
 }
 
 
@@ -447,19 +282,6 @@ func ParseOutputScript(output *block.Output) (string, error) {
 
 
 
-//ReverseEndian switches the output of as 32 byte hash to Big-Endian from Little-Endian because blockchain.info is weird
-func ReverseEndian(s string) (string) {
-  var tempstring [64]string
-  for i := 0; i < len(s) - 1; i+= 2 {
-    tempstring[63 - i] = string(s[i]) + string(s[i+1])
-  }
-  var ret string
-  for j := 0; j < len(tempstring); j++ {
-    ret += tempstring[j]
-  }
-  return ret
-}
-
 func narcolepsy() {
   time.Sleep(100 * time.Millisecond)
 }
@@ -467,8 +289,8 @@ func narcolepsy() {
 //BlockChainInfoValidation calls blockchain.info and checks the block for near-real-time error-checking
 func BlockChainInfoValidation(Block *block.Block) (error) {
   ResponseBlock := block.ResponseBlock{}
-  blockHash := ReverseEndian(Block.BlockHash)
-  fmt.Println("block hash", blockHash)
+  blockHash := Block.BlockHash.String()
+  slog.Debug("validating with blockchain.info", logging.KeyBlockHash, blockHash)
   resp, err := http.Get(BLOCKCHAININFOENDPOINT + blockHash)
   if err != nil {
     return err
@@ -478,20 +300,20 @@ func BlockChainInfoValidation(Block *block.Block) (error) {
   json.Unmarshal(body, &ResponseBlock)
 
   if blockHash == ResponseBlock.Hash {
-    fmt.Println("Height: ", ResponseBlock.Height)
+    slog.Debug("blockchain.info match", logging.KeyBlockHash, blockHash, logging.KeyHeight, ResponseBlock.Height)
     return nil
   }
   return errors.New("Hashes do not match")
 }
 
 //GetReplacementKey returns blockchain.info's reported previous block hash given the parameter block hash
-func GetReplacementKey(hash string) (string, string, error) {
+func GetReplacementKey(hash block.Hash) (block.Hash, block.Hash, error) {
   //narcolepsy()
-  blockHash := hash
-  fmt.Println("Looking for previous block hash ...")
+  blockHash := hash.String()
+  slog.Info("looking up previous block hash on blockchain.info", logging.KeyBlockHash, blockHash)
   resp, err := http.Get(BLOCKCHAININFOENDPOINT + blockHash + "?" + APICode)
   if err != nil {
-    return "", "", err
+    return block.Hash{}, block.Hash{}, err
   }
   defer resp.Body.Close()
   body, err := ioutil.ReadAll(resp.Body)
@@ -499,19 +321,27 @@ func GetReplacementKey(hash string) (string, string, error) {
     panic(err.Error())
   }
   tx, err := getTxs(body)
-  fmt.Println("prevblock" , tx.Prevblock)
+  slog.Debug("blockchain.info previous block", logging.KeyBlockHash, blockHash, "previous_block_hash", tx.Prevblock)
   if tx.Prevblock != "" {
-    return tx.Prevblock, tx.Hash, nil
+    previous, err := block.ParseHash(tx.Prevblock)
+    if err != nil {
+      return block.Hash{}, block.Hash{}, err
+    }
+    current, err := block.ParseHash(tx.Hash)
+    if err != nil {
+      return block.Hash{}, block.Hash{}, err
+    }
+    return previous, current, nil
   }
 
-  return "", "", ErrReplacementKey
+  return block.Hash{}, block.Hash{}, ErrReplacementKey
 }
 
 func getTxs(body []byte) (*block.ResponseBlock, error) {
   var r = new(block.ResponseBlock)
   err := json.Unmarshal(body, &r)
   if err != nil {
-    fmt.Println("couldn't unmarshal", body, err)
+    slog.Warn("could not unmarshal blockchain.info response", "body", string(body), logging.KeyError, err)
   }
   return r, nil
 }
@@ -519,8 +349,9 @@ func getTxs(body []byte) (*block.ResponseBlock, error) {
 
 
 //BridgeWithBlockchainInfo bridges data that could not be parsed with block from blockchain.info
-func BridgeWithBlockchainInfo(dBlock *block.DBlock, hash string) (error) {
+func BridgeWithBlockchainInfo(dBlock *block.DBlock, blockHash block.Hash) (error) {
   var r = new(block.ResponseBlock)
+  hash := blockHash.String()
   resp, err := http.Get(BLOCKCHAININFOENDPOINT + hash + "?" + APICode)
   if err != nil {
     return err
@@ -529,7 +360,7 @@ func BridgeWithBlockchainInfo(dBlock *block.DBlock, hash string) (error) {
   body, _ := ioutil.ReadAll(resp.Body)
   json.Unmarshal(body, &r)
 
-  fmt.Println("Hashes: ", r.Hash , hash)
+  slog.Debug("bridging with blockchain.info", logging.KeyBlockHash, hash, "response_hash", r.Hash)
 
   if hash == r.Hash {
     mapResponseToBlock(r, dBlock)
@@ -0,0 +1,172 @@
+package blockvalidation_test
+
+import (
+    "bytes"
+    "encoding/hex"
+    "testing"
+    "github.com/tgebhart/goparsebtc/base58"
+    "github.com/tgebhart/goparsebtc/bech32"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//the generator point, the public key of private key 1, whose addresses are well known
+const (
+  compressedG = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+  uncompressedG = "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+  compressedGAddress = "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"
+  uncompressedGAddress = "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
+  //the hash160 of the key the genesis coinbase pays, and its address
+  genesisHash160 = "62e907b15cbf27d5425399ebf6f0fb50ebb88f18"
+  genesisAddress = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+)
+
+func push(hexKey string) ([]byte) {
+  key := chaintest.MustHex(hexKey)
+  return append([]byte{byte(len(key))}, key...)
+}
+
+func TestParseOutputScript(t *testing.T) {
+  hash := chaintest.MustHex(genesisHash160)
+  multisig := append([]byte{blockvalidation.OP1}, push(compressedG)...)
+  multisig = append(multisig, push(uncompressedG)...)
+  multisig = append(multisig, blockvalidation.OP2, blockvalidation.OPCHECKMULTISIG)
+  tests := []struct {
+    name string
+    script []byte
+    keytype string
+    addresses []string
+  }{
+    {"p2pk uncompressed", append(push(uncompressedG), blockvalidation.OPCHECKSIG), script.PubKey, []string{uncompressedGAddress}},
+    {"p2pk compressed", append(push(compressedG), blockvalidation.OPCHECKSIG), script.PubKey, []string{compressedGAddress}},
+    {"p2pkh", append(append([]byte{blockvalidation.OPDUP, blockvalidation.OPHASH160, 20}, hash...), blockvalidation.OPEQUALVERIFY, blockvalidation.OPCHECKSIG),
+      script.PubKeyHash, []string{genesisAddress}},
+    {"p2sh", append(append([]byte{blockvalidation.OPHASH160, 20}, hash...), blockvalidation.OPEQUAL), script.ScriptHash, nil},
+    {"1 of 2 multisig", multisig, script.Multisig, []string{compressedGAddress, uncompressedGAddress}},
+    {"op_return", []byte{blockvalidation.OPRETURN, 1, 2}, script.NullData, nil},
+    {"p2pkh inside a longer script", append(append(append([]byte{blockvalidation.OPNOP, blockvalidation.OPDUP, blockvalidation.OPHASH160, 20}, hash...),
+      blockvalidation.OPEQUALVERIFY, blockvalidation.OPCHECKSIG), blockvalidation.OPNOP), script.NonStandard, []string{genesisAddress}},
+    //witness programs from BIP173 and BIP350
+    {"p2wpkh", chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6"), script.WitnessPubKeyHash,
+      []string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}},
+    {"p2wsh", chaintest.MustHex("00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"), script.WitnessScriptHash,
+      []string{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"}},
+    {"p2tr", append([]byte{blockvalidation.OP1, 32}, chaintest.MustHex(compressedG)[1:]...), script.Taproot,
+      []string{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"}},
+    {"witness version 16", chaintest.MustHex("6002751e"), script.WitnessUnknown, []string{"bc1sw50qgdz25j"}},
+    //a version 0 program of neither length pays no address
+    {"version 0 program of 21 bytes", append([]byte{blockvalidation.OP0, 21}, make([]byte, 21)...), script.NonStandard, nil},
+  }
+  for _, test := range tests {
+    out := block.Output{ChallengeScript: test.script}
+    keytype, err := blockvalidation.ParseOutputScript(&out)
+    if err != nil || keytype != test.keytype || out.KeyType != test.keytype {
+      t.Errorf("%s: key type %q (output %q), %v, want %q", test.name, keytype, out.KeyType, err, test.keytype)
+      continue
+    }
+    if test.addresses == nil {
+      continue
+    }
+    if len(out.Addresses) != len(test.addresses) {
+      t.Errorf("%s: %d addresses, want %d", test.name, len(out.Addresses), len(test.addresses))
+      continue
+    }
+    for i, want := range test.addresses {
+      if out.Addresses[i].Address != want {
+        t.Errorf("%s: address %d is %s, want %s", test.name, i, out.Addresses[i].Address, want)
+      }
+    }
+  }
+}
+
+func TestParseOutputScriptHashAddress(t *testing.T) {
+  hash := bytes.Repeat([]byte{0x11}, 20)
+  out := block.Output{ChallengeScript: append(append([]byte{blockvalidation.OPHASH160, 20}, hash...), blockvalidation.OPEQUAL)}
+  blockvalidation.ParseOutputScript(&out)
+  if len(out.Addresses) != 1 || out.Addresses[0].Address[0] != '3' {
+    t.Fatalf("pay to script hash addresses %+v, want one starting with 3", out.Addresses)
+  }
+  //the address is the script hash version byte and the hash itself, not a hash of it
+  raw, err := base58.ToHex(out.Addresses[0].Address)
+  if err != nil {
+    t.Fatalf("decoding %s: %v", out.Addresses[0].Address, err)
+  }
+  decoded := hex.EncodeToString(raw)
+  if want := "05" + hex.EncodeToString(hash); decoded[:len(want)] != want {
+    t.Errorf("address decodes to %s, want it to start %s", decoded, want)
+  }
+}
+
+func TestParseOutputScriptMalformed(t *testing.T) {
+  for _, s := range [][]byte{
+    {blockvalidation.OPCHECKMULTISIG},
+    {blockvalidation.OP1, 0x21, 0x02, blockvalidation.OP1, blockvalidation.OPCHECKMULTISIG},
+    {blockvalidation.OP1, 0x41, blockvalidation.OP1, blockvalidation.OPCHECKMULTISIG},
+    append(push(compressedG)[:20], blockvalidation.OPCHECKMULTISIG),
+  } {
+    out := block.Output{ChallengeScript: s}
+    if _, err := blockvalidation.ParseOutputScript(&out); err != blockvalidation.ErrMultiSig {
+      t.Errorf("ParseOutputScript(%x) = %v, want ErrMultiSig", s, err)
+    }
+  }
+  //keys whose first byte is neither a compressed nor an uncompressed prefix
+  notAKey := append([]byte{0x05}, chaintest.MustHex(compressedG)[1:]...)
+  for _, s := range [][]byte{
+    append(append([]byte{33}, notAKey...), blockvalidation.OPCHECKSIG),
+    append(append([]byte{65, 0x05}, chaintest.MustHex(uncompressedG)[1:]...), blockvalidation.OPCHECKSIG),
+  } {
+    out := block.Output{ChallengeScript: s}
+    if keytype, err := blockvalidation.ParseOutputScript(&out); keytype != script.NonStandard || err != blockvalidation.ErrPublicKey || out.Addresses != nil {
+      t.Errorf("ParseOutputScript(%x) = %q, %v with addresses %+v, want ErrPublicKey and none", s, keytype, err, out.Addresses)
+    }
+  }
+  multisig := append(append([]byte{blockvalidation.OP1}, push(compressedG)...), 33)
+  multisig = append(append(multisig, notAKey...), blockvalidation.OP2, blockvalidation.OPCHECKMULTISIG)
+  out := block.Output{ChallengeScript: multisig}
+  if _, err := blockvalidation.ParseOutputScript(&out); err != blockvalidation.ErrMultiSig || out.Addresses != nil {
+    t.Errorf("multisig with a malformed key: %v with addresses %+v, want ErrMultiSig and none", err, out.Addresses)
+  }
+  out = block.Output{ChallengeScript: []byte{}}
+  if keytype, err := blockvalidation.ParseOutputScript(&out); keytype != script.NonStandard || err != blockvalidation.ErrZeroOutputScript {
+    t.Errorf("empty script: %q, %v", keytype, err)
+  }
+}
+
+//FuzzParseOutputScript checks that classifying never panics, whatever the script, that the key type is the script's
+//type or nonstandard where its keys are malformed, and that every address it derives is the segwit address of the
+//script's witness program or valid base58 of a version byte, a hash and a checksum
+func FuzzParseOutputScript(f *testing.F) {
+  f.Add(append(push(uncompressedG), blockvalidation.OPCHECKSIG))
+  f.Add(append(push(compressedG), blockvalidation.OPCHECKSIG))
+  f.Add(append(append([]byte{blockvalidation.OPDUP, blockvalidation.OPHASH160, 20}, chaintest.MustHex(genesisHash160)...),
+    blockvalidation.OPEQUALVERIFY, blockvalidation.OPCHECKSIG))
+  f.Add(append(append([]byte{blockvalidation.OP1}, push(compressedG)...), blockvalidation.OP1, blockvalidation.OPCHECKMULTISIG))
+  f.Add(chaintest.MustHex(chaintest.Block9CoinbaseScript))
+  f.Add(chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6"))
+  f.Add(append([]byte{blockvalidation.OP1, 32}, chaintest.MustHex(compressedG)[1:]...))
+  //scripts shorter than the forms they start like, which once indexed past their end
+  f.Add([]byte{0x41, 0x04})
+  f.Add([]byte{blockvalidation.OPDUP, blockvalidation.OPHASH160})
+  f.Add([]byte{blockvalidation.OPCHECKMULTISIG})
+  f.Fuzz(func(t *testing.T, s []byte) {
+    out := block.Output{ChallengeScript: s}
+    keytype, err := blockvalidation.ParseOutputScript(&out)
+    if keytype != out.KeyType || (err == nil && keytype != script.Classify(s)) || (err != nil && keytype != script.NonStandard) {
+      t.Fatalf("ParseOutputScript(%x) = %q, output key type %q", s, keytype, out.KeyType)
+    }
+    for _, a := range out.Addresses {
+      if version, program, ok := script.WitnessProgram(s); ok {
+        if want, err := bech32.SegwitAddress(network.Active.Bech32Prefix, version, program); err != nil || a.Address != want {
+          t.Fatalf("ParseOutputScript(%x) derived address %q for a witness program, want %q, %v", s, a.Address, want, err)
+        }
+        continue
+      }
+      if raw, err := base58.ToHex(a.Address); err != nil || len(raw) != 25 {
+        t.Fatalf("ParseOutputScript(%x) derived address %q, %x, %v", s, a.Address, raw, err)
+      }
+    }
+  })
+}
@@ -3,9 +3,12 @@ package btchashing
 
 import (
   "errors"
-   "fmt"
+   "log/slog"
    "github.com/tgebhart/goparsebtc/block"
    "github.com/tgebhart/goparsebtc/base58"
+   "github.com/tgebhart/goparsebtc/bech32"
+   "github.com/tgebhart/goparsebtc/blockserializer"
+   "github.com/tgebhart/goparsebtc/network"
    "crypto/sha256"
    "golang.org/x/crypto/ripemd160"
    "encoding/hex"
@@ -15,54 +18,65 @@ import (
    //"github.com/tv42/base58"
 )
 
+//ErrCountMismatch is returned when the counts passed to ComputeTransactionHash disagree with the transaction's inputs or outputs
+var ErrCountMismatch = errors.New("btchashing: input or output count does not match the transaction")
+
 //ComputeBlockHash computes the SHA256 double-hash of the block header
-func ComputeBlockHash(Block *block.Block) (string, error) {
-  hasher := sha256.New()
-  slicetwo := append(Block.Header.BytePreviousBlockHash[:], Block.Header.ByteMerkleRoot[:] ...)
-  slicethree := append(Block.Header.ByteTimeStamp[:], Block.Header.ByteTargetValue[:] ...)
-  slicefour := append(slicethree[:], Block.Header.ByteNonce[:] ...)
-  slicetwofour := append(slicetwo[:], slicefour[:] ...)
-  kimbo := append(Block.Header.ByteFormatVersion, slicetwofour ...)
-  hasher.Write(kimbo)
-  slasher := hasher.Sum(nil)
-  hasherTwo := sha256.New()
-  hasherTwo.Write(slasher)
-  return hex.EncodeToString(hasherTwo.Sum(nil)), nil
+func ComputeBlockHash(Block *block.Block) (block.Hash) {
+  return DoubleSha256(blockserializer.SerializeHeader(&Block.Header))
+}
+
+//ComputeTransactionHash computes the dual-SHA256 hash of a given transaction over its legacy serialization,
+//so segwit transactions get their txid rather than their wtxid
+func ComputeTransactionHash(Transaction *block.Transaction, inputCount uint64, outputCount uint64) (block.Hash, error) {
+  if inputCount != uint64(len(Transaction.Inputs)) || outputCount != uint64(len(Transaction.Outputs)) {
+    return block.Hash{}, ErrCountMismatch
+  }
+  return DoubleSha256(blockserializer.SerializeTransactionNoWitness(Transaction)), nil
 }
 
-//ComputeTransactionHash computes the dual-SHA256 hash of a given transaction
-func ComputeTransactionHash(Transaction *block.Transaction, inputCount uint64, outputCount uint64) (string, error) {
-  hasher := sha256.New()
-  var inputBytes []byte
-  var outputBytes []byte
-  for i := 0; i < int(inputCount); i++ {
-    inputBytes = append(inputBytes[:], combineInputBytes(&Transaction.Inputs[i])[:] ...)
+//ComputeMerkleRoot computes the merkle root of a block from its transaction hashes
+func ComputeMerkleRoot(transactionHashes []block.Hash) (block.Hash, error) {
+  if len(transactionHashes) == 0 {
+    return block.Hash{}, errors.New("cannot compute merkle root of an empty block")
   }
-  for o := 0; o < int(outputCount); o++ {
-    outputBytes = append(outputBytes[:], combineOutputBytes(&Transaction.Outputs[o])[:] ...)
+  level := append([]block.Hash{}, transactionHashes...)
+  var pair [2*block.HashLength]byte
+  for len(level) > 1 {
+    if len(level) % 2 == 1 {
+      level = append(level, level[len(level)-1])
+    }
+    next := make([]block.Hash, len(level)/2)
+    for i := 0; i < len(level); i += 2 {
+      copy(pair[:], level[i][:])
+      copy(pair[block.HashLength:], level[i+1][:])
+      next[i/2] = DoubleSha256(pair[:])
+    }
+    level = next
   }
-  sliceone := append(Transaction.ByteTransactionVersionNumber[:], Transaction.ByteInputCount[:] ...)
-  slicetwo := append(inputBytes[:], Transaction.ByteOutputCount[:] ...)
-  slicethree := append(slicetwo[:], outputBytes[:] ...)
-  sliceonethree := append(sliceone[:], slicethree[:] ...)
-  kimbo := append(sliceonethree[:], Transaction.ByteTransactionLockTime[:] ...)
-  hasher.Write(kimbo)
-  slasher := hasher.Sum(nil)
-  hasherTwo := sha256.New()
-  hasherTwo.Write(slasher)
-  return hex.EncodeToString(hasherTwo.Sum(nil)), nil
+  return level[0], nil
 }
 
-//ComputeCompressedBlockHash truncates a block hash to just the last half of its SHA256 hash
-func ComputeCompressedBlockHash(hash string) (string) {
-  ret := hash[int(len(hash)/2):]
-  return ret
+//DoubleSha256 returns SHA256(SHA256(b)) as a Hash in internal byte order, where b is the concatenation of parts.
+//Taking parts lets a txid be computed from pieces of a serialized segwit transaction without copying them.
+func DoubleSha256(parts ...[]byte) (block.Hash) {
+  var first block.Hash
+  if len(parts) == 1 {
+    first = sha256.Sum256(parts[0])
+  } else {
+    h := sha256.New()
+    for _, p := range parts {
+      h.Write(p)
+    }
+    h.Sum(first[:0])
+  }
+  return sha256.Sum256(first[:])
 }
 
 //BitcoinPublicKeyToAddress takes a 65 byte public key found in parsing addresses
 //and converts it to the 20 byte form
 func BitcoinPublicKeyToAddress(pubKey []byte, address *block.Address) ([]byte, []byte, error) {
-  if pubKey[0] != 0x04 {
+  if len(pubKey) != 65 || pubKey[0] != 0x04 {
     return nil, nil, errors.New("Beginning of 65 byte public key does not match expected format")
   }
   sha1 := sha256.New()
@@ -72,38 +86,30 @@ func BitcoinPublicKeyToAddress(pubKey []byte, address *block.Address) ([]byte, [
   ripemd.Write(hash1)
   hash160 := ripemd.Sum(nil)
   ret := BitcoinRipeMD160ToAddress(hash160, address)
-  address.RipeMD160 = hex.EncodeToString(hash160)
-  address.PublicKey = hex.EncodeToString(pubKey)
+  address.PublicKeyBytes = pubKey
   return ret, hash160, nil
 }
 
 //BitcoinRipeMD160ToAddress takes 20 byte RipeMD160 hash and returns the 25-byte address as well as updates the address representation of the output
 func BitcoinRipeMD160ToAddress(hash160 []byte, address *block.Address) ([]byte) {
-  ret := append([]byte{0}, hash160[:] ...) //append network byte of 0 (main network) as checksum
-  sha2 := sha256.New()
-  sha2.Write(ret) //sha256 on ripemd hash
-  hash3 := sha2.Sum(nil)
-  sha3 := sha256.New()
-  sha3.Write(hash3) // compute second hash to get checksum to store at end of output
-  hash4 := sha3.Sum(nil)
-  ret = append(ret[:], hash4[0:4] ...)
+  ret := make([]byte, 0, 1 + len(hash160) + 4)
+  ret = append(ret, network.Active.PubKeyHashAddressID) //prepend the network's address version byte
+  ret = append(ret, hash160...)
+  checksum := DoubleSha256(ret) //the first four bytes of the double hash are stored at the end of the address
+  ret = append(ret, checksum[:4]...)
   address.Address = BitcoinToASCII(ret)
-  address.RipeMD160 = hex.EncodeToString(hash160)
-  address.PublicKey = hex.EncodeToString(hash160)
+  address.Hash160 = hash160
   return ret
 
 }
 
-//BitcoinCompressedPublicKeyToAddress takes a compressed ECDSA key and converts it to 25-byte address
+//BitcoinCompressedPublicKeyToAddress takes a 33 byte compressed ECDSA key and converts it to 25-byte address
 func BitcoinCompressedPublicKeyToAddress(key []byte, address *block.Address) ([]byte) {
-  if key[0] == 0x02 || key[0] == 0x03 {
-    address.PublicKey = hex.EncodeToString(key)
-    sha1 := sha256.New()
-    sha1.Write(key)
-    hash1 := sha1.Sum(nil)
-    return BitcoinRipeMD160ToAddress(hash1, address)
+  if len(key) == 33 && (key[0] == 0x02 || key[0] == 0x03) {
+    address.PublicKeyBytes = key
+    return BitcoinRipeMD160ToAddress(Hash160(key), address)
   }
-  fmt.Println("Invalid Compressed Public Key")
+  slog.Debug("invalid compressed public key", "public_key", hex.EncodeToString(key))
   return nil
 }
 
@@ -122,25 +128,41 @@ func BitcoinCompressedPublicKeyToAddress(key []byte, address *block.Address) ([]
 }
 */
 
-//BitcoinToASCII returns the ASCII representation of the 25 byte public key
-func BitcoinToASCII(address []byte) (string) {
-  return base58.HexToBase58(address)
+//Hash160 returns the RIPEMD160 of the SHA256 of b, the hash addresses are made from
+func Hash160(b []byte) ([]byte) {
+  sum := sha256.Sum256(b)
+  ripemd := ripemd160.New()
+  ripemd.Write(sum[:])
+  return ripemd.Sum(nil)
 }
 
-func combineInputBytes(Input *block.Input) ([]byte) {
-  var inputBytes []byte
-  sliceone := append(Input.ByteTransactionHash[:], Input.ByteTransactionIndex[:] ...)
-  slicetwo := append(Input.ByteInputScriptLength[:], Input.ByteInputScript[:] ...)
-  slicethree := append(sliceone[:], slicetwo[:] ...)
-  inputBytes = append(slicethree[:], Input.ByteSequenceNumber[:] ...)
-  return inputBytes
+//BitcoinScriptHashToAddress takes the 20 byte hash of a pay to script hash script and updates the address
+//representation of the output, which uses the network's script hash version byte
+func BitcoinScriptHashToAddress(hash160 []byte, address *block.Address) ([]byte) {
+  ret := make([]byte, 0, 1 + len(hash160) + 4)
+  ret = append(ret, network.Active.ScriptHashAddressID)
+  ret = append(ret, hash160...)
+  checksum := DoubleSha256(ret)
+  ret = append(ret, checksum[:4]...)
+  address.Address = BitcoinToASCII(ret)
+  address.Hash160 = hash160
+  return ret
 }
 
-func combineOutputBytes(Output *block.Output) ([]byte) {
-  var outputBytes []byte
-  sliceone := append(Output.ByteOutputValue[:], Output.ByteChallengeScriptLength[:] ...)
-  outputBytes = append(sliceone[:], Output.ChallengeScriptBytes[:] ...)
-  return outputBytes
+//WitnessProgramToAddress updates the address representation of an output paying to a witness program with its
+//bech32 or bech32m address
+func WitnessProgramToAddress(version int, program []byte, address *block.Address) (error) {
+  a, err := bech32.SegwitAddress(network.Active.Bech32Prefix, version, program)
+  if err != nil {
+    return err
+  }
+  address.Address = a
+  return nil
+}
+
+//BitcoinToASCII returns the ASCII representation of the 25 byte public key
+func BitcoinToASCII(address []byte) (string) {
+  return base58.HexToBase58(address)
 }
 
 //ParseAddressFromOutputScript parses an output's script to determine address hash
@@ -204,7 +226,7 @@ func sixSevenByteScript(script []byte) ([]byte, error) {
   if script[0] != 65 { //hex value of coming address length does not match the raw 65 byte address hash
     return nil, errors.New("Incorrect address length at beginning of 67 byte block")
   }
-  fmt.Println("----SixSevenByte----")
+  slog.Debug("matched 67 byte script")
   return ret, nil
 }
 
@@ -213,7 +235,7 @@ func sixSixByteScript(script []byte) ([]byte, error) {
   if script[65] != 0xac { //hex value of OP_CHECKSIG
     return nil, errors.New("Incorrect OP_CHECKSIG at end of 66 byte block")
   }
-  fmt.Println("----SixSixByte----")
+  slog.Debug("matched 66 byte script")
   return ret, nil
 }
 
@@ -228,7 +250,7 @@ func twentyFivePlusScript(script []byte) ([]byte, error) {
   if script[2] != 0x14 { //hex value of 20
     return nil, errors.New("Possibly incorrect script length")
   }
-  fmt.Println("----TwentyFivePlusByte----")
+  slog.Debug("matched 25+ byte script")
   return ret, nil
 }
 
@@ -237,7 +259,7 @@ func fiveErrorScript(script []byte) ([]byte, error) {
   if script[2] == 0 {
     return ret, nil
   }
-  fmt.Println("----FiveError----")
+  slog.Debug("unmatched 5 byte script")
   return ret, errors.New("Not a five script error")
 }
 
@@ -251,6 +273,6 @@ func searchForAddress(script []byte) ([]byte, error) {
       return script[i+2:i+22], nil
     }
   }
-  fmt.Println("----SearchedAddress----")
+  slog.Debug("no address found in script")
   return nil, errors.New("Could not find address in output script")
 }
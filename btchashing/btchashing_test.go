@@ -0,0 +1,44 @@
+package btchashing_test
+
+import (
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+func TestPublicKeyToAddress(t *testing.T) {
+  //the key the genesis coinbase pays, which is well known as the address below
+  key := chaintest.Genesis().Transactions[0].Outputs[0].ChallengeScript[1:66]
+  var address block.Address
+  _, hash160, err := btchashing.BitcoinPublicKeyToAddress(key, &address)
+  if err != nil {
+    t.Fatalf("BitcoinPublicKeyToAddress: %v", err)
+  }
+  if address.Address != "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa" {
+    t.Errorf("address %s, want 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", address.Address)
+  }
+  if address.RipeMD160() != "62e907b15cbf27d5425399ebf6f0fb50ebb88f18" {
+    t.Errorf("hash160 %s, want 62e907b15cbf27d5425399ebf6f0fb50ebb88f18", address.RipeMD160())
+  }
+  if string(address.Hash160) != string(hash160) || address.PublicKey() != chaintest.Genesis().Transactions[0].Outputs[0].ChallengeScriptHex()[2:132] {
+    t.Errorf("address holds hash160 %x and public key %s, not the ones it was derived from", address.Hash160, address.PublicKey())
+  }
+}
+
+func TestCompressedPublicKeyToAddress(t *testing.T) {
+  //the compressed generator point, the public key of private key 1
+  key := chaintest.MustHex("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+  var address block.Address
+  btchashing.BitcoinCompressedPublicKeyToAddress(key, &address)
+  if address.Address != "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH" {
+    t.Errorf("address %s, want 1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", address.Address)
+  }
+  if address.RipeMD160() != "751e76e8199196d454941c45d1b3a323f1433bd6" {
+    t.Errorf("hash160 %s, want 751e76e8199196d454941c45d1b3a323f1433bd6", address.RipeMD160())
+  }
+  var empty block.Address
+  if btchashing.BitcoinCompressedPublicKeyToAddress(key[:32], &empty) != nil || empty.Address != "" {
+    t.Errorf("a 32 byte key made address %q", empty.Address)
+  }
+}
@@ -0,0 +1,213 @@
+package chainindex
+
+import (
+    "math/big"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//Node is a block in the tree of every block the index has seen
+type Node struct {
+  HashBlock block.HashBlock
+  Bits uint32
+  Height int
+  //Work is the total proof of work of the chain from the genesis block up to and including this block
+  Work *big.Int
+  Parent *Node
+}
+
+//Hash returns the block hash of the node
+func (n *Node) Hash() (block.Hash) {
+  return n.HashBlock.BlockHash
+}
+
+//Change describes how the main chain moved. Fork is the last block the old and new main chains share, or nil when
+//the genesis block is connected. Disconnected lists the old main chain blocks above Fork, tip first, and Connected
+//the new main chain blocks above Fork, in height order.
+type Change struct {
+  Fork *Node
+  Disconnected []*Node
+  Connected []*Node
+}
+
+//Tip returns the main chain tip after the change
+func (c *Change) Tip() (*Node) {
+  if len(c.Connected) > 0 {
+    return c.Connected[len(c.Connected)-1]
+  }
+  return c.Fork
+}
+
+//orphan holds a block whose parent the index has not seen yet
+type orphan struct {
+  hb block.HashBlock
+  bits uint32
+}
+
+//Index is the tree of blocks rooted at a network's genesis block. The main chain is the branch with the most work;
+//when two tips have the same work the one seen first stays the tip, as it does in bitcoind.
+type Index struct {
+  genesis block.Hash
+  nodes map[block.Hash]*Node
+  //orphans holds blocks whose parent has not been seen, by the hash of that parent
+  orphans map[block.Hash][]orphan
+  orphanCount int
+  //main holds the main chain by height
+  main []*Node
+}
+
+//New returns an empty index for the chain starting at genesis
+func New(genesis block.Hash) (*Index) {
+  return &Index{genesis: genesis, nodes: make(map[block.Hash]*Node), orphans: make(map[block.Hash][]orphan)}
+}
+
+//Target expands the compact target bits held in block headers. Negative and overflowing targets are returned as zero,
+//which no hash meets.
+func Target(bits uint32) (*big.Int) {
+  mantissa := int64(bits & 0x007fffff)
+  exponent := uint(bits >> 24)
+  negative := mantissa != 0 && bits & 0x00800000 != 0
+  overflow := mantissa != 0 && (exponent > 34 || (mantissa > 0xff && exponent > 33) || (mantissa > 0xffff && exponent > 32))
+  if negative || overflow {
+    return new(big.Int)
+  }
+  t := big.NewInt(mantissa)
+  if exponent <= 3 {
+    return t.Rsh(t, 8 * (3 - exponent))
+  }
+  return t.Lsh(t, 8 * (exponent - 3))
+}
+
+//Work returns the expected number of hashes needed to find a block meeting the compact target bits, 2^256 / (target + 1)
+func Work(bits uint32) (*big.Int) {
+  target := Target(bits)
+  if target.Sign() == 0 {
+    return new(big.Int)
+  }
+  work := new(big.Int).Lsh(big.NewInt(1), 256)
+  return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+//Add adds a block to the tree and returns the resulting change of the main chain, or nil when the main chain is
+//unchanged. A block whose parent has not been seen is held until the parent is added, and blocks already in the
+//index are ignored, as are parentless blocks other than the genesis block.
+func (ix *Index) Add(hb block.HashBlock, bits uint32) (*Change) {
+  if _, ok := ix.nodes[hb.BlockHash]; ok {
+    return nil
+  }
+  var best *Node
+  if len(ix.main) > 0 {
+    best = ix.main[len(ix.main)-1]
+  }
+  tip := best
+
+  var parent *Node
+  if hb.PreviousBlockHash.IsZero() {
+    if hb.BlockHash != ix.genesis {
+      return nil
+    }
+  } else {
+    parent = ix.nodes[hb.PreviousBlockHash]
+    if parent == nil {
+      for _, o := range ix.orphans[hb.PreviousBlockHash] {
+        if o.hb.BlockHash == hb.BlockHash {
+          return nil
+        }
+      }
+      ix.orphans[hb.PreviousBlockHash] = append(ix.orphans[hb.PreviousBlockHash], orphan{hb, bits})
+      ix.orphanCount++
+      return nil
+    }
+  }
+
+  //attaching the block may attach orphans waiting on it, and so on down their branches
+  queue := []*Node{ix.attach(parent, hb, bits)}
+  for len(queue) > 0 {
+    n := queue[0]
+    queue = queue[1:]
+    if best == nil || n.Work.Cmp(best.Work) > 0 {
+      best = n
+    }
+    waiting := ix.orphans[n.Hash()]
+    delete(ix.orphans, n.Hash())
+    ix.orphanCount -= len(waiting)
+    for _, o := range waiting {
+      queue = append(queue, ix.attach(n, o.hb, o.bits))
+    }
+  }
+  if best == tip {
+    return nil
+  }
+  return ix.reorganize(best)
+}
+
+//attach adds a node for hb under parent, which is nil for the genesis block
+func (ix *Index) attach(parent *Node, hb block.HashBlock, bits uint32) (*Node) {
+  n := &Node{HashBlock: hb, Bits: bits, Parent: parent, Work: Work(bits)}
+  if parent != nil {
+    n.Height = parent.Height + 1
+    n.Work.Add(n.Work, parent.Work)
+  }
+  ix.nodes[hb.BlockHash] = n
+  return n
+}
+
+//reorganize makes tip the main chain tip and returns the change
+func (ix *Index) reorganize(tip *Node) (*Change) {
+  c := &Change{}
+  fork := tip
+  for fork != nil && !ix.OnMainChain(fork) {
+    c.Connected = append([]*Node{fork}, c.Connected...)
+    fork = fork.Parent
+  }
+  c.Fork = fork
+  forkHeight := -1
+  if fork != nil {
+    forkHeight = fork.Height
+  }
+  for h := len(ix.main) - 1; h > forkHeight; h-- {
+    c.Disconnected = append(c.Disconnected, ix.main[h])
+  }
+  ix.main = append(ix.main[:forkHeight+1], c.Connected...)
+  return c
+}
+
+//Tip returns the main chain tip, or nil before the genesis block is added
+func (ix *Index) Tip() (*Node) {
+  if len(ix.main) == 0 {
+    return nil
+  }
+  return ix.main[len(ix.main)-1]
+}
+
+//Get returns the node of the block with hash, or nil when the block is not in the tree
+func (ix *Index) Get(hash block.Hash) (*Node) {
+  return ix.nodes[hash]
+}
+
+//AtHeight returns the main chain block at height, or nil above the tip
+func (ix *Index) AtHeight(height int) (*Node) {
+  if height < 0 || height >= len(ix.main) {
+    return nil
+  }
+  return ix.main[height]
+}
+
+//OnMainChain reports whether n is on the main chain
+func (ix *Index) OnMainChain(n *Node) (bool) {
+  return ix.AtHeight(n.Height) == n
+}
+
+//MainChain returns the main chain from the genesis block to the tip
+func (ix *Index) MainChain() ([]*Node) {
+  return append([]*Node(nil), ix.main...)
+}
+
+//Len returns the number of blocks in the tree
+func (ix *Index) Len() (int) {
+  return len(ix.nodes)
+}
+
+//Orphans returns the number of blocks held until their parent is added
+func (ix *Index) Orphans() (int) {
+  return ix.orphanCount
+}
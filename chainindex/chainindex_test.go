@@ -0,0 +1,129 @@
+package chainindex_test
+
+import (
+    "math/big"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainindex"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+func TestWork(t *testing.T) {
+  tests := []struct {
+    bits uint32
+    work string
+  }{
+    //the main network minimum difficulty
+    {0x1d00ffff, "100010001"},
+    {0x207fffff, "2"},
+    //negative and overflowing targets
+    {0x1d80ffff, "0"},
+    {0xff123456, "0"},
+    {0, "0"},
+  }
+  for _, test := range tests {
+    want, _ := new(big.Int).SetString(test.work, 16)
+    if got := chainindex.Work(test.bits); got.Cmp(want) != 0 {
+      t.Errorf("Work(%#x) = %x, want %s", test.bits, got, test.work)
+    }
+  }
+  if got := chainindex.Target(0x1d00ffff).Text(16); got != "ffff" + "0000000000000000000000000000000000000000000000000000" {
+    t.Errorf("Target(0x1d00ffff) = %s", got)
+  }
+}
+
+//add adds blocks in order and returns the last change
+func add(ix *chainindex.Index, blocks ...*block.Block) (*chainindex.Change) {
+  var change *chainindex.Change
+  for _, b := range blocks {
+    change = ix.Add(b.HashBlock, b.Header.TargetValue)
+  }
+  return change
+}
+
+func TestAddExtendsMainChain(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(3, "")
+  ix := chainindex.New(c.Order[0].BlockHash)
+  for h, b := range c.Order {
+    change := add(ix, b)
+    if change == nil || len(change.Disconnected) != 0 || len(change.Connected) != 1 || change.Tip().Hash() != b.BlockHash {
+      t.Fatalf("adding block %d: change %+v, want it connected", h, change)
+    }
+    if change.Tip().Height != h {
+      t.Fatalf("block %d given height %d", h, change.Tip().Height)
+    }
+  }
+  if add(ix, c.Order[2]) != nil || ix.Len() != 4 {
+    t.Fatalf("adding a block twice changed the index")
+  }
+  for h, n := range ix.MainChain() {
+    if n.Hash() != c.Order[h].BlockHash || ix.AtHeight(h) != n || !ix.OnMainChain(n) {
+      t.Errorf("main chain height %d is %s, want %s", h, n.Hash(), c.Order[h].BlockHash)
+    }
+  }
+}
+
+func TestAddReorganizes(t *testing.T) {
+  for _, depth := range []int{1, 2, 5} {
+    c := chaintest.NewChain()
+    c.Extend(2, "")
+    fork := c.Tip
+    old := c.Extend(depth, "old")
+    ix := chainindex.New(c.Order[0].BlockHash)
+    add(ix, c.Order...)
+
+    //a branch as long as the main chain has the same work and does not take over
+    var branch []*block.Block
+    parent := fork
+    for i := 0; i < depth; i++ {
+      b := c.Mine(parent, "new", 0)
+      branch = append(branch, b)
+      parent = b.BlockHash
+      if change := add(ix, b); change != nil {
+        t.Fatalf("depth %d: branch block %d at equal or less work moved the tip", depth, i)
+      }
+    }
+    longer := c.Mine(parent, "new", 0)
+    change := add(ix, longer)
+    if change == nil || change.Fork.Hash() != fork || change.Tip().Hash() != longer.BlockHash {
+      t.Fatalf("depth %d: change %+v, want a reorg from %s to %s", depth, change, fork, longer.BlockHash)
+    }
+    if len(change.Disconnected) != depth || len(change.Connected) != depth + 1 {
+      t.Fatalf("depth %d: %d disconnected and %d connected", depth, len(change.Disconnected), len(change.Connected))
+    }
+    for i, n := range change.Disconnected {
+      if n.Hash() != old[depth-1-i].BlockHash {
+        t.Errorf("depth %d: disconnected %d is %s, want the old branch tip first", depth, i, n.Hash())
+      }
+    }
+    for i, n := range append(branch, longer) {
+      if change.Connected[i].Hash() != n.BlockHash || ix.AtHeight(3 + i) != change.Connected[i] {
+        t.Errorf("depth %d: connected %d is %s, want %s", depth, i, change.Connected[i].Hash(), n.BlockHash)
+      }
+    }
+    if ix.Tip().Height != 3 + depth || ix.OnMainChain(ix.Get(old[0].BlockHash)) {
+      t.Errorf("depth %d: tip at height %d, old branch still on the main chain", depth, ix.Tip().Height)
+    }
+  }
+}
+
+func TestAddOrphans(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(4, "")
+  ix := chainindex.New(c.Order[0].BlockHash)
+  add(ix, c.Order[0], c.Order[1])
+  //blocks arriving before their parents wait for them
+  if add(ix, c.Order[4], c.Order[3]) != nil || ix.Orphans() != 2 {
+    t.Fatalf("%d orphans, want 2 held back", ix.Orphans())
+  }
+  change := add(ix, c.Order[2])
+  if change == nil || len(change.Connected) != 3 || change.Tip().Hash() != c.Order[4].BlockHash || ix.Orphans() != 0 {
+    t.Fatalf("change %+v with %d orphans, want the three blocks connected", change, ix.Orphans())
+  }
+  //a parentless block that is not the genesis block is ignored
+  stray := chaintest.NewBlock(block.Hash{}, c.Order[0].Header.TimeStamp)
+  if add(ix, stray) != nil || ix.Get(stray.BlockHash) != nil {
+    t.Fatalf("stray block added")
+  }
+}
@@ -0,0 +1,138 @@
+package chainstate
+
+import (
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+)
+
+//AddressBalance totals the coins an address has been paid and has spent on the main chain
+type AddressBalance struct {
+  Received uint64 `json:"received"`
+  Spent uint64 `json:"spent"`
+  Outputs int `json:"outputs"`
+  SpentOutputs int `json:"spent_outputs"`
+}
+
+//Balance returns the value of the address's unspent coins
+func (a AddressBalance) Balance() (uint64) {
+  return a.Received - a.Spent
+}
+
+//AddressIndex totals the coins paid to and spent from each address. A multisig output counts toward every key it
+//names. Coins a repeated txid overwrote count as spent, since they can no longer be, so balances add up to the UTXO
+//set. Spent coins are credited back from the block's undo data when it is disconnected.
+type AddressIndex struct {
+  addresses map[string]*AddressBalance
+}
+
+//NewAddressIndex returns an empty address index
+func NewAddressIndex() (*AddressIndex) {
+  return &AddressIndex{addresses: make(map[string]*AddressBalance)}
+}
+
+//Get returns the totals of address
+func (ix *AddressIndex) Get(address string) (AddressBalance) {
+  if a := ix.addresses[address]; a != nil {
+    return *a
+  }
+  return AddressBalance{}
+}
+
+//Len returns the number of addresses with coins received on the main chain
+func (ix *AddressIndex) Len() (int) {
+  return len(ix.addresses)
+}
+
+func (ix *AddressIndex) ConnectBlock(height int, b *block.Block, undo *BlockUndo) (error) {
+  if height == 0 {
+    return nil
+  }
+  for t := range b.Transactions {
+    for _, out := range b.Transactions[t].Outputs {
+      if Unspendable(out.ChallengeScript) {
+        continue
+      }
+      for _, address := range scriptAddresses(out.ChallengeScript) {
+        ix.receive(address, int64(out.OutputValue), 1)
+      }
+    }
+  }
+  for _, coins := range [][]SpentCoin{undo.Spent, undo.Overwritten} {
+    for _, s := range coins {
+      for _, address := range scriptAddresses(s.Coin.Script) {
+        ix.get(address).spend(int64(s.Coin.Value), 1)
+      }
+    }
+  }
+  return nil
+}
+
+func (ix *AddressIndex) DisconnectBlock(height int, b *block.Block, undo *BlockUndo) (error) {
+  if height == 0 {
+    return nil
+  }
+  for _, coins := range [][]SpentCoin{undo.Spent, undo.Overwritten} {
+    for _, s := range coins {
+      for _, address := range scriptAddresses(s.Coin.Script) {
+        ix.get(address).spend(-int64(s.Coin.Value), -1)
+      }
+    }
+  }
+  for t := range b.Transactions {
+    for _, out := range b.Transactions[t].Outputs {
+      if Unspendable(out.ChallengeScript) {
+        continue
+      }
+      for _, address := range scriptAddresses(out.ChallengeScript) {
+        ix.receive(address, -int64(out.OutputValue), -1)
+      }
+    }
+  }
+  return nil
+}
+
+//get returns the totals of address, adding it if it is new
+func (ix *AddressIndex) get(address string) (*AddressBalance) {
+  a := ix.addresses[address]
+  if a == nil {
+    a = &AddressBalance{}
+    ix.addresses[address] = a
+  }
+  return a
+}
+
+//receive adds value to the coins paid to address and n to its outputs. An address left without outputs is dropped.
+func (ix *AddressIndex) receive(address string, value int64, n int) {
+  a := ix.get(address)
+  a.Received = uint64(int64(a.Received) + value)
+  a.Outputs += n
+  if a.Outputs == 0 {
+    delete(ix.addresses, address)
+  }
+}
+
+//spend adds value to the coins spent from the address and n to its spent outputs
+func (a *AddressBalance) spend(value int64, n int) {
+  a.Spent = uint64(int64(a.Spent) + value)
+  a.SpentOutputs += n
+}
+
+//scriptAddresses returns the distinct addresses an output script pays to
+func scriptAddresses(script []byte) ([]string) {
+  out := block.Output{ChallengeScript: script}
+  blockvalidation.ParseOutputScript(&out)
+  var addresses []string
+  for _, a := range out.Addresses {
+    if a.Address == "" {
+      continue
+    }
+    seen := false
+    for _, s := range addresses {
+      seen = seen || s == a.Address
+    }
+    if !seen {
+      addresses = append(addresses, a.Address)
+    }
+  }
+  return addresses
+}
@@ -0,0 +1,97 @@
+package chainstate
+
+import (
+    "errors"
+    "fmt"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//ErrMissingCoin is returned when a block spends an output that is not in the UTXO set
+var ErrMissingCoin = errors.New("chainstate: spent output is not in the UTXO set")
+//ErrNoUndo is returned when a block is disconnected whose undo data is not held, as when a reorg is deeper than
+//State.UndoDepth
+var ErrNoUndo = errors.New("chainstate: no undo data for block")
+
+//DefaultUndoDepth is how many blocks below the tip keep their undo data, as bitcoind keeps at least 288 when pruning
+const DefaultUndoDepth = 288
+
+//Index is a store derived from the main chain that State keeps in step with the UTXO set. undo holds the coins the
+//block spent, in the order its inputs spend them, so indexes can reverse the spends without a lookup.
+type Index interface {
+  ConnectBlock(height int, b *block.Block, undo *BlockUndo) (error)
+  DisconnectBlock(height int, b *block.Block, undo *BlockUndo) (error)
+}
+
+//State is the UTXO set and the indexes derived from it. It implements follow.Store: connecting a block spends its
+//inputs, adds its outputs and records the spent coins as undo data, and disconnecting it puts the chain state back
+//from that undo data. Indexes are connected after the UTXO set in order and disconnected before it in reverse order.
+type State struct {
+  UTXO *UTXOSet
+  Indexes []Index
+  Undo UndoStore
+  //UndoDepth is how many blocks below the tip keep their undo data; zero keeps it for every block
+  UndoDepth int
+
+  //connected holds the hash of each main chain block by height, for pruning undo data
+  connected map[int]block.Hash
+}
+
+//New returns an empty chain state holding undo data in memory for DefaultUndoDepth blocks
+func New(indexes ...Index) (*State) {
+  return &State{
+    UTXO: NewUTXOSet(),
+    Indexes: indexes,
+    Undo: NewMemoryUndo(),
+    UndoDepth: DefaultUndoDepth,
+    connected: make(map[int]block.Hash),
+  }
+}
+
+//ConnectBlock applies the block at height to the UTXO set and the indexes
+func (s *State) ConnectBlock(height int, b *block.Block) (error) {
+  undo, err := s.UTXO.Connect(height, b)
+  if err != nil {
+    return err
+  }
+  err = s.Undo.Put(b.BlockHash, undo)
+  if err != nil {
+    return err
+  }
+  for _, ix := range s.Indexes {
+    err = ix.ConnectBlock(height, b, undo)
+    if err != nil {
+      return err
+    }
+  }
+  s.connected[height] = b.BlockHash
+  if s.UndoDepth > 0 {
+    if old, ok := s.connected[height - s.UndoDepth]; ok {
+      delete(s.connected, height - s.UndoDepth)
+      return s.Undo.Delete(old)
+    }
+  }
+  return nil
+}
+
+//DisconnectBlock reverses ConnectBlock for the main chain tip b at height using its undo data
+func (s *State) DisconnectBlock(height int, b *block.Block) (error) {
+  undo, err := s.Undo.Get(b.BlockHash)
+  if err != nil {
+    return err
+  }
+  if undo == nil {
+    return fmt.Errorf("%w %s at height %d", ErrNoUndo, b.BlockHash, height)
+  }
+  for i := len(s.Indexes) - 1; i >= 0; i-- {
+    err = s.Indexes[i].DisconnectBlock(height, b, undo)
+    if err != nil {
+      return err
+    }
+  }
+  err = s.UTXO.Disconnect(height, b, undo)
+  if err != nil {
+    return err
+  }
+  delete(s.connected, height)
+  return s.Undo.Delete(b.BlockHash)
+}
@@ -0,0 +1,336 @@
+package chainstate
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainindex"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//payTo returns a pay to public key hash script for a hash160 filled with b
+func payTo(b byte) ([]byte) {
+  script := []byte{0x76, 0xa9, 0x14}
+  for i := 0; i < 20; i++ {
+    script = append(script, b)
+  }
+  return append(script, 0x88, 0xac)
+}
+
+//mineSpends mines n blocks on parent, each spending the coinbase of the block below it to two addresses picked by
+//seed, one of which is spent again within the block, and writing an OP_RETURN output
+func mineSpends(c *chaintest.Chain, parent block.Hash, n int, tag string, seed byte) ([]*block.Block) {
+  var mined []*block.Block
+  for i := 0; i < n; i++ {
+    coinbase := c.Blocks[parent].Transactions[0].TransactionHash
+    pay := chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)},
+      chaintest.Out(chaintest.Subsidy / 2, payTo(seed + byte(i))), chaintest.Out(chaintest.Subsidy / 2, chaintest.OpTrue),
+      chaintest.Out(0, []byte{0x6a, 0x04, 't', 'e', 's', 't'}))
+    respend := chaintest.Tx([]block.Input{chaintest.In(pay.TransactionHash, 1)}, chaintest.Out(chaintest.Subsidy / 2, payTo(seed + 100 + byte(i))))
+    b := c.Mine(parent, tag, 0, pay, respend)
+    mined = append(mined, b)
+    parent = b.BlockHash
+  }
+  return mined
+}
+
+//newState returns a State with every index, keeping undo data in undo
+func newState(undo UndoStore) (*State) {
+  s := New(NewAddressIndex(), NewTxIndex())
+  s.Undo = undo
+  return s
+}
+
+//follow adds blocks to ix and applies each change of the main chain to s, returning how many blocks were disconnected
+func follow(t *testing.T, ix *chainindex.Index, s *State, c *chaintest.Chain, blocks ...*block.Block) (int) {
+  disconnected := 0
+  for _, b := range blocks {
+    change := ix.Add(b.HashBlock, b.Header.TargetValue)
+    if change == nil {
+      continue
+    }
+    for _, n := range change.Disconnected {
+      err := s.DisconnectBlock(n.Height, c.Blocks[n.Hash()])
+      if err != nil {
+        t.Fatalf("disconnecting %s at %d: %v", n.Hash(), n.Height, err)
+      }
+      disconnected++
+    }
+    for _, n := range change.Connected {
+      err := s.ConnectBlock(n.Height, c.Blocks[n.Hash()])
+      if err != nil {
+        t.Fatalf("connecting %s at %d: %v", n.Hash(), n.Height, err)
+      }
+    }
+  }
+  return disconnected
+}
+
+//sameState fails the test unless got and want hold the same coins and indexes
+func sameState(t *testing.T, got *State, want *State) {
+  t.Helper()
+  if !reflect.DeepEqual(got.UTXO, want.UTXO) {
+    t.Errorf("UTXO set holds %d coins worth %d, want %d worth %d", got.UTXO.Len(), got.UTXO.Total(), want.UTXO.Len(), want.UTXO.Total())
+  }
+  for i := range want.Indexes {
+    if !reflect.DeepEqual(got.Indexes[i], want.Indexes[i]) {
+      t.Errorf("index %T differs from one built on the new branch", want.Indexes[i])
+    }
+  }
+}
+
+func TestReorg(t *testing.T) {
+  undoStores := []struct {
+    name string
+    undo func(t *testing.T) (UndoStore)
+  }{
+    {"memory", func(t *testing.T) (UndoStore) { return NewMemoryUndo() }},
+    {"dir", func(t *testing.T) (UndoStore) { return DirUndo(t.TempDir()) }},
+  }
+  for _, depth := range []int{1, 2, 5} {
+    for _, store := range undoStores {
+      c := chaintest.NewChain()
+      c.Extend(3, "")
+      fork := c.Tip
+      old := mineSpends(c, fork, depth, "old", 1)
+      //the new branch spends the same coinbase to other addresses
+      replacement := mineSpends(c, fork, depth + 1, "new", 50)
+
+      ix := chainindex.New(c.Order[0].BlockHash)
+      s := newState(store.undo(t))
+      disconnected := follow(t, ix, s, c, c.Order...)
+      if disconnected != depth {
+        t.Fatalf("depth %d %s: %d blocks disconnected", depth, store.name, disconnected)
+      }
+      want := newState(NewMemoryUndo())
+      follow(t, chainindex.New(c.Order[0].BlockHash), want, c, c.Branch(replacement[depth].BlockHash)...)
+      sameState(t, s, want)
+
+      //the old branch's transactions are gone and the new branch's are indexed
+      txs := s.Indexes[1].(*TxIndex)
+      if _, ok := txs.Get(old[0].Transactions[1].TransactionHash); ok {
+        t.Errorf("depth %d %s: disconnected transaction still indexed", depth, store.name)
+      }
+      if l, ok := txs.Get(replacement[0].Transactions[2].TransactionHash); !ok || l.Height != 4 || l.Index != 2 || l.BlockHash != replacement[0].BlockHash {
+        t.Errorf("depth %d %s: connected transaction at %+v", depth, store.name, l)
+      }
+      addresses := s.Indexes[0].(*AddressIndex)
+      if n := addresses.Len(); n != 2 * (depth + 1) {
+        t.Errorf("depth %d %s: %d addresses indexed, want %d", depth, store.name, n, 2 * (depth + 1))
+      }
+      //spends only move coins, so the set is worth every main chain coinbase but the genesis block's
+      if s.UTXO.Total() != uint64(4 + depth) * chaintest.Subsidy {
+        t.Errorf("depth %d %s: UTXO set worth %d", depth, store.name, s.UTXO.Total())
+      }
+    }
+  }
+}
+
+func TestReorgBeyondUndoDepth(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(1, "")
+  fork := c.Tip
+  c.Extend(3, "old")
+  for i, parent := 0, fork; i < 4; i++ {
+    parent = c.Mine(parent, "new", 0).BlockHash
+  }
+  ix := chainindex.New(c.Order[0].BlockHash)
+  s := New()
+  s.UndoDepth = 2
+  for _, b := range c.Order {
+    change := ix.Add(b.HashBlock, b.Header.TargetValue)
+    if change == nil {
+      continue
+    }
+    if len(change.Disconnected) > 0 {
+      //the two blocks below the tip still have their undo data, the third does not
+      for i, n := range change.Disconnected {
+        err := s.DisconnectBlock(n.Height, c.Blocks[n.Hash()])
+        if i < 2 && err != nil {
+          t.Fatalf("disconnecting block %d of %d: %v", i, len(change.Disconnected), err)
+        }
+        if i == 2 && !errors.Is(err, ErrNoUndo) {
+          t.Fatalf("disconnecting block %d of %d returned %v, want ErrNoUndo", i, len(change.Disconnected), err)
+        }
+      }
+      return
+    }
+    for _, n := range change.Connected {
+      err := s.ConnectBlock(n.Height, c.Blocks[n.Hash()])
+      if err != nil {
+        t.Fatal(err)
+      }
+    }
+  }
+  t.Fatal("no reorg")
+}
+
+func TestConnectMissingCoin(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(2, "")
+  s := New(NewAddressIndex(), NewTxIndex())
+  for h, b := range c.Order {
+    err := s.ConnectBlock(h, b)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  before := *s.UTXO
+  before.coins = make(map[Outpoint]Coin)
+  for o, coin := range s.UTXO.coins {
+    before.coins[o] = coin
+  }
+  //the second transaction spends a coin that exists, the third one that does not
+  spend := chaintest.Tx([]block.Input{chaintest.In(c.Order[1].Transactions[0].TransactionHash, 0)}, chaintest.Out(1, payTo(9)))
+  bad := chaintest.Tx([]block.Input{chaintest.In(spend.TransactionHash, 0), chaintest.In(spend.TransactionHash, 7)}, chaintest.Out(1, payTo(9)))
+  b := c.Mine(c.Tip, "", 0, spend, bad)
+  err := s.ConnectBlock(3, b)
+  if !errors.Is(err, ErrMissingCoin) {
+    t.Fatalf("ConnectBlock returned %v, want ErrMissingCoin", err)
+  }
+  if !reflect.DeepEqual(s.UTXO, &before) {
+    t.Fatalf("failed block left the UTXO set changed: %d coins worth %d, had %d worth %d", s.UTXO.Len(), s.UTXO.Total(), before.Len(), before.Total())
+  }
+}
+
+func TestUndoRoundTrip(t *testing.T) {
+  undo := &BlockUndo{Spent: []SpentCoin{
+    {Outpoint{block.Hash{1, 2, 3}, 0}, Coin{Value: chaintest.Subsidy, Script: chaintest.OpTrue, Height: 1, Coinbase: true}},
+    {Outpoint{block.Hash{4}, 0xffffffff}, Coin{Value: 0, Script: []byte{}, Height: 840000}},
+    {Outpoint{block.Hash{5}, 3}, Coin{Value: 21000000 * 100000000, Script: payTo(7), Height: 0}},
+  }, Overwritten: []SpentCoin{
+    {Outpoint{block.Hash{6}, 0}, Coin{Value: chaintest.Subsidy, Script: payTo(8), Height: 91812, Coinbase: true}},
+  }}
+  b, err := undo.MarshalBinary()
+  if err != nil {
+    t.Fatal(err)
+  }
+  var got BlockUndo
+  err = got.UnmarshalBinary(b)
+  if err != nil || !reflect.DeepEqual(&got, undo) {
+    t.Fatalf("round trip gave %+v, %v; want %+v", got, err, undo)
+  }
+  for _, bad := range [][]byte{nil, b[:len(b)-1], append(append([]byte{}, b...), 0), {0xff, 0xff, 0xff, 0xff, 0x0f}} {
+    if err := new(BlockUndo).UnmarshalBinary(bad); err != ErrBadUndo {
+      t.Errorf("UnmarshalBinary(%x) returned %v, want ErrBadUndo", bad, err)
+    }
+  }
+}
+
+//mineDuplicate mines a chain whose blocks 1 and 4 have the same coinbase, as blocks 91812 and 91842 did, paying the
+//address of payTo(1)
+func mineDuplicate() (*chaintest.Chain) {
+  c := chaintest.NewChain()
+  coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase([]byte("/dup/"))}, chaintest.Out(chaintest.Subsidy, payTo(1)))
+  c.MineCoinbase(c.Tip, coinbase)
+  c.Extend(2, "")
+  c.MineCoinbase(c.Tip, coinbase)
+  return c
+}
+
+func TestDuplicateTxID(t *testing.T) {
+  for _, undo := range []func(t *testing.T) (UndoStore){
+    func(t *testing.T) (UndoStore) { return NewMemoryUndo() },
+    func(t *testing.T) (UndoStore) { return DirUndo(t.TempDir()) },
+  } {
+    c := mineDuplicate()
+    txid := c.Order[1].Transactions[0].TransactionHash
+    s := newState(undo(t))
+    for h, b := range c.Order[:4] {
+      if err := s.ConnectBlock(h, b); err != nil {
+        t.Fatal(err)
+      }
+    }
+    before := newState(NewMemoryUndo())
+    follow(t, chainindex.New(c.Order[0].BlockHash), before, c, c.Order[:4]...)
+    if err := s.ConnectBlock(4, c.Order[4]); err != nil {
+      t.Fatal(err)
+    }
+
+    //the earlier coin is lost, so the set holds three coinbases rather than four
+    if s.UTXO.Len() != 3 || s.UTXO.Total() != 3 * chaintest.Subsidy {
+      t.Errorf("UTXO set holds %d coins worth %d, want 3 worth %d", s.UTXO.Len(), s.UTXO.Total(), 3 * chaintest.Subsidy)
+    }
+    if coin, ok := s.UTXO.Get(Outpoint{txid, 0}); !ok || coin.Height != 4 {
+      t.Errorf("coin at the repeated txid %+v, want the one from height 4", coin)
+    }
+    u, err := s.Undo.Get(c.Order[4].BlockHash)
+    if err != nil || len(u.Overwritten) != 1 || u.Overwritten[0].Coin.Height != 1 || u.Overwritten[0].Outpoint != (Outpoint{txid, 0}) {
+      t.Errorf("undo data %+v, %v, want the coin from height 1 overwritten", u, err)
+    }
+    addresses := s.Indexes[0].(*AddressIndex)
+    address := scriptAddresses(payTo(1))[0]
+    if a := addresses.Get(address); a.Balance() != chaintest.Subsidy || a.Outputs != 2 || a.SpentOutputs != 1 {
+      t.Errorf("address totals %+v, want a balance of one coinbase", a)
+    }
+    if l, ok := s.Indexes[1].(*TxIndex).Get(txid); !ok || l.Height != 4 {
+      t.Errorf("repeated txid located at %+v, want height 4", l)
+    }
+
+    //disconnecting the repeat brings the earlier coin and location back
+    if err := s.DisconnectBlock(4, c.Order[4]); err != nil {
+      t.Fatal(err)
+    }
+    sameState(t, s, before)
+    if l, ok := s.Indexes[1].(*TxIndex).Get(txid); !ok || l.Height != 1 {
+      t.Errorf("after disconnecting, repeated txid located at %+v, want height 1", l)
+    }
+  }
+}
+
+func TestAddressIndexSegwit(t *testing.T) {
+  //witness programs from BIP173 and BIP350 with their addresses
+  programs := []struct {
+    script []byte
+    address string
+  }{
+    {chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6"), "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+    {chaintest.MustHex("00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"),
+      "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"},
+    {chaintest.MustHex("512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+      "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+  }
+  c := chaintest.NewChain()
+  c.Extend(1, "")
+  coinbase := c.Tip
+  var outs []block.Output
+  for i, p := range programs {
+    outs = append(outs, chaintest.Out(uint64(i + 1) * 1000, p.script))
+  }
+  pay := chaintest.Tx([]block.Input{chaintest.In(c.Blocks[coinbase].Transactions[0].TransactionHash, 0)}, outs...)
+  c.Mine(coinbase, "", 0, pay)
+  //the next block spends every segwit output back to the first program
+  var ins []block.Input
+  for i := range programs {
+    ins = append(ins, chaintest.In(pay.TransactionHash, uint32(i)))
+  }
+  c.Mine(c.Tip, "", 0, chaintest.Tx(ins, chaintest.Out(6000, programs[0].script)))
+
+  s := newState(NewMemoryUndo())
+  for h, b := range c.Order {
+    if err := s.ConnectBlock(h, b); err != nil {
+      t.Fatal(err)
+    }
+  }
+  addresses := s.Indexes[0].(*AddressIndex)
+  for i, p := range programs {
+    want := AddressBalance{Received: uint64(i + 1) * 1000, Spent: uint64(i + 1) * 1000, Outputs: 1, SpentOutputs: 1}
+    if i == 0 {
+      want.Received, want.Outputs = 7000, 2
+    }
+    if got := addresses.Get(p.address); got != want {
+      t.Errorf("%s: %+v, want %+v", p.address, got, want)
+    }
+  }
+
+  //disconnecting the spend leaves the outputs unspent
+  if err := s.DisconnectBlock(3, c.Order[3]); err != nil {
+    t.Fatal(err)
+  }
+  for i, p := range programs {
+    if got := addresses.Get(p.address); got.Balance() != uint64(i + 1) * 1000 || got.SpentOutputs != 0 || got.Outputs != 1 {
+      t.Errorf("%s after disconnecting the spend: %+v", p.address, got)
+    }
+  }
+}
@@ -0,0 +1,68 @@
+package chainstate
+
+import (
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//TxLocation is where a transaction sits in the main chain
+type TxLocation struct {
+  BlockHash block.Hash `json:"block_hash"`
+  Height int `json:"height"`
+  //Index is the position of the transaction in its block
+  Index int `json:"index"`
+}
+
+//TxIndex maps the txid of every main chain transaction to its block. A txid repeated before BIP30 maps to its latest
+//transaction, as bitcoind's txindex does, and the earlier location comes back when that block is disconnected.
+type TxIndex struct {
+  txs map[block.Hash]TxLocation
+  //shadowed holds the earlier locations of repeated txids, oldest first
+  shadowed map[block.Hash][]TxLocation
+}
+
+//NewTxIndex returns an empty transaction index
+func NewTxIndex() (*TxIndex) {
+  return &TxIndex{txs: make(map[block.Hash]TxLocation), shadowed: make(map[block.Hash][]TxLocation)}
+}
+
+//Get returns the location of the latest transaction with txid
+func (ix *TxIndex) Get(txid block.Hash) (TxLocation, bool) {
+  l, ok := ix.txs[txid]
+  return l, ok
+}
+
+//Len returns the number of indexed transactions
+func (ix *TxIndex) Len() (int) {
+  return len(ix.txs)
+}
+
+func (ix *TxIndex) ConnectBlock(height int, b *block.Block, undo *BlockUndo) (error) {
+  for t := range b.Transactions {
+    txid := b.Transactions[t].TransactionHash
+    if l, ok := ix.txs[txid]; ok {
+      ix.shadowed[txid] = append(ix.shadowed[txid], l)
+    }
+    ix.txs[txid] = TxLocation{b.BlockHash, height, t}
+  }
+  return nil
+}
+
+func (ix *TxIndex) DisconnectBlock(height int, b *block.Block, undo *BlockUndo) (error) {
+  for t := range b.Transactions {
+    txid := b.Transactions[t].TransactionHash
+    if ix.txs[txid].BlockHash != b.BlockHash {
+      continue
+    }
+    if earlier := ix.shadowed[txid]; len(earlier) > 0 {
+      ix.txs[txid] = earlier[len(earlier)-1]
+      if len(earlier) == 1 {
+        delete(ix.shadowed, txid)
+      } else {
+        ix.shadowed[txid] = earlier[:len(earlier)-1]
+      }
+      continue
+    }
+    delete(ix.txs, txid)
+  }
+  return nil
+}
@@ -0,0 +1,185 @@
+package chainstate
+
+import (
+    "encoding/binary"
+    "errors"
+    "os"
+    "path/filepath"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//ErrBadUndo is returned when serialized undo data is malformed
+var ErrBadUndo = errors.New("chainstate: malformed undo data")
+
+//SpentCoin is a coin a block spent, with the outpoint it was spent from
+type SpentCoin struct {
+  Outpoint Outpoint
+  Coin Coin
+}
+
+//BlockUndo holds what disconnecting a block needs to restore: the coins its inputs spent, in the order they were spent,
+//and the unspent coins it replaced by repeating the txid that created them
+type BlockUndo struct {
+  Spent []SpentCoin
+  //Overwritten holds the coins whose outpoints the block's outputs took over, in the order it took them. Before BIP30
+  //a transaction could repeat the txid of one with unspent outputs, as the coinbases of blocks 91842 and 91880 did,
+  //and the earlier outputs were lost rather than spent.
+  Overwritten []SpentCoin
+}
+
+//MarshalBinary serializes u. Each coin is written as its outpoint, its height and coinbase flag as one varint, its
+//value and its script behind its length. The overwritten coins follow the spent coins in the same form, and are left
+//out when there are none.
+func (u *BlockUndo) MarshalBinary() ([]byte, error) {
+  b := appendCoins(nil, u.Spent)
+  if len(u.Overwritten) > 0 {
+    b = appendCoins(b, u.Overwritten)
+  }
+  return b, nil
+}
+
+func appendCoins(b []byte, coins []SpentCoin) ([]byte) {
+  b = binary.AppendUvarint(b, uint64(len(coins)))
+  for _, s := range coins {
+    b = append(b, s.Outpoint.Hash[:]...)
+    b = binary.AppendUvarint(b, uint64(s.Outpoint.Index))
+    code := uint64(s.Coin.Height) << 1
+    if s.Coin.Coinbase {
+      code |= 1
+    }
+    b = binary.AppendUvarint(b, code)
+    b = binary.AppendUvarint(b, s.Coin.Value)
+    b = binary.AppendUvarint(b, uint64(len(s.Coin.Script)))
+    b = append(b, s.Coin.Script...)
+  }
+  return b
+}
+
+//UnmarshalBinary reads undo data written by MarshalBinary. Scripts are copied out of b.
+func (u *BlockUndo) UnmarshalBinary(b []byte) (error) {
+  var err error
+  u.Spent, b, err = readCoins(b)
+  if err != nil {
+    return err
+  }
+  u.Overwritten = nil
+  if len(b) > 0 {
+    u.Overwritten, b, err = readCoins(b)
+    if err != nil {
+      return err
+    }
+    //MarshalBinary leaves out an empty list
+    if len(u.Overwritten) == 0 {
+      return ErrBadUndo
+    }
+  }
+  if len(b) != 0 {
+    return ErrBadUndo
+  }
+  return nil
+}
+
+//readCoins reads a list of coins written by appendCoins and returns the bytes after it
+func readCoins(b []byte) ([]SpentCoin, []byte, error) {
+  varint := func() (uint64) {
+    v, n := binary.Uvarint(b)
+    if n <= 0 {
+      b = nil
+      return 0
+    }
+    b = b[n:]
+    return v
+  }
+  count := varint()
+  //every coin takes at least 36 bytes, which bounds the allocation for damaged counts
+  if b == nil || count > uint64(len(b)) / 36 {
+    return nil, nil, ErrBadUndo
+  }
+  coins := make([]SpentCoin, count)
+  for i := range coins {
+    s := &coins[i]
+    if len(b) < block.HashLength {
+      return nil, nil, ErrBadUndo
+    }
+    copy(s.Outpoint.Hash[:], b)
+    b = b[block.HashLength:]
+    index := varint()
+    code := varint()
+    s.Coin.Value = varint()
+    length := varint()
+    if b == nil || index > 0xffffffff || length > uint64(len(b)) {
+      return nil, nil, ErrBadUndo
+    }
+    s.Outpoint.Index = uint32(index)
+    s.Coin.Height, s.Coin.Coinbase = int(code >> 1), code & 1 == 1
+    s.Coin.Script = append([]byte{}, b[:length]...)
+    b = b[length:]
+  }
+  return coins, b, nil
+}
+
+//UndoStore holds the undo data of connected blocks by block hash. Get returns nil for a block it does not hold.
+type UndoStore interface {
+  Put(hash block.Hash, undo *BlockUndo) (error)
+  Get(hash block.Hash) (*BlockUndo, error)
+  Delete(hash block.Hash) (error)
+}
+
+//MemoryUndo is an UndoStore held in memory
+type MemoryUndo map[block.Hash]*BlockUndo
+
+//NewMemoryUndo returns an empty MemoryUndo
+func NewMemoryUndo() (MemoryUndo) {
+  return make(MemoryUndo)
+}
+
+func (m MemoryUndo) Put(hash block.Hash, undo *BlockUndo) (error) {
+  m[hash] = undo
+  return nil
+}
+
+func (m MemoryUndo) Get(hash block.Hash) (*BlockUndo, error) {
+  return m[hash], nil
+}
+
+func (m MemoryUndo) Delete(hash block.Hash) (error) {
+  delete(m, hash)
+  return nil
+}
+
+//DirUndo is an UndoStore keeping each block's undo data in a file named after the block hash, as bitcoind keeps
+//undo data in rev files beside its blk files
+type DirUndo string
+
+//fileName returns the file holding the undo data of hash
+func (d DirUndo) fileName(hash block.Hash) (string) {
+  return filepath.Join(string(d), hash.String() + ".rev")
+}
+
+func (d DirUndo) Put(hash block.Hash, undo *BlockUndo) (error) {
+  b, err := undo.MarshalBinary()
+  if err != nil {
+    return err
+  }
+  return os.WriteFile(d.fileName(hash), b, 0644)
+}
+
+func (d DirUndo) Get(hash block.Hash) (*BlockUndo, error) {
+  b, err := os.ReadFile(d.fileName(hash))
+  if errors.Is(err, os.ErrNotExist) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  undo := new(BlockUndo)
+  return undo, undo.UnmarshalBinary(b)
+}
+
+func (d DirUndo) Delete(hash block.Hash) (error) {
+  err := os.Remove(d.fileName(hash))
+  if errors.Is(err, os.ErrNotExist) {
+    return nil
+  }
+  return err
+}
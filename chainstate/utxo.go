@@ -0,0 +1,160 @@
+package chainstate
+
+import (
+    "fmt"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//maxScriptSize is the largest script the interpreter runs; outputs with longer scripts can never be spent
+const maxScriptSize = 10000
+
+//opReturn marks an output script as provably unspendable
+const opReturn = 0x6a
+
+//Outpoint names a transaction output
+type Outpoint struct {
+  Hash block.Hash
+  Index uint32
+}
+
+func (o Outpoint) String() (string) {
+  return fmt.Sprintf("%s:%d", o.Hash, o.Index)
+}
+
+//Coin is an unspent transaction output
+type Coin struct {
+  Value uint64
+  Script []byte
+  //Height is the height of the block holding the transaction that created the coin
+  Height int
+  Coinbase bool
+}
+
+//Unspendable reports whether script can never be spent, so its output is left out of the UTXO set
+func Unspendable(script []byte) (bool) {
+  return (len(script) > 0 && script[0] == opReturn) || len(script) > maxScriptSize
+}
+
+//UTXOSet is the set of unspent transaction outputs of the main chain
+type UTXOSet struct {
+  coins map[Outpoint]Coin
+  total uint64
+}
+
+//NewUTXOSet returns an empty UTXO set
+func NewUTXOSet() (*UTXOSet) {
+  return &UTXOSet{coins: make(map[Outpoint]Coin)}
+}
+
+//Get returns the unspent coin at o
+func (u *UTXOSet) Get(o Outpoint) (Coin, bool) {
+  c, ok := u.coins[o]
+  return c, ok
+}
+
+//Len returns the number of unspent coins
+func (u *UTXOSet) Len() (int) {
+  return len(u.coins)
+}
+
+//Total returns the value of every unspent coin
+func (u *UTXOSet) Total() (uint64) {
+  return u.total
+}
+
+//Connect spends the inputs and adds the outputs of the block at height, returning the coins spent and those its
+//outputs overwrote. The outputs of the genesis block are never added, as bitcoind never added them, and scripts are
+//copied out of the block.
+func (u *UTXOSet) Connect(height int, b *block.Block) (*BlockUndo, error) {
+  undo := &BlockUndo{}
+  if height == 0 {
+    return undo, nil
+  }
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    if t > 0 {
+      for i := range tx.Inputs {
+        o := Outpoint{tx.Inputs[i].TransactionHash, tx.Inputs[i].TransactionIndex}
+        c, ok := u.coins[o]
+        if !ok {
+          //put back what this block already changed so a failed block leaves the set as it was
+          for ; i > 0; i-- {
+            last := undo.Spent[len(undo.Spent)-1]
+            undo.Spent = undo.Spent[:len(undo.Spent)-1]
+            u.add(last.Outpoint, last.Coin)
+          }
+          u.undo(b, t, undo)
+          return nil, fmt.Errorf("%w: %s spent by %s at height %d", ErrMissingCoin, o, tx.TransactionHash, height)
+        }
+        u.remove(o, c)
+        undo.Spent = append(undo.Spent, SpentCoin{o, c})
+      }
+    }
+    for i := range tx.Outputs {
+      out := &tx.Outputs[i]
+      if Unspendable(out.ChallengeScript) {
+        continue
+      }
+      o := Outpoint{tx.TransactionHash, uint32(i)}
+      if old, ok := u.coins[o]; ok {
+        undo.Overwritten = append(undo.Overwritten, SpentCoin{o, old})
+      }
+      u.add(o, Coin{out.OutputValue, append([]byte{}, out.ChallengeScript...), height, t == 0})
+    }
+  }
+  return undo, nil
+}
+
+//Disconnect removes the outputs of the block at height and restores the coins it spent from undo
+func (u *UTXOSet) Disconnect(height int, b *block.Block, undo *BlockUndo) (error) {
+  if height == 0 {
+    return nil
+  }
+  spent := 0
+  for t := 1; t < len(b.Transactions); t++ {
+    spent += len(b.Transactions[t].Inputs)
+  }
+  if spent != len(undo.Spent) {
+    return fmt.Errorf("%w: block %s spends %d coins, undo data holds %d", ErrBadUndo, b.BlockHash, spent, len(undo.Spent))
+  }
+  u.undo(b, len(b.Transactions), undo)
+  return nil
+}
+
+//undo reverses the first n transactions of b, whose spends and overwrites are recorded in undo, newest first
+func (u *UTXOSet) undo(b *block.Block, n int, undo *BlockUndo) {
+  s := len(undo.Spent)
+  w := len(undo.Overwritten)
+  for t := n - 1; t >= 0; t-- {
+    tx := &b.Transactions[t]
+    for i := range tx.Outputs {
+      o := Outpoint{tx.TransactionHash, uint32(i)}
+      if c, ok := u.coins[o]; ok {
+        u.remove(o, c)
+      }
+    }
+    for ; w > 0 && undo.Overwritten[w-1].Outpoint.Hash == tx.TransactionHash; w-- {
+      u.add(undo.Overwritten[w-1].Outpoint, undo.Overwritten[w-1].Coin)
+    }
+    if t == 0 {
+      break
+    }
+    for i := len(tx.Inputs) - 1; i >= 0 && s > 0; i-- {
+      s--
+      u.add(undo.Spent[s].Outpoint, undo.Spent[s].Coin)
+    }
+  }
+}
+
+func (u *UTXOSet) add(o Outpoint, c Coin) {
+  if old, ok := u.coins[o]; ok {
+    u.total -= old.Value
+  }
+  u.coins[o] = c
+  u.total += c.Value
+}
+
+func (u *UTXOSet) remove(o Outpoint, c Coin) {
+  delete(u.coins, o)
+  u.total -= c.Value
+}
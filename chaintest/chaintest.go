@@ -0,0 +1,243 @@
+package chaintest
+
+import (
+    "encoding/binary"
+    "encoding/hex"
+    "math/big"
+    "os"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/network"
+)
+
+//GenesisHex is the serialized main network genesis block
+const GenesisHex = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c0101000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+//RegTestBits is the compact target of regtest blocks, which any hash below 2^255 meets
+const RegTestBits = 0x207fffff
+
+//Subsidy is the coinbase value of blocks mined by Chain
+const Subsidy = 50 * 100000000
+
+//BlockInterval is the number of seconds between the timestamps of consecutive blocks mined by Chain
+const BlockInterval = 600
+
+//OpTrue is an output script anyone can spend with an empty input script
+var OpTrue = []byte{0x51}
+
+//MustHex decodes a hex constant
+func MustHex(s string) ([]byte) {
+  b, err := hex.DecodeString(s)
+  if err != nil {
+    panic(err)
+  }
+  return b
+}
+
+//Genesis returns the main network genesis block, so chains built on it index like mainnet
+func Genesis() (*block.Block) {
+  coinbase := Tx([]block.Input{Coinbase(MustHex("04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73"))},
+    Out(Subsidy, MustHex("4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac")))
+  b := newBlock(block.Hash{}, 1231006505, 0x1d00ffff, []block.Transaction{coinbase})
+  b.Header.FormatVersion = 1
+  b.Header.Nonce = 2083236893
+  finishBlock(b)
+  if b.BlockHash != network.MainNet.GenesisBlockHash {
+    panic("chaintest: genesis block does not hash to the main network genesis hash")
+  }
+  return b
+}
+
+//Coinbase returns the input of a coinbase transaction carrying script
+func Coinbase(script []byte) (block.Input) {
+  return block.Input{TransactionIndex: 0xffffffff, InputScript: script, SequenceNumber: 0xffffffff}
+}
+
+//In returns an input spending output index of txid with an empty input script, as OpTrue outputs need
+func In(txid block.Hash, index uint32) (block.Input) {
+  return block.Input{TransactionHash: txid, TransactionIndex: index, InputScript: []byte{}, SequenceNumber: 0xffffffff}
+}
+
+//Out returns an output paying value to script
+func Out(value uint64, script []byte) (block.Output) {
+  return block.Output{OutputValue: value, ChallengeScript: script}
+}
+
+//Tx returns a version 1 transaction with its counts, Raw and txid filled in
+func Tx(inputs []block.Input, outputs ...block.Output) (block.Transaction) {
+  tx := block.Transaction{TransactionVersionNumber: 1, Inputs: inputs, Outputs: outputs}
+  return Finish(tx)
+}
+
+//Finish fills in the counts, Raw and txid of tx after its fields have been changed
+func Finish(tx block.Transaction) (block.Transaction) {
+  tx.InputCount = uint64(len(tx.Inputs))
+  tx.OutputCount = uint64(len(tx.Outputs))
+  tx.Raw = blockserializer.SerializeTransaction(&tx)
+  tx.TransactionHash, _ = btchashing.ComputeTransactionHash(&tx, tx.InputCount, tx.OutputCount)
+  return tx
+}
+
+//HeightScript returns a BIP34 coinbase script committing to height followed by tag. Like bitcoind, heights
+//up to 16 are pushed with OP_0 to OP_16 and larger heights as minimal script numbers.
+func HeightScript(height int, tag string) ([]byte) {
+  var script []byte
+  switch {
+  case height == 0:
+    script = []byte{0x00}
+  case height <= 16:
+    script = []byte{byte(0x50 + height)}
+  default:
+    var n []byte
+    for v := height; v > 0; v >>= 8 {
+      n = append(n, byte(v))
+    }
+    if n[len(n)-1] & 0x80 != 0 {
+      n = append(n, 0)
+    }
+    script = append([]byte{byte(len(n))}, n...)
+  }
+  if tag != "" {
+    script = append(script, byte(len(tag)))
+    script = append(script, tag...)
+  }
+  return script
+}
+
+//newBlock assembles a block from its transactions without finishing it
+func newBlock(prev block.Hash, time uint32, bits uint32, txs []block.Transaction) (*block.Block) {
+  hashes := make([]block.Hash, len(txs))
+  for t := range txs {
+    hashes[t] = txs[t].TransactionHash
+  }
+  root, _ := btchashing.ComputeMerkleRoot(hashes)
+  return &block.Block{
+    MagicNumber: network.Active.Magic,
+    Header: block.Header{FormatVersion: 0x20000000, PreviousBlockHash: prev, MerkleRoot: root, TimeStamp: time, TargetValue: bits},
+    TransactionCount: uint64(len(txs)),
+    Transactions: txs,
+  }
+}
+
+//finishBlock fills in the hash, Raw and length of b
+func finishBlock(b *block.Block) {
+  b.BlockHash = btchashing.ComputeBlockHash(b)
+  b.Raw = blockserializer.SerializeBlock(b)
+  b.BlockLength = uint32(len(b.Raw))
+  b.HashBlock = block.HashBlock{BlockHash: b.BlockHash, PreviousBlockHash: b.Header.PreviousBlockHash, TimeStamp: b.Header.TimeStamp, ParsedBlockLength: b.BlockLength}
+}
+
+//target expands a compact target
+func target(bits uint32) (*big.Int) {
+  t := big.NewInt(int64(bits & 0x007fffff))
+  exponent := int(bits >> 24)
+  if exponent <= 3 {
+    return t.Rsh(t, uint(8 * (3 - exponent)))
+  }
+  return t.Lsh(t, uint(8 * (exponent - 3)))
+}
+
+//NewBlock returns a block on prev holding txs, with its nonce ground until its hash meets the regtest target
+func NewBlock(prev block.Hash, time uint32, txs ...block.Transaction) (*block.Block) {
+  b := newBlock(prev, time, RegTestBits, txs)
+  limit := target(RegTestBits)
+  for {
+    finishBlock(b)
+    h := b.BlockHash
+    for i := 0; i < block.HashLength/2; i++ {
+      h[i], h[block.HashLength-1-i] = h[block.HashLength-1-i], h[i]
+    }
+    if new(big.Int).SetBytes(h[:]).Cmp(limit) <= 0 {
+      return b
+    }
+    b.Header.Nonce++
+  }
+}
+
+//Chain is a tree of blocks rooted at the main network genesis block. Branches are mined by passing an
+//earlier block as the parent.
+type Chain struct {
+  Blocks map[block.Hash]*block.Block
+  Heights map[block.Hash]int
+  //Order lists blocks in the order they were mined, the order WriteBlkFile writes them in
+  Order []*block.Block
+  Tip block.Hash
+}
+
+//NewChain returns a chain holding only the genesis block
+func NewChain() (*Chain) {
+  g := Genesis()
+  return &Chain{
+    Blocks: map[block.Hash]*block.Block{g.BlockHash: g},
+    Heights: map[block.Hash]int{g.BlockHash: 0},
+    Order: []*block.Block{g},
+    Tip: g.BlockHash,
+  }
+}
+
+//Mine adds a block on parent holding a coinbase that pays Subsidy plus fees to OpTrue, followed by txs.
+//tag is written into the coinbase script after the BIP34 height so sibling blocks differ, and defaults to
+///chaintest/ so the script meets the two byte minimum. The tip moves to the new block when it is higher than
+//the current tip.
+func (c *Chain) Mine(parent block.Hash, tag string, fees uint64, txs ...block.Transaction) (*block.Block) {
+  height := c.Heights[parent] + 1
+  if tag == "" {
+    tag = "/chaintest/"
+  }
+  coinbase := Tx([]block.Input{Coinbase(HeightScript(height, tag))}, Out(Subsidy + fees, OpTrue))
+  return c.MineCoinbase(parent, coinbase, txs...)
+}
+
+//MineCoinbase adds a block on parent holding coinbase followed by txs, moving the tip as Mine does
+func (c *Chain) MineCoinbase(parent block.Hash, coinbase block.Transaction, txs ...block.Transaction) (*block.Block) {
+  height := c.Heights[parent] + 1
+  time := c.Blocks[parent].Header.TimeStamp + BlockInterval
+  b := NewBlock(parent, time, append([]block.Transaction{coinbase}, txs...)...)
+  c.Blocks[b.BlockHash] = b
+  c.Heights[b.BlockHash] = height
+  c.Order = append(c.Order, b)
+  if height > c.Heights[c.Tip] {
+    c.Tip = b.BlockHash
+  }
+  return b
+}
+
+//Extend mines n blocks on the tip with empty bodies and returns them
+func (c *Chain) Extend(n int, tag string) ([]*block.Block) {
+  var mined []*block.Block
+  for i := 0; i < n; i++ {
+    mined = append(mined, c.Mine(c.Tip, tag, 0))
+  }
+  return mined
+}
+
+//Branch returns the blocks from the genesis block to tip, in height order
+func (c *Chain) Branch(tip block.Hash) ([]*block.Block) {
+  var branch []*block.Block
+  for h := tip; ; {
+    b := c.Blocks[h]
+    branch = append([]*block.Block{b}, branch...)
+    if c.Heights[h] == 0 {
+      return branch
+    }
+    h = b.Header.PreviousBlockHash
+  }
+}
+
+//AppendBlk appends blocks to b as they appear in a blk file, each behind the magic number and its length
+func AppendBlk(b []byte, blocks ...*block.Block) ([]byte) {
+  for _, bl := range blocks {
+    b = binary.LittleEndian.AppendUint32(b, network.Active.Magic)
+    b = binary.LittleEndian.AppendUint32(b, uint32(len(bl.Raw)))
+    b = append(b, bl.Raw...)
+  }
+  return b
+}
+
+//WriteBlkFile writes blocks to path as bitcoind would, followed by padding zero bytes standing in for the
+//space bitcoind preallocates
+func WriteBlkFile(path string, padding int, blocks ...*block.Block) (error) {
+  b := AppendBlk(nil, blocks...)
+  return os.WriteFile(path, append(b, make([]byte, padding)...), 0644)
+}
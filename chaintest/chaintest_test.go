@@ -0,0 +1,28 @@
+package chaintest
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestGenesisMatchesMainnet(t *testing.T) {
+  if !bytes.Equal(Genesis().Raw, MustHex(GenesisHex)) {
+    t.Fatal("Genesis does not serialize to the main network genesis block")
+  }
+}
+
+func TestMineBranches(t *testing.T) {
+  c := NewChain()
+  main := c.Extend(3, "main")
+  side := c.Mine(main[0].BlockHash, "side", 0)
+  if c.Tip != main[2].BlockHash {
+    t.Fatalf("tip moved to a lower side branch")
+  }
+  if c.Heights[side.BlockHash] != 2 || side.BlockHash == main[1].BlockHash {
+    t.Fatalf("side block at height %d", c.Heights[side.BlockHash])
+  }
+  branch := c.Branch(side.BlockHash)
+  if len(branch) != 3 || branch[1] != main[0] {
+    t.Fatalf("side branch has %d blocks", len(branch))
+  }
+}
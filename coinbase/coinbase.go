@@ -0,0 +1,133 @@
+package coinbase
+
+import (
+    "bytes"
+    "strings"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//MinTagLength is the shortest run of printable characters reported as a miner tag
+const MinTagLength = 4
+
+//maxHeightLength is the longest height push BIP34 coinbases start with; heights below 2^39 fit
+const maxHeightLength = 5
+
+//maxExtraNonceLength is the longest push taken for an extranonce
+const maxExtraNonceLength = 32
+
+//witnessCommitmentHeader starts the OP_RETURN output committing to a block's witness data under BIP141
+var witnessCommitmentHeader = []byte{script.OPRETURN, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+//Info is what a coinbase transaction tells about the block and its miner
+type Info struct {
+  //Script is the coinbase input script
+  Script []byte
+  //Height is the number the script starts with, which BIP34 makes the block height. Blocks from before BIP34
+  //usually start with the target bits instead. It is -1 when the script does not start with a number.
+  Height int64
+  //ExtraNonce is the first short push after the height that is not text, which miners vary to search more hashes
+  ExtraNonce []byte
+  //Tags are the runs of printable characters in the data the script pushes, such as pool names
+  Tags []string
+  //WitnessCommitment is the BIP141 commitment to the block's witness data, nil when the block has none
+  WitnessCommitment []byte
+  //Addresses are the distinct addresses the coinbase pays, in output order
+  Addresses []string
+  Value uint64
+}
+
+//IsCoinbase reports whether tx has the single input spending no output that marks a coinbase transaction
+func IsCoinbase(tx *block.Transaction) (bool) {
+  return len(tx.Inputs) == 1 && tx.Inputs[0].TransactionHash.IsZero() && tx.Inputs[0].TransactionIndex == 0xffffffff
+}
+
+//Analyze reads the coinbase transaction tx
+func Analyze(tx *block.Transaction) (Info) {
+  info := Info{Height: -1}
+  if len(tx.Inputs) > 0 {
+    info.Script = tx.Inputs[0].InputScript
+  }
+  var ops []script.Op
+  for pos := 0; pos < len(info.Script); {
+    op, next, err := script.Next(info.Script, pos)
+    if err != nil {
+      //miners write text without pushing it too; what cannot be parsed is searched as it is
+      info.Tags = append(info.Tags, tags(info.Script[pos:])...)
+      break
+    }
+    ops = append(ops, op)
+    pos = next
+  }
+  rest := ops
+  if len(ops) > 0 {
+    if n, ok := ops[0].SmallInt(); ok && n >= 0 {
+      info.Height, rest = int64(n), ops[1:]
+    } else if ops[0].IsPush() {
+      n, err := script.Number(ops[0].Data, maxHeightLength, true)
+      if err == nil && n >= 0 {
+        info.Height, rest = n, ops[1:]
+      }
+    }
+  }
+  for _, op := range rest {
+    if op.IsPush() && len(op.Data) > 0 && len(op.Data) <= maxExtraNonceLength && len(tags(op.Data)) == 0 {
+      info.ExtraNonce = op.Data
+      break
+    }
+  }
+  var found []string
+  for _, op := range ops {
+    found = append(found, tags(op.Data)...)
+  }
+  info.Tags = append(found, info.Tags...)
+
+  for i := range tx.Outputs {
+    out := &tx.Outputs[i]
+    info.Value += out.OutputValue
+    s := out.ChallengeScript
+    //the last matching output holds the commitment
+    if len(s) >= 38 && bytes.HasPrefix(s, witnessCommitmentHeader) {
+      info.WitnessCommitment = s[6:38]
+    }
+    parsed := block.Output{ChallengeScript: s}
+    blockvalidation.ParseOutputScript(&parsed)
+    for _, a := range parsed.Addresses {
+      if a.Address != "" && !contains(info.Addresses, a.Address) {
+        info.Addresses = append(info.Addresses, a.Address)
+      }
+    }
+  }
+  return info
+}
+
+//tags returns the runs of at least MinTagLength printable characters in b, trimmed of spaces
+func tags(b []byte) ([]string) {
+  var found []string
+  start := -1
+  for i := 0; i <= len(b); i++ {
+    if i < len(b) && b[i] >= 0x20 && b[i] < 0x7f {
+      if start < 0 {
+        start = i
+      }
+      continue
+    }
+    if start >= 0 && i - start >= MinTagLength {
+      if tag := strings.TrimSpace(string(b[start:i])); len(tag) >= MinTagLength {
+        found = append(found, tag)
+      }
+    }
+    start = -1
+  }
+  return found
+}
+
+func contains(list []string, s string) (bool) {
+  for _, v := range list {
+    if v == s {
+      return true
+    }
+  }
+  return false
+}
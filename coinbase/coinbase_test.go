@@ -0,0 +1,172 @@
+package coinbase_test
+
+import (
+    "bytes"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/coinbase"
+)
+
+func TestAnalyzeMainnet(t *testing.T) {
+  var block1 block.Block
+  err := blockchainbuilder.ParseBytesOnly(&block1, chaintest.MustHex(chaintest.Block1Hex))
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    name string
+    tx *block.Transaction
+    tags []string
+    address string
+  }{
+    {"genesis", &chaintest.Genesis().Transactions[0], []string{"The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"}, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+    {"block 1", &block1.Transactions[0], nil, "12c6DSiU4Rq3P4ZxziKxzrL5LmMBrzjrJX"},
+  }
+  for _, test := range tests {
+    if !coinbase.IsCoinbase(test.tx) {
+      t.Fatalf("%s: not a coinbase", test.name)
+    }
+    info := coinbase.Analyze(test.tx)
+    //before BIP34 the script starts with the target bits and an extranonce of 4
+    if info.Height != 0x1d00ffff || !bytes.Equal(info.ExtraNonce, []byte{4}) {
+      t.Errorf("%s: height %d extranonce %x, want the bits and 04", test.name, info.Height, info.ExtraNonce)
+    }
+    if len(info.Tags) != len(test.tags) || (len(test.tags) > 0 && info.Tags[0] != test.tags[0]) {
+      t.Errorf("%s: tags %q, want %q", test.name, info.Tags, test.tags)
+    }
+    if len(info.Addresses) != 1 || info.Addresses[0] != test.address || info.Value != chaintest.Subsidy || info.WitnessCommitment != nil {
+      t.Errorf("%s: pays %v %d with commitment %x", test.name, info.Addresses, info.Value, info.WitnessCommitment)
+    }
+  }
+}
+
+func TestAnalyzeBIP34(t *testing.T) {
+  commitment := bytes.Repeat([]byte{0xab}, 32)
+  for _, height := range []int{1, 16, 17, 127, 128, 227931, 840000} {
+    script := append(chaintest.HeightScript(height, "/ViaBTC/Mined by someone/"), 0x08, 1, 2, 3, 4, 5, 6, 7, 8)
+    tx := chaintest.Tx([]block.Input{chaintest.Coinbase(script)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue),
+      chaintest.Out(0, append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, commitment...)))
+    info := coinbase.Analyze(&tx)
+    if info.Height != int64(height) {
+      t.Errorf("height %d read as %d from %x", height, info.Height, script)
+    }
+    if !bytes.Equal(info.ExtraNonce, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+      t.Errorf("height %d: extranonce %x", height, info.ExtraNonce)
+    }
+    if len(info.Tags) != 1 || info.Tags[0] != "/ViaBTC/Mined by someone/" {
+      t.Errorf("height %d: tags %q", height, info.Tags)
+    }
+    if !bytes.Equal(info.WitnessCommitment, commitment) || len(info.Addresses) != 0 {
+      t.Errorf("height %d: commitment %x addresses %v", height, info.WitnessCommitment, info.Addresses)
+    }
+  }
+  //a non-minimal or negative number is not a height
+  for _, script := range [][]byte{{0x02, 0x05, 0x00, 0xaa}, {0x01, 0x85, 0xaa}, {0x4f}, {}} {
+    tx := chaintest.Tx([]block.Input{chaintest.Coinbase(script)}, chaintest.Out(0, chaintest.OpTrue))
+    if info := coinbase.Analyze(&tx); info.Height != -1 {
+      t.Errorf("script %x read as height %d", script, info.Height)
+    }
+  }
+}
+
+func TestAnalyzeSegwitPayout(t *testing.T) {
+  //the BIP173 pay to witness public key hash example, beside a witness commitment
+  p2wpkh := chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+  commitment := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, bytes.Repeat([]byte{0xab}, 32)...)
+  tx := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(481824, "/BTC.COM/"))},
+    chaintest.Out(chaintest.Subsidy, p2wpkh), chaintest.Out(0, commitment))
+  info := coinbase.Analyze(&tx)
+  if len(info.Addresses) != 1 || info.Addresses[0] != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+    t.Errorf("pays %v, want the bech32 address of the witness program", info.Addresses)
+  }
+  if info.Value != chaintest.Subsidy || len(info.WitnessCommitment) != 32 {
+    t.Errorf("pays %d with commitment %x", info.Value, info.WitnessCommitment)
+  }
+}
+
+const poolsJSON = `{
+  "coinbase_tags": {
+    "/ViaBTC/": {"name": "ViaBTC", "link": "https://viabtc.com"},
+    "Mined by": {"name": "Generic"},
+    "Mined by AntPool": {"name": "AntPool"}
+  },
+  "payout_addresses": {
+    "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa": {"name": "Satoshi"},
+    "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4": {"name": "Segwit"}
+  }
+}`
+
+func TestIdentify(t *testing.T) {
+  pools, err := coinbase.ReadPools(bytes.NewReader([]byte(poolsJSON)))
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    script string
+    pay []byte
+    pool string
+  }{
+    {"/ViaBTC/", chaintest.OpTrue, "ViaBTC"},
+    //the longest matching tag wins
+    {"Mined by AntPool bj", chaintest.OpTrue, "AntPool"},
+    {"Mined by me", chaintest.OpTrue, "Generic"},
+    //a payout address wins over a tag
+    {"/ViaBTC/", chaintest.Genesis().Transactions[0].Outputs[0].ChallengeScript, "Satoshi"},
+    {"/ViaBTC/", chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6"), "Segwit"},
+    {"solo", chaintest.OpTrue, coinbase.Unknown},
+  }
+  for _, test := range tests {
+    tx := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(1000, test.script))}, chaintest.Out(1, test.pay))
+    info := coinbase.Analyze(&tx)
+    pool, ok := pools.Identify(&info)
+    if pool.Name != test.pool || ok != (test.pool != coinbase.Unknown) {
+      t.Errorf("%q identified as %q, %v; want %q", test.script, pool.Name, ok, test.pool)
+    }
+  }
+  if _, err := coinbase.ReadPools(bytes.NewReader([]byte("{"))); err == nil {
+    t.Errorf("truncated mapping read without error")
+  }
+}
+
+func TestDistribute(t *testing.T) {
+  //Monday 2024-01-01 00:00 UTC
+  const monday = 1704067200
+  reports := []coinbase.BlockReport{
+    {Height: 2015, Time: monday - 1, Pool: "A"},
+    {Height: 2016, Time: monday + 10, Pool: "A"},
+    //a timestamp earlier than its parent's still counts in its own week
+    {Height: 2017, Time: monday - 5, Pool: "B"},
+    {Height: 2018, Time: monday + 7 * 86400, Pool: "B"},
+    {Height: 2019, Time: monday + 20, Pool: "B"},
+  }
+  weeks, err := coinbase.Distribute(reports, "week")
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := []struct {
+    period string
+    blocks int
+    top string
+  }{{"2023-12-25", 2, "A"}, {"2024-01-01", 2, "A"}, {"2024-01-08", 1, "B"}}
+  if len(weeks) != len(want) {
+    t.Fatalf("weeks %+v", weeks)
+  }
+  for i, w := range want {
+    if weeks[i].Period != w.period || weeks[i].Blocks != w.blocks || weeks[i].Pools[0].Pool != w.top {
+      t.Errorf("week %d is %+v, want %s with %d blocks led by %s", i, weeks[i], w.period, w.blocks, w.top)
+    }
+  }
+  if weeks[1].Pools[0].Share != 0.5 {
+    t.Errorf("share %v, want 0.5", weeks[1].Pools[0].Share)
+  }
+
+  retargets, err := coinbase.Distribute(reports, "retarget")
+  if err != nil || len(retargets) != 2 || retargets[0].Period != "0" || retargets[1].Period != "2016" || retargets[1].Blocks != 4 {
+    t.Fatalf("retarget periods %+v, %v", retargets, err)
+  }
+  if _, err := coinbase.Distribute(reports, "fortnight"); err == nil {
+    t.Errorf("unknown period accepted")
+  }
+}
@@ -0,0 +1,193 @@
+package coinbase
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//Unknown names the pool of blocks no tag or address identifies
+const Unknown = "Unknown"
+
+//Pool is a mining pool
+type Pool struct {
+  Name string `json:"name"`
+  Link string `json:"link,omitempty"`
+}
+
+//Pools maps coinbase tags and payout addresses to the pools that use them. The file format is that of the widely
+//shared pools.json: {"coinbase_tags": {"/ViaBTC/": {"name": "ViaBTC", "link": "..."}}, "payout_addresses": {...}}.
+type Pools struct {
+  Tags map[string]Pool `json:"coinbase_tags"`
+  Addresses map[string]Pool `json:"payout_addresses"`
+
+  //tags holds the keys of Tags longest first, so the most specific tag wins and matching does not depend on map order
+  tags []string
+}
+
+//ReadPools reads a pool mapping in the pools.json format
+func ReadPools(r io.Reader) (*Pools, error) {
+  p := &Pools{}
+  err := json.NewDecoder(r).Decode(p)
+  if err != nil {
+    return nil, fmt.Errorf("coinbase: reading pool mapping: %w", err)
+  }
+  for tag := range p.Tags {
+    if tag != "" {
+      p.tags = append(p.tags, tag)
+    }
+  }
+  sort.Slice(p.tags, func(i, j int) bool {
+    if len(p.tags[i]) != len(p.tags[j]) {
+      return len(p.tags[i]) > len(p.tags[j])
+    }
+    return p.tags[i] < p.tags[j]
+  })
+  return p, nil
+}
+
+//LoadPools reads the pool mapping file at path
+func LoadPools(path string) (*Pools, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  return ReadPools(f)
+}
+
+//Identify returns the pool that mined the block whose coinbase is described by info. A payout address identifies the
+//pool before a tag does, as tags are easily copied. Blocks nothing identifies belong to Unknown.
+func (p *Pools) Identify(info *Info) (Pool, bool) {
+  if p != nil {
+    for _, a := range info.Addresses {
+      if pool, ok := p.Addresses[a]; ok {
+        return pool, true
+      }
+    }
+    s := string(info.Script)
+    for _, tag := range p.tags {
+      if strings.Contains(s, tag) {
+        return p.Tags[tag], true
+      }
+    }
+  }
+  return Pool{Name: Unknown}, false
+}
+
+//BlockReport describes the coinbase of a main chain block
+type BlockReport struct {
+  Height int `json:"height"`
+  BlockHash block.Hash `json:"block_hash"`
+  Time uint32 `json:"time"`
+  //CoinbaseHeight is the height the coinbase script starts with, or -1
+  CoinbaseHeight int64 `json:"coinbase_height"`
+  //BIP34 reports whether the coinbase commits to the block's height
+  BIP34 bool `json:"bip34"`
+  ExtraNonce string `json:"extranonce,omitempty"`
+  Tags []string `json:"tags"`
+  WitnessCommitment string `json:"witness_commitment,omitempty"`
+  Addresses []string `json:"addresses"`
+  Value uint64 `json:"value"`
+  Pool string `json:"pool"`
+}
+
+//Report describes the coinbase of the block b at height, naming its pool from pools, which may be nil
+func Report(height int, b *block.Block, pools *Pools) (BlockReport) {
+  r := BlockReport{Height: height, BlockHash: b.BlockHash, Time: b.Header.TimeStamp, CoinbaseHeight: -1, Pool: Unknown}
+  if len(b.Transactions) == 0 || !IsCoinbase(&b.Transactions[0]) {
+    return r
+  }
+  info := Analyze(&b.Transactions[0])
+  r.CoinbaseHeight = info.Height
+  r.BIP34 = info.Height == int64(height)
+  r.ExtraNonce = fmt.Sprintf("%x", info.ExtraNonce)
+  r.Tags = info.Tags
+  r.WitnessCommitment = fmt.Sprintf("%x", info.WitnessCommitment)
+  r.Addresses = info.Addresses
+  r.Value = info.Value
+  pool, _ := pools.Identify(&info)
+  r.Pool = pool.Name
+  return r
+}
+
+//Periods name the periods Distribute can group blocks by
+var Periods = []string{"day", "week", "month", "retarget"}
+
+//retargetInterval is the number of blocks between difficulty adjustments
+const retargetInterval = 2016
+
+//periodStart returns the label of the period holding r: the UTC date a day or week starts on, the month, or the height
+//a difficulty period starts at
+func periodStart(period string, r *BlockReport) (string, error) {
+  t := time.Unix(int64(r.Time), 0).UTC()
+  switch period {
+  case "day":
+    return t.Format("2006-01-02"), nil
+  case "week":
+    //weeks start on Monday
+    return t.AddDate(0, 0, -(int(t.Weekday()) + 6) % 7).Format("2006-01-02"), nil
+  case "month":
+    return t.Format("2006-01"), nil
+  case "retarget":
+    return fmt.Sprint(r.Height / retargetInterval * retargetInterval), nil
+  }
+  return "", fmt.Errorf("coinbase: unknown period %q", period)
+}
+
+//PoolShare is the number of blocks a pool mined in a period
+type PoolShare struct {
+  Pool string `json:"pool"`
+  Blocks int `json:"blocks"`
+  Share float64 `json:"share"`
+}
+
+//Distribution is the share of blocks each pool mined in a period, most blocks first
+type Distribution struct {
+  Period string `json:"period"`
+  Blocks int `json:"blocks"`
+  Pools []PoolShare `json:"pools"`
+}
+
+//Distribute groups reports into periods, ordered by the lowest height each holds. Timestamps are not in height
+//order, so a block is counted in the period its own time falls in.
+func Distribute(reports []BlockReport, period string) ([]Distribution, error) {
+  sorted := append([]BlockReport(nil), reports...)
+  sort.Slice(sorted, func(i, j int) bool {
+    return sorted[i].Height < sorted[j].Height
+  })
+  var out []Distribution
+  index := make(map[string]int)
+  counts := make(map[string]map[string]int)
+  for i := range sorted {
+    label, err := periodStart(period, &sorted[i])
+    if err != nil {
+      return nil, err
+    }
+    if _, ok := index[label]; !ok {
+      index[label] = len(out)
+      out = append(out, Distribution{Period: label})
+      counts[label] = make(map[string]int)
+    }
+    out[index[label]].Blocks++
+    counts[label][sorted[i].Pool]++
+  }
+  for i := range out {
+    d := &out[i]
+    for pool, n := range counts[d.Period] {
+      d.Pools = append(d.Pools, PoolShare{pool, n, float64(n) / float64(d.Blocks)})
+    }
+    sort.Slice(d.Pools, func(i, j int) bool {
+      if d.Pools[i].Blocks != d.Pools[j].Blocks {
+        return d.Pools[i].Blocks > d.Pools[j].Blocks
+      }
+      return d.Pools[i].Pool < d.Pools[j].Pool
+    })
+  }
+  return out, nil
+}
@@ -0,0 +1,766 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "os/signal"
+    "sort"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chainindex"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/coinbase"
+    "github.com/tgebhart/goparsebtc/consensus"
+    "github.com/tgebhart/goparsebtc/follow"
+    "github.com/tgebhart/goparsebtc/graphexport"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/scriptcheck"
+    "github.com/tgebhart/goparsebtc/supply"
+    "github.com/tgebhart/goparsebtc/postgresloader"
+)
+
+//errNotFound is returned when an inspected block or transaction is not on the main chain
+var errNotFound = errors.New("not found on the main chain")
+
+//blkFileName returns the name bitcoind gives the n'th block file
+func blkFileName(n int) (string) {
+  return fmt.Sprintf("blk%05d.dat", n)
+}
+
+func runIndex(args []string) (error) {
+  var o options
+  var files, report string
+  var recover bool
+  fs := o.newFlagSet("index", "[flags]", "Scans a range of blk files, links their blocks into the main chain and writes\nthe chain, tip first, to the reference file used by every other command.")
+  o.addDataFlags(fs)
+  o.addFormatFlags(fs)
+  fs.StringVar(&files, "files", "0", "range of blk file numbers to scan as FIRST:LAST")
+  fs.BoolVar(&recover, "recover", false, "skip damaged blocks instead of stopping at the first one")
+  fs.StringVar(&report, "report", "", "write the damaged stretches of the blk files to this file in -format")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  start, finish, err := parseRange(files)
+  if err != nil || finish < 0 {
+    return o.usageError(fs, fmt.Errorf("bad file range %q", files))
+  }
+
+  options := blockchainbuilder.DefaultDecodeOptions
+  options.Recover = recover
+  var blockCounter = 0
+  chain := blockchainbuilder.NewBlockchain()
+  var key block.Hash
+  var corruptions []blockchainbuilder.Corruption
+
+  for j := start; j <= finish; j++ {
+    pathEndpoint := blkFileName(j)
+    path := o.datadir + pathEndpoint
+
+    file, err := os.Open(path)
+    if err != nil {
+      return err
+    }
+    slog.Info("scanning block file", logging.KeyFile, path)
+    decoder := blockchainbuilder.NewDecoder(file, options)
+    var lengthRead = 0
+    for {
+      Block := block.Block{}
+
+      err = decoder.Decode(&Block)
+      if err == io.EOF {
+        break
+      }
+      if err == blockchainbuilder.ErrPartialBlock {
+        //bitcoind is still writing the block, or stopped before finishing it
+        slog.Warn("stopping at incomplete block", logging.KeyFile, path, logging.KeyOffset, decoder.Offset)
+        break
+      }
+      if err != nil {
+        file.Close()
+        return fmt.Errorf("%s at byte %d: %w", path, decoder.Offset, err)
+      }
+      key = Block.HashBlock.BlockHash
+      Block.HashBlock.FileEndpoint = pathEndpoint
+      Block.HashBlock.RawBlockNumber = blockCounter
+      Block.HashBlock.LengthRead = lengthRead
+
+      //Add HashBlock to Blockchain hashmap
+      chain.BlockMap[Block.HashBlock.BlockHash] = Block.HashBlock
+
+      lengthRead += int(Block.BlockLength)
+      blockCounter++
+    }
+    file.Close()
+    corruptions = append(corruptions, decoder.Corruptions...)
+  }
+
+  if report != "" {
+    f, err := os.Create(report)
+    if err != nil {
+      return err
+    }
+    err = writeCorruptionReport(f, o.format, corruptions)
+    if err != nil {
+      f.Close()
+      return err
+    }
+    err = f.Close()
+    if err != nil {
+      return err
+    }
+  }
+  return blockchainbuilder.WriteMainChainToFile(chain, key, strings.TrimSuffix(o.reference, ".csv"))
+}
+
+//readReference reads the reference file named by the options
+func (o *options) readReference() (*blockchainreader.ReadChain, error) {
+  readchain := blockchainreader.NewReadChain()
+  err := blockchainreader.ReadReferenceFile(readchain, o.reference)
+  if err != nil {
+    return nil, err
+  }
+  return readchain, nil
+}
+
+func runExport(args []string) (error) {
+  var o options
+  var to, dsn, out string
+  fs := o.newFlagSet("export", "-to postgres|neo4j [flags]", "Exports the indexed main chain. PostgreSQL exports resume after the highest\nloaded block; Neo4j exports write neo4j-admin import files to -out.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  fs.StringVar(&to, "to", "", "export target: postgres or neo4j")
+  fs.StringVar(&dsn, "dsn", os.Getenv(postgresloader.DSNEnvironment), "PostgreSQL connection string (default $" + postgresloader.DSNEnvironment + ")")
+  fs.StringVar(&out, "out", "graph", "directory for the Neo4j import files")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  switch to {
+  case "postgres":
+    if o.heights != "" {
+      return o.usageError(fs, errors.New("-heights does not apply to postgres exports, which resume after the highest loaded block"))
+    }
+    loader, err := postgresloader.NewLoader(dsn)
+    if err != nil {
+      return err
+    }
+    defer loader.Close()
+    return loader.LoadChain(readchain, o.datadir)
+  case "neo4j":
+    exporter, err := graphexport.NewExporter(out)
+    if err != nil {
+      return err
+    }
+    err = exporter.ExportChain(readchain, o.datadir, o.from, o.to)
+    if err != nil {
+      exporter.Close()
+      return err
+    }
+    err = exporter.Close()
+    if err != nil {
+      return err
+    }
+    fmt.Println("neo4j-admin", strings.Join(exporter.ImportArguments(), " "))
+    return nil
+  }
+  return o.usageError(fs, fmt.Errorf("unknown export target %q", to))
+}
+
+func runInspectBlock(args []string) (error) {
+  var o options
+  var height int
+  fs := o.newFlagSet("inspect-block", "[flags] [block hash]", "Prints a main chain block, selected by hash or by -height.")
+  o.addDataFlags(fs)
+  o.addFormatFlags(fs)
+  fs.IntVar(&height, "height", -1, "height of the block to print")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  if (fs.Arg(0) == "") == (height < 0) {
+    return o.usageError(fs, errors.New("give exactly one of a block hash or -height"))
+  }
+  var hash block.Hash
+  if fs.Arg(0) != "" {
+    hash, err = block.ParseHash(fs.Arg(0))
+    if err != nil {
+      return o.usageError(fs, fmt.Errorf("bad block hash %q: %v", fs.Arg(0), err))
+    }
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  for _, ib := range blockchainreader.IndexByHeight(readchain) {
+    if ib.Height != height && ib.BlockHash != hash {
+      continue
+    }
+    var found *block.Block
+    err = blockchainreader.WalkChain(readchain, o.datadir, ib.Height, ib.Height, func(_ blockchainreader.IndexedBlock, b *block.Block) (error) {
+      found = b
+      return nil
+    })
+    if err != nil {
+      return err
+    }
+    return writeBlock(os.Stdout, o.format, newBlockView(ib.Height, found))
+  }
+  return errNotFound
+}
+
+func runInspectTx(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("inspect-tx", "[flags] <txid>", "Prints a main chain transaction. Without a transaction index the blocks in\n-heights are searched in order, so narrowing the range speeds up the search.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  prevouts := fs.Bool("prevouts", false, "replay the main chain from the genesis block with a UTXO set, so the output each input spends is known")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  txid, err := block.ParseHash(fs.Arg(0))
+  if err != nil {
+    return o.usageError(fs, errors.New("a 64 character txid is required"))
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var found *transactionView
+  from := o.from
+  var finder *prevoutFinder
+  var state *chainstate.State
+  if *prevouts {
+    finder = &prevoutFinder{txid: txid}
+    state = chainstate.New(finder)
+    from = 0
+  }
+  err = blockchainreader.WalkChain(readchain, o.datadir, from, o.to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    var scripts [][]byte
+    if state != nil {
+      err := state.ConnectBlock(ib.Height, b)
+      if err != nil {
+        return err
+      }
+      if !o.inRange(ib.Height) {
+        return nil
+      }
+      scripts = finder.scripts
+    }
+    for t := range b.Transactions {
+      if b.Transactions[t].TransactionHash == txid {
+        v := newTransactionView(&b.Transactions[t], scripts)
+        v.BlockHeight = ib.Height
+        v.BlockHash = b.BlockHash.String()
+        found = &v
+        return blockchainreader.ErrStopWalk
+      }
+    }
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+  if found == nil {
+    return errNotFound
+  }
+  return writeTransaction(os.Stdout, o.format, found)
+}
+
+//prevoutFinder is a chainstate.Index keeping the output scripts the inputs of one transaction spend, taken from the
+//undo data of the block that holds it
+type prevoutFinder struct {
+  txid block.Hash
+  scripts [][]byte
+}
+
+func (f *prevoutFinder) ConnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  //the coinbase spends nothing, so the spends of each later transaction follow those of the one before it
+  n := 0
+  for t := 1; t < len(b.Transactions); t++ {
+    tx := &b.Transactions[t]
+    if tx.TransactionHash == f.txid {
+      f.scripts = make([][]byte, len(tx.Inputs))
+      for i := range tx.Inputs {
+        f.scripts[i] = undo.Spent[n + i].Coin.Script
+      }
+      return nil
+    }
+    n += len(tx.Inputs)
+  }
+  return nil
+}
+
+func (f *prevoutFinder) DisconnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  return nil
+}
+
+//walkFunc is blockchainreader.WalkChain or WalkBlocks
+type walkFunc func(*blockchainreader.ReadChain, string, int, int, func(blockchainreader.IndexedBlock, *block.Block) error) (error)
+
+//blockCheck is a unit of verification work handed to the worker pool
+type blockCheck struct {
+  height int
+  block *block.Block
+}
+
+//forEachBlock walks the selected heights with walk on a single reader while fn runs on o.workers goroutines
+func (o *options) forEachBlock(readchain *blockchainreader.ReadChain, walk walkFunc, fn func(height int, b *block.Block)) (error) {
+  work := make(chan blockCheck, o.workers * 2)
+  var wg sync.WaitGroup
+  for w := 0; w < o.workers; w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for c := range work {
+        fn(c.height, c.block)
+      }
+    }()
+  }
+  err := walk(readchain, o.datadir, o.from, o.to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    work <- blockCheck{height: ib.Height, block: b}
+    return nil
+  })
+  close(work)
+  wg.Wait()
+  return err
+}
+
+func runVerify(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("verify", "[flags]", "Re-parses the main chain and checks each block's hash against the reference\nfile, its merkle root against its transactions and its link to the previous block.\nExits with status 1 when any block fails.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  expected := make(map[int]block.Hash)
+  for _, ib := range blockchainreader.IndexByHeight(readchain) {
+    expected[ib.Height] = ib.BlockHash
+  }
+
+  var mu sync.Mutex
+  var failures []verifyFailure
+  checked, failed := 0, 0
+  err = o.forEachBlock(readchain, blockchainreader.WalkBlocks, func(height int, b *block.Block) {
+    var found []verifyFailure
+    blockHash := b.BlockHash.String()
+    if b.BlockHash != expected[height] {
+      found = append(found, verifyFailure{Height: height, BlockHash: blockHash, Rule: "block-hash", Detail: "reference file has " + expected[height].String()})
+    }
+    if previous, ok := expected[height-1]; ok && b.Header.PreviousBlockHash != previous {
+      found = append(found, verifyFailure{Height: height, BlockHash: blockHash, Rule: "previous-hash", Detail: "does not link to block " + previous.String()})
+    }
+    hashes := make([]block.Hash, len(b.Transactions))
+    for t := range b.Transactions {
+      hashes[t] = b.Transactions[t].TransactionHash
+    }
+    root, err := btchashing.ComputeMerkleRoot(hashes)
+    if err != nil {
+      found = append(found, verifyFailure{Height: height, BlockHash: blockHash, Rule: "merkle-root", Detail: err.Error()})
+    } else if root != b.Header.MerkleRoot {
+      found = append(found, verifyFailure{Height: height, BlockHash: blockHash, Rule: "merkle-root", Detail: "computed " + root.String()})
+    }
+    mu.Lock()
+    checked++
+    if len(found) > 0 {
+      failed++
+    }
+    failures = append(failures, found...)
+    mu.Unlock()
+  })
+  if err != nil {
+    return err
+  }
+
+  err = writeVerifyReport(os.Stdout, o.format, checked, failures)
+  if err != nil {
+    return err
+  }
+  if failed > 0 {
+    return fmt.Errorf("%d of %d blocks failed verification", failed, checked)
+  }
+  return nil
+}
+
+func runVerifyScripts(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("verify-scripts", "[flags]", "Replays the main chain from the genesis block with a UTXO set and runs the scripts of\nevery input of the blocks in -heights against the output it spends, under the rules\nbitcoind applied at that height, printing the result for each input. Exits with\nstatus 1 when any input fails.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  failures := fs.Bool("failures", false, "only print inputs that failed")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var rows []scriptResultRow
+  checker := &scriptcheck.Checker{Check: o.inRange, Workers: o.workers, Report: func(r scriptcheck.Result) {
+    if r.Err != nil || !*failures {
+      rows = append(rows, newScriptResultRow(r))
+    }
+  }}
+  state := chainstate.New(checker)
+  err = blockchainreader.WalkChain(readchain, o.datadir, 0, o.to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    return state.ConnectBlock(ib.Height, b)
+  })
+  if err != nil {
+    return err
+  }
+
+  err = writeScriptReport(os.Stdout, o.format, checker.Inputs, rows)
+  if err != nil {
+    return err
+  }
+  if checker.Failed > 0 {
+    return fmt.Errorf("%d of %d inputs failed script verification", checker.Failed, checker.Inputs)
+  }
+  return nil
+}
+
+func runValidate(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("validate", "[flags]", "Replays the main chain from the genesis block with a UTXO set and applies the consensus\nrules to each block in -heights: size and weight, signature operations, the coinbase,\ndouble spends, value conservation, lock times and sequence locks, and scripts. Prints\nwhether each block passed and the rules it broke. Exits with status 1 when any fails.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  failures := fs.Bool("failures", false, "only print blocks that broke a rule")
+  noScripts := fs.Bool("no-scripts", false, "skip script verification")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var results []consensus.Result
+  v := consensus.NewValidator(chainstate.New())
+  v.Check = o.inRange
+  v.SkipScripts = *noScripts
+  v.Workers = o.workers
+  v.Report = func(r consensus.Result) {
+    if !r.Valid() || !*failures {
+      results = append(results, r)
+    }
+  }
+  err = blockchainreader.WalkChain(readchain, o.datadir, 0, o.to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    return v.ConnectBlock(ib.Height, b)
+  })
+  if err != nil {
+    return err
+  }
+
+  err = writeValidationReport(os.Stdout, o.format, v.Blocks, results)
+  if err != nil {
+    return err
+  }
+  if v.Failed > 0 {
+    return fmt.Errorf("%d of %d blocks failed validation", v.Failed, v.Blocks)
+  }
+  return nil
+}
+
+func runStats(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("stats", "[flags]", "Summarizes the main chain blocks in -heights: counts of blocks, transactions,\ninputs and outputs, total output value and output script types.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var mu sync.Mutex
+  s := newChainStats()
+  err = o.forEachBlock(readchain, blockchainreader.WalkChain, func(height int, b *block.Block) {
+    bs := newChainStats()
+    bs.addBlock(height, b)
+    mu.Lock()
+    s.merge(bs)
+    mu.Unlock()
+  })
+  if err != nil {
+    return err
+  }
+  return writeStats(os.Stdout, o.format, s)
+}
+
+func runCoinbase(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("coinbase", "[flags]", "Reads the coinbase of each main chain block in -heights: the BIP34 height, extranonce,\nminer tags, witness commitment and payout addresses, and the pool that mined it\naccording to -pools. With -period, prints the share of blocks each pool mined per\nperiod instead.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  poolsFile := fs.String("pools", "", "pool mapping file in the pools.json format, mapping coinbase tags and payout addresses to pools")
+  period := fs.String("period", "", "report pool shares per period: " + strings.Join(coinbase.Periods, ", "))
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  if *period != "" && !contains(coinbase.Periods, *period) {
+    return o.usageError(fs, fmt.Errorf("unknown period %q", *period))
+  }
+  var pools *coinbase.Pools
+  if *poolsFile != "" {
+    pools, err = coinbase.LoadPools(*poolsFile)
+    if err != nil {
+      return err
+    }
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var mu sync.Mutex
+  var reports []coinbase.BlockReport
+  err = o.forEachBlock(readchain, blockchainreader.WalkChain, func(height int, b *block.Block) {
+    r := coinbase.Report(height, b, pools)
+    mu.Lock()
+    reports = append(reports, r)
+    mu.Unlock()
+  })
+  if err != nil {
+    return err
+  }
+  if *period != "" {
+    distribution, err := coinbase.Distribute(reports, *period)
+    if err != nil {
+      return err
+    }
+    return writeDistribution(os.Stdout, o.format, distribution)
+  }
+  sort.Slice(reports, func(i, j int) bool {
+    return reports[i].Height < reports[j].Height
+  })
+  return writeCoinbaseReports(os.Stdout, o.format, reports)
+}
+
+//contains reports whether list holds s
+func contains(list []string, s string) (bool) {
+  for _, v := range list {
+    if v == s {
+      return true
+    }
+  }
+  return false
+}
+
+func runSupply(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("supply", "[flags]", "Replays the main chain from the genesis block, accounting for the coins each block\nissued and made unspendable, and prints the supply of the blocks in -heights, or of\nthe tip without it. Circulating supply leaves out the genesis coinbase, OP_RETURN\noutputs and outputs to burn addresses.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  underClaimed := fs.Bool("underclaimed", false, "only print blocks whose coinbase claimed less than the subsidy and fees")
+  schedule := fs.Bool("schedule", false, "print the halving schedule of the network and exit")
+  burn := fs.String("burn-addresses", "", "comma separated addresses to count as unspendable besides " + strings.Join(supply.BurnAddresses, ", "))
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  if *schedule {
+    return writeSchedule(os.Stdout, o.format, supply.Schedule())
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  tracker := supply.NewTracker()
+  for _, a := range strings.Split(*burn, ",") {
+    if a != "" {
+      tracker.BurnAddresses[a] = true
+    }
+  }
+  state := chainstate.New(tracker)
+  var rows []supply.BlockSupply
+  err = blockchainreader.WalkChain(readchain, o.datadir, 0, o.to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    err := state.ConnectBlock(ib.Height, b)
+    if err != nil {
+      return err
+    }
+    row, _ := tracker.At(ib.Height)
+    if o.heights != "" && o.inRange(ib.Height) && (!*underClaimed || row.Unclaimed > 0) {
+      rows = append(rows, row)
+    }
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+  if o.heights == "" && *underClaimed {
+    rows = tracker.UnderClaimed()
+  } else if tip, ok := tracker.At(tracker.Height()); o.heights == "" && ok {
+    rows = []supply.BlockSupply{tip}
+  }
+  return writeSupply(os.Stdout, o.format, rows)
+}
+
+func runNullData(args []string) (error) {
+  var o options
+  fs := o.newFlagSet("nulldata", "[flags]", "Exports the data carried by the OP_RETURN outputs of the main chain blocks in\n-heights, in height order, tagged with the protocol it belongs to where known: omni,\ncounterparty, opentimestamps or runes.")
+  o.addDataFlags(fs)
+  o.addRangeFlags(fs)
+  o.addFormatFlags(fs)
+  o.addWorkerFlags(fs)
+  inscriptions := fs.Bool("inscriptions", false, "also export ordinals inscriptions found in input witnesses")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  readchain, err := o.readReference()
+  if err != nil {
+    return err
+  }
+
+  var mu sync.Mutex
+  var rows []nullDataRow
+  err = o.forEachBlock(readchain, blockchainreader.WalkChain, func(height int, b *block.Block) {
+    found := nullDataRows(height, b, *inscriptions)
+    mu.Lock()
+    rows = append(rows, found...)
+    mu.Unlock()
+  })
+  if err != nil {
+    return err
+  }
+  //blocks finish in any order on the workers; within a block the rows are already in order
+  sort.SliceStable(rows, func(i, j int) bool {
+    if rows[i].Height != rows[j].Height {
+      return rows[i].Height < rows[j].Height
+    }
+    return rows[i].Position < rows[j].Position
+  })
+  return writeNullData(os.Stdout, o.format, rows)
+}
+
+func runFollow(args []string) (error) {
+  var o options
+  var interval time.Duration
+  fs := o.newFlagSet("follow", "[flags]", "Reads every blk file, then follows the newest as bitcoind appends to it. The main\nchain is the branch with the most work, so reorgs are followed. Whenever it catches\nup the reference file is rewritten, and every later change of the tip is written\nto stdout as an event in -format. Runs until interrupted.")
+  o.addDataFlags(fs)
+  o.addFormatFlags(fs)
+  fs.DurationVar(&interval, "interval", blockchainbuilder.DefaultTailInterval, "how often to look for new blocks")
+  indexes := fs.String("indexes", "", "comma separated indexes to keep in memory alongside the UTXO set, rolled back across reorgs: address, tx, or utxo alone")
+  undoDir := fs.String("undo-dir", "", "directory to keep undo data in instead of memory")
+  err := o.parse(fs, args)
+  if err != nil {
+    return err
+  }
+  state, err := newChainState(*indexes, *undoDir)
+  if err != nil {
+    return o.usageError(fs, err)
+  }
+
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+  defer stop()
+  f := follow.New(o.datadir)
+  f.Interval = interval
+  if state != nil {
+    f.Stores = append(f.Stores, state)
+  }
+  header := true
+  f.OnEvent = func(e follow.Event) (error) {
+    err := writeEvent(os.Stdout, o.format, e, header)
+    header = false
+    return err
+  }
+  f.OnCaughtUp = func(tip *chainindex.Node) (error) {
+    slog.Info("caught up", logging.KeyHeight, tip.Height, logging.KeyBlockHash, tip.Hash())
+    if state != nil {
+      slog.Info("chain state", "coins", state.UTXO.Len(), "value", state.UTXO.Total())
+    }
+    return writeReference(f.Index, o.reference)
+  }
+  err = f.Run(ctx)
+  if ctx.Err() == nil {
+    return err
+  }
+  //interrupted: keep what was read so far
+  if f.Index.Tip() == nil {
+    return nil
+  }
+  return writeReference(f.Index, o.reference)
+}
+
+//writeReference replaces the reference file with the main chain of index. The chain is written to a temporary file
+//first so commands reading the reference never see it half written.
+func writeReference(index *chainindex.Index, reference string) (error) {
+  tmp := strings.TrimSuffix(reference, ".csv") + ".tmp"
+  err := blockchainbuilder.WriteMainChainToFile(follow.Blockchain(index), index.Tip().Hash(), tmp)
+  if err != nil {
+    return err
+  }
+  return os.Rename(tmp + ".csv", reference)
+}
+
+//newChainState returns the chain state follow keeps for -indexes, or nil when no index is asked for
+func newChainState(indexes string, undoDir string) (*chainstate.State, error) {
+  if indexes == "" {
+    return nil, nil
+  }
+  state := chainstate.New()
+  for _, name := range strings.Split(indexes, ",") {
+    switch name {
+    case "utxo":
+    case "address":
+      state.Indexes = append(state.Indexes, chainstate.NewAddressIndex())
+    case "tx":
+      state.Indexes = append(state.Indexes, chainstate.NewTxIndex())
+    default:
+      return nil, fmt.Errorf("unknown index %q", name)
+    }
+  }
+  if undoDir != "" {
+    err := os.MkdirAll(undoDir, 0755)
+    if err != nil {
+      return nil, err
+    }
+    state.Undo = chainstate.DirUndo(undoDir)
+  }
+  return state, nil
+}
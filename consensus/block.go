@@ -0,0 +1,274 @@
+package consensus
+
+import (
+    "bytes"
+    "fmt"
+    "math/big"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/supply"
+)
+
+const (
+  //MaxBlockWeight is the most a block may weigh, where bytes outside witnesses weigh WitnessScaleFactor and witness
+  //bytes weigh one
+  MaxBlockWeight = 4000000
+  WitnessScaleFactor = 4
+  //MaxBlockSigOpsCost is the most signature operations a block may cost, where legacy and pay to script hash
+  //operations cost WitnessScaleFactor and witness operations cost one
+  MaxBlockSigOpsCost = 80000
+  //CoinbaseMaturity is how many blocks must be mined on a coinbase before its outputs can be spent
+  CoinbaseMaturity = 100
+  //MaxMoney is the most satoshis an output, or the outputs or inputs of a transaction together, may hold
+  MaxMoney = 21000000 * supply.Coin
+  //MedianTimeSpan is how many blocks the median time past is taken over
+  MedianTimeSpan = 11
+  //BIP34ImpliesBIP30Limit is the first height at which a coinbase may repeat the height prefix of one from before
+  //BIP34, so BIP30 is enforced again from there although BIP34 otherwise makes it redundant
+  BIP34ImpliesBIP30Limit = 1983702
+)
+
+//witnessCommitmentHeader starts the coinbase output committing to a block's witnesses: OP_RETURN, a 36 byte push and
+//BIP141's tag
+var witnessCommitmentHeader = []byte{script.OPRETURN, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+//Violation is a consensus rule a block breaks
+type Violation struct {
+  //Rule is the reason bitcoind rejects a block breaking the rule, such as bad-cb-amount
+  Rule string `json:"rule"`
+  //TxID is the transaction breaking the rule, zero when the rule is about the whole block
+  TxID block.Hash `json:"txid"`
+  //Input is the input breaking the rule, -1 when the rule is about a whole transaction or block
+  Input int `json:"input"`
+  Detail string `json:"detail,omitempty"`
+}
+
+//report collects the violations of one block, each rule once for the block or any one transaction or input
+type report []Violation
+
+func (r *report) add(txid block.Hash, input int, rule string, format string, args ...interface{}) {
+  for _, v := range *r {
+    if v.Rule == rule && v.TxID == txid && v.Input == input {
+      return
+    }
+  }
+  *r = append(*r, Violation{rule, txid, input, fmt.Sprintf(format, args...)})
+}
+
+//IsCoinbase reports whether tx is a coinbase: a single input spending the null outpoint
+func IsCoinbase(tx *block.Transaction) (bool) {
+  return len(tx.Inputs) == 1 && isNull(&tx.Inputs[0])
+}
+
+func isNull(in *block.Input) (bool) {
+  return in.TransactionHash.IsZero() && in.TransactionIndex == 0xffffffff
+}
+
+//CheckTransaction applies the rules a transaction must meet whatever chain it is in, as bitcoind's CheckTransaction
+//does, stopping at the first it breaks
+func CheckTransaction(tx *block.Transaction) ([]Violation) {
+  var r report
+  checkTransaction(&r, tx)
+  return r
+}
+
+func checkTransaction(r *report, tx *block.Transaction) {
+  id := tx.TransactionHash
+  if len(tx.Inputs) == 0 {
+    r.add(id, -1, "bad-txns-vin-empty", "no inputs")
+    return
+  }
+  if len(tx.Outputs) == 0 {
+    r.add(id, -1, "bad-txns-vout-empty", "no outputs")
+    return
+  }
+  if size := len(blockserializer.SerializeTransactionNoWitness(tx)); size * WitnessScaleFactor > MaxBlockWeight {
+    r.add(id, -1, "bad-txns-oversize", "%d bytes without witnesses", size)
+    return
+  }
+  var total uint64
+  for o := range tx.Outputs {
+    value := tx.Outputs[o].OutputValue
+    if int64(value) < 0 {
+      r.add(id, -1, "bad-txns-vout-negative", "output %d pays %d", o, int64(value))
+      return
+    }
+    if value > MaxMoney {
+      r.add(id, -1, "bad-txns-vout-toolarge", "output %d pays %d", o, value)
+      return
+    }
+    total += value
+    if total > MaxMoney {
+      r.add(id, -1, "bad-txns-txouttotal-toolarge", "outputs pay more than %d", uint64(MaxMoney))
+      return
+    }
+  }
+  seen := make(map[chainstate.Outpoint]bool, len(tx.Inputs))
+  for i := range tx.Inputs {
+    o := chainstate.Outpoint{Hash: tx.Inputs[i].TransactionHash, Index: tx.Inputs[i].TransactionIndex}
+    if seen[o] {
+      r.add(id, i, "bad-txns-inputs-duplicate", "spends %s again", o)
+      return
+    }
+    seen[o] = true
+  }
+  if IsCoinbase(tx) {
+    if n := len(tx.Inputs[0].InputScript); n < 2 || n > 100 {
+      r.add(id, 0, "bad-cb-length", "coinbase script is %d bytes, not 2 to 100", n)
+    }
+    return
+  }
+  for i := range tx.Inputs {
+    if isNull(&tx.Inputs[i]) {
+      r.add(id, i, "bad-txns-prevout-null", "spends the null outpoint")
+      return
+    }
+  }
+}
+
+//CheckBlock applies the rules a block must meet wherever it is in the chain, as bitcoind's CheckBlock does: proof of
+//work, the merkle root, size, a single coinbase first, CheckTransaction for each transaction and the legacy
+//signature operation limit
+func CheckBlock(b *block.Block) ([]Violation) {
+  var r report
+  if !CheckProofOfWork(b.BlockHash, b.Header.TargetValue) {
+    r.add(block.Hash{}, -1, "high-hash", "hash %s is above the target of bits %08x", b.BlockHash, b.Header.TargetValue)
+  }
+  txids := make([]block.Hash, len(b.Transactions))
+  for t := range b.Transactions {
+    txids[t] = b.Transactions[t].TransactionHash
+  }
+  root, mutated := merkleRoot(txids)
+  if root != b.Header.MerkleRoot {
+    r.add(block.Hash{}, -1, "bad-txnmrklroot", "merkle root is %s, header commits to %s", root, b.Header.MerkleRoot)
+  }
+  if mutated {
+    r.add(block.Hash{}, -1, "bad-txns-duplicate", "transactions repeat so the merkle root matches another block's")
+  }
+  if stripped, _ := Sizes(b); len(b.Transactions) == 0 || len(b.Transactions) * WitnessScaleFactor > MaxBlockWeight ||
+    stripped * WitnessScaleFactor > MaxBlockWeight {
+    r.add(block.Hash{}, -1, "bad-blk-length", "%d transactions in %d bytes without witnesses", len(b.Transactions), stripped)
+  }
+  if len(b.Transactions) == 0 || !IsCoinbase(&b.Transactions[0]) {
+    r.add(block.Hash{}, -1, "bad-cb-missing", "first transaction is not a coinbase")
+  }
+  sigOps := 0
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    if t > 0 && IsCoinbase(tx) {
+      r.add(tx.TransactionHash, -1, "bad-cb-multiple", "transaction %d is a second coinbase", t)
+    }
+    checkTransaction(&r, tx)
+    sigOps += legacySigOps(tx)
+  }
+  if sigOps * WitnessScaleFactor > MaxBlockSigOpsCost {
+    r.add(block.Hash{}, -1, "bad-blk-sigops", "%d legacy signature operations", sigOps)
+  }
+  return r
+}
+
+//CheckProofOfWork reports whether hash meets the target bits encodes, and whether bits encodes a valid target
+func CheckProofOfWork(hash block.Hash, bits uint32) (bool) {
+  exponent := uint(bits >> 24)
+  mantissa := int64(bits & 0x007fffff)
+  if bits & 0x00800000 != 0 && mantissa != 0 {
+    return false
+  }
+  if mantissa != 0 && (exponent > 34 || (mantissa > 0xff && exponent > 33) || (mantissa > 0xffff && exponent > 32)) {
+    return false
+  }
+  target := big.NewInt(mantissa)
+  if exponent <= 3 {
+    target.Rsh(target, 8 * (3 - exponent))
+  } else {
+    target.Lsh(target, 8 * (exponent - 3))
+  }
+  if target.Sign() == 0 {
+    return false
+  }
+  var h [block.HashLength]byte
+  for i := range h {
+    h[i] = hash[block.HashLength-1-i]
+  }
+  return new(big.Int).SetBytes(h[:]).Cmp(target) <= 0
+}
+
+//merkleRoot computes the merkle root of hashes as bitcoind does, also reporting whether two equal hashes were paired
+//at any level, which lets a block with repeated transactions share the root of a valid block (CVE-2012-2459)
+func merkleRoot(hashes []block.Hash) (block.Hash, bool) {
+  if len(hashes) == 0 {
+    return block.Hash{}, false
+  }
+  mutated := false
+  level := append([]block.Hash{}, hashes...)
+  for len(level) > 1 {
+    for i := 0; i + 1 < len(level); i += 2 {
+      mutated = mutated || level[i] == level[i+1]
+    }
+    if len(level) % 2 == 1 {
+      level = append(level, level[len(level)-1])
+    }
+    next := make([]block.Hash, len(level)/2)
+    for i := range next {
+      next[i] = btchashing.DoubleSha256(level[2*i][:], level[2*i+1][:])
+    }
+    level = next
+  }
+  return level[0], mutated
+}
+
+//Sizes returns the serialized size of b without its witnesses and with them
+func Sizes(b *block.Block) (int, int) {
+  stripped := blockserializer.HeaderLength + blockserializer.CompactSizeLength(uint64(len(b.Transactions)))
+  total := stripped
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    stripped += len(blockserializer.SerializeTransactionNoWitness(tx))
+    total += len(blockserializer.SerializeTransaction(tx))
+  }
+  return stripped, total
+}
+
+//Weight returns the BIP141 weight of b
+func Weight(b *block.Block) (int) {
+  stripped, total := Sizes(b)
+  return stripped * (WitnessScaleFactor - 1) + total
+}
+
+//legacySigOps counts the signature operations in the scripts of tx, inaccurately, as bitcoind limits them before
+//BIP141
+func legacySigOps(tx *block.Transaction) (int) {
+  n := 0
+  for i := range tx.Inputs {
+    n += script.SigOpCount(tx.Inputs[i].InputScript, false)
+  }
+  for o := range tx.Outputs {
+    n += script.SigOpCount(tx.Outputs[o].ChallengeScript, false)
+  }
+  return n
+}
+
+//witnessCommitment returns the index of the last coinbase output committing to the block's witnesses, or -1
+func witnessCommitment(coinbase *block.Transaction) (int) {
+  pos := -1
+  for o := range coinbase.Outputs {
+    s := coinbase.Outputs[o].ChallengeScript
+    if len(s) >= 38 && bytes.HasPrefix(s, witnessCommitmentHeader) {
+      pos = o
+    }
+  }
+  return pos
+}
+
+//witnessMerkleRoot computes the merkle root of the wtxids of b, taking the coinbase's as zero
+func witnessMerkleRoot(b *block.Block) (block.Hash) {
+  wtxids := make([]block.Hash, len(b.Transactions))
+  for t := 1; t < len(b.Transactions); t++ {
+    wtxids[t] = btchashing.DoubleSha256(blockserializer.SerializeTransaction(&b.Transactions[t]))
+  }
+  root, _ := merkleRoot(wtxids)
+  return root
+}
@@ -0,0 +1,313 @@
+package consensus_test
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/consensus"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//activate makes every soft fork active from height 1 for the rest of the test, as on regtest
+func activate(t *testing.T) {
+  p := network.MainNet
+  p.BIP34Height, p.BIP66Height, p.BIP65Height, p.CSVHeight, p.SegwitHeight = 1, 1, 1, 1, 1
+  network.Active = &p
+  t.Cleanup(func() { network.Active = &network.MainNet })
+}
+
+//validate connects blocks in height order and returns the result of each
+func validate(t *testing.T, blocks []*block.Block) ([]consensus.Result) {
+  var results []consensus.Result
+  v := consensus.NewValidator(chainstate.New())
+  v.Report = func(r consensus.Result) {
+    results = append(results, r)
+  }
+  for h, b := range blocks {
+    err := v.ConnectBlock(h, b)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if v.Blocks != len(blocks) {
+    t.Errorf("validated %d blocks, want %d", v.Blocks, len(blocks))
+  }
+  return results
+}
+
+func rules(r consensus.Result) ([]string) {
+  var names []string
+  for _, v := range r.Violations {
+    names = append(names, v.Rule)
+  }
+  return names
+}
+
+func coinbaseOf(b *block.Block) (block.Hash) {
+  return b.Transactions[0].TransactionHash
+}
+
+//p2wshOpTrue pays to the version 0 witness script hash of OP_TRUE, spent by a witness holding OP_TRUE
+var p2wshOpTrue = func() ([]byte) {
+  h := sha256.Sum256(chaintest.OpTrue)
+  return append([]byte{script.OP0, 32}, h[:]...)
+}()
+
+//commit adds a BIP141 witness commitment to txs to coinbase
+func commit(coinbase block.Transaction, txs ...block.Transaction) (block.Transaction) {
+  wtxids := []block.Hash{{}}
+  for t := range txs {
+    wtxids = append(wtxids, btchashing.DoubleSha256(blockserializer.SerializeTransaction(&txs[t])))
+  }
+  root, _ := btchashing.ComputeMerkleRoot(wtxids)
+  nonce := make([]byte, 32)
+  c := btchashing.DoubleSha256(root[:], nonce)
+  coinbase.Inputs[0].Witness = [][]byte{nonce}
+  coinbase.Outputs = append(coinbase.Outputs, chaintest.Out(0, append([]byte{script.OPRETURN, 0x24, 0xaa, 0x21, 0xa9, 0xed}, c[:]...)))
+  return chaintest.Finish(coinbase)
+}
+
+func TestValidChain(t *testing.T) {
+  activate(t)
+  c := chaintest.NewChain()
+  c.Extend(101, "")
+  pay := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy - 1000, chaintest.OpTrue))
+  //a version 2 spend whose relative lock of 5 blocks has long passed, and a lock time in the past
+  relative := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[2]), 0)}, chaintest.Out(chaintest.Subsidy, p2wshOpTrue))
+  relative.TransactionVersionNumber = 2
+  relative.Inputs[0].SequenceNumber = 5
+  relative.TransactionLockTime = 50
+  relative = chaintest.Finish(relative)
+  c.Mine(c.Tip, "", 1000, pay, relative)
+
+  //a witness spend in a block committing to it
+  witness := chaintest.Tx([]block.Input{chaintest.In(relative.TransactionHash, 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+  witness.Inputs[0].Witness = [][]byte{chaintest.OpTrue}
+  witness = chaintest.Finish(witness)
+  coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(103, ""))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+  c.MineCoinbase(c.Tip, commit(coinbase, witness), witness)
+
+  for _, r := range validate(t, c.Order) {
+    if !r.Valid() {
+      t.Errorf("block %d: %+v", r.Height, r.Violations)
+    }
+  }
+}
+
+func TestViolations(t *testing.T) {
+  activate(t)
+  tests := []struct {
+    name string
+    //build mines the invalid block, and any it needs first, on a chain of 101 blocks
+    build func(c *chaintest.Chain)
+    rule string
+  }{
+    {"coinbase claims fees that were not paid", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 1)
+    }, "bad-cb-amount"},
+    {"immature coinbase", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[100]), 0)}, chaintest.Out(1, chaintest.OpTrue)))
+    }, "bad-txns-premature-spend-of-coinbase"},
+    {"double spend", func(c *chaintest.Chain) {
+      in := []block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}
+      c.Mine(c.Tip, "", 0, chaintest.Tx(in, chaintest.Out(1, chaintest.OpTrue)), chaintest.Tx(in, chaintest.Out(2, chaintest.OpTrue)))
+    }, "bad-txns-inputs-missingorspent"},
+    {"missing coin", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(block.Hash{1}, 0)}, chaintest.Out(1, chaintest.OpTrue)))
+    }, "bad-txns-inputs-missingorspent"},
+    {"duplicate inputs", func(c *chaintest.Chain) {
+      in := chaintest.In(coinbaseOf(c.Order[1]), 0)
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{in, in}, chaintest.Out(1, chaintest.OpTrue)))
+    }, "bad-txns-inputs-duplicate"},
+    {"outputs over inputs", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy + 1, chaintest.OpTrue)))
+    }, "bad-txns-in-belowout"},
+    {"lock time", func(c *chaintest.Chain) {
+      tx := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(1, chaintest.OpTrue))
+      tx.TransactionLockTime = 200
+      tx.Inputs[0].SequenceNumber = 0
+      c.Mine(c.Tip, "", chaintest.Subsidy - 1, chaintest.Finish(tx))
+    }, "bad-txns-nonfinal"},
+    {"relative lock height", func(c *chaintest.Chain) {
+      parent := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      c.Mine(c.Tip, "", 0, parent)
+      tx := chaintest.Tx([]block.Input{chaintest.In(parent.TransactionHash, 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      tx.TransactionVersionNumber = 2
+      tx.Inputs[0].SequenceNumber = 5
+      c.Mine(c.Tip, "", 0, chaintest.Finish(tx))
+    }, "bad-txns-nonfinal"},
+    {"relative lock time", func(c *chaintest.Chain) {
+      parent := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      c.Mine(c.Tip, "", 0, parent)
+      tx := chaintest.Tx([]block.Input{chaintest.In(parent.TransactionHash, 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      tx.TransactionVersionNumber = 2
+      //ten units of 512 seconds, more than the 600 seconds to the next block
+      tx.Inputs[0].SequenceNumber = script.SequenceTypeFlag | 10
+      c.Mine(c.Tip, "", 0, chaintest.Finish(tx))
+    }, "bad-txns-nonfinal"},
+    {"script", func(c *chaintest.Chain) {
+      parent := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, []byte{script.OP0}))
+      c.Mine(c.Tip, "", 0, parent)
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(parent.TransactionHash, 0)}, chaintest.Out(1, chaintest.OpTrue)))
+    }, "mandatory-script-verify-flag-failed"},
+    {"coinbase height", func(c *chaintest.Chain) {
+      c.MineCoinbase(c.Tip, chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(5, "/x/"))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue)))
+    }, "bad-cb-height"},
+    {"second coinbase", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.Coinbase([]byte{1, 2})}, chaintest.Out(1, chaintest.OpTrue)))
+    }, "bad-cb-multiple"},
+    {"merkle root", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0).Header.MerkleRoot = block.Hash{1}
+    }, "bad-txnmrklroot"},
+    {"repeated transactions", func(c *chaintest.Chain) {
+      a := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      b := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[2]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      c.Mine(c.Tip, "", 0, a, b, b)
+    }, "bad-txns-duplicate"},
+    {"proof of work", func(c *chaintest.Chain) {
+      c.Mine(c.Tip, "", 0).Header.TargetValue = 0x03000001
+    }, "high-hash"},
+    {"time before the median time past", func(c *chaintest.Chain) {
+      coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(102, ""))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      b := chaintest.NewBlock(c.Tip, c.Blocks[c.Tip].Header.TimeStamp - 6 * chaintest.BlockInterval, coinbase)
+      c.Order = append(c.Order, b)
+    }, "time-too-old"},
+    {"witness without a commitment", func(c *chaintest.Chain) {
+      tx := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      tx.Inputs[0].Witness = [][]byte{{1}}
+      c.Mine(c.Tip, "", 0, chaintest.Finish(tx))
+    }, "unexpected-witness"},
+    {"witness commitment mismatch", func(c *chaintest.Chain) {
+      coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(102, ""))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      tx := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      c.MineCoinbase(c.Tip, commit(coinbase), tx)
+    }, "bad-witness-merkle-match"},
+    {"witness nonce", func(c *chaintest.Chain) {
+      coinbase := commit(chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(102, ""))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue)))
+      coinbase.Inputs[0].Witness = [][]byte{make([]byte, 31)}
+      c.MineCoinbase(c.Tip, chaintest.Finish(coinbase))
+    }, "bad-witness-nonce-size"},
+    {"weight", func(c *chaintest.Chain) {
+      tx := chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      tx.Inputs[0].Witness = [][]byte{make([]byte, consensus.MaxBlockWeight)}
+      tx = chaintest.Finish(tx)
+      coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase(chaintest.HeightScript(102, ""))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+      c.MineCoinbase(c.Tip, commit(coinbase, tx), tx)
+    }, "bad-blk-weight"},
+    {"signature operations", func(c *chaintest.Chain) {
+      many := bytes.Repeat([]byte{script.OPCHECKSIG}, consensus.MaxBlockSigOpsCost / consensus.WitnessScaleFactor + 1)
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, many)))
+    }, "bad-blk-sigops"},
+    {"multisig signature operations", func(c *chaintest.Chain) {
+      //each bare CHECKMULTISIG counts twenty
+      many := bytes.Repeat([]byte{script.OPCHECKMULTISIG}, consensus.MaxBlockSigOpsCost / consensus.WitnessScaleFactor / 20 + 1)
+      c.Mine(c.Tip, "", 0, chaintest.Tx([]block.Input{chaintest.In(coinbaseOf(c.Order[1]), 0)}, chaintest.Out(chaintest.Subsidy, many)))
+    }, "bad-blk-sigops"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      c := chaintest.NewChain()
+      c.Extend(101, "")
+      n := len(c.Order)
+      test.build(c)
+      results := validate(t, c.Order)
+      for _, r := range results[:n] {
+        if !r.Valid() {
+          t.Fatalf("block %d before the invalid block: %+v", r.Height, r.Violations)
+        }
+      }
+      last := results[len(results)-1]
+      found := false
+      for _, rule := range rules(last) {
+        found = found || rule == test.rule
+      }
+      if !found {
+        t.Errorf("block %d broke %v, want %s", last.Height, rules(last), test.rule)
+      }
+    })
+  }
+}
+
+func TestBIP30(t *testing.T) {
+  //below BIP34 on the main network, a coinbase repeated while its coin is unspent and again once it is spent
+  coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase([]byte("/dup/"))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+  c := chaintest.NewChain()
+  c.MineCoinbase(c.Tip, coinbase)
+  c.Extend(100, "")
+  repeat := c.MineCoinbase(c.Tip, coinbase)
+  results := validate(t, c.Order)
+  if got := rules(results[102]); len(got) != 1 || got[0] != "bad-txns-BIP30" {
+    t.Errorf("repeated coinbase broke %v, want bad-txns-BIP30", got)
+  }
+
+  //the exceptions overwrite the coin, as blocks 91842 and 91880 did
+  p := network.MainNet
+  p.BIP30Exceptions = []block.Hash{repeat.BlockHash}
+  network.Active = &p
+  t.Cleanup(func() { network.Active = &network.MainNet })
+  if results := validate(t, c.Order); !results[102].Valid() {
+    t.Errorf("exception broke %v", rules(results[102]))
+  }
+
+  c.Order = c.Order[:102]
+  c.Tip = c.Order[101].BlockHash
+  spend := chaintest.Tx([]block.Input{chaintest.In(coinbase.TransactionHash, 0)}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+  c.Mine(c.Tip, "", 0, spend)
+  c.MineCoinbase(c.Tip, coinbase)
+  for h, r := range validate(t, c.Order) {
+    if !r.Valid() {
+      t.Errorf("height %d broke %v after the coin was spent", h, rules(r))
+    }
+  }
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+  genesis := network.MainNet.GenesisBlockHash
+  tests := []struct {
+    bits uint32
+    want bool
+  }{
+    {0x1d00ffff, true},
+    //the genesis hash has 43 leading zero bits
+    {0x1b00ffff, false},
+    //negative and overflowing targets
+    {0x1d80ffff, false},
+    {0xff00ffff, false},
+    {0, false},
+  }
+  for _, test := range tests {
+    if got := consensus.CheckProofOfWork(genesis, test.bits); got != test.want {
+      t.Errorf("CheckProofOfWork(genesis, %08x) = %v, want %v", test.bits, got, test.want)
+    }
+  }
+}
+
+func TestMedianTimePast(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(20, "")
+  v := consensus.NewValidator(chainstate.New())
+  for h, b := range c.Order {
+    err := v.ConnectBlock(h, b)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  //timestamps rise by BlockInterval, so the median of eleven is the sixth from the top
+  want := int64(c.Order[15].Header.TimeStamp)
+  if got := v.MedianTimePast(20); got != want {
+    t.Errorf("MedianTimePast(20) = %d, want %d", got, want)
+  }
+  if got := v.MedianTimePast(0); got != int64(c.Order[0].Header.TimeStamp) {
+    t.Errorf("MedianTimePast(0) = %d, want the genesis timestamp", got)
+  }
+  err := v.ConnectBlock(5, c.Order[5])
+  if err == nil {
+    t.Error("connecting a block out of order succeeded")
+  }
+}
@@ -0,0 +1,395 @@
+package consensus
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "sort"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/scriptcheck"
+    "github.com/tgebhart/goparsebtc/supply"
+)
+
+//ErrOutOfOrder is returned when blocks are not connected one height at a time from the genesis block
+var ErrOutOfOrder = errors.New("consensus: blocks must be connected in height order from the genesis block")
+
+//Result is the outcome of validating one main chain block
+type Result struct {
+  Height int `json:"height"`
+  Hash block.Hash `json:"hash"`
+  //Violations lists the rules the block breaks, empty when it is valid
+  Violations []Violation `json:"violations"`
+}
+
+//Valid reports whether the block broke no rule
+func (r Result) Valid() (bool) {
+  return len(r.Violations) == 0
+}
+
+//Validator applies the consensus rules to each block connected to a chain state, using the UTXO set for the coins
+//blocks spend. Blocks are connected whatever rules they break, so the blocks after them are checked against the
+//chain bitcoind accepted, except that a block spending a coin the UTXO set lacks cannot be connected at all.
+type Validator struct {
+  State *chainstate.State
+  //Check selects the heights whose blocks are validated; nil validates every block
+  Check func(height int) (bool)
+  //Report is called with the result of each block validated
+  Report func(Result)
+  //SkipScripts leaves out script verification, by far the slowest rule
+  SkipScripts bool
+  //Workers is how many transactions of a block have their scripts verified at once
+  Workers int
+
+  //Blocks and Failed count the blocks validated and those that broke a rule
+  Blocks int
+  Failed int
+
+  //times holds the timestamp of each connected block by height, for median times past
+  times []uint32
+}
+
+//NewValidator returns a validator connecting blocks to state
+func NewValidator(state *chainstate.State) (*Validator) {
+  return &Validator{State: state}
+}
+
+//MedianTimePast returns the median timestamp of the block at height and the ten before it, which BIP113 measures
+//lock times against
+func (v *Validator) MedianTimePast(height int) (int64) {
+  if height < 0 || height >= len(v.times) {
+    return 0
+  }
+  first := height - MedianTimeSpan + 1
+  if first < 0 {
+    first = 0
+  }
+  times := append([]uint32{}, v.times[first:height+1]...)
+  sort.Slice(times, func(i, j int) (bool) { return times[i] < times[j] })
+  return int64(times[len(times)/2])
+}
+
+//ConnectBlock validates the block at height and connects it to the chain state. The error is only for blocks
+//connected out of order or a failing chain state; broken rules are reported through Report.
+func (v *Validator) ConnectBlock(height int, b *block.Block) (error) {
+  if height != len(v.times) {
+    return fmt.Errorf("%w: block %s at height %d after %d blocks", ErrOutOfOrder, b.BlockHash, height, len(v.times))
+  }
+  check := v.Check == nil || v.Check(height)
+  var r report
+  if check {
+    r = append(r, CheckBlock(b)...)
+    if height > 0 {
+      v.contextualCheck(&r, height, b)
+      v.checkOverwrites(&r, height, b)
+      v.checkSpends(&r, b)
+    }
+  }
+  err := v.State.ConnectBlock(height, b)
+  switch {
+  case errors.Is(err, chainstate.ErrMissingCoin) && check:
+    //checkSpends has reported the input
+  case err != nil:
+    return err
+  case check && height > 0:
+    undo, err := v.State.Undo.Get(b.BlockHash)
+    if err != nil {
+      return err
+    }
+    v.connectInputs(&r, height, b, undo)
+  }
+  v.times = append(v.times, b.Header.TimeStamp)
+  if !check {
+    return nil
+  }
+  v.Blocks++
+  if len(r) > 0 {
+    v.Failed++
+  }
+  if v.Report != nil {
+    v.Report(Result{height, b.BlockHash, r})
+  }
+  return nil
+}
+
+//DisconnectBlock disconnects the main chain tip b at height from the chain state
+func (v *Validator) DisconnectBlock(height int, b *block.Block) (error) {
+  if height != len(v.times) - 1 {
+    return fmt.Errorf("%w: disconnecting block %s at height %d with %d blocks connected", ErrOutOfOrder, b.BlockHash, height, len(v.times))
+  }
+  err := v.State.DisconnectBlock(height, b)
+  if err != nil {
+    return err
+  }
+  v.times = v.times[:height]
+  return nil
+}
+
+//contextualCheck applies the rules that depend on the block's height and the blocks before it, as bitcoind's
+//ContextualCheckBlockHeader and ContextualCheckBlock do: the version and timestamp, lock times, the BIP34 height in
+//the coinbase, the witness commitment and the block weight
+func (v *Validator) contextualCheck(r *report, height int, b *block.Block) {
+  p := network.Active
+  prevTime := v.MedianTimePast(height - 1)
+  version := int32(b.Header.FormatVersion)
+  if (version < 2 && height >= p.BIP34Height) || (version < 3 && height >= p.BIP66Height) || (version < 4 && height >= p.BIP65Height) {
+    r.add(block.Hash{}, -1, fmt.Sprintf("bad-version(0x%08x)", b.Header.FormatVersion), "version is too low for height %d", height)
+  }
+  if int64(b.Header.TimeStamp) <= prevTime {
+    r.add(block.Hash{}, -1, "time-too-old", "timestamp %d is not after the median time past %d", b.Header.TimeStamp, prevTime)
+  }
+
+  //BIP113 measures lock times against the median time past rather than the block's own timestamp
+  cutoff := int64(b.Header.TimeStamp)
+  if height >= p.CSVHeight {
+    cutoff = prevTime
+  }
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    if !IsFinal(tx, height, cutoff) {
+      r.add(tx.TransactionHash, -1, "bad-txns-nonfinal", "lock time %d is not final at height %d and time %d", tx.TransactionLockTime, height, cutoff)
+    }
+  }
+  if len(b.Transactions) == 0 {
+    return
+  }
+  coinbase := &b.Transactions[0]
+
+  if height >= p.BIP34Height {
+    prefix := heightPrefix(height)
+    if len(coinbase.Inputs) == 0 || !bytes.HasPrefix(coinbase.Inputs[0].InputScript, prefix) {
+      r.add(coinbase.TransactionHash, 0, "bad-cb-height", "coinbase script does not start with height %d", height)
+    }
+  }
+
+  committed := false
+  if height >= p.SegwitHeight {
+    if pos := witnessCommitment(coinbase); pos >= 0 {
+      committed = true
+      witness := coinbase.Inputs[0].Witness
+      if len(witness) != 1 || len(witness[0]) != 32 {
+        r.add(coinbase.TransactionHash, 0, "bad-witness-nonce-size", "coinbase witness is not a single 32 byte nonce")
+      } else {
+        root := witnessMerkleRoot(b)
+        want := btchashing.DoubleSha256(root[:], witness[0])
+        if !bytes.Equal(want[:], coinbase.Outputs[pos].ChallengeScript[6:38]) {
+          r.add(coinbase.TransactionHash, -1, "bad-witness-merkle-match", "output %d commits to %x, witnesses hash to %x", pos,
+            coinbase.Outputs[pos].ChallengeScript[6:38], want[:])
+        }
+      }
+    }
+  }
+  if !committed {
+    for t := range b.Transactions {
+      if blockserializer.HasWitness(&b.Transactions[t]) {
+        r.add(b.Transactions[t].TransactionHash, -1, "unexpected-witness", "witness in a block without a witness commitment")
+        break
+      }
+    }
+  }
+  if w := Weight(b); w > MaxBlockWeight {
+    r.add(block.Hash{}, -1, "bad-blk-weight", "weight %d is over %d", w, MaxBlockWeight)
+  }
+}
+
+//IsFinal reports whether tx may be mined at height, where lock times at or above script.LockTimeThreshold are
+//compared with cutoff: a lock time below the height or cutoff, or every input's sequence number final, makes it so
+func IsFinal(tx *block.Transaction, height int, cutoff int64) (bool) {
+  if tx.TransactionLockTime == 0 {
+    return true
+  }
+  lockTime := int64(tx.TransactionLockTime)
+  limit := int64(height)
+  if lockTime >= script.LockTimeThreshold {
+    limit = cutoff
+  }
+  if lockTime < limit {
+    return true
+  }
+  for i := range tx.Inputs {
+    if tx.Inputs[i].SequenceNumber != script.SequenceFinal {
+      return false
+    }
+  }
+  return true
+}
+
+//heightPrefix returns the push of height that BIP34 requires a coinbase script to start with, as bitcoind writes it
+func heightPrefix(height int) ([]byte) {
+  switch {
+  case height == 0:
+    return []byte{script.OP0}
+  case height <= 16:
+    return []byte{byte(script.OP1 + height - 1)}
+  }
+  return script.PushData(script.NumberBytes(int64(height)))
+}
+
+//checkOverwrites reports transactions repeating the txid of one with unspent outputs, which BIP30 forbids. As in
+//bitcoind the rule is not enforced from BIP34, which makes coinbase txids unique, until BIP34ImpliesBIP30Limit, and
+//never for the blocks in network.Active.BIP30Exceptions.
+func (v *Validator) checkOverwrites(r *report, height int, b *block.Block) {
+  p := network.Active
+  for _, h := range p.BIP30Exceptions {
+    if h == b.BlockHash {
+      return
+    }
+  }
+  if height >= p.BIP34Height && height < BIP34ImpliesBIP30Limit {
+    return
+  }
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    for o := range tx.Outputs {
+      if _, ok := v.State.UTXO.Get(chainstate.Outpoint{Hash: tx.TransactionHash, Index: uint32(o)}); ok {
+        r.add(tx.TransactionHash, -1, "bad-txns-BIP30", "output %d would overwrite an unspent output of the same txid", o)
+        break
+      }
+    }
+  }
+}
+
+//checkSpends reports inputs spending a coin that is neither in the UTXO set nor created earlier in the block, or that
+//an earlier transaction of the block spent. Spending the same coin twice within a transaction is left to
+//CheckTransaction.
+func (v *Validator) checkSpends(r *report, b *block.Block) {
+  spentBy := make(map[chainstate.Outpoint]int)
+  created := make(map[chainstate.Outpoint]bool)
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    if t > 0 {
+      for i := range tx.Inputs {
+        o := chainstate.Outpoint{Hash: tx.Inputs[i].TransactionHash, Index: tx.Inputs[i].TransactionIndex}
+        if by, ok := spentBy[o]; ok {
+          if by != t {
+            r.add(tx.TransactionHash, i, "bad-txns-inputs-missingorspent", "%s is already spent by transaction %d of the block", o, by)
+          }
+          continue
+        }
+        spentBy[o] = t
+        if _, ok := v.State.UTXO.Get(o); !ok && !created[o] {
+          r.add(tx.TransactionHash, i, "bad-txns-inputs-missingorspent", "%s is not in the UTXO set", o)
+        }
+      }
+    }
+    for o := range tx.Outputs {
+      if !chainstate.Unspendable(tx.Outputs[o].ChallengeScript) {
+        created[chainstate.Outpoint{Hash: tx.TransactionHash, Index: uint32(o)}] = true
+      }
+    }
+  }
+}
+
+//connectInputs applies the rules on the coins a connected block spent, as bitcoind's ConnectBlock does: coinbase
+//maturity, input and fee ranges, value conservation, BIP68 sequence locks, the signature operation cost, the coinbase
+//amount and the scripts
+func (v *Validator) connectInputs(r *report, height int, b *block.Block, undo *chainstate.BlockUndo) {
+  p := network.Active
+  flags := scriptcheck.Flags(height, b.BlockHash)
+  prevTime := v.MedianTimePast(height - 1)
+  var fees uint64
+  cost := 0
+  s := 0
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    cost += legacySigOps(tx) * WitnessScaleFactor
+    if t == 0 {
+      continue
+    }
+    coins := undo.Spent[s:s+len(tx.Inputs)]
+    s += len(tx.Inputs)
+
+    var in uint64
+    inRange := true
+    for i := range coins {
+      c := &coins[i].Coin
+      if c.Coinbase && height - c.Height < CoinbaseMaturity {
+        r.add(tx.TransactionHash, i, "bad-txns-premature-spend-of-coinbase", "spends the coinbase of height %d", c.Height)
+      }
+      in += c.Value
+      if c.Value > MaxMoney || in > MaxMoney {
+        inRange = false
+      }
+      if flags & script.VerifyP2SH != 0 {
+        cost += script.P2SHSigOpCount(tx.Inputs[i].InputScript, c.Script) * WitnessScaleFactor
+      }
+      cost += script.WitnessSigOpCount(tx.Inputs[i].InputScript, c.Script, tx.Inputs[i].Witness, flags)
+    }
+    var out uint64
+    for o := range tx.Outputs {
+      out += tx.Outputs[o].OutputValue
+    }
+    switch {
+    case !inRange:
+      r.add(tx.TransactionHash, -1, "bad-txns-inputvalues-outofrange", "inputs hold more than %d", uint64(MaxMoney))
+    case in < out:
+      r.add(tx.TransactionHash, -1, "bad-txns-in-belowout", "inputs hold %d, outputs pay %d", in, out)
+    default:
+      fees += in - out
+      if fees > MaxMoney {
+        r.add(tx.TransactionHash, -1, "bad-txns-accumulated-fee-outofrange", "fees reach %d", fees)
+      }
+    }
+
+    if height >= p.CSVHeight && tx.TransactionVersionNumber >= 2 {
+      minHeight, minTime := v.sequenceLocks(tx, coins)
+      if minHeight >= height || minTime >= prevTime {
+        r.add(tx.TransactionHash, -1, "bad-txns-nonfinal", "sequence locks need height above %d and time above %d", minHeight, minTime)
+      }
+    }
+  }
+  if cost > MaxBlockSigOpsCost {
+    r.add(block.Hash{}, -1, "bad-blk-sigops", "signature operations cost %d", cost)
+  }
+  if len(b.Transactions) > 0 {
+    coinbase := &b.Transactions[0]
+    var paid uint64
+    for o := range coinbase.Outputs {
+      paid += coinbase.Outputs[o].OutputValue
+    }
+    if reward := supply.Subsidy(height) + fees; paid > reward {
+      r.add(coinbase.TransactionHash, -1, "bad-cb-amount", "coinbase pays %d, the subsidy and fees are %d", paid, reward)
+    }
+  }
+
+  if v.SkipScripts {
+    return
+  }
+  checker := &scriptcheck.Checker{Workers: v.Workers, Report: func(res scriptcheck.Result) {
+    if res.Err != nil {
+      r.add(res.TxID, res.Input, "mandatory-script-verify-flag-failed", "%v", res.Err)
+    }
+  }}
+  checker.ConnectBlock(height, b, undo)
+}
+
+//sequenceLocks returns the height and median time past the previous block must exceed for the BIP68 relative lock
+//times of tx's inputs to have passed, -1 for each when none applies
+func (v *Validator) sequenceLocks(tx *block.Transaction, coins []chainstate.SpentCoin) (int, int64) {
+  minHeight, minTime := -1, int64(-1)
+  for i := range tx.Inputs {
+    sequence := tx.Inputs[i].SequenceNumber
+    if sequence & script.SequenceDisableFlag != 0 {
+      continue
+    }
+    coinHeight := coins[i].Coin.Height
+    lock := int64(sequence & script.SequenceMask)
+    if sequence & script.SequenceTypeFlag != 0 {
+      //time locks count from the median time past of the block before the coin's, in units of 512 seconds
+      base := coinHeight - 1
+      if base < 0 {
+        base = 0
+      }
+      if t := v.MedianTimePast(base) + lock << 9 - 1; t > minTime {
+        minTime = t
+      }
+    } else if h := coinHeight + int(lock) - 1; h > minHeight {
+      minHeight = h
+    }
+  }
+  return minHeight, minTime
+}
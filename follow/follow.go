@@ -0,0 +1,210 @@
+package follow
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "os"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/chainindex"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/network"
+)
+
+//Store is an index derived from the main chain and kept in step with it. Each block that joins the main chain is
+//connected, and each block that leaves it in a reorg is disconnected, newest first, before the new branch is connected.
+type Store interface {
+  ConnectBlock(height int, b *block.Block) (error)
+  DisconnectBlock(height int, b *block.Block) (error)
+}
+
+//event types
+const (
+  EventTip = "tip"
+  EventReorg = "reorg"
+)
+
+//Event reports a new main chain tip. Reorgs also list the blocks that left the main chain, tip first, and the blocks
+//that joined it, in height order, above the last block the two branches share.
+type Event struct {
+  Type string `json:"type"`
+  Height int `json:"height"`
+  Hash block.Hash `json:"hash"`
+  Time uint32 `json:"time"`
+  ForkHeight int `json:"fork_height,omitempty"`
+  ForkHash *block.Hash `json:"fork_hash,omitempty"`
+  Disconnected []block.Hash `json:"disconnected,omitempty"`
+  Connected []block.Hash `json:"connected,omitempty"`
+}
+
+//Follower reads the blk files of a blocks directory from the first, links their blocks into a chainindex.Index and
+//keeps following the newest file as bitcoind appends to it, moving on when bitcoind starts the next file.
+type Follower struct {
+  Datadir string
+  Index *chainindex.Index
+  //Stores are connected in order and disconnected in reverse order
+  Stores []Store
+  //Interval is how often the newest blk file is polled for new blocks
+  Interval time.Duration
+  Options blockchainbuilder.DecodeOptions
+  //OnEvent receives an Event for each change of the tip once the follower has first caught up with the blk files
+  OnEvent func(Event) (error)
+  //OnCaughtUp is called when the follower reaches the written end of the newest blk file after the tip has changed,
+  //with the stores up to date
+  OnCaughtUp func(tip *chainindex.Node) (error)
+
+  file int
+  blocks int
+  caughtUp bool
+  dirty bool
+  err error
+}
+
+//New returns a Follower for the blk files in datadir, which must end in a path separator
+func New(datadir string) (*Follower) {
+  return &Follower{
+    Datadir: datadir,
+    Index: chainindex.New(network.Active.GenesisBlockHash),
+    Interval: blockchainbuilder.DefaultTailInterval,
+    Options: blockchainbuilder.DefaultDecodeOptions,
+  }
+}
+
+//fileName returns the name bitcoind gives the n'th block file
+func fileName(n int) (string) {
+  return fmt.Sprintf("blk%05d.dat", n)
+}
+
+//Run follows the blk files until ctx is done or a store fails, and returns ctx's error or the failure
+func (f *Follower) Run(ctx context.Context) (error) {
+  for {
+    name := fileName(f.file)
+    file, err := os.Open(f.Datadir + name)
+    if err != nil {
+      return err
+    }
+    slog.Info("following block file", logging.KeyFile, f.Datadir + name)
+    lengthRead := 0
+    err = blockchainbuilder.NewDecoder(file, f.Options).Tail(ctx, f.Interval, f.finished, func(b *block.Block) (error) {
+      b.HashBlock.FileEndpoint = name
+      b.HashBlock.RawBlockNumber = f.blocks
+      b.HashBlock.LengthRead = lengthRead
+      f.blocks++
+      lengthRead += int(b.BlockLength)
+      return f.add(b)
+    })
+    file.Close()
+    if f.err != nil {
+      return f.err
+    }
+    if err == blockchainbuilder.ErrPartialBlock {
+      //bitcoind moved on to the next file without finishing this one, as after a crash
+      slog.Warn("skipping incomplete block at the end of a finished file", logging.KeyFile, f.Datadir + name)
+    } else if err != nil {
+      return err
+    }
+    f.file++
+  }
+}
+
+//finished reports whether bitcoind has started the next blk file, so the current one cannot grow. Otherwise the
+//follower has caught up, and the stores' owner is told so. A failure of OnCaughtUp is kept in f.err and ends the
+//current file so Run can return it.
+func (f *Follower) finished() (bool) {
+  _, err := os.Stat(f.Datadir + fileName(f.file + 1))
+  if err == nil {
+    return true
+  }
+  f.caughtUp = true
+  if f.dirty && f.OnCaughtUp != nil {
+    f.dirty = false
+    f.err = f.OnCaughtUp(f.Index.Tip())
+  }
+  return f.err != nil
+}
+
+//add links b into the index and applies any change of the main chain to the stores
+func (f *Follower) add(b *block.Block) (error) {
+  change := f.Index.Add(b.HashBlock, b.Header.TargetValue)
+  if change == nil {
+    return nil
+  }
+  for _, n := range change.Disconnected {
+    disconnected, err := f.read(n, b)
+    if err != nil {
+      return err
+    }
+    for s := len(f.Stores) - 1; s >= 0; s-- {
+      err = f.Stores[s].DisconnectBlock(n.Height, disconnected)
+      if err != nil {
+        return fmt.Errorf("follow: disconnecting block %s at height %d: %w", n.Hash(), n.Height, err)
+      }
+    }
+  }
+  for _, n := range change.Connected {
+    connected, err := f.read(n, b)
+    if err != nil {
+      return err
+    }
+    for _, s := range f.Stores {
+      err = s.ConnectBlock(n.Height, connected)
+      if err != nil {
+        return fmt.Errorf("follow: connecting block %s at height %d: %w", n.Hash(), n.Height, err)
+      }
+    }
+  }
+  f.dirty = true
+  if f.caughtUp && f.OnEvent != nil {
+    return f.OnEvent(NewEvent(change))
+  }
+  return nil
+}
+
+//read returns the block of n, which is b itself or a block read back from its blk file
+func (f *Follower) read(n *chainindex.Node, b *block.Block) (*block.Block, error) {
+  if n.Hash() == b.BlockHash {
+    return b, nil
+  }
+  file, err := os.Open(f.Datadir + n.HashBlock.FileEndpoint)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+  read := new(block.Block)
+  err = blockchainreader.ScanBlock(read, n.HashBlock.ByteOffset, int(n.HashBlock.ParsedBlockLength), file)
+  if err != nil {
+    return nil, fmt.Errorf("follow: reading block %s from %s: %w", n.Hash(), n.HashBlock.FileEndpoint, err)
+  }
+  return read, nil
+}
+
+//NewEvent describes change as an Event
+func NewEvent(change *chainindex.Change) (Event) {
+  tip := change.Tip()
+  e := Event{Type: EventTip, Height: tip.Height, Hash: tip.Hash(), Time: tip.HashBlock.TimeStamp}
+  if len(change.Disconnected) == 0 {
+    return e
+  }
+  e.Type = EventReorg
+  fork := change.Fork.Hash()
+  e.ForkHeight, e.ForkHash = change.Fork.Height, &fork
+  for _, n := range change.Disconnected {
+    e.Disconnected = append(e.Disconnected, n.Hash())
+  }
+  for _, n := range change.Connected {
+    e.Connected = append(e.Connected, n.Hash())
+  }
+  return e
+}
+
+//Blockchain returns the main chain of index in the form blockchainbuilder.WriteMainChainToFile writes
+func Blockchain(index *chainindex.Index) (*blockchainbuilder.Blockchain) {
+  chain := blockchainbuilder.NewBlockchain()
+  for _, n := range index.MainChain() {
+    chain.BlockMap[n.Hash()] = n.HashBlock
+  }
+  return chain
+}
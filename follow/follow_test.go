@@ -0,0 +1,154 @@
+package follow_test
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainindex"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/follow"
+)
+
+//recorder is a Store that logs the blocks it is given
+type recorder struct {
+  log []string
+}
+
+func (r *recorder) ConnectBlock(height int, b *block.Block) (error) {
+  r.log = append(r.log, "+" + b.BlockHash.String())
+  return nil
+}
+
+func (r *recorder) DisconnectBlock(height int, b *block.Block) (error) {
+  r.log = append(r.log, "-" + b.BlockHash.String())
+  return nil
+}
+
+func TestFollowReorg(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(2, "")
+  fork := c.Tip
+  old := c.Extend(2, "old")
+  dir := t.TempDir() + string(os.PathSeparator)
+  //the first file is finished; the second is the one bitcoind is writing
+  err := chaintest.WriteBlkFile(filepath.Join(dir, "blk00000.dat"), 0, c.Order[:3]...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = chaintest.WriteBlkFile(filepath.Join(dir, "blk00001.dat"), 4096, old...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  first := c.Mine(fork, "new", 0)
+  second := c.Mine(first.BlockHash, "new", 0)
+  third := c.Mine(second.BlockHash, "new", 0)
+  fourth := c.Mine(third.BlockHash, "new", 0)
+  //bitcoind writes the competing branch, then a block on it, each once the follower has caught up
+  writes := [][]*block.Block{{first, second, third}, {fourth}}
+  end := int64(len(chaintest.AppendBlk(nil, old...)))
+
+  ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+  defer cancel()
+  r := &recorder{}
+  f := follow.New(dir)
+  f.Interval = time.Millisecond
+  f.Stores = []follow.Store{r}
+  var events []follow.Event
+  var tips []block.Hash
+  f.OnEvent = func(e follow.Event) (error) {
+    events = append(events, e)
+    return nil
+  }
+  f.OnCaughtUp = func(tip *chainindex.Node) (error) {
+    tips = append(tips, tip.Hash())
+    if len(writes) == 0 {
+      cancel()
+      return nil
+    }
+    file, err := os.OpenFile(filepath.Join(dir, "blk00001.dat"), os.O_WRONLY, 0)
+    if err != nil {
+      return err
+    }
+    defer file.Close()
+    raw := chaintest.AppendBlk(nil, writes[0]...)
+    writes = writes[1:]
+    _, err = file.WriteAt(raw, end)
+    end += int64(len(raw))
+    return err
+  }
+  err = f.Run(ctx)
+  if !errors.Is(err, context.Canceled) {
+    t.Fatalf("Run returned %v, want context.Canceled", err)
+  }
+
+  if len(tips) != 3 || tips[0] != old[1].BlockHash || tips[1] != third.BlockHash || tips[2] != fourth.BlockHash {
+    t.Fatalf("caught up at %v, want %s, %s and %s", tips, old[1].BlockHash, third.BlockHash, fourth.BlockHash)
+  }
+  var want []string
+  for _, b := range c.Order[:5] {
+    want = append(want, "+" + b.BlockHash.String())
+  }
+  //the new branch only takes over once it has more work than the old one
+  for _, b := range []*block.Block{old[1], old[0]} {
+    want = append(want, "-" + b.BlockHash.String())
+  }
+  for _, b := range []*block.Block{first, second, third, fourth} {
+    want = append(want, "+" + b.BlockHash.String())
+  }
+  if len(r.log) != len(want) {
+    t.Fatalf("store saw %v, want %v", r.log, want)
+  }
+  for i := range want {
+    if r.log[i] != want[i] {
+      t.Fatalf("store saw %v, want %v", r.log, want)
+    }
+  }
+
+  if len(events) != 2 {
+    t.Fatalf("events %+v, want a reorg and a tip", events)
+  }
+  reorg := events[0]
+  if reorg.Type != follow.EventReorg || reorg.Height != 5 || reorg.Hash != third.BlockHash || reorg.ForkHeight != 2 || *reorg.ForkHash != fork ||
+    len(reorg.Disconnected) != 2 || reorg.Disconnected[0] != old[1].BlockHash || len(reorg.Connected) != 3 || reorg.Connected[0] != first.BlockHash {
+    t.Errorf("reorg event %+v", reorg)
+  }
+  if events[1].Type != follow.EventTip || events[1].Height != 6 || events[1].Hash != fourth.BlockHash || events[1].ForkHash != nil {
+    t.Errorf("tip event %+v", events[1])
+  }
+}
+
+func TestFollowStoreFailure(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(2, "")
+  dir := t.TempDir() + string(os.PathSeparator)
+  err := chaintest.WriteBlkFile(filepath.Join(dir, "blk00000.dat"), 0, c.Order...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  failure := errors.New("store failed")
+  f := follow.New(dir)
+  f.Stores = []follow.Store{failing{failure}}
+  err = f.Run(context.Background())
+  if !errors.Is(err, failure) {
+    t.Fatalf("Run returned %v, want the store's failure", err)
+  }
+}
+
+type failing struct {
+  err error
+}
+
+func (s failing) ConnectBlock(height int, b *block.Block) (error) {
+  if height == 1 {
+    return s.err
+  }
+  return nil
+}
+
+func (s failing) DisconnectBlock(height int, b *block.Block) (error) {
+  return nil
+}
@@ -0,0 +1,209 @@
+package graphexport
+
+import (
+    "encoding/csv"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+)
+
+
+//csvFile pairs an open file with its csv writer
+type csvFile struct {
+  file *os.File
+  writer *csv.Writer
+}
+
+//files written by the exporter along with their neo4j-admin headers
+var nodeFiles = map[string][]string{
+  "blocks.csv": {"hash:ID(Block)", "height:int", "previous_hash", "merkle_root", "version:long", "time_stamp:long", "target_value:long", "nonce:long", "block_length:long", "tx_count:int", ":LABEL"},
+  "transactions.csv": {"txid:ID(Transaction)", "version:long", "lock_time:long", "input_count:int", "output_count:int", ":LABEL"},
+  "inputs.csv": {"input_id:ID(Input)", "txid", "input_index:int", "previous_txid", "previous_output_index:long", "input_script", "sequence_number:long", ":LABEL"},
+  "outputs.csv": {"outpoint:ID(Output)", "txid", "output_index:int", "output_value:long", "challenge_script", "key_type", ":LABEL"},
+  "addresses.csv": {"address:ID(Address)", ":LABEL"},
+}
+
+var relationshipFiles = map[string][]string{
+  "block_parent.csv": {":START_ID(Block)", ":END_ID(Block)", ":TYPE"},
+  "block_contains.csv": {":START_ID(Block)", ":END_ID(Transaction)", "tx_index:int", ":TYPE"},
+  "transaction_inputs.csv": {":START_ID(Transaction)", ":END_ID(Input)", ":TYPE"},
+  "transaction_outputs.csv": {":START_ID(Transaction)", ":END_ID(Output)", ":TYPE"},
+  "output_spent_by.csv": {":START_ID(Output)", ":END_ID(Input)", ":TYPE"},
+  "output_pays.csv": {":START_ID(Output)", ":END_ID(Address)", ":TYPE"},
+}
+
+//Exporter writes the transaction graph as node and relationship csv files for neo4j-admin import
+type Exporter struct {
+  Dir string
+  files map[string]*csvFile
+  //addresses holds every address already written to addresses.csv. It grows with the number of distinct
+  //addresses exported, which is what keeps neo4j-admin from skipping a duplicate node for every payment
+  addresses map[string]struct{}
+}
+
+//NewExporter creates dir if necessary and opens every node and relationship file with its header row
+func NewExporter(dir string) (*Exporter, error) {
+  err := os.MkdirAll(dir, 0755)
+  if err != nil {
+    return nil, err
+  }
+  e := &Exporter{Dir: dir, files: make(map[string]*csvFile), addresses: make(map[string]struct{})}
+  for _, set := range []map[string][]string{nodeFiles, relationshipFiles} {
+    for name, header := range set {
+      f, err := os.Create(filepath.Join(dir, name))
+      if err != nil {
+        e.Close()
+        return nil, err
+      }
+      c := &csvFile{file: f, writer: csv.NewWriter(f)}
+      e.files[name] = c
+      err = c.writer.Write(header)
+      if err != nil {
+        e.Close()
+        return nil, err
+      }
+    }
+  }
+  return e, nil
+}
+
+//Outpoint formats the identifier of output index of transaction txid
+func Outpoint(txid string, index uint32) (string) {
+  return txid + ":" + strconv.FormatUint(uint64(index), 10)
+}
+
+//InputID formats the identifier of input index of transaction txid. It differs from the outpoint of the
+//output with the same index so the two are not mistaken for each other.
+func InputID(txid string, index int) (string) {
+  return txid + ":in:" + strconv.Itoa(index)
+}
+
+func (e *Exporter) write(name string, record ...string) (error) {
+  return e.files[name].writer.Write(record)
+}
+
+//WriteBlock writes the nodes and relationships for a single main chain block
+func (e *Exporter) WriteBlock(height int, b *block.Block) (error) {
+  blockHash := b.BlockHash.String()
+  previousHash := b.Header.PreviousBlockHash.String()
+  err := e.write("blocks.csv", blockHash, strconv.Itoa(height), previousHash, b.Header.MerkleRoot.String(),
+    fmt.Sprint(b.Header.FormatVersion), fmt.Sprint(b.Header.TimeStamp), fmt.Sprint(b.Header.TargetValue), fmt.Sprint(b.Header.Nonce),
+    fmt.Sprint(b.BlockLength), strconv.Itoa(len(b.Transactions)), "Block")
+  if err != nil {
+    return err
+  }
+  if height > 0 {
+    err = e.write("block_parent.csv", blockHash, previousHash, "CHILD_OF")
+    if err != nil {
+      return err
+    }
+  }
+
+  for t, tran := range b.Transactions {
+    txid := tran.TransactionHash.String()
+    err = e.write("transactions.csv", txid, fmt.Sprint(tran.TransactionVersionNumber), fmt.Sprint(tran.TransactionLockTime),
+      strconv.Itoa(len(tran.Inputs)), strconv.Itoa(len(tran.Outputs)), "Transaction")
+    if err != nil {
+      return err
+    }
+    err = e.write("block_contains.csv", blockHash, txid, strconv.Itoa(t), "CONTAINS")
+    if err != nil {
+      return err
+    }
+
+    for i, in := range tran.Inputs {
+      inputID := InputID(txid, i)
+      previousTxid := in.TransactionHash.String()
+      err = e.write("inputs.csv", inputID, txid, strconv.Itoa(i), previousTxid, fmt.Sprint(in.TransactionIndex), in.InputScriptHex(),
+        fmt.Sprint(in.SequenceNumber), "Input")
+      if err != nil {
+        return err
+      }
+      err = e.write("transaction_inputs.csv", txid, inputID, "HAS_INPUT")
+      if err != nil {
+        return err
+      }
+      if !in.TransactionHash.IsZero() {
+        err = e.write("output_spent_by.csv", Outpoint(previousTxid, in.TransactionIndex), inputID, "SPENT_BY")
+        if err != nil {
+          return err
+        }
+      }
+    }
+
+    for o, out := range tran.Outputs {
+      outpoint := Outpoint(txid, uint32(o))
+      err = e.write("outputs.csv", outpoint, txid, strconv.Itoa(o), fmt.Sprint(out.OutputValue), out.ChallengeScriptHex(), out.KeyType, "Output")
+      if err != nil {
+        return err
+      }
+      err = e.write("transaction_outputs.csv", txid, outpoint, "HAS_OUTPUT")
+      if err != nil {
+        return err
+      }
+      seen := make(map[string]bool)
+      for _, a := range out.Addresses {
+        if a.Address == "" || seen[a.Address] {
+          continue
+        }
+        seen[a.Address] = true
+        if _, written := e.addresses[a.Address]; !written {
+          e.addresses[a.Address] = struct{}{}
+          err = e.write("addresses.csv", a.Address, "Address")
+          if err != nil {
+            return err
+          }
+        }
+        err = e.write("output_pays.csv", outpoint, a.Address, "PAYS")
+        if err != nil {
+          return err
+        }
+      }
+    }
+  }
+  return nil
+}
+
+//ExportChain writes the main chain blocks listed in readchain with heights from to to, inclusive.
+//A negative to exports through to the tip.
+func (e *Exporter) ExportChain(readchain *blockchainreader.ReadChain, datLocation string, from int, to int) (error) {
+  return blockchainreader.WalkChain(readchain, datLocation, from, to, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    return e.WriteBlock(ib.Height, b)
+  })
+}
+
+//ImportArguments returns the neo4j-admin import arguments for the files in the export directory.
+//Each address is written once, but the duplicate coinbase transactions of BIP30 and their
+//outputs appear twice, so duplicate nodes are skipped. Spends of outputs outside the
+//exported range are dropped as bad relationships.
+func (e *Exporter) ImportArguments() ([]string) {
+  args := []string{"database", "import", "full", "--skip-duplicate-nodes=true", "--skip-bad-relationships=true"}
+  for _, name := range []string{"blocks.csv", "transactions.csv", "inputs.csv", "outputs.csv", "addresses.csv"} {
+    args = append(args, "--nodes=" + filepath.Join(e.Dir, name))
+  }
+  for _, name := range []string{"block_parent.csv", "block_contains.csv", "transaction_inputs.csv", "transaction_outputs.csv", "output_spent_by.csv", "output_pays.csv"} {
+    args = append(args, "--relationships=" + filepath.Join(e.Dir, name))
+  }
+  return args
+}
+
+//Close flushes and closes every output file, returning the first error encountered
+func (e *Exporter) Close() (error) {
+  var first error
+  for _, c := range e.files {
+    c.writer.Flush()
+    err := c.writer.Error()
+    if err == nil {
+      err = c.file.Close()
+    } else {
+      c.file.Close()
+    }
+    if err != nil && first == nil {
+      first = err
+    }
+  }
+  return first
+}
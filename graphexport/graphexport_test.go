@@ -0,0 +1,127 @@
+package graphexport_test
+
+import (
+    "encoding/csv"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/graphexport"
+)
+
+//p2pkh returns a pay to public key hash script for a hash160 of repeated b
+func p2pkh(b byte) ([]byte) {
+  script := []byte{0x76, 0xa9, 0x14}
+  for i := 0; i < 20; i++ {
+    script = append(script, b)
+  }
+  return append(script, 0x88, 0xac)
+}
+
+//decode decodes the serialization of a synthetic block so its output addresses are filled in
+func decode(t *testing.T, b *block.Block) (*block.Block) {
+  var decoded block.Block
+  err := blockchainbuilder.DecodeBlockBytes(b.Raw, &decoded, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return &decoded
+}
+
+func readCSV(t *testing.T, dir string, name string) ([][]string) {
+  f, err := os.Open(filepath.Join(dir, name))
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  rows, err := csv.NewReader(f).ReadAll()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return rows
+}
+
+func TestWriteBlock(t *testing.T) {
+  c := chaintest.NewChain()
+  first := c.Extend(1, "")[0]
+  spend := chaintest.Tx([]block.Input{chaintest.In(first.Transactions[0].TransactionHash, 0)},
+    chaintest.Out(1000, p2pkh(1)), chaintest.Out(2000, p2pkh(1)), chaintest.Out(3000, p2pkh(2)))
+  second := c.Mine(first.BlockHash, "", 0, spend)
+  txid := spend.TransactionHash.String()
+
+  dir := t.TempDir()
+  e, err := graphexport.NewExporter(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = e.WriteBlock(1, decode(t, first))
+  if err == nil {
+    err = e.WriteBlock(2, decode(t, second))
+  }
+  if err != nil {
+    e.Close()
+    t.Fatal(err)
+  }
+  err = e.Close()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  headers := map[string][]string{
+    "blocks.csv": {"hash:ID(Block)", "height:int", "previous_hash", "merkle_root", "version:long", "time_stamp:long", "target_value:long", "nonce:long", "block_length:long", "tx_count:int", ":LABEL"},
+    "inputs.csv": {"input_id:ID(Input)", "txid", "input_index:int", "previous_txid", "previous_output_index:long", "input_script", "sequence_number:long", ":LABEL"},
+    "outputs.csv": {"outpoint:ID(Output)", "txid", "output_index:int", "output_value:long", "challenge_script", "key_type", ":LABEL"},
+    "addresses.csv": {"address:ID(Address)", ":LABEL"},
+    "output_spent_by.csv": {":START_ID(Output)", ":END_ID(Input)", ":TYPE"},
+    "output_pays.csv": {":START_ID(Output)", ":END_ID(Address)", ":TYPE"},
+  }
+  rows := make(map[string][][]string)
+  for name, header := range headers {
+    rows[name] = readCSV(t, dir, name)
+    if !reflect.DeepEqual(rows[name][0], header) {
+      t.Errorf("%s header %v, want %v", name, rows[name][0], header)
+    }
+  }
+
+  blocks := rows["blocks.csv"][1:]
+  if len(blocks) != 2 || blocks[1][0] != second.BlockHash.String() || blocks[1][1] != "2" || blocks[1][2] != first.BlockHash.String() || blocks[1][9] != "2" {
+    t.Errorf("blocks.csv rows %v", blocks)
+  }
+
+  //both coinbases pay OP_TRUE, which has no address, and the spend pays two addresses three times
+  addresses := rows["addresses.csv"][1:]
+  if len(addresses) != 2 || addresses[0][0] == addresses[1][0] {
+    t.Errorf("addresses.csv rows %v, want each address once", addresses)
+  }
+  if pays := rows["output_pays.csv"][1:]; len(pays) != 3 || pays[0][0] != graphexport.Outpoint(txid, 0) || pays[0][2] != "PAYS" {
+    t.Errorf("output_pays.csv rows %v", pays)
+  }
+
+  inputID := graphexport.InputID(txid, 0)
+  if inputID == graphexport.Outpoint(txid, 0) {
+    t.Fatalf("input id %s collides with the outpoint of the same index", inputID)
+  }
+  found := false
+  for _, in := range rows["inputs.csv"][1:] {
+    if in[0] == inputID {
+      found = true
+      if in[1] != txid || in[3] != first.Transactions[0].TransactionHash.String() || in[4] != "0" {
+        t.Errorf("inputs.csv row %v", in)
+      }
+    }
+  }
+  if !found {
+    t.Errorf("no inputs.csv row for %s", inputID)
+  }
+  spent := rows["output_spent_by.csv"][1:]
+  want := []string{graphexport.Outpoint(first.Transactions[0].TransactionHash.String(), 0), inputID, "SPENT_BY"}
+  if len(spent) != 1 || !reflect.DeepEqual(spent[0], want) {
+    t.Errorf("output_spent_by.csv rows %v, want %v", spent, want)
+  }
+  if outputs := rows["outputs.csv"][1:]; len(outputs) != 5 {
+    t.Errorf("outputs.csv has %d rows, want 5", len(outputs))
+  }
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "strings"
+)
+
+//attribute keys shared by every package so log lines can be filtered consistently
+const (
+  KeyFile = "file"
+  KeyOffset = "offset"
+  KeyBlockHash = "block_hash"
+  KeyHeight = "height"
+  KeyTransaction = "txid"
+  KeyError = "err"
+)
+
+//ErrUnknownFormat is thrown when a log format other than text or json is requested
+var ErrUnknownFormat = errors.New("logging: format must be text or json")
+
+//ParseLevel converts a level name (debug, info, warn, error) to a slog level
+func ParseLevel(s string) (slog.Level, error) {
+  var level slog.Level
+  err := level.UnmarshalText([]byte(strings.ToUpper(s)))
+  if err != nil {
+    return 0, fmt.Errorf("logging: unknown level %q", s)
+  }
+  return level, nil
+}
+
+//Setup installs a default logger writing to w at the named level in text or json format
+func Setup(w io.Writer, level string, format string) (error) {
+  l, err := ParseLevel(level)
+  if err != nil {
+    return err
+  }
+  opts := &slog.HandlerOptions{Level: l}
+  var handler slog.Handler
+  switch format {
+  case "text":
+    handler = slog.NewTextHandler(w, opts)
+  case "json":
+    handler = slog.NewJSONHandler(w, opts)
+  default:
+    return ErrUnknownFormat
+  }
+  slog.SetDefault(slog.New(handler))
+  return nil
+}
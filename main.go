@@ -1,184 +1,212 @@
 package main
 
 import (
+    "errors"
+    "flag"
     "fmt"
-    "log"
     "os"
-    "io"
-    "flag"
+    "runtime"
     "strconv"
     "strings"
-    "github.com/tgebhart/goparsebtc/blockchainbuilder"
-    "github.com/tgebhart/goparsebtc/block"
-    "github.com/tgebhart/goparsebtc/filefunctions"
-    "github.com/tgebhart/goparsebtc/blockvalidation"
-    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/logging"
+    "github.com/tgebhart/goparsebtc/network"
+)
+
+//exit codes returned by the command line
+const (
+  exitOK = 0
+  exitFailure = 1
+  exitUsage = 2
 )
 
-//CHECKEVERY determines how many blocks go unchecked before we check the next block using blockchain.info
-var CHECKEVERY = 200
+//errUsage is returned by a command when its arguments are invalid
+var errUsage = errors.New("invalid usage")
+
+//command describes a single subcommand
+type command struct {
+  name string
+  summary string
+  run func(args []string) (error)
+}
+
+var commands = []command{
+  {"index", "scan blk files and write the main chain reference file", runIndex},
+  {"export", "load indexed blocks into PostgreSQL or write Neo4j import files", runExport},
+  {"inspect-block", "print a block by hash or height", runInspectBlock},
+  {"inspect-tx", "print a transaction by txid", runInspectTx},
+  {"verify", "check block hashes, merkle roots and chain linkage", runVerify},
+  {"verify-scripts", "run the scripts of each input against the output it spends", runVerifyScripts},
+  {"validate", "apply the consensus rules to each block and report the rules broken", runValidate},
+  {"stats", "summarize blocks, transactions and outputs over a height range", runStats},
+  {"coinbase", "report coinbase heights, miner tags and mining pool shares", runCoinbase},
+  {"supply", "account for issued, unclaimed and unspendable coins and report the supply", runSupply},
+  {"nulldata", "export OP_RETURN payloads by height, tagged by protocol", runNullData},
+  {"follow", "keep the reference file current as bitcoind writes new blocks", runFollow},
+}
 
-var datLocation = "/Users/tgebhart/Library/Application Support/Bitcoin/blocks/"
 /******************************MAIN********************************************/
 
 func main() {
-  path := datLocation
-  flag.Parse()
-    s := flag.Arg(0)
-    f := flag.Arg(1)
-    dumpLocation := flag.Arg(2)
-
-    var start int
-    var finish int
-    var err error
-
-    if s != "" && strings.Compare(s, "inspect") != 0{
-      start, err = strconv.Atoi(s)
-      if err != nil {
-        fmt.Println(err)
-        os.Exit(2)
-      }
-    }
+  os.Exit(run(os.Args[1:]))
+}
 
-    if f != "" && strings.Compare(f, "map") != 0 && strings.Compare(f, "upload") != 0 {
-      finish, err = strconv.Atoi(f)
-      if err != nil {
-        fmt.Println(err)
-        os.Exit(2)
+func run(args []string) (int) {
+  if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+    usage()
+    if len(args) == 0 {
+      return exitUsage
+    }
+    return exitOK
+  }
+  for _, c := range commands {
+    if c.name == args[0] {
+      err := c.run(args[1:])
+      if err == nil {
+        return exitOK
+      }
+      if err == errUsage || err == flag.ErrHelp {
+        if err == flag.ErrHelp {
+          return exitOK
+        }
+        return exitUsage
       }
+      fmt.Fprintln(os.Stderr, "goparsebtc " + c.name + ":", err)
+      return exitFailure
     }
+  }
+  fmt.Fprintf(os.Stderr, "goparsebtc: unknown command %q\n\n", args[0])
+  usage()
+  return exitUsage
+}
 
-  if finish != 0 {
+func usage() {
+  fmt.Fprintln(os.Stderr, "Usage: goparsebtc <command> [flags]")
+  fmt.Fprintln(os.Stderr, "")
+  fmt.Fprintln(os.Stderr, "Commands:")
+  for _, c := range commands {
+    fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+  }
+  fmt.Fprintln(os.Stderr, "")
+  fmt.Fprintln(os.Stderr, "Run 'goparsebtc <command> -h' for the flags of a command.")
+}
 
-    var blockCounter = 0
+//options holds the flag values shared between commands
+type options struct {
+  datadir string
+  networkName string
+  reference string
+  format string
+  heights string
+  workers int
+  logLevel string
+  logFormat string
+
+  from int
+  to int
+}
 
-    chain :=  blockchainbuilder.NewBlockchain()
-    var key string
+//newFlagSet creates the flag set for a command along with its help text and the logging flags every command takes
+func (o *options) newFlagSet(name string, synopsis string, description string) (*flag.FlagSet) {
+  fs := flag.NewFlagSet(name, flag.ContinueOnError)
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "Usage: goparsebtc %s %s\n\n%s\n\nFlags:\n", name, synopsis, description)
+    fs.PrintDefaults()
+  }
+  fs.StringVar(&o.logLevel, "log-level", "info", "minimum level of log lines written to stderr: debug, info, warn or error")
+  fs.StringVar(&o.logFormat, "log-format", "text", "log line format: text or json")
+  return fs
+}
 
+func (o *options) addDataFlags(fs *flag.FlagSet) {
+  fs.StringVar(&o.datadir, "datadir", "", "directory holding the blk*.dat files (default: bitcoind's blocks directory for the network)")
+  fs.StringVar(&o.networkName, "network", network.MainNet.Name, "network the blk files belong to: mainnet, testnet, signet or regtest")
+  fs.StringVar(&o.reference, "reference", "mainchain.csv", "main chain reference file written by index")
+}
 
-    for j := start; j <= finish; j++ {
-      path = datLocation
-      e := strconv.Itoa(j)
-      tempString := e
-      for k := len(e); k < 5; k++ {
-        tempString = "0" + tempString
-      }
-      pathEndpoint := "blk" + tempString + ".dat"
-      path = path + pathEndpoint
+func (o *options) addRangeFlags(fs *flag.FlagSet) {
+  fs.StringVar(&o.heights, "heights", "", "height range to process as FROM:TO, inclusive; either end may be omitted")
+}
 
-      file, err := os.Open(path)
-      if err != nil {
-          log.Fatal("Error while opening file", err)
-      }
-      fmt.Printf("%s opened\n", path)
-      var bytesRead = 0
-      var lengthRead = 0
-      defer file.Close()
-      err = nil
-      for err == nil {
-        fmt.Println("++++++++++++++++++++++++++++++++++++ BLOCK ", blockCounter, " +++++++++++++++++++++++++++++++++++++++++++")
-        Block := block.Block{}
-
-        err = chain.ParseIndividualBlockSuppressOutput(&Block, file)
-        if err != nil {
-          if err == io.EOF { //reached end of file
-            fmt.Println("EOF, opening next file")
-            break
-          }
-          if err == blockvalidation.ErrMultiSig {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n MultiSigErr \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            //log.Fatal(err)
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == blockchainbuilder.ErrBadFormatVersion {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Found bad format version \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == blockchainbuilder.ErrBadOutputValue {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Found bad Output Value \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == blockchainbuilder.ErrBadSequenceNumber {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Found bad Sequence Number \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == blockchainbuilder.ErrBadTransactionVersion{
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Found bad Transaction Version \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == blockvalidation.ErrZeroOutputScript {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Zero Output Script \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            err = nil
-            chain.PrepareSkipBlock(&Block, pathEndpoint, blockCounter, bytesRead, file)
-          }
-          if err == filefunctions.ErrDetailedMagic {
-            fmt.Println("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@ \n Problem Looking for Magic Byte-by-Byte \n @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
-            break
-          }
-          if err == blockchainbuilder.ErrBadMagic {
-            log.Fatal(err)
-          }
-        }
-        fmt.Println(blockvalidation.ReverseEndian(Block.BlockHash))
-        if Block.HashBlock.CompressedBlockHash != "" {
-          key = Block.HashBlock.CompressedBlockHash
-        }
-        Block.HashBlock.FileEndpoint = pathEndpoint
-        Block.HashBlock.RawBlockNumber = blockCounter
-        Block.HashBlock.LengthRead = lengthRead
+func (o *options) addFormatFlags(fs *flag.FlagSet) {
+  fs.StringVar(&o.format, "format", "text", "output format: text, json or csv")
+}
 
-        //Add HashBlock to Blockchain hashmap
-        if Block.HashBlock.CompressedBlockHash == "" {
-          fmt.Println("ZERO HASH BLOCK AT", Block.HashBlock.PreviousCompressedBlockHash)
-        }
-        chain.BlockMap[Block.HashBlock.CompressedBlockHash] = Block.HashBlock
-
-        //if blockCounter % CHECKEVERY == 0 {
-          //fmt.Println("?? Checking Block ??")
-          //err = blockvalidation.BlockChainInfoValidation(&Block)
-        //}
-        //if err != nil {
-          //log.Fatal("error in blockchain.info validation")
-        //}
-        bytesRead += filefunctions.GetByteCount()
-        lengthRead += int(Block.BlockLength)
-        blockCounter++
-      }
-      fmt.Println("Bytes read: ", bytesRead)
-      fmt.Println("Closing file...", path)
-      file.Close()
-    }
+func (o *options) addWorkerFlags(fs *flag.FlagSet) {
+  fs.IntVar(&o.workers, "workers", runtime.NumCPU(), "number of worker goroutines")
+}
 
-    fmt.Println("About to call main write")
-    err := blockchainbuilder.WriteMainChainToFile(chain, key, dumpLocation)
+//parse parses args into fs and validates the shared options
+func (o *options) parse(fs *flag.FlagSet, args []string) (error) {
+  o.to = -1
+  err := fs.Parse(args)
+  if err != nil {
+    if err == flag.ErrHelp {
+      return err
+    }
+    return errUsage
+  }
+  err = logging.Setup(os.Stderr, o.logLevel, o.logFormat)
+  if err != nil {
+    return o.usageError(fs, err)
+  }
+  if o.networkName != "" {
+    p, err := network.Lookup(o.networkName)
     if err != nil {
-      log.Fatal(err)
+      return o.usageError(fs, err)
     }
-  } else {
-
-    if f == "map" && dumpLocation != "" {
-
-      readchain := blockchainreader.NewReadChain()
-      mainchain := blockchainreader.NewBlockchain()
-
-      err = blockchainreader.ReadReferenceFile(readchain, dumpLocation)
-      if err != nil {
-        log.Fatal(err)
-      }
+    network.Active = p
+  }
+  if fs.Lookup("datadir") != nil && o.datadir == "" {
+    o.datadir = network.Active.DefaultBlocksDirectory()
+  }
+  if o.datadir != "" && !strings.HasSuffix(o.datadir, string(os.PathSeparator)) {
+    o.datadir += string(os.PathSeparator)
+  }
+  if o.heights != "" {
+    o.from, o.to, err = parseRange(o.heights)
+    if err != nil {
+      return o.usageError(fs, err)
+    }
+  }
+  if fs.Lookup("format") != nil && o.format != "text" && o.format != "json" && o.format != "csv" {
+    return o.usageError(fs, fmt.Errorf("unknown format %q", o.format))
+  }
+  if fs.Lookup("workers") != nil && o.workers < 1 {
+    return o.usageError(fs, errors.New("workers must be at least 1"))
+  }
+  return nil
+}
 
-      fmt.Println(mainchain)
-      err = blockchainreader.LoadChain(mainchain, readchain, datLocation)
-      if err != nil {
-        log.Fatal(err)
-      }
+func (o *options) usageError(fs *flag.FlagSet, err error) (error) {
+  fmt.Fprintln(fs.Output(), "goparsebtc " + fs.Name() + ":", err)
+  fs.Usage()
+  return errUsage
+}
 
+//inRange reports whether height lies within the parsed height range
+func (o *options) inRange(height int) (bool) {
+  return height >= o.from && (o.to < 0 || height <= o.to)
+}
 
+//parseRange parses FROM:TO into an inclusive range. A missing TO is returned as -1
+func parseRange(s string) (int, int, error) {
+  parts := strings.SplitN(s, ":", 2)
+  from, to := 0, -1
+  var err error
+  if parts[0] != "" {
+    from, err = strconv.Atoi(parts[0])
+    if err != nil || from < 0 {
+      return 0, 0, fmt.Errorf("bad range start %q", parts[0])
     }
   }
-
+  if len(parts) == 1 {
+    return from, from, nil
+  }
+  if parts[1] != "" {
+    to, err = strconv.Atoi(parts[1])
+    if err != nil || to < from {
+      return 0, 0, fmt.Errorf("bad range end %q", parts[1])
+    }
+  }
+  return from, to, nil
 }
@@ -0,0 +1,155 @@
+package network
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "runtime"
+    "github.com/tgebhart/goparsebtc/block"
+)
+
+//Params holds the values that differ between bitcoin networks
+type Params struct {
+  Name string
+  Magic uint32
+  PubKeyHashAddressID byte
+  ScriptHashAddressID byte
+  Bech32Prefix string
+  DataSubdirectory string
+  GenesisBlockHash block.Hash
+  //SubsidyHalvingInterval is the number of blocks between halvings of the block subsidy
+  SubsidyHalvingInterval int
+  //BIP16Exception is the one block whose scripts are checked without BIP16, as it spends an invalid P2SH output
+  BIP16Exception block.Hash
+  //TaprootException is the one block whose scripts are checked without taproot, as it spends an invalid taproot output
+  TaprootException block.Hash
+  //BIP30Exceptions are the two blocks allowed to repeat the txid of a transaction with unspent outputs, overwriting
+  //them, as their coinbases did before BIP30 forbade it
+  BIP30Exceptions []block.Hash
+  //BIP34Height is the first block whose coinbase must start with its height and whose version must be at least 2
+  BIP34Height int
+  //BIP66Height, BIP65Height, CSVHeight and SegwitHeight are the first blocks checked with strict DER signatures,
+  //OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY and BIP147's empty multisig dummy
+  BIP66Height int
+  BIP65Height int
+  CSVHeight int
+  SegwitHeight int
+}
+
+//mustParseHash parses the display order hash of a network constant
+func mustParseHash(s string) (block.Hash) {
+  h, err := block.ParseHash(s)
+  if err != nil {
+    panic(err)
+  }
+  return h
+}
+
+//MainNet holds the parameters of the main bitcoin network
+var MainNet = Params{
+  Name: "mainnet",
+  Magic: 0xD9B4BEF9,
+  PubKeyHashAddressID: 0x00,
+  ScriptHashAddressID: 0x05,
+  Bech32Prefix: "bc",
+  DataSubdirectory: "",
+  GenesisBlockHash: mustParseHash("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"),
+  SubsidyHalvingInterval: 210000,
+  BIP16Exception: mustParseHash("00000000000002dc756eebf4f49723ed8d30cc28a5f108eb94b1ba88ac4f9c22"),
+  TaprootException: mustParseHash("0000000000000000000f14c35b2d841e986ab5441de8c585d5ffe55ea1e395ad"),
+  BIP30Exceptions: []block.Hash{
+    mustParseHash("00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec"),
+    mustParseHash("00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721"),
+  },
+  BIP34Height: 227931,
+  BIP66Height: 363725,
+  BIP65Height: 388381,
+  CSVHeight: 419328,
+  SegwitHeight: 481824,
+}
+
+//TestNet holds the parameters of testnet3
+var TestNet = Params{
+  Name: "testnet",
+  Magic: 0x0709110B,
+  PubKeyHashAddressID: 0x6f,
+  ScriptHashAddressID: 0xc4,
+  Bech32Prefix: "tb",
+  DataSubdirectory: "testnet3",
+  GenesisBlockHash: mustParseHash("000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"),
+  SubsidyHalvingInterval: 210000,
+  BIP16Exception: mustParseHash("00000000dd30457c001f4095d208cc1296b0eed002427aa599874af7a432b105"),
+  BIP34Height: 21111,
+  BIP66Height: 330776,
+  BIP65Height: 581885,
+  CSVHeight: 770112,
+  SegwitHeight: 834624,
+}
+
+//SigNet holds the parameters of the default signet
+var SigNet = Params{
+  Name: "signet",
+  Magic: 0x40CF030A,
+  PubKeyHashAddressID: 0x6f,
+  ScriptHashAddressID: 0xc4,
+  Bech32Prefix: "tb",
+  DataSubdirectory: "signet",
+  GenesisBlockHash: mustParseHash("00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"),
+  SubsidyHalvingInterval: 210000,
+  BIP34Height: 1,
+  BIP66Height: 1,
+  BIP65Height: 1,
+  CSVHeight: 1,
+  SegwitHeight: 1,
+}
+
+//RegTest holds the parameters of the regression test network
+var RegTest = Params{
+  Name: "regtest",
+  Magic: 0xDAB5BFFA,
+  PubKeyHashAddressID: 0x6f,
+  ScriptHashAddressID: 0xc4,
+  Bech32Prefix: "bcrt",
+  DataSubdirectory: "regtest",
+  GenesisBlockHash: mustParseHash("0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"),
+  SubsidyHalvingInterval: 150,
+  BIP34Height: 1,
+  BIP66Height: 1,
+  BIP65Height: 1,
+  CSVHeight: 1,
+  SegwitHeight: 1,
+}
+
+//Active holds the parameters of the network currently being parsed
+var Active = &MainNet
+
+//ErrUnknownNetwork is thrown when a network name does not match any known network
+var ErrUnknownNetwork = errors.New("network: unknown network name")
+
+//Lookup returns the parameters for a network name
+func Lookup(name string) (*Params, error) {
+  for _, p := range []*Params{&MainNet, &TestNet, &SigNet, &RegTest} {
+    if p.Name == name {
+      return p, nil
+    }
+  }
+  return nil, ErrUnknownNetwork
+}
+
+//DefaultBlocksDirectory returns the blocks directory bitcoind uses on this platform for the network
+func (p *Params) DefaultBlocksDirectory() (string) {
+  home, err := os.UserHomeDir()
+  if err != nil {
+    home = "."
+  }
+  var base string
+  switch runtime.GOOS {
+  case "darwin":
+    base = filepath.Join(home, "Library", "Application Support", "Bitcoin")
+  case "windows":
+    base = filepath.Join(os.Getenv("APPDATA"), "Bitcoin")
+  default:
+    base = filepath.Join(home, ".bitcoin")
+  }
+  return filepath.Join(base, p.DataSubdirectory, "blocks") + string(filepath.Separator)
+}
@@ -0,0 +1,153 @@
+package nulldata
+
+import (
+    "bytes"
+    "crypto/rc4"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//protocols recognized in OP_RETURN outputs and witnesses
+const (
+  Omni = "omni"
+  Counterparty = "counterparty"
+  //OpenTimestamps calendars commit a bare 32 byte digest with no marker, so any single 32 byte push is tagged with it
+  OpenTimestamps = "opentimestamps"
+  Runes = "runes"
+  Ordinals = "ordinals"
+)
+
+//op codes that mark data
+const (
+  opIf = 0x63
+  opEndIf = 0x68
+  //opRunes follows the OP_RETURN of a runestone
+  opRunes = 0x5d
+)
+
+var (
+  omniMarker = []byte("omni")
+  counterpartyMarker = []byte("CNTRPRTY")
+  ordinalsMarker = []byte("ord")
+)
+
+//Parse reads the OP_RETURN output script s of a transaction whose inputs are ins, returning nil when s does not
+//start with OP_RETURN. Counterparty data is encrypted with the txid its first input spends from, which is why the
+//inputs are needed. Data that cannot be parsed as pushes is kept whole as the last payload.
+func Parse(s []byte, ins []block.Input) (*block.NullData) {
+  if len(s) == 0 || s[0] != script.OPRETURN {
+    return nil
+  }
+  n := &block.NullData{}
+  pos := 1
+  runestone := len(s) > 1 && s[1] == opRunes
+  if runestone {
+    pos = 2
+  }
+  for pos < len(s) {
+    op, next, err := script.Next(s, pos)
+    if err != nil {
+      n.Payloads = append(n.Payloads, s[pos:])
+      break
+    }
+    if op.IsPush() {
+      n.Payloads = append(n.Payloads, op.Data)
+    }
+    pos = next
+  }
+  switch {
+  case runestone:
+    n.Protocol = Runes
+  case len(n.Payloads) > 0 && bytes.HasPrefix(n.Payloads[0], omniMarker):
+    n.Protocol = Omni
+  case counterparty(n, ins):
+    n.Protocol = Counterparty
+  case len(n.Payloads) == 1 && len(n.Payloads[0]) == 32:
+    n.Protocol = OpenTimestamps
+  }
+  return n
+}
+
+//counterparty reports whether the data starts with Counterparty's marker, either plainly or encrypted with ARC4
+//keyed by the txid the first input spends from, as it is written in hex
+func counterparty(n *block.NullData, ins []block.Input) (bool) {
+  data := n.Data()
+  if bytes.HasPrefix(data, counterpartyMarker) {
+    return true
+  }
+  if len(ins) == 0 || len(data) < len(counterpartyMarker) {
+    return false
+  }
+  key := ins[0].TransactionHash
+  for i := 0; i < block.HashLength/2; i++ {
+    key[i], key[block.HashLength-1-i] = key[block.HashLength-1-i], key[i]
+  }
+  cipher, err := rc4.NewCipher(key[:])
+  if err != nil {
+    return false
+  }
+  prefix := make([]byte, len(counterpartyMarker))
+  cipher.XORKeyStream(prefix, data[:len(prefix)])
+  return bytes.Equal(prefix, counterpartyMarker)
+}
+
+//Envelope is an ordinals inscription: data in a taproot script behind OP_FALSE OP_IF "ord", which never runs
+type Envelope struct {
+  //Input is the index of the input whose witness holds the envelope
+  Input int
+  ContentType string
+  Body []byte
+}
+
+//Envelopes returns the ordinals inscriptions in the witnesses of tx. An inscription lives in the script of a
+//taproot script path spend, which comes before the control block at the end of the witness and any annex.
+func Envelopes(tx *block.Transaction) ([]Envelope) {
+  var found []Envelope
+  for i := range tx.Inputs {
+    w := tx.Inputs[i].Witness
+    if len(w) > 1 && len(w[len(w)-1]) > 0 && w[len(w)-1][0] == 0x50 {
+      w = w[:len(w)-1]
+    }
+    if len(w) < 2 {
+      continue
+    }
+    for _, e := range envelopes(w[len(w)-2]) {
+      e.Input = i
+      found = append(found, e)
+    }
+  }
+  return found
+}
+
+//envelopes reads the inscriptions in a tapscript. Fields come in tag and value pairs after the marker; tag 1 is the
+//content type and an empty tag starts the body, which runs in pushes to OP_ENDIF.
+func envelopes(s []byte) ([]Envelope) {
+  ops, _ := script.Parse(s)
+  var found []Envelope
+  for i := 0; i + 2 < len(ops); i++ {
+    if ops[i].Code != script.OP0 || ops[i+1].Code != opIf || !bytes.Equal(ops[i+2].Data, ordinalsMarker) {
+      continue
+    }
+    var e Envelope
+    j := i + 3
+    for j < len(ops) && ops[j].Code != opEndIf {
+      tag := ops[j]
+      if tag.Code == script.OP0 {
+        for j++; j < len(ops) && ops[j].IsPush(); j++ {
+          e.Body = append(e.Body, ops[j].Data...)
+        }
+        break
+      }
+      if j + 1 >= len(ops) {
+        break
+      }
+      if n, ok := tag.SmallInt(); (ok && n == 1) || bytes.Equal(tag.Data, []byte{1}) {
+        e.ContentType = string(ops[j+1].Data)
+      }
+      j += 2
+    }
+    found = append(found, e)
+    i = j
+  }
+  return found
+}
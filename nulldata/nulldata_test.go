@@ -0,0 +1,130 @@
+package nulldata_test
+
+import (
+    "bytes"
+    "crypto/rc4"
+    "encoding/hex"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/nulldata"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//spending is the txid the first input of the tested transactions spends from
+var spending = block.Hash{0x01, 0x02, 0x03, 0xff}
+
+//counterpartyScript returns an OP_RETURN script carrying message behind the Counterparty marker, encrypted as
+//Counterparty encrypts it with the txid of the output the first input spends, in display order
+func counterpartyScript(message []byte) ([]byte) {
+  key, _ := hex.DecodeString(spending.String())
+  cipher, _ := rc4.NewCipher(key)
+  data := append([]byte("CNTRPRTY"), message...)
+  cipher.XORKeyStream(data, data)
+  return append([]byte{0x6a, byte(len(data))}, data...)
+}
+
+func TestParse(t *testing.T) {
+  digest := bytes.Repeat([]byte{0x5a}, 32)
+  tests := []struct {
+    name string
+    script []byte
+    protocol string
+    payloads []string
+  }{
+    {"omni simple send", chaintest.MustHex("6a146f6d6e6900000000000000010000000005f5e100"), nulldata.Omni, []string{"6f6d6e6900000000000000010000000005f5e100"}},
+    {"counterparty plain", append([]byte{0x6a, 0x0a}, "CNTRPRTY\x00\x14"...), nulldata.Counterparty, []string{"434e545250525459" + "0014"}},
+    {"counterparty encrypted", counterpartyScript([]byte{0, 0, 0, 20}), nulldata.Counterparty, nil},
+    {"timestamp", append([]byte{0x6a, 0x20}, digest...), nulldata.OpenTimestamps, []string{hex.EncodeToString(digest)}},
+    {"runestone", chaintest.MustHex("6a5d0614c0a233ce08"), nulldata.Runes, []string{"14c0a233ce08"}},
+    {"text over two pushes", append(append([]byte{0x6a, 0x05}, "hello"...), 0x4c, 0x06, ' ', 'w', 'o', 'r', 'l', 'd'), "", []string{hex.EncodeToString([]byte("hello")), hex.EncodeToString([]byte(" world"))}},
+    {"bare", []byte{0x6a}, "", nil},
+    {"truncated push", []byte{0x6a, 0x05, 0x01}, "", []string{"0501"}},
+    //the 40 byte output once taken for a stealth address key
+    {"forty bytes", append([]byte{0x6a, 0x26, 0x06}, bytes.Repeat([]byte{0x42}, 37)...), "", []string{"06" + hex.EncodeToString(bytes.Repeat([]byte{0x42}, 37))}},
+  }
+  ins := []block.Input{chaintest.In(spending, 0)}
+  for _, test := range tests {
+    n := nulldata.Parse(test.script, ins)
+    if n == nil || n.Protocol != test.protocol {
+      t.Errorf("%s: parsed as %+v, want protocol %q", test.name, n, test.protocol)
+      continue
+    }
+    if test.payloads == nil {
+      continue
+    }
+    if len(n.Payloads) != len(test.payloads) {
+      t.Errorf("%s: %d payloads, want %d", test.name, len(n.Payloads), len(test.payloads))
+      continue
+    }
+    for i, p := range test.payloads {
+      if hex.EncodeToString(n.Payloads[i]) != p {
+        t.Errorf("%s: payload %d is %x, want %s", test.name, i, n.Payloads[i], p)
+      }
+    }
+  }
+  if n := nulldata.Parse(chaintest.OpTrue, ins); n != nil {
+    t.Errorf("OP_TRUE parsed as %+v", n)
+  }
+  //encrypted Counterparty data is not recognized under another key
+  if n := nulldata.Parse(counterpartyScript([]byte{0, 0, 0, 20}), []block.Input{chaintest.In(block.Hash{9}, 0)}); n.Protocol == nulldata.Counterparty {
+    t.Errorf("Counterparty data recognized under the wrong key")
+  }
+}
+
+func TestOutputScriptNullData(t *testing.T) {
+  out := block.Output{ChallengeScript: append([]byte{0x6a, 0x26}, bytes.Repeat([]byte{0x42}, 38)...)}
+  keyType, err := blockvalidation.ParseOutputScript(&out)
+  if err != nil || keyType != script.NullData || len(out.Addresses) != 0 {
+    t.Fatalf("40 byte OP_RETURN classified as %q with addresses %+v, %v", keyType, out.Addresses, err)
+  }
+
+  //decoded blocks carry the data of their OP_RETURN outputs
+  c := chaintest.NewChain()
+  c.Extend(1, "")
+  tx := chaintest.Tx([]block.Input{chaintest.In(c.Order[1].Transactions[0].TransactionHash, 0)},
+    chaintest.Out(0, chaintest.MustHex("6a146f6d6e6900000000000000010000000005f5e100")), chaintest.Out(1, chaintest.OpTrue))
+  b := c.Mine(c.Tip, "", 0, tx)
+  var decoded block.Block
+  err = blockchainbuilder.ParseBytesOnly(&decoded, b.Raw)
+  if err != nil {
+    t.Fatal(err)
+  }
+  outs := decoded.Transactions[1].Outputs
+  if outs[0].KeyType != script.NullData || outs[0].NullData == nil || outs[0].NullData.Protocol != nulldata.Omni || outs[1].NullData != nil {
+    t.Fatalf("decoded outputs %+v", outs)
+  }
+}
+
+func TestEnvelopes(t *testing.T) {
+  key := bytes.Repeat([]byte{0x11}, 32)
+  contentType := "text/plain;charset=utf-8"
+  tapscript := append(append([]byte{0x20}, key...), 0xac, 0x00, 0x63, 0x03, 'o', 'r', 'd', 0x01, 0x01, byte(len(contentType)))
+  tapscript = append(tapscript, contentType...)
+  tapscript = append(tapscript, 0x00, 0x05, 'h', 'e', 'l', 'l', 'o', 0x02, ' ', '!', 0x68)
+  control := append([]byte{0xc1}, key...)
+  sig := bytes.Repeat([]byte{0x22}, 64)
+  tx := chaintest.Tx([]block.Input{chaintest.In(spending, 0), chaintest.In(spending, 1), chaintest.In(spending, 2)}, chaintest.Out(1, chaintest.OpTrue))
+  tx.Inputs[0].Witness = [][]byte{sig}
+  tx.Inputs[1].Witness = [][]byte{sig, tapscript, control}
+  //an annex after the control block
+  tx.Inputs[2].Witness = [][]byte{sig, tapscript, control, {0x50, 0x01}}
+  found := nulldata.Envelopes(&tx)
+  if len(found) != 2 {
+    t.Fatalf("found %+v, want inscriptions in inputs 1 and 2", found)
+  }
+  for i, e := range found {
+    if e.Input != i + 1 || e.ContentType != contentType || string(e.Body) != "hello !" {
+      t.Errorf("inscription %d is %+v", i, e)
+    }
+  }
+  //OP_1 also tags the content type
+  tapscript = []byte{0x00, 0x63, 0x03, 'o', 'r', 'd', 0x51, 0x09, 'i', 'm', 'a', 'g', 'e', '/', 'p', 'n', 'g', 0x00, 0x01, 0x89, 0x68}
+  tx.Inputs[1].Witness = [][]byte{tapscript, control}
+  tx.Inputs[2].Witness = nil
+  if found = nulldata.Envelopes(&tx); len(found) != 1 || found[0].ContentType != "image/png" || !bytes.Equal(found[0].Body, []byte{0x89}) {
+    t.Errorf("found %+v", found)
+  }
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/coinbase"
+    "github.com/tgebhart/goparsebtc/consensus"
+    "github.com/tgebhart/goparsebtc/follow"
+    "github.com/tgebhart/goparsebtc/nulldata"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/scriptcheck"
+    "github.com/tgebhart/goparsebtc/spend"
+    "github.com/tgebhart/goparsebtc/supply"
+)
+
+//blockView holds the printable form of a block with hashes in display order
+type blockView struct {
+  Height int `json:"height"`
+  Hash string `json:"hash"`
+  PreviousHash string `json:"previous_hash"`
+  MerkleRoot string `json:"merkle_root"`
+  Version uint32 `json:"version"`
+  Time uint32 `json:"time"`
+  Bits uint32 `json:"bits"`
+  Nonce uint32 `json:"nonce"`
+  Size uint32 `json:"size"`
+  Transactions []transactionView `json:"transactions"`
+}
+
+//transactionView holds the printable form of a transaction
+type transactionView struct {
+  Txid string `json:"txid"`
+  BlockHeight int `json:"block_height,omitempty"`
+  BlockHash string `json:"block_hash,omitempty"`
+  Version uint32 `json:"version"`
+  LockTime uint32 `json:"lock_time"`
+  Inputs []inputView `json:"inputs"`
+  Outputs []outputView `json:"outputs"`
+}
+
+//inputView holds the printable form of an input
+type inputView struct {
+  PreviousTxid string `json:"previous_txid"`
+  PreviousIndex uint32 `json:"previous_index"`
+  Script string `json:"script"`
+  Sequence uint32 `json:"sequence"`
+  Witness []string `json:"witness,omitempty"`
+  Spend *spendView `json:"spend,omitempty"`
+}
+
+//spendView holds the printable form of what an input's script and witness reveal about the output it spends
+type spendView struct {
+  Type string `json:"type"`
+  Address string `json:"address,omitempty"`
+  PublicKey string `json:"public_key,omitempty"`
+  PublicKeys []string `json:"public_keys,omitempty"`
+  Required int `json:"required,omitempty"`
+  Signatures []signatureView `json:"signatures,omitempty"`
+  RedeemScript string `json:"redeem_script,omitempty"`
+  WitnessScript string `json:"witness_script,omitempty"`
+}
+
+//signatureView holds the printable form of a signature
+type signatureView struct {
+  R string `json:"r"`
+  S string `json:"s"`
+  HashType string `json:"hash_type"`
+  Schnorr bool `json:"schnorr,omitempty"`
+  Strict bool `json:"strict"`
+}
+
+//outputView holds the printable form of an output
+type outputView struct {
+  Value uint64 `json:"value"`
+  Script string `json:"script"`
+  KeyType string `json:"key_type"`
+  Addresses []string `json:"addresses"`
+  NullData *nullDataView `json:"nulldata,omitempty"`
+}
+
+//nullDataView holds the printable form of the data an OP_RETURN output carries
+type nullDataView struct {
+  Protocol string `json:"protocol,omitempty"`
+  Payloads []string `json:"payloads"`
+}
+
+//verifyFailure records a single rule a block failed during verify
+type verifyFailure struct {
+  Height int `json:"height"`
+  BlockHash string `json:"block_hash"`
+  Rule string `json:"rule"`
+  Detail string `json:"detail"`
+}
+
+func newBlockView(height int, b *block.Block) (blockView) {
+  v := blockView{
+    Height: height,
+    Hash: b.BlockHash.String(),
+    PreviousHash: b.Header.PreviousBlockHash.String(),
+    MerkleRoot: b.Header.MerkleRoot.String(),
+    Version: b.Header.FormatVersion,
+    Time: b.Header.TimeStamp,
+    Bits: b.Header.TargetValue,
+    Nonce: b.Header.Nonce,
+    Size: b.BlockLength,
+  }
+  for t := range b.Transactions {
+    v.Transactions = append(v.Transactions, newTransactionView(&b.Transactions[t], nil))
+  }
+  return v
+}
+
+//newTransactionView returns the printable form of t. prevouts holds the output script each input spends and may be
+//nil, in which case the spends are read from the input scripts and witnesses alone.
+func newTransactionView(t *block.Transaction, prevouts [][]byte) (transactionView) {
+  v := transactionView{
+    Txid: t.TransactionHash.String(),
+    Version: t.TransactionVersionNumber,
+    LockTime: t.TransactionLockTime,
+  }
+  spends := spend.Transaction(t, prevouts)
+  for i, in := range t.Inputs {
+    iv := inputView{
+      PreviousTxid: in.TransactionHash.String(),
+      PreviousIndex: in.TransactionIndex,
+      Script: in.InputScriptHex(),
+      Sequence: in.SequenceNumber,
+      Spend: newSpendView(spends[i]),
+    }
+    for _, item := range in.Witness {
+      iv.Witness = append(iv.Witness, hex.EncodeToString(item))
+    }
+    v.Inputs = append(v.Inputs, iv)
+  }
+  for _, out := range t.Outputs {
+    ov := outputView{Value: out.OutputValue, Script: out.ChallengeScriptHex(), KeyType: out.KeyType}
+    for _, a := range out.Addresses {
+      if a.Address != "" {
+        ov.Addresses = append(ov.Addresses, a.Address)
+      }
+    }
+    if out.NullData != nil {
+      ov.NullData = &nullDataView{Protocol: out.NullData.Protocol, Payloads: []string{}}
+      for _, p := range out.NullData.Payloads {
+        ov.NullData.Payloads = append(ov.NullData.Payloads, hex.EncodeToString(p))
+      }
+    }
+    v.Outputs = append(v.Outputs, ov)
+  }
+  return v
+}
+
+func newSpendView(a spend.Input) (*spendView) {
+  v := &spendView{
+    Type: a.Type,
+    Address: a.Address,
+    PublicKey: hex.EncodeToString(a.PublicKey),
+    Required: a.Required,
+    RedeemScript: hex.EncodeToString(a.RedeemScript),
+    WitnessScript: hex.EncodeToString(a.WitnessScript),
+  }
+  for _, k := range a.PublicKeys {
+    v.PublicKeys = append(v.PublicKeys, hex.EncodeToString(k))
+  }
+  for _, sig := range a.Signatures {
+    v.Signatures = append(v.Signatures, signatureView{R: hex.EncodeToString(sig.R), S: hex.EncodeToString(sig.S),
+      HashType: script.HashTypeName(sig.HashType), Schnorr: sig.Schnorr, Strict: sig.Strict})
+  }
+  return v
+}
+
+func writeJSON(w io.Writer, v interface{}) (error) {
+  enc := json.NewEncoder(w)
+  enc.SetIndent("", "  ")
+  return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, rows [][]string) (error) {
+  cw := csv.NewWriter(w)
+  err := cw.WriteAll(rows)
+  if err != nil {
+    return err
+  }
+  return cw.Error()
+}
+
+func writeBlock(w io.Writer, format string, v blockView) (error) {
+  switch format {
+  case "json":
+    return writeJSON(w, v)
+  case "csv":
+    rows := [][]string{{"height", "hash", "previous_hash", "merkle_root", "version", "time", "bits", "nonce", "size", "tx_count"}}
+    rows = append(rows, []string{strconv.Itoa(v.Height), v.Hash, v.PreviousHash, v.MerkleRoot, fmt.Sprint(v.Version), fmt.Sprint(v.Time),
+      fmt.Sprint(v.Bits), fmt.Sprint(v.Nonce), fmt.Sprint(v.Size), strconv.Itoa(len(v.Transactions))})
+    return writeCSV(w, rows)
+  }
+  fmt.Fprintf(w, "Height:        %d\n", v.Height)
+  fmt.Fprintf(w, "Hash:          %s\n", v.Hash)
+  fmt.Fprintf(w, "Previous Hash: %s\n", v.PreviousHash)
+  fmt.Fprintf(w, "Merkle Root:   %s\n", v.MerkleRoot)
+  fmt.Fprintf(w, "Version:       %d\n", v.Version)
+  fmt.Fprintf(w, "Time:          %s\n", blockvalidation.ConvertUnixEpochToDate(v.Time).UTC())
+  fmt.Fprintf(w, "Bits:          %08x\n", v.Bits)
+  fmt.Fprintf(w, "Nonce:         %d\n", v.Nonce)
+  fmt.Fprintf(w, "Size:          %d\n", v.Size)
+  fmt.Fprintf(w, "Transactions:  %d\n", len(v.Transactions))
+  for i := range v.Transactions {
+    fmt.Fprintf(w, "  %d %s\n", i, v.Transactions[i].Txid)
+  }
+  return nil
+}
+
+func writeTransaction(w io.Writer, format string, v *transactionView) (error) {
+  switch format {
+  case "json":
+    return writeJSON(w, v)
+  case "csv":
+    rows := [][]string{{"txid", "direction", "index", "previous_txid", "previous_index", "value", "key_type", "addresses", "script"}}
+    for i, in := range v.Inputs {
+      rows = append(rows, []string{v.Txid, "input", strconv.Itoa(i), in.PreviousTxid, fmt.Sprint(in.PreviousIndex), "", in.Spend.Type, in.Spend.Address, in.Script})
+    }
+    for o, out := range v.Outputs {
+      addresses := ""
+      for a, address := range out.Addresses {
+        if a > 0 {
+          addresses += " "
+        }
+        addresses += address
+      }
+      rows = append(rows, []string{v.Txid, "output", strconv.Itoa(o), "", "", fmt.Sprint(out.Value), out.KeyType, addresses, out.Script})
+    }
+    return writeCSV(w, rows)
+  }
+  fmt.Fprintf(w, "Txid:      %s\n", v.Txid)
+  fmt.Fprintf(w, "Block:     %d %s\n", v.BlockHeight, v.BlockHash)
+  fmt.Fprintf(w, "Version:   %d\n", v.Version)
+  fmt.Fprintf(w, "Lock Time: %d\n", v.LockTime)
+  for i, in := range v.Inputs {
+    fmt.Fprintf(w, "Input %d:   %s:%d sequence %d %s\n", i, in.PreviousTxid, in.PreviousIndex, in.Sequence,
+      strings.TrimSpace(in.Spend.Type + " " + in.Spend.Address))
+  }
+  for o, out := range v.Outputs {
+    if out.NullData != nil {
+      fmt.Fprintf(w, "Output %d:  %d %s %s %v\n", o, out.Value, out.KeyType, out.NullData.Protocol, out.NullData.Payloads)
+      continue
+    }
+    fmt.Fprintf(w, "Output %d:  %d %s %v\n", o, out.Value, out.KeyType, out.Addresses)
+  }
+  return nil
+}
+
+func writeVerifyReport(w io.Writer, format string, checked int, failures []verifyFailure) (error) {
+  sort.Slice(failures, func(i, j int) bool {
+    return failures[i].Height < failures[j].Height
+  })
+  switch format {
+  case "json":
+    return writeJSON(w, struct {
+      Checked int `json:"checked"`
+      Failures []verifyFailure `json:"failures"`
+    }{checked, failures})
+  case "csv":
+    rows := [][]string{{"height", "block_hash", "rule", "detail"}}
+    for _, f := range failures {
+      rows = append(rows, []string{strconv.Itoa(f.Height), f.BlockHash, f.Rule, f.Detail})
+    }
+    return writeCSV(w, rows)
+  }
+  for _, f := range failures {
+    fmt.Fprintf(w, "FAIL %d %s %s: %s\n", f.Height, f.BlockHash, f.Rule, f.Detail)
+  }
+  fmt.Fprintf(w, "%d blocks checked, %d failures\n", checked, len(failures))
+  return nil
+}
+
+type scriptResultRow struct {
+  Height int `json:"height"`
+  Txid string `json:"txid"`
+  Input int `json:"input"`
+  Type string `json:"type"`
+  Value uint64 `json:"value"`
+  Valid bool `json:"valid"`
+  Error string `json:"error,omitempty"`
+}
+
+func newScriptResultRow(r scriptcheck.Result) (scriptResultRow) {
+  row := scriptResultRow{Height: r.Height, Txid: r.TxID.String(), Input: r.Input, Type: r.Type, Value: r.Value, Valid: r.Err == nil}
+  if r.Err != nil {
+    row.Error = r.Err.Error()
+  }
+  return row
+}
+
+func writeScriptReport(w io.Writer, format string, checked int, rows []scriptResultRow) (error) {
+  switch format {
+  case "json":
+    if rows == nil {
+      rows = []scriptResultRow{}
+    }
+    return writeJSON(w, struct {
+      Checked int `json:"checked"`
+      Inputs []scriptResultRow `json:"inputs"`
+    }{checked, rows})
+  case "csv":
+    records := [][]string{{"height", "txid", "input", "type", "value", "valid", "error"}}
+    for _, r := range rows {
+      records = append(records, []string{strconv.Itoa(r.Height), r.Txid, strconv.Itoa(r.Input), r.Type, fmt.Sprint(r.Value), strconv.FormatBool(r.Valid), r.Error})
+    }
+    return writeCSV(w, records)
+  }
+  failed := 0
+  for _, r := range rows {
+    if r.Valid {
+      fmt.Fprintf(w, "OK %d %s:%d %s\n", r.Height, r.Txid, r.Input, r.Type)
+    } else {
+      failed++
+      fmt.Fprintf(w, "FAIL %d %s:%d %s: %s\n", r.Height, r.Txid, r.Input, r.Type, r.Error)
+    }
+  }
+  fmt.Fprintf(w, "%d inputs checked, %d failures\n", checked, failed)
+  return nil
+}
+
+//validationRow is one rule a block broke, or a block that broke none
+type validationRow struct {
+  Height int `json:"height"`
+  Hash string `json:"hash"`
+  Valid bool `json:"valid"`
+  Rule string `json:"rule,omitempty"`
+  Txid string `json:"txid,omitempty"`
+  Input int `json:"input"`
+  Detail string `json:"detail,omitempty"`
+}
+
+func newValidationRows(r consensus.Result) ([]validationRow) {
+  if r.Valid() {
+    return []validationRow{{Height: r.Height, Hash: r.Hash.String(), Valid: true, Input: -1}}
+  }
+  var rows []validationRow
+  for _, v := range r.Violations {
+    row := validationRow{Height: r.Height, Hash: r.Hash.String(), Rule: v.Rule, Input: v.Input, Detail: v.Detail}
+    if !v.TxID.IsZero() {
+      row.Txid = v.TxID.String()
+    }
+    rows = append(rows, row)
+  }
+  return rows
+}
+
+func writeValidationReport(w io.Writer, format string, checked int, results []consensus.Result) (error) {
+  var rows []validationRow
+  for _, r := range results {
+    rows = append(rows, newValidationRows(r)...)
+  }
+  switch format {
+  case "json":
+    if rows == nil {
+      rows = []validationRow{}
+    }
+    return writeJSON(w, struct {
+      Checked int `json:"checked"`
+      Blocks []validationRow `json:"blocks"`
+    }{checked, rows})
+  case "csv":
+    records := [][]string{{"height", "hash", "valid", "rule", "txid", "input", "detail"}}
+    for _, r := range rows {
+      records = append(records, []string{strconv.Itoa(r.Height), r.Hash, strconv.FormatBool(r.Valid), r.Rule, r.Txid, strconv.Itoa(r.Input), r.Detail})
+    }
+    return writeCSV(w, records)
+  }
+  failed := 0
+  for _, r := range results {
+    if r.Valid() {
+      fmt.Fprintf(w, "OK %d %s\n", r.Height, r.Hash)
+      continue
+    }
+    failed++
+    for _, v := range r.Violations {
+      where := ""
+      switch {
+      case v.Input >= 0:
+        where = fmt.Sprintf(" %s:%d", v.TxID, v.Input)
+      case !v.TxID.IsZero():
+        where = " " + v.TxID.String()
+      }
+      fmt.Fprintf(w, "FAIL %d %s %s%s: %s\n", r.Height, r.Hash, v.Rule, where, v.Detail)
+    }
+  }
+  fmt.Fprintf(w, "%d blocks checked, %d failures\n", checked, failed)
+  return nil
+}
+
+func writeCorruptionReport(w io.Writer, format string, corruptions []blockchainbuilder.Corruption) (error) {
+  switch format {
+  case "json":
+    if corruptions == nil {
+      corruptions = []blockchainbuilder.Corruption{}
+    }
+    return writeJSON(w, corruptions)
+  case "csv":
+    rows := [][]string{{"file", "offset", "reason", "bytes_skipped"}}
+    for _, c := range corruptions {
+      rows = append(rows, []string{c.File, fmt.Sprint(c.Offset), c.Reason, fmt.Sprint(c.BytesSkipped)})
+    }
+    return writeCSV(w, rows)
+  }
+  for _, c := range corruptions {
+    fmt.Fprintf(w, "SKIP %s@%d %d bytes: %s\n", c.File, c.Offset, c.BytesSkipped, c.Reason)
+  }
+  fmt.Fprintf(w, "%d damaged stretches\n", len(corruptions))
+  return nil
+}
+
+//chainStats accumulates summary counts over a range of blocks
+type chainStats struct {
+  FirstHeight int `json:"first_height"`
+  LastHeight int `json:"last_height"`
+  Blocks int `json:"blocks"`
+  Bytes uint64 `json:"bytes"`
+  Transactions int `json:"transactions"`
+  Inputs int `json:"inputs"`
+  Outputs int `json:"outputs"`
+  OutputValue uint64 `json:"output_value"`
+  KeyTypes map[string]int `json:"key_types"`
+}
+
+func newChainStats() (*chainStats) {
+  return &chainStats{FirstHeight: -1, LastHeight: -1, KeyTypes: make(map[string]int)}
+}
+
+func (s *chainStats) addBlock(height int, b *block.Block) {
+  s.FirstHeight, s.LastHeight = height, height
+  s.Blocks++
+  s.Bytes += uint64(b.BlockLength)
+  for _, t := range b.Transactions {
+    s.Transactions++
+    s.Inputs += len(t.Inputs)
+    s.Outputs += len(t.Outputs)
+    for _, out := range t.Outputs {
+      s.OutputValue += out.OutputValue
+      s.KeyTypes[out.KeyType]++
+    }
+  }
+}
+
+func (s *chainStats) merge(o *chainStats) {
+  if s.FirstHeight < 0 || (o.FirstHeight >= 0 && o.FirstHeight < s.FirstHeight) {
+    s.FirstHeight = o.FirstHeight
+  }
+  if o.LastHeight > s.LastHeight {
+    s.LastHeight = o.LastHeight
+  }
+  s.Blocks += o.Blocks
+  s.Bytes += o.Bytes
+  s.Transactions += o.Transactions
+  s.Inputs += o.Inputs
+  s.Outputs += o.Outputs
+  s.OutputValue += o.OutputValue
+  for k, n := range o.KeyTypes {
+    s.KeyTypes[k] += n
+  }
+}
+
+func writeStats(w io.Writer, format string, s *chainStats) (error) {
+  if format == "json" {
+    return writeJSON(w, s)
+  }
+  rows := [][]string{
+    {"first_height", strconv.Itoa(s.FirstHeight)},
+    {"last_height", strconv.Itoa(s.LastHeight)},
+    {"blocks", strconv.Itoa(s.Blocks)},
+    {"bytes", fmt.Sprint(s.Bytes)},
+    {"transactions", strconv.Itoa(s.Transactions)},
+    {"inputs", strconv.Itoa(s.Inputs)},
+    {"outputs", strconv.Itoa(s.Outputs)},
+    {"output_value", fmt.Sprint(s.OutputValue)},
+  }
+  var keyTypes []string
+  for k := range s.KeyTypes {
+    keyTypes = append(keyTypes, k)
+  }
+  sort.Strings(keyTypes)
+  for _, k := range keyTypes {
+    rows = append(rows, []string{"key_type " + k, strconv.Itoa(s.KeyTypes[k])})
+  }
+  if format == "csv" {
+    return writeCSV(w, append([][]string{{"statistic", "value"}}, rows...))
+  }
+  for _, r := range rows {
+    fmt.Fprintf(w, "%-40s %s\n", r[0], r[1])
+  }
+  return nil
+}
+
+//writeEvent writes a follow event as a line of text, a single line of JSON or a CSV row; header writes the CSV header
+//before the first event
+func writeEvent(w io.Writer, format string, e follow.Event, header bool) (error) {
+  switch format {
+  case "json":
+    return json.NewEncoder(w).Encode(e)
+  case "csv":
+    fork := ""
+    if e.ForkHash != nil {
+      fork = e.ForkHash.String()
+    }
+    rows := [][]string{{e.Type, strconv.Itoa(e.Height), e.Hash.String(), fmt.Sprint(e.Time), fork, strconv.Itoa(len(e.Disconnected))}}
+    if header {
+      rows = append([][]string{{"type", "height", "hash", "time", "fork_hash", "disconnected"}}, rows...)
+    }
+    return writeCSV(w, rows)
+  }
+  if e.Type == follow.EventReorg {
+    fmt.Fprintf(w, "REORG %d blocks at %d %s\n", len(e.Disconnected), e.ForkHeight, e.ForkHash)
+  }
+  _, err := fmt.Fprintf(w, "TIP %d %s\n", e.Height, e.Hash)
+  return err
+}
+
+func writeCoinbaseReports(w io.Writer, format string, reports []coinbase.BlockReport) (error) {
+  switch format {
+  case "json":
+    if reports == nil {
+      reports = []coinbase.BlockReport{}
+    }
+    return writeJSON(w, reports)
+  case "csv":
+    rows := [][]string{{"height", "block_hash", "time", "coinbase_height", "bip34", "extranonce", "tags", "witness_commitment", "addresses", "value", "pool"}}
+    for _, r := range reports {
+      rows = append(rows, []string{strconv.Itoa(r.Height), r.BlockHash.String(), fmt.Sprint(r.Time), strconv.FormatInt(r.CoinbaseHeight, 10),
+        strconv.FormatBool(r.BIP34), r.ExtraNonce, strings.Join(r.Tags, "|"), r.WitnessCommitment, strings.Join(r.Addresses, "|"),
+        fmt.Sprint(r.Value), r.Pool})
+    }
+    return writeCSV(w, rows)
+  }
+  for _, r := range reports {
+    fmt.Fprintf(w, "%d %s %s %q\n", r.Height, r.BlockHash, r.Pool, strings.Join(r.Tags, " "))
+  }
+  return nil
+}
+
+func writeDistribution(w io.Writer, format string, distribution []coinbase.Distribution) (error) {
+  switch format {
+  case "json":
+    if distribution == nil {
+      distribution = []coinbase.Distribution{}
+    }
+    return writeJSON(w, distribution)
+  case "csv":
+    rows := [][]string{{"period", "pool", "blocks", "share"}}
+    for _, d := range distribution {
+      for _, p := range d.Pools {
+        rows = append(rows, []string{d.Period, p.Pool, strconv.Itoa(p.Blocks), strconv.FormatFloat(p.Share, 'f', 4, 64)})
+      }
+    }
+    return writeCSV(w, rows)
+  }
+  for _, d := range distribution {
+    fmt.Fprintf(w, "%s %d blocks\n", d.Period, d.Blocks)
+    for _, p := range d.Pools {
+      fmt.Fprintf(w, "  %-30s %6d %6.2f%%\n", p.Pool, p.Blocks, 100 * p.Share)
+    }
+  }
+  return nil
+}
+
+//formatBTC formats satoshis as bitcoin
+func formatBTC(satoshis uint64) (string) {
+  return fmt.Sprintf("%d.%08d", satoshis / supply.Coin, satoshis % supply.Coin)
+}
+
+func writeSupply(w io.Writer, format string, rows []supply.BlockSupply) (error) {
+  switch format {
+  case "json":
+    if rows == nil {
+      rows = []supply.BlockSupply{}
+    }
+    return writeJSON(w, rows)
+  case "csv":
+    records := [][]string{{"height", "block_hash", "subsidy", "fees", "claimed", "unclaimed", "unspendable", "supply", "circulating"}}
+    for _, r := range rows {
+      records = append(records, []string{strconv.Itoa(r.Height), r.BlockHash.String(), fmt.Sprint(r.Subsidy), fmt.Sprint(r.Fees), fmt.Sprint(r.Claimed),
+        fmt.Sprint(r.Unclaimed), fmt.Sprint(r.Unspendable), fmt.Sprint(r.Supply), fmt.Sprint(r.Circulating)})
+    }
+    return writeCSV(w, records)
+  }
+  for _, r := range rows {
+    fmt.Fprintf(w, "%d %s supply %s circulating %s", r.Height, r.BlockHash, formatBTC(r.Supply), formatBTC(r.Circulating))
+    if r.Unclaimed > 0 {
+      fmt.Fprintf(w, " unclaimed %d", r.Unclaimed)
+    }
+    fmt.Fprintln(w)
+  }
+  return nil
+}
+
+func writeSchedule(w io.Writer, format string, eras []supply.Era) (error) {
+  switch format {
+  case "json":
+    return writeJSON(w, eras)
+  case "csv":
+    rows := [][]string{{"height", "subsidy", "supply"}}
+    for _, e := range eras {
+      rows = append(rows, []string{strconv.Itoa(e.Height), fmt.Sprint(e.Subsidy), fmt.Sprint(e.Supply)})
+    }
+    return writeCSV(w, rows)
+  }
+  for _, e := range eras {
+    fmt.Fprintf(w, "%-8d %s %s\n", e.Height, formatBTC(e.Subsidy), formatBTC(e.Supply))
+  }
+  return nil
+}
+
+//nullDataRow is an OP_RETURN payload or an ordinals inscription found by the nulldata command
+type nullDataRow struct {
+  Height int `json:"height"`
+  Txid string `json:"txid"`
+  //Position is the position of the transaction in its block
+  Position int `json:"-"`
+  //Source is output for OP_RETURN outputs and input for inscriptions in a witness
+  Source string `json:"source"`
+  Index int `json:"index"`
+  Value uint64 `json:"value"`
+  Protocol string `json:"protocol"`
+  ContentType string `json:"content_type,omitempty"`
+  Data string `json:"data"`
+}
+
+//nullDataRows returns the OP_RETURN payloads of b, and its inscriptions when inscriptions is set
+func nullDataRows(height int, b *block.Block, inscriptions bool) ([]nullDataRow) {
+  var rows []nullDataRow
+  for t := range b.Transactions {
+    tx := &b.Transactions[t]
+    txid := tx.TransactionHash.String()
+    for o := range tx.Outputs {
+      out := &tx.Outputs[o]
+      n := out.NullData
+      if n == nil {
+        n = nulldata.Parse(out.ChallengeScript, tx.Inputs)
+      }
+      if n != nil {
+        rows = append(rows, nullDataRow{height, txid, t, "output", o, out.OutputValue, n.Protocol, "", hex.EncodeToString(n.Data())})
+      }
+    }
+    if inscriptions {
+      for _, e := range nulldata.Envelopes(tx) {
+        rows = append(rows, nullDataRow{height, txid, t, "input", e.Input, 0, nulldata.Ordinals, e.ContentType, hex.EncodeToString(e.Body)})
+      }
+    }
+  }
+  return rows
+}
+
+func writeNullData(w io.Writer, format string, rows []nullDataRow) (error) {
+  switch format {
+  case "json":
+    if rows == nil {
+      rows = []nullDataRow{}
+    }
+    return writeJSON(w, rows)
+  case "csv":
+    records := [][]string{{"height", "txid", "source", "index", "value", "protocol", "content_type", "data"}}
+    for _, r := range rows {
+      records = append(records, []string{strconv.Itoa(r.Height), r.Txid, r.Source, strconv.Itoa(r.Index), fmt.Sprint(r.Value), r.Protocol, r.ContentType, r.Data})
+    }
+    return writeCSV(w, records)
+  }
+  for _, r := range rows {
+    protocol := r.Protocol
+    if protocol == "" {
+      protocol = "-"
+    }
+    fmt.Fprintf(w, "%d %s %s %d %s %s\n", r.Height, r.Txid, r.Source, r.Index, protocol, r.Data)
+  }
+  return nil
+}
@@ -0,0 +1,236 @@
+package postgresloader
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "github.com/lib/pq"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//testDSNEnvironment names the environment variable holding the connection string of a PostgreSQL server the
+//integration tests may use. Each test works in a schema of its own, which it drops when it finishes, so the database
+//need not be empty; the tests are skipped when the variable is unset.
+const testDSNEnvironment = "GOPARSEBTC_TEST_POSTGRES"
+
+//openPostgres returns a handle on a new, empty schema of the test server, skipping the test when there is none
+func openPostgres(t *testing.T) (*sql.DB) {
+  dsn := os.Getenv(testDSNEnvironment)
+  if dsn == "" {
+    t.Skipf("%s is not set", testDSNEnvironment)
+  }
+  admin, err := sql.Open("postgres", dsn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() { admin.Close() })
+  schema := fmt.Sprintf("goparsebtc_test_%d_%s", os.Getpid(), strings.ToLower(strings.ReplaceAll(t.Name(), "/", "_")))
+  _, err = admin.Exec("CREATE SCHEMA " + pq.QuoteIdentifier(schema))
+  if err != nil {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() {
+    _, err := admin.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE")
+    if err != nil {
+      t.Errorf("dropping schema %s: %v", schema, err)
+    }
+  })
+  //lib/pq sends parameters it does not know to the server, so every connection of the pool searches the new schema
+  switch {
+  case !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://"):
+    dsn += " search_path=" + schema
+  case strings.Contains(dsn, "?"):
+    dsn += "&search_path=" + schema
+  default:
+    dsn += "?search_path=" + schema
+  }
+  db, err := sql.Open("postgres", dsn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() { db.Close() })
+  return db
+}
+
+//count returns the result of a query for a single number
+func count(t *testing.T, db *sql.DB, query string, args ...interface{}) (int) {
+  var n int
+  err := db.QueryRow(query, args...).Scan(&n)
+  if err != nil {
+    t.Fatalf("%s: %v", query, err)
+  }
+  return n
+}
+
+//loadedHeights returns the heights in the blocks table in order
+func loadedHeights(t *testing.T, db *sql.DB) (string) {
+  rows, err := db.Query("SELECT height FROM blocks ORDER BY height")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer rows.Close()
+  var heights []int
+  for rows.Next() {
+    var h int
+    err = rows.Scan(&h)
+    if err != nil {
+      t.Fatal(err)
+    }
+    heights = append(heights, h)
+  }
+  if err := rows.Err(); err != nil {
+    t.Fatal(err)
+  }
+  return fmt.Sprint(heights)
+}
+
+func TestPostgresMigrate(t *testing.T) {
+  db := openPostgres(t)
+  for run := 0; run < 2; run++ {
+    err := Migrate(db)
+    if err != nil {
+      t.Fatalf("run %d: %v", run, err)
+    }
+  }
+  if n := count(t, db, "SELECT COUNT(*) FROM schema_migrations"); n != len(migrations) {
+    t.Errorf("%d migrations recorded, want %d", n, len(migrations))
+  }
+  _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", len(migrations) + 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := Migrate(db); err != ErrSchemaTooNew {
+    t.Errorf("migrating a newer schema returned %v, want ErrSchemaTooNew", err)
+  }
+}
+
+func TestPostgresKeyTypeMigration(t *testing.T) {
+  db := openPostgres(t)
+  //the schema as it stood before key types became script types
+  for v, m := range migrations[:5] {
+    _, err := db.Exec(m)
+    if err != nil {
+      t.Fatalf("migration %d: %v", v + 1, err)
+    }
+  }
+  _, err := db.Exec(`CREATE TABLE schema_migrations (version integer PRIMARY KEY, applied_at timestamptz NOT NULL DEFAULT now());
+    INSERT INTO schema_migrations (version) SELECT generate_series(1, 5);
+    INSERT INTO blocks VALUES (0, '', '', '', 1, 0, 0, 0, 0, 1, 'blk00000.dat', 0);
+    INSERT INTO transactions VALUES (0, 0, '', 1, 0, 1, 8)`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  outputs := []struct {
+    keyType string
+    script string
+    want string
+  }{
+    {"COMPRESSED_PUBLIC_KEY", "21" + strings.Repeat("02", 33) + "ac", "p2pk"},
+    {"RIPEMD160", "76a914" + strings.Repeat("00", 20) + "88ac", "p2pkh"},
+    //a pay to public key hash prefix found inside a longer script
+    {"RIPEMD160", "76a914" + strings.Repeat("00", 20) + "88ac75", "nonstandard"},
+    {"SCRIPT_HASH", "a914" + strings.Repeat("00", 20) + "87", "p2sh"},
+    {"NULLDATA", "6a", "nulldata"},
+    {"", "0014751e76e8199196d454941c45d1b3a323f1433bd6", "p2wpkh"},
+    {"", "5120" + strings.Repeat("79", 32), "p2tr"},
+    {"", "6002751e", "witness_unknown"},
+  }
+  for o, out := range outputs {
+    _, err := db.Exec("INSERT INTO outputs VALUES (0, 0, $1, '', 0, decode($2, 'hex'), $3)", o, out.script, out.keyType)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  err = Migrate(db)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for o, out := range outputs {
+    var got string
+    err := db.QueryRow("SELECT key_type FROM outputs WHERE output_index = $1", o).Scan(&got)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got != out.want {
+      t.Errorf("output %d of type %q with script %s migrated to %s, want %s", o, out.keyType, out.script, got, out.want)
+    }
+  }
+}
+
+func TestPostgresLoad(t *testing.T) {
+  db := openPostgres(t)
+  err := Migrate(db)
+  if err != nil {
+    t.Fatal(err)
+  }
+  loader := &Loader{DB: db, BatchSize: 2}
+  dir := t.TempDir()
+  c := chaintest.NewChain()
+  c.Extend(6, "")
+
+  if err := loader.LoadBlocks(testBatch(c, 1, 1)); err != ErrOutOfOrder {
+    t.Fatalf("loading height 1 into an empty database: got %v, want ErrOutOfOrder", err)
+  }
+  err = loader.LoadBlocks(testBatch(c, 0, 1))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if n := count(t, db, "SELECT COUNT(*) FROM outputs WHERE block_height <= 1"); n != 2 {
+    t.Errorf("%d outputs copied for heights 0 and 1, want 2", n)
+  }
+
+  //a constraint stands in for a connection lost while copying height 4: its batch is rolled back, the ones before it
+  //are kept, and the next load resumes from there
+  _, err = db.Exec("ALTER TABLE blocks ADD CONSTRAINT lost_connection CHECK (height <> 4)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  //the reference file cannot locate the tip, so heights 0 to 5 are loadable
+  err = loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err == nil {
+    t.Fatal("load with a failing batch succeeded")
+  }
+  if got := loadedHeights(t, db); got != "[0 1 2 3]" {
+    t.Fatalf("after the failed load, heights %s are loaded", got)
+  }
+  if n := count(t, db, "SELECT COUNT(*) FROM transactions WHERE block_height >= 4"); n != 0 {
+    t.Errorf("%d transactions of the failed batch were kept", n)
+  }
+  _, err = db.Exec("ALTER TABLE blocks DROP CONSTRAINT lost_connection")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got := loadedHeights(t, db); got != "[0 1 2 3 4 5]" {
+    t.Fatalf("after resuming, heights %s are loaded", got)
+  }
+
+  c.Extend(2, "")
+  err = loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got := loadedHeights(t, db); got != "[0 1 2 3 4 5 6 7]" {
+    t.Fatalf("after the chain grew, heights %s are loaded", got)
+  }
+  branch := c.Branch(c.Tip)
+  for h := 0; h <= 7; h++ {
+    var hash string
+    err := db.QueryRow("SELECT hash FROM blocks WHERE height = $1", h).Scan(&hash)
+    if err != nil || hash != branch[h].BlockHash.String() {
+      t.Errorf("height %d has hash %s, %v, want %s", h, hash, err, branch[h].BlockHash)
+    }
+  }
+  //every block has one transaction with one input and one output
+  for _, table := range []string{"transactions", "inputs", "outputs"} {
+    if n := count(t, db, "SELECT COUNT(*) FROM " + table); n != 8 {
+      t.Errorf("%d rows in %s, want 8", n, table)
+    }
+  }
+}
@@ -0,0 +1,142 @@
+package postgresloader
+
+import (
+    "database/sql"
+)
+
+//migrations holds the schema changes in the order they are applied. The version
+//of a migration is its position in the slice plus one. Never edit a migration
+//that has shipped; append a new one instead.
+var migrations = []string{
+  `CREATE TABLE blocks (
+    height integer PRIMARY KEY,
+    hash char(64) NOT NULL UNIQUE,
+    previous_hash char(64) NOT NULL,
+    merkle_root char(64) NOT NULL,
+    version bigint NOT NULL,
+    time_stamp bigint NOT NULL,
+    target_value bigint NOT NULL,
+    nonce bigint NOT NULL,
+    block_length integer NOT NULL,
+    tx_count integer NOT NULL,
+    file_endpoint text NOT NULL,
+    byte_offset bigint NOT NULL
+  )`,
+
+  `CREATE TABLE transactions (
+    block_height integer NOT NULL REFERENCES blocks (height),
+    tx_index integer NOT NULL,
+    txid char(64) NOT NULL,
+    version bigint NOT NULL,
+    lock_time bigint NOT NULL,
+    input_count integer NOT NULL,
+    output_count integer NOT NULL,
+    PRIMARY KEY (block_height, tx_index)
+  );
+  CREATE INDEX transactions_txid_idx ON transactions (txid)`,
+
+  `CREATE TABLE inputs (
+    block_height integer NOT NULL,
+    tx_index integer NOT NULL,
+    input_index integer NOT NULL,
+    txid char(64) NOT NULL,
+    previous_txid char(64) NOT NULL,
+    previous_output_index bigint NOT NULL,
+    input_script bytea NOT NULL,
+    sequence_number bigint NOT NULL,
+    PRIMARY KEY (block_height, tx_index, input_index),
+    FOREIGN KEY (block_height, tx_index) REFERENCES transactions (block_height, tx_index)
+  );
+  CREATE INDEX inputs_previous_output_idx ON inputs (previous_txid, previous_output_index)`,
+
+  `CREATE TABLE outputs (
+    block_height integer NOT NULL,
+    tx_index integer NOT NULL,
+    output_index integer NOT NULL,
+    txid char(64) NOT NULL,
+    output_value bigint NOT NULL,
+    challenge_script bytea NOT NULL,
+    key_type text NOT NULL,
+    PRIMARY KEY (block_height, tx_index, output_index),
+    FOREIGN KEY (block_height, tx_index) REFERENCES transactions (block_height, tx_index)
+  );
+  CREATE INDEX outputs_outpoint_idx ON outputs (txid, output_index)`,
+
+  `CREATE TABLE addresses (
+    address text PRIMARY KEY,
+    first_seen_height integer NOT NULL
+  );
+  CREATE TABLE output_addresses (
+    block_height integer NOT NULL,
+    tx_index integer NOT NULL,
+    output_index integer NOT NULL,
+    address text NOT NULL,
+    PRIMARY KEY (block_height, tx_index, output_index, address),
+    FOREIGN KEY (block_height, tx_index, output_index) REFERENCES outputs (block_height, tx_index, output_index)
+  );
+  CREATE INDEX output_addresses_address_idx ON output_addresses (address)`,
+
+  //key types were once named by the blockvalidation package and are now the script types script.Classify returns;
+  //witness programs were left unnamed. The addresses of witness programs are only written by loading their blocks
+  //again.
+  `UPDATE outputs SET key_type = CASE
+    WHEN key_type = 'NULLDATA' THEN 'nulldata'
+    WHEN key_type IN ('UNCOMPRESSED_PUBLIC_KEY', 'COMPRESSED_PUBLIC_KEY') AND octet_length(challenge_script) IN (35, 67) THEN 'p2pk'
+    WHEN key_type = 'RIPEMD160' AND octet_length(challenge_script) = 25 AND get_byte(challenge_script, 23) = 136
+      AND get_byte(challenge_script, 24) = 172 THEN 'p2pkh'
+    WHEN key_type = 'SCRIPT_HASH' THEN 'p2sh'
+    WHEN key_type = 'MULTISIG' THEN 'multisig'
+    WHEN octet_length(challenge_script) BETWEEN 4 AND 42 AND get_byte(challenge_script, 1) = octet_length(challenge_script) - 2
+      AND (get_byte(challenge_script, 0) = 0 OR get_byte(challenge_script, 0) BETWEEN 81 AND 96) THEN CASE
+        WHEN get_byte(challenge_script, 0) = 0 AND octet_length(challenge_script) = 22 THEN 'p2wpkh'
+        WHEN get_byte(challenge_script, 0) = 0 AND octet_length(challenge_script) = 34 THEN 'p2wsh'
+        WHEN get_byte(challenge_script, 0) = 0 THEN 'nonstandard'
+        WHEN get_byte(challenge_script, 0) = 81 AND octet_length(challenge_script) = 34 THEN 'p2tr'
+        ELSE 'witness_unknown'
+      END
+    ELSE 'nonstandard'
+  END`,
+}
+
+//Migrate applies every migration not yet recorded in the schema_migrations table.
+//Each migration runs in its own transaction alongside its bookkeeping row.
+func Migrate(db *sql.DB) (error) {
+  _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version integer PRIMARY KEY,
+    applied_at timestamptz NOT NULL DEFAULT now()
+  )`)
+  if err != nil {
+    return err
+  }
+
+  var current int
+  err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+  if err != nil {
+    return err
+  }
+  if current > len(migrations) {
+    return ErrSchemaTooNew
+  }
+
+  for v := current + 1; v <= len(migrations); v++ {
+    tx, err := db.Begin()
+    if err != nil {
+      return err
+    }
+    _, err = tx.Exec(migrations[v-1])
+    if err != nil {
+      tx.Rollback()
+      return err
+    }
+    _, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", v)
+    if err != nil {
+      tx.Rollback()
+      return err
+    }
+    err = tx.Commit()
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
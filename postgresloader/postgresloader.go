@@ -0,0 +1,272 @@
+package postgresloader
+
+import (
+    "database/sql"
+    "errors"
+    "log/slog"
+    "github.com/lib/pq"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/logging"
+)
+
+//DefaultBatchSize holds the number of blocks copied per database transaction
+const DefaultBatchSize = 100
+
+//DSNEnvironment names the environment variable holding the connection string.
+//When it is unset lib/pq falls back to the standard PGHOST, PGUSER, ... variables
+const DSNEnvironment = "GOPARSEBTC_POSTGRES"
+
+//ErrSchemaTooNew is thrown when the database has migrations this binary does not know about
+var ErrSchemaTooNew = errors.New("postgresloader: database schema is newer than this loader")
+//ErrOutOfOrder is thrown when a batch does not continue directly from the last loaded height
+var ErrOutOfOrder = errors.New("postgresloader: blocks must be loaded in height order")
+
+//Loader holds the database handle used to bulk load parsed blocks
+type Loader struct {
+  DB *sql.DB
+  BatchSize int
+}
+
+//HeightBlock pairs a parsed block with its main chain height and location
+type HeightBlock struct {
+  Height int
+  FileEndpoint string
+  Block *block.Block
+}
+
+//NewLoader connects to the database described by dsn and brings its schema up to date
+func NewLoader(dsn string) (*Loader, error) {
+  db, err := sql.Open("postgres", dsn)
+  if err != nil {
+    return nil, err
+  }
+  err = db.Ping()
+  if err != nil {
+    db.Close()
+    return nil, err
+  }
+  err = Migrate(db)
+  if err != nil {
+    db.Close()
+    return nil, err
+  }
+  return &Loader{DB: db, BatchSize: DefaultBatchSize}, nil
+}
+
+//Close closes the underlying database handle
+func (l *Loader) Close() (error) {
+  return l.DB.Close()
+}
+
+//LastLoadedHeight returns the height of the highest loaded block, or -1 for an empty database
+func (l *Loader) LastLoadedHeight() (int, error) {
+  var height int
+  err := l.DB.QueryRow("SELECT COALESCE(MAX(height), -1) FROM blocks").Scan(&height)
+  return height, err
+}
+
+//LoadChain loads every main chain block listed in readchain that sits above the
+//last loaded height. Blocks are committed in batches, so an interrupted run
+//resumes from the last complete batch.
+func (l *Loader) LoadChain(readchain *blockchainreader.ReadChain, datLocation string) (error) {
+  last, err := l.LastLoadedHeight()
+  if err != nil {
+    return err
+  }
+  slog.Info("resuming load", logging.KeyHeight, last + 1)
+
+  var batch []HeightBlock
+  err = blockchainreader.WalkChain(readchain, datLocation, last + 1, -1, func(ib blockchainreader.IndexedBlock, b *block.Block) (error) {
+    batch = append(batch, HeightBlock{Height: ib.Height, FileEndpoint: ib.FileEndpoint, Block: b})
+    if len(batch) < l.BatchSize {
+      return nil
+    }
+    err := l.LoadBlocks(batch)
+    batch = batch[:0]
+    return err
+  })
+  if err != nil {
+    return err
+  }
+  if len(batch) > 0 {
+    return l.LoadBlocks(batch)
+  }
+  return nil
+}
+
+//LoadBlocks copies a batch of consecutive blocks into the database inside a single transaction
+func (l *Loader) LoadBlocks(batch []HeightBlock) (error) {
+  last, err := l.LastLoadedHeight()
+  if err != nil {
+    return err
+  }
+  for i, hb := range batch {
+    if hb.Height != last + 1 + i {
+      return ErrOutOfOrder
+    }
+  }
+
+  tx, err := l.DB.Begin()
+  if err != nil {
+    return err
+  }
+  err = copyBatch(tx, batch)
+  if err != nil {
+    tx.Rollback()
+    return err
+  }
+  _, err = tx.Exec(`INSERT INTO addresses (address, first_seen_height)
+    SELECT address, MIN(block_height) FROM output_addresses
+    WHERE block_height BETWEEN $1 AND $2 GROUP BY address
+    ON CONFLICT (address) DO NOTHING`, batch[0].Height, batch[len(batch)-1].Height)
+  if err != nil {
+    tx.Rollback()
+    return err
+  }
+  err = tx.Commit()
+  if err != nil {
+    return err
+  }
+  slog.Info("loaded batch", "first_height", batch[0].Height, logging.KeyHeight, batch[len(batch)-1].Height)
+  return nil
+}
+
+//copier wraps a prepared COPY statement for one table
+type copier struct {
+  stmt *sql.Stmt
+}
+
+func newCopier(tx *sql.Tx, table string, columns ...string) (*copier, error) {
+  stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+  if err != nil {
+    return nil, err
+  }
+  return &copier{stmt: stmt}, nil
+}
+
+func (c *copier) row(values ...interface{}) (error) {
+  _, err := c.stmt.Exec(values...)
+  return err
+}
+
+//flush sends the buffered rows to the server and releases the statement
+func (c *copier) flush() (error) {
+  _, err := c.stmt.Exec()
+  if err != nil {
+    c.stmt.Close()
+    return err
+  }
+  return c.stmt.Close()
+}
+
+//copyBatch streams each table in turn because a connection can only run one COPY at a time
+func copyBatch(tx *sql.Tx, batch []HeightBlock) (error) {
+  c, err := newCopier(tx, "blocks", "height", "hash", "previous_hash", "merkle_root", "version", "time_stamp", "target_value", "nonce", "block_length", "tx_count", "file_endpoint", "byte_offset")
+  if err != nil {
+    return err
+  }
+  for _, hb := range batch {
+    b := hb.Block
+    err = c.row(hb.Height, b.BlockHash.String(), b.Header.PreviousBlockHash.String(), b.Header.MerkleRoot.String(),
+      int64(b.Header.FormatVersion), int64(b.Header.TimeStamp), int64(b.Header.TargetValue), int64(b.Header.Nonce),
+      int64(b.BlockLength), len(b.Transactions), hb.FileEndpoint, int64(b.HashBlock.ByteOffset))
+    if err != nil {
+      return err
+    }
+  }
+  err = c.flush()
+  if err != nil {
+    return err
+  }
+
+  c, err = newCopier(tx, "transactions", "block_height", "tx_index", "txid", "version", "lock_time", "input_count", "output_count")
+  if err != nil {
+    return err
+  }
+  for _, hb := range batch {
+    for t, tran := range hb.Block.Transactions {
+      err = c.row(hb.Height, t, tran.TransactionHash.String(), int64(tran.TransactionVersionNumber),
+        int64(tran.TransactionLockTime), len(tran.Inputs), len(tran.Outputs))
+      if err != nil {
+        return err
+      }
+    }
+  }
+  err = c.flush()
+  if err != nil {
+    return err
+  }
+
+  c, err = newCopier(tx, "inputs", "block_height", "tx_index", "input_index", "txid", "previous_txid", "previous_output_index", "input_script", "sequence_number")
+  if err != nil {
+    return err
+  }
+  for _, hb := range batch {
+    for t, tran := range hb.Block.Transactions {
+      txid := tran.TransactionHash.String()
+      for i, in := range tran.Inputs {
+        err = c.row(hb.Height, t, i, txid, in.TransactionHash.String(), int64(in.TransactionIndex),
+          nonNil(in.InputScript), int64(in.SequenceNumber))
+        if err != nil {
+          return err
+        }
+      }
+    }
+  }
+  err = c.flush()
+  if err != nil {
+    return err
+  }
+
+  c, err = newCopier(tx, "outputs", "block_height", "tx_index", "output_index", "txid", "output_value", "challenge_script", "key_type")
+  if err != nil {
+    return err
+  }
+  for _, hb := range batch {
+    for t, tran := range hb.Block.Transactions {
+      txid := tran.TransactionHash.String()
+      for o, out := range tran.Outputs {
+        err = c.row(hb.Height, t, o, txid, int64(out.OutputValue), nonNil(out.ChallengeScript), out.KeyType)
+        if err != nil {
+          return err
+        }
+      }
+    }
+  }
+  err = c.flush()
+  if err != nil {
+    return err
+  }
+
+  c, err = newCopier(tx, "output_addresses", "block_height", "tx_index", "output_index", "address")
+  if err != nil {
+    return err
+  }
+  for _, hb := range batch {
+    for t, tran := range hb.Block.Transactions {
+      for o, out := range tran.Outputs {
+        seen := make(map[string]bool)
+        for _, a := range out.Addresses {
+          if a.Address == "" || seen[a.Address] {
+            continue
+          }
+          seen[a.Address] = true
+          err = c.row(hb.Height, t, o, a.Address)
+          if err != nil {
+            return err
+          }
+        }
+      }
+    }
+  }
+  return c.flush()
+}
+
+//nonNil keeps empty scripts from being copied as NULL
+func nonNil(b []byte) ([]byte) {
+  if b == nil {
+    return []byte{}
+  }
+  return b
+}
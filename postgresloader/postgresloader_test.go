@@ -0,0 +1,329 @@
+package postgresloader
+
+import (
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/blockchainreader"
+    "github.com/tgebhart/goparsebtc/chaintest"
+)
+
+//fakeDatabase stands in for PostgreSQL in the tests of the order blocks are loaded in, which need to make a batch fail
+//part way through. It understands only the statements LoadBlocks issues and keeps the loaded block heights and the
+//rows copied into each table; integration_test.go runs the loader against a real server.
+type fakeDatabase struct {
+  mu sync.Mutex
+  heights []int
+  rows map[string]int
+  //failHeight makes copying the block at that height fail, as a lost connection would
+  failHeight int
+}
+
+//fakeChanges holds the changes of an open transaction until it commits
+type fakeChanges struct {
+  heights []int
+  rows map[string]int
+}
+
+func (db *fakeDatabase) apply(c *fakeChanges) {
+  db.mu.Lock()
+  defer db.mu.Unlock()
+  db.heights = append(db.heights, c.heights...)
+  for table, n := range c.rows {
+    db.rows[table] += n
+  }
+}
+
+var fakeDatabases = struct {
+  sync.Mutex
+  m map[string]*fakeDatabase
+}{m: make(map[string]*fakeDatabase)}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+  fakeDatabases.Lock()
+  defer fakeDatabases.Unlock()
+  db, ok := fakeDatabases.m[name]
+  if !ok {
+    return nil, fmt.Errorf("no fake database %q", name)
+  }
+  return &fakeConn{db: db}, nil
+}
+
+func init() {
+  sql.Register("fakepostgres", fakeDriver{})
+}
+
+//openFake returns a handle on a new, empty fake database
+func openFake(t *testing.T) (*sql.DB, *fakeDatabase) {
+  fake := &fakeDatabase{rows: make(map[string]int), failHeight: -1}
+  fakeDatabases.Lock()
+  fakeDatabases.m[t.Name()] = fake
+  fakeDatabases.Unlock()
+  db, err := sql.Open("fakepostgres", t.Name())
+  if err != nil {
+    t.Fatal(err)
+  }
+  //a single connection keeps each transaction's statements on the conn that began it
+  db.SetMaxOpenConns(1)
+  t.Cleanup(func() { db.Close() })
+  return db, fake
+}
+
+type fakeConn struct {
+  db *fakeDatabase
+  tx *fakeChanges
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+  return &fakeStmt{conn: c, query: strings.TrimSpace(query)}, nil
+}
+
+func (c *fakeConn) Close() (error) {
+  return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+  c.tx = &fakeChanges{rows: make(map[string]int)}
+  return c, nil
+}
+
+func (c *fakeConn) Commit() (error) {
+  c.db.apply(c.tx)
+  c.tx = nil
+  return nil
+}
+
+func (c *fakeConn) Rollback() (error) {
+  c.tx = nil
+  return nil
+}
+
+//changes returns the open transaction, or a change set applied as soon as the statement finishes
+func (c *fakeConn) changes() (*fakeChanges, func()) {
+  if c.tx != nil {
+    return c.tx, func() {}
+  }
+  ch := &fakeChanges{rows: make(map[string]int)}
+  return ch, func() { c.db.apply(ch) }
+}
+
+type fakeStmt struct {
+  conn *fakeConn
+  query string
+  copied []int
+  rows int
+}
+
+func (s *fakeStmt) Close() (error) {
+  return nil
+}
+
+func (s *fakeStmt) NumInput() (int) {
+  return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+  ch, done := s.conn.changes()
+  defer done()
+  switch {
+  case strings.HasPrefix(s.query, "COPY"):
+    table := strings.Trim(strings.Fields(s.query)[1], `"`)
+    if len(args) == 0 {
+      //an argumentless Exec ends the COPY
+      ch.rows[table] += s.rows
+      if table == "blocks" {
+        ch.heights = append(ch.heights, s.copied...)
+      }
+      return driver.RowsAffected(s.rows), nil
+    }
+    if table == "blocks" {
+      height := int(args[0].(int64))
+      if height == s.conn.db.failHeight {
+        return nil, errors.New("fake: connection lost")
+      }
+      s.copied = append(s.copied, height)
+    }
+    s.rows++
+    return driver.RowsAffected(1), nil
+  case strings.HasPrefix(s.query, "INSERT INTO addresses"):
+  default:
+    return nil, fmt.Errorf("fake: unexpected statement %q", s.query)
+  }
+  return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+  db := s.conn.db
+  db.mu.Lock()
+  defer db.mu.Unlock()
+  switch s.query {
+  case "SELECT COALESCE(MAX(height), -1) FROM blocks":
+    max := -1
+    for _, h := range db.heights {
+      if h > max {
+        max = h
+      }
+    }
+    return &fakeRows{value: int64(max)}, nil
+  }
+  return nil, fmt.Errorf("fake: unexpected query %q", s.query)
+}
+
+//fakeRows returns a single row holding a single value
+type fakeRows struct {
+  value int64
+  done bool
+}
+
+func (r *fakeRows) Columns() ([]string) {
+  return []string{"value"}
+}
+
+func (r *fakeRows) Close() (error) {
+  return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) (error) {
+  if r.done {
+    return io.EOF
+  }
+  r.done = true
+  dest[0] = r.value
+  return nil
+}
+
+//testBatch returns consecutive blocks of a synthetic chain as a batch starting at height from
+func testBatch(c *chaintest.Chain, from int, to int) ([]HeightBlock) {
+  var batch []HeightBlock
+  branch := c.Branch(c.Tip)
+  for h := from; h <= to; h++ {
+    batch = append(batch, HeightBlock{Height: h, FileEndpoint: "blk00000.dat", Block: branch[h]})
+  }
+  return batch
+}
+
+func TestLoadBlocksOrdering(t *testing.T) {
+  db, fake := openFake(t)
+  loader := &Loader{DB: db, BatchSize: DefaultBatchSize}
+  c := chaintest.NewChain()
+  c.Extend(4, "")
+
+  err := loader.LoadBlocks(testBatch(c, 1, 2))
+  if err != ErrOutOfOrder {
+    t.Fatalf("loading height 1 into an empty database: got %v, want ErrOutOfOrder", err)
+  }
+  err = loader.LoadBlocks(append(testBatch(c, 0, 0), testBatch(c, 2, 2)...))
+  if err != ErrOutOfOrder {
+    t.Fatalf("loading a batch with a gap: got %v, want ErrOutOfOrder", err)
+  }
+  err = loader.LoadBlocks(testBatch(c, 0, 1))
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = loader.LoadBlocks(testBatch(c, 1, 2))
+  if err != ErrOutOfOrder {
+    t.Fatalf("reloading height 1: got %v, want ErrOutOfOrder", err)
+  }
+  err = loader.LoadBlocks(testBatch(c, 2, 4))
+  if err != nil {
+    t.Fatal(err)
+  }
+  last, err := loader.LastLoadedHeight()
+  if err != nil || last != 4 {
+    t.Fatalf("LastLoadedHeight = %d, %v, want 4", last, err)
+  }
+  if fmt.Sprint(fake.heights) != "[0 1 2 3 4]" {
+    t.Errorf("loaded heights %v", fake.heights)
+  }
+  //every block has one transaction with one input and one output
+  if fake.rows["transactions"] != 5 || fake.rows["inputs"] != 5 || fake.rows["outputs"] != 5 {
+    t.Errorf("copied rows %v", fake.rows)
+  }
+}
+
+//indexChain writes the main chain of c to a blk file in dir and indexes it the way the index command does
+func indexChain(t *testing.T, c *chaintest.Chain, dir string) (*blockchainreader.ReadChain) {
+  err := chaintest.WriteBlkFile(filepath.Join(dir, "blk00000.dat"), 0, c.Branch(c.Tip)...)
+  if err != nil {
+    t.Fatal(err)
+  }
+  f, err := os.Open(filepath.Join(dir, "blk00000.dat"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  chain := blockchainbuilder.NewBlockchain()
+  d := blockchainbuilder.NewDecoder(f, blockchainbuilder.DefaultDecodeOptions)
+  var tip block.Hash
+  for {
+    var b block.Block
+    err = d.Decode(&b)
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      t.Fatal(err)
+    }
+    b.HashBlock.FileEndpoint = "blk00000.dat"
+    chain.BlockMap[b.BlockHash] = b.HashBlock
+    tip = b.BlockHash
+  }
+  err = blockchainbuilder.WriteMainChainToFile(chain, tip, filepath.Join(dir, "mainchain"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  readchain := blockchainreader.NewReadChain()
+  err = blockchainreader.ReadReferenceFile(readchain, filepath.Join(dir, "mainchain.csv"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  return readchain
+}
+
+func TestLoadChainResumes(t *testing.T) {
+  db, fake := openFake(t)
+  loader := &Loader{DB: db, BatchSize: 2}
+  dir := t.TempDir()
+  c := chaintest.NewChain()
+  c.Extend(6, "")
+
+  //the reference file cannot locate the tip, so heights 0 to 5 are loadable. Copying height 4 fails,
+  //losing its batch but keeping the batches before it
+  fake.failHeight = 4
+  err := loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err == nil {
+    t.Fatal("load with a failing batch succeeded")
+  }
+  if fmt.Sprint(fake.heights) != "[0 1 2 3]" {
+    t.Fatalf("after the failed load, heights %v are loaded", fake.heights)
+  }
+
+  fake.failHeight = -1
+  err = loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fmt.Sprint(fake.heights) != "[0 1 2 3 4 5]" {
+    t.Fatalf("after resuming, heights %v are loaded", fake.heights)
+  }
+
+  c.Extend(2, "")
+  err = loader.LoadChain(indexChain(t, c, dir), dir + string(filepath.Separator))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fmt.Sprint(fake.heights) != "[0 1 2 3 4 5 6 7]" {
+    t.Fatalf("after the chain grew, heights %v are loaded", fake.heights)
+  }
+}
@@ -0,0 +1,80 @@
+package script
+
+import (
+    "fmt"
+    "strings"
+)
+
+//Flags selects the rules scripts are verified under. Consensus turned them on one soft fork at a time, and bitcoind
+//applies further ones to transactions it relays.
+type Flags uint32
+
+//verification flags
+const (
+  VerifyP2SH Flags = 1 << iota
+  VerifyStrictEncoding
+  VerifyDERSignatures
+  VerifyLowS
+  VerifyNullDummy
+  VerifySigPushOnly
+  VerifyMinimalData
+  VerifyDiscourageUpgradableNops
+  VerifyCleanStack
+  VerifyCheckLockTime
+  VerifyCheckSequence
+  VerifyNullFail
+  VerifyConstScriptCode
+  VerifyWitness
+  VerifyDiscourageUpgradableWitnessProgram
+  VerifyMinimalIf
+  VerifyWitnessPubKeyType
+  VerifyTaproot
+  VerifyDiscourageUpgradableTaprootVersion
+  VerifyDiscourageOpSuccess
+  VerifyDiscourageUpgradablePubKeyType
+)
+
+//VerifyNone verifies scripts as the first version of bitcoin did
+const VerifyNone Flags = 0
+
+//flagNames maps the names bitcoind uses for flags, as in its script test data, to the flags
+var flagNames = map[string]Flags{
+  "NONE": VerifyNone,
+  "P2SH": VerifyP2SH,
+  "STRICTENC": VerifyStrictEncoding,
+  "DERSIG": VerifyDERSignatures,
+  "LOW_S": VerifyLowS,
+  "NULLDUMMY": VerifyNullDummy,
+  "SIGPUSHONLY": VerifySigPushOnly,
+  "MINIMALDATA": VerifyMinimalData,
+  "DISCOURAGE_UPGRADABLE_NOPS": VerifyDiscourageUpgradableNops,
+  "CLEANSTACK": VerifyCleanStack,
+  "CHECKLOCKTIMEVERIFY": VerifyCheckLockTime,
+  "CHECKSEQUENCEVERIFY": VerifyCheckSequence,
+  "NULLFAIL": VerifyNullFail,
+  "CONST_SCRIPTCODE": VerifyConstScriptCode,
+  "WITNESS": VerifyWitness,
+  "DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": VerifyDiscourageUpgradableWitnessProgram,
+  "MINIMALIF": VerifyMinimalIf,
+  "WITNESS_PUBKEYTYPE": VerifyWitnessPubKeyType,
+  "TAPROOT": VerifyTaproot,
+  "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION": VerifyDiscourageUpgradableTaprootVersion,
+  "DISCOURAGE_OP_SUCCESS": VerifyDiscourageOpSuccess,
+  "DISCOURAGE_UPGRADABLE_PUBKEYTYPE": VerifyDiscourageUpgradablePubKeyType,
+}
+
+//ParseFlags reads a comma separated list of flag names such as P2SH,STRICTENC
+func ParseFlags(s string) (Flags, error) {
+  var flags Flags
+  if s == "" {
+    return flags, nil
+  }
+  for _, name := range strings.Split(s, ",") {
+    f, ok := flagNames[strings.TrimSpace(name)]
+    if !ok {
+      return 0, fmt.Errorf("script: unknown verification flag %q", name)
+    }
+    flags |= f
+  }
+  return flags, nil
+}
@@ -0,0 +1,44 @@
+package script
+
+import (
+    "bytes"
+    "testing"
+)
+
+//FuzzParse checks that parsing never panics, that the instructions returned cover the script end to end and that
+//the classifiers built on the parser cope with any script
+func FuzzParse(f *testing.F) {
+  for _, seed := range []string{
+    //the genesis coinbase output, pay to public key
+    "4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac",
+    "76a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac",
+    "a914748284390f9e263a4b766a75d0633c50426eb87587",
+    "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1",
+    "51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f8179851ae",
+    "6a0b68656c6c6f20776f726c64",
+    "4c", "4d01", "4e01000000", "4effffffff",
+  } {
+    f.Add(mustHex(seed))
+  }
+  f.Fuzz(func(t *testing.T, s []byte) {
+    ops, err := Parse(s)
+    end := 0
+    for _, op := range ops {
+      if op.Offset != end || s[op.Offset] != op.Code {
+        t.Fatalf("Parse(%x): op %+v does not start where the last ended, at %d", s, op, end)
+      }
+      _, end, _ = Next(s, op.Offset)
+      if !bytes.Equal(op.Data, s[end-len(op.Data):end]) {
+        t.Fatalf("Parse(%x): op %+v pushes data other than the bytes ending it", s, op)
+      }
+    }
+    if err == nil && end != len(s) {
+      t.Fatalf("Parse(%x) stopped at %d", s, end)
+    }
+    Classify(s)
+    WitnessProgram(s)
+    ParseMultisig(s)
+    SigOpCount(s, true)
+    SigOpCount(s, false)
+  })
+}
@@ -0,0 +1,789 @@
+package script
+
+import (
+    "crypto/sha1"
+    "crypto/sha256"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "golang.org/x/crypto/ripemd160"
+)
+
+//consensus limits of script evaluation
+const (
+  MaxScriptSize = 10000
+  MaxElementSize = 520
+  MaxOpsPerScript = 201
+  MaxPubKeysPerMultisig = 20
+  MaxStackSize = 1000
+)
+
+//lock time and sequence values compared by OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY
+const (
+  LockTimeThreshold = 500000000
+  SequenceFinal = 0xffffffff
+  SequenceDisableFlag = 1 << 31
+  SequenceTypeFlag = 1 << 22
+  SequenceMask = 0x0000ffff
+)
+
+//sigVersion selects the signature rules of the script being run
+type sigVersion int
+
+const (
+  sigVersionBase sigVersion = iota
+  //sigVersionWitnessV0 runs pay to witness public key hash and pay to witness script hash scripts, signed with BIP143
+  sigVersionWitnessV0
+  //sigVersionTapscript runs the leaves of taproot script trees under BIP342
+  sigVersionTapscript
+)
+
+//stack is the main or alt stack of a script, with the top element last
+type stack [][]byte
+
+func (s *stack) push(b []byte) {
+  *s = append(*s, b)
+}
+
+func (s *stack) pop() ([]byte) {
+  top := (*s)[len(*s)-1]
+  *s = (*s)[:len(*s)-1]
+  return top
+}
+
+//top returns the element i from the top, where -1 is the top itself
+func (s stack) top(i int) ([]byte) {
+  return s[len(s)+i]
+}
+
+//erase removes the element i from the top
+func (s *stack) erase(i int) {
+  n := len(*s) + i
+  *s = append((*s)[:n], (*s)[n+1:]...)
+}
+
+//swap exchanges the elements i and j from the top
+func (s stack) swap(i int, j int) {
+  s[len(s)+i], s[len(s)+j] = s[len(s)+j], s[len(s)+i]
+}
+
+//CastToBool reports whether a stack element is true: any non zero byte, except for a negative zero
+func CastToBool(b []byte) (bool) {
+  for i, v := range b {
+    if v != 0 {
+      return !(i == len(b) - 1 && v == 0x80)
+    }
+  }
+  return false
+}
+
+//boolBytes returns the stack element for a boolean
+func boolBytes(v bool) ([]byte) {
+  if v {
+    return []byte{1}
+  }
+  return []byte{}
+}
+
+//isMinimalPush reports whether op pushes its data with the smallest op code that can
+func isMinimalPush(op Op) (bool) {
+  n := len(op.Data)
+  switch {
+  case n == 0:
+    return op.Code == OP0
+  case n == 1 && op.Data[0] >= 1 && op.Data[0] <= 16:
+    return false
+  case n == 1 && op.Data[0] == 0x81:
+    return false
+  case n < OPPUSHDATA1:
+    return int(op.Code) == n
+  case n <= 0xff:
+    return op.Code == OPPUSHDATA1
+  case n <= 0xffff:
+    return op.Code == OPPUSHDATA2
+  }
+  return true
+}
+
+//IsPushOnly reports whether s holds nothing but pushes, counting OP_RESERVED and the small integer op codes as bitcoind does
+func IsPushOnly(s []byte) (bool) {
+  ops, err := Parse(s)
+  if err != nil {
+    return false
+  }
+  for _, op := range ops {
+    if op.Code > OP16 {
+      return false
+    }
+  }
+  return true
+}
+
+//IsPayToScriptHash reports whether s is a BIP16 pay to script hash output script
+func IsPayToScriptHash(s []byte) (bool) {
+  return len(s) == 23 && s[0] == OPHASH160 && s[1] == 20 && s[22] == OPEQUAL
+}
+
+//isDisabled reports whether an op code fails a script even where it is not executed
+func isDisabled(code byte) (bool) {
+  switch code {
+  case OPCAT, OPSUBSTR, OPLEFT, OPRIGHT, OPINVERT, OPAND, OPOR, OPXOR, OP2MUL, OP2DIV, OPMUL, OPDIV, OPMOD, OPLSHIFT, OPRSHIFT:
+    return true
+  }
+  return false
+}
+
+//checkSignatureEncoding applies the signature encoding rules flags select. An empty signature passes, and fails
+//the signature check itself.
+func checkSignatureEncoding(sig []byte, flags Flags) (error) {
+  if len(sig) == 0 {
+    return nil
+  }
+  if flags & (VerifyDERSignatures | VerifyLowS | VerifyStrictEncoding) != 0 && !IsStrictDER(sig) {
+    return ErrSigDER
+  }
+  if flags & VerifyLowS != 0 {
+    parsed, err := ParseSignature(sig)
+    if err != nil {
+      return ErrSigDER
+    }
+    if !isLowS(parsed.S) {
+      return ErrSigHighS
+    }
+  }
+  if flags & VerifyStrictEncoding != 0 {
+    base := sig[len(sig)-1] &^ SigHashAnyoneCanPay
+    if base < SigHashAll || base > SigHashSingle {
+      return ErrSigHashType
+    }
+  }
+  return nil
+}
+
+//checkPubKeyEncoding applies the public key encoding rules flags select, which for witness scripts can require
+//compressed keys
+func checkPubKeyEncoding(key []byte, flags Flags, version sigVersion) (error) {
+  if flags & VerifyStrictEncoding != 0 && !IsPublicKey(key) {
+    return ErrPubKeyType
+  }
+  if flags & VerifyWitnessPubKeyType != 0 && version == sigVersionWitnessV0 && (len(key) != 33 || (key[0] != 0x02 && key[0] != 0x03)) {
+    return ErrWitnessPubKeyType
+  }
+  return nil
+}
+
+//number reads a stack element as a script number of at most maxLength bytes
+func number(b []byte, flags Flags, maxLength int) (int64, error) {
+  return Number(b, maxLength, flags & VerifyMinimalData != 0)
+}
+
+//eval runs s on st as bitcoind's EvalScript does
+func eval(st *stack, s []byte, flags Flags, c *Checker, version sigVersion) (error) {
+  if version != sigVersionTapscript && len(s) > MaxScriptSize {
+    return ErrScriptSize
+  }
+  var alt stack
+  var exec []bool
+  opCount := 0
+  codeHash := 0
+  requireMinimal := flags & VerifyMinimalData != 0
+  for pos, opPos := 0, uint32(0); pos < len(s); opPos++ {
+    op, next, err := Next(s, pos)
+    if err != nil {
+      return ErrBadOpcode
+    }
+    pos = next
+    if len(op.Data) > MaxElementSize {
+      return ErrPushSize
+    }
+    if op.Code > OP16 && version != sigVersionTapscript {
+      opCount++
+      if opCount > MaxOpsPerScript {
+        return ErrOpCount
+      }
+    }
+    if isDisabled(op.Code) {
+      return ErrDisabledOpcode
+    }
+    if op.Code == OPCODESEPARATOR && version == sigVersionBase && flags & VerifyConstScriptCode != 0 {
+      return ErrOpCodeSeparator
+    }
+    executing := true
+    for _, e := range exec {
+      executing = executing && e
+    }
+
+    if executing && op.Code <= OPPUSHDATA4 {
+      if requireMinimal && !isMinimalPush(op) {
+        return ErrMinimalData
+      }
+      st.push(op.Data)
+    } else if executing || (op.Code >= OPIF && op.Code <= OPENDIF) {
+      if executing && op.Code == OPCODESEPARATOR && version == sigVersionTapscript {
+        c.tapscript.CodeSeparator = opPos
+      }
+      err = step(st, &alt, &exec, op, s, pos, &codeHash, &opCount, flags, c, version, executing)
+      if err != nil {
+        return err
+      }
+    }
+    if len(*st) + len(alt) > MaxStackSize {
+      return ErrStackSize
+    }
+  }
+  if len(exec) != 0 {
+    return ErrUnbalancedConditional
+  }
+  return nil
+}
+
+//step executes a single op code other than a push. pos is the position after it.
+func step(st *stack, alt *stack, exec *[]bool, op Op, s []byte, pos int, codeHash *int, opCount *int, flags Flags, c *Checker,
+  version sigVersion, executing bool) (error) {
+  need := func(n int) (error) {
+    if len(*st) < n {
+      return ErrInvalidStackOperation
+    }
+    return nil
+  }
+  if n, ok := op.SmallInt(); ok {
+    st.push(NumberBytes(int64(n)))
+    return nil
+  }
+  switch op.Code {
+  case OPNOP:
+  case OPCHECKLOCKTIMEVERIFY:
+    if flags & VerifyCheckLockTime == 0 {
+      return discourageNop(flags)
+    }
+    if err := need(1); err != nil {
+      return err
+    }
+    //lock times reach 2^39 - 1, so five byte numbers are allowed here
+    lockTime, err := number(st.top(-1), flags, 5)
+    if err != nil {
+      return err
+    }
+    if lockTime < 0 {
+      return ErrNegativeLockTime
+    }
+    if !c.checkLockTime(lockTime) {
+      return ErrUnsatisfiedLockTime
+    }
+  case OPCHECKSEQUENCEVERIFY:
+    if flags & VerifyCheckSequence == 0 {
+      return discourageNop(flags)
+    }
+    if err := need(1); err != nil {
+      return err
+    }
+    sequence, err := number(st.top(-1), flags, 5)
+    if err != nil {
+      return err
+    }
+    if sequence < 0 {
+      return ErrNegativeLockTime
+    }
+    if sequence & SequenceDisableFlag != 0 {
+      break
+    }
+    if !c.checkSequence(sequence) {
+      return ErrUnsatisfiedLockTime
+    }
+  case OPNOP1, OPNOP4, OPNOP4 + 1, OPNOP4 + 2, OPNOP4 + 3, OPNOP4 + 4, OPNOP4 + 5, OPNOP10:
+    return discourageNop(flags)
+  case OPIF, OPNOTIF:
+    value := false
+    if executing {
+      if len(*st) < 1 {
+        return ErrUnbalancedConditional
+      }
+      v := st.top(-1)
+      if version == sigVersionTapscript && (len(v) > 1 || (len(v) == 1 && v[0] != 1)) {
+        return ErrTapscriptMinimalIf
+      }
+      if version == sigVersionWitnessV0 && flags & VerifyMinimalIf != 0 && (len(v) > 1 || (len(v) == 1 && v[0] != 1)) {
+        return ErrMinimalIf
+      }
+      value = CastToBool(v)
+      if op.Code == OPNOTIF {
+        value = !value
+      }
+      st.pop()
+    }
+    *exec = append(*exec, value)
+  case OPELSE:
+    if len(*exec) == 0 {
+      return ErrUnbalancedConditional
+    }
+    (*exec)[len(*exec)-1] = !(*exec)[len(*exec)-1]
+  case OPENDIF:
+    if len(*exec) == 0 {
+      return ErrUnbalancedConditional
+    }
+    *exec = (*exec)[:len(*exec)-1]
+  case OPVERIFY:
+    if err := need(1); err != nil {
+      return err
+    }
+    if !CastToBool(st.top(-1)) {
+      return ErrVerify
+    }
+    st.pop()
+  case OPRETURN:
+    return ErrOpReturn
+
+  case OPTOALTSTACK:
+    if err := need(1); err != nil {
+      return err
+    }
+    alt.push(st.pop())
+  case OPFROMALTSTACK:
+    if len(*alt) < 1 {
+      return ErrInvalidAltStackOperation
+    }
+    st.push(alt.pop())
+  case OP2DROP:
+    if err := need(2); err != nil {
+      return err
+    }
+    st.pop()
+    st.pop()
+  case OP2DUP:
+    if err := need(2); err != nil {
+      return err
+    }
+    a, b := st.top(-2), st.top(-1)
+    st.push(a)
+    st.push(b)
+  case OP3DUP:
+    if err := need(3); err != nil {
+      return err
+    }
+    a, b, c := st.top(-3), st.top(-2), st.top(-1)
+    st.push(a)
+    st.push(b)
+    st.push(c)
+  case OP2OVER:
+    if err := need(4); err != nil {
+      return err
+    }
+    a, b := st.top(-4), st.top(-3)
+    st.push(a)
+    st.push(b)
+  case OP2ROT:
+    if err := need(6); err != nil {
+      return err
+    }
+    a, b := st.top(-6), st.top(-5)
+    st.erase(-6)
+    st.erase(-5)
+    st.push(a)
+    st.push(b)
+  case OP2SWAP:
+    if err := need(4); err != nil {
+      return err
+    }
+    st.swap(-4, -2)
+    st.swap(-3, -1)
+  case OPIFDUP:
+    if err := need(1); err != nil {
+      return err
+    }
+    if CastToBool(st.top(-1)) {
+      st.push(st.top(-1))
+    }
+  case OPDEPTH:
+    st.push(NumberBytes(int64(len(*st))))
+  case OPDROP:
+    if err := need(1); err != nil {
+      return err
+    }
+    st.pop()
+  case OPDUP:
+    if err := need(1); err != nil {
+      return err
+    }
+    st.push(st.top(-1))
+  case OPNIP:
+    if err := need(2); err != nil {
+      return err
+    }
+    st.erase(-2)
+  case OPOVER:
+    if err := need(2); err != nil {
+      return err
+    }
+    st.push(st.top(-2))
+  case OPPICK, OPROLL:
+    if err := need(2); err != nil {
+      return err
+    }
+    n, err := number(st.top(-1), flags, 4)
+    if err != nil {
+      return err
+    }
+    st.pop()
+    if n < 0 || n >= int64(len(*st)) {
+      return ErrInvalidStackOperation
+    }
+    v := st.top(int(-n) - 1)
+    if op.Code == OPROLL {
+      st.erase(int(-n) - 1)
+    }
+    st.push(v)
+  case OPROT:
+    if err := need(3); err != nil {
+      return err
+    }
+    st.swap(-3, -2)
+    st.swap(-2, -1)
+  case OPSWAP:
+    if err := need(2); err != nil {
+      return err
+    }
+    st.swap(-2, -1)
+  case OPTUCK:
+    if err := need(2); err != nil {
+      return err
+    }
+    v := st.top(-1)
+    n := len(*st) - 2
+    *st = append((*st)[:n], append([][]byte{v}, (*st)[n:]...)...)
+  case OPSIZE:
+    if err := need(1); err != nil {
+      return err
+    }
+    st.push(NumberBytes(int64(len(st.top(-1)))))
+
+  case OPEQUAL, OPEQUALVERIFY:
+    if err := need(2); err != nil {
+      return err
+    }
+    equal := string(st.top(-2)) == string(st.top(-1))
+    st.pop()
+    st.pop()
+    st.push(boolBytes(equal))
+    if op.Code == OPEQUALVERIFY {
+      if !equal {
+        return ErrEqualVerify
+      }
+      st.pop()
+    }
+
+  case OP1ADD, OP1SUB, OPNEGATE, OPABS, OPNOT, OP0NOTEQUAL:
+    if err := need(1); err != nil {
+      return err
+    }
+    n, err := number(st.top(-1), flags, 4)
+    if err != nil {
+      return err
+    }
+    switch op.Code {
+    case OP1ADD:
+      n++
+    case OP1SUB:
+      n--
+    case OPNEGATE:
+      n = -n
+    case OPABS:
+      if n < 0 {
+        n = -n
+      }
+    case OPNOT:
+      n = boolNumber(n == 0)
+    case OP0NOTEQUAL:
+      n = boolNumber(n != 0)
+    }
+    st.pop()
+    st.push(NumberBytes(n))
+  case OPADD, OPSUB, OPBOOLAND, OPBOOLOR, OPNUMEQUAL, OPNUMEQUALVERIFY, OPNUMNOTEQUAL, OPLESSTHAN, OPGREATERTHAN,
+    OPLESSTHANOREQUAL, OPGREATERTHANOREQUAL, OPMIN, OPMAX:
+    if err := need(2); err != nil {
+      return err
+    }
+    a, err := number(st.top(-2), flags, 4)
+    if err != nil {
+      return err
+    }
+    b, err := number(st.top(-1), flags, 4)
+    if err != nil {
+      return err
+    }
+    var n int64
+    switch op.Code {
+    case OPADD:
+      n = a + b
+    case OPSUB:
+      n = a - b
+    case OPBOOLAND:
+      n = boolNumber(a != 0 && b != 0)
+    case OPBOOLOR:
+      n = boolNumber(a != 0 || b != 0)
+    case OPNUMEQUAL, OPNUMEQUALVERIFY:
+      n = boolNumber(a == b)
+    case OPNUMNOTEQUAL:
+      n = boolNumber(a != b)
+    case OPLESSTHAN:
+      n = boolNumber(a < b)
+    case OPGREATERTHAN:
+      n = boolNumber(a > b)
+    case OPLESSTHANOREQUAL:
+      n = boolNumber(a <= b)
+    case OPGREATERTHANOREQUAL:
+      n = boolNumber(a >= b)
+    case OPMIN:
+      n = min(a, b)
+    case OPMAX:
+      n = max(a, b)
+    }
+    st.pop()
+    st.pop()
+    st.push(NumberBytes(n))
+    if op.Code == OPNUMEQUALVERIFY {
+      if !CastToBool(st.top(-1)) {
+        return ErrNumEqualVerify
+      }
+      st.pop()
+    }
+  case OPWITHIN:
+    if err := need(3); err != nil {
+      return err
+    }
+    x, err := number(st.top(-3), flags, 4)
+    if err != nil {
+      return err
+    }
+    low, err := number(st.top(-2), flags, 4)
+    if err != nil {
+      return err
+    }
+    high, err := number(st.top(-1), flags, 4)
+    if err != nil {
+      return err
+    }
+    st.pop()
+    st.pop()
+    st.pop()
+    st.push(boolBytes(low <= x && x < high))
+
+  case OPRIPEMD160, OPSHA1, OPSHA256, OPHASH160, OPHASH256:
+    if err := need(1); err != nil {
+      return err
+    }
+    v := st.pop()
+    var h []byte
+    switch op.Code {
+    case OPRIPEMD160:
+      r := ripemd160.New()
+      r.Write(v)
+      h = r.Sum(nil)
+    case OPSHA1:
+      sum := sha1.Sum(v)
+      h = sum[:]
+    case OPSHA256:
+      sum := sha256.Sum256(v)
+      h = sum[:]
+    case OPHASH160:
+      h = btchashing.Hash160(v)
+    case OPHASH256:
+      sum := btchashing.DoubleSha256(v)
+      h = sum[:]
+    }
+    st.push(h)
+  case OPCODESEPARATOR:
+    *codeHash = pos
+
+  case OPCHECKSIG, OPCHECKSIGVERIFY:
+    if err := need(2); err != nil {
+      return err
+    }
+    sig, key := st.top(-2), st.top(-1)
+    if version == sigVersionTapscript {
+      ok, err := c.checkTapscriptSig(sig, key, flags)
+      if err != nil {
+        return err
+      }
+      st.pop()
+      st.pop()
+      st.push(boolBytes(ok))
+      if op.Code == OPCHECKSIGVERIFY {
+        if !ok {
+          return ErrCheckSigVerify
+        }
+        st.pop()
+      }
+      break
+    }
+    scriptCode := s[*codeHash:]
+    if version == sigVersionBase {
+      var found int
+      scriptCode, found = FindAndDelete(scriptCode, sig)
+      if found > 0 && flags & VerifyConstScriptCode != 0 {
+        return ErrSigFindAndDelete
+      }
+    }
+    if err := checkSignatureEncoding(sig, flags); err != nil {
+      return err
+    }
+    if err := checkPubKeyEncoding(key, flags, version); err != nil {
+      return err
+    }
+    ok := c.checkECDSA(sig, key, scriptCode, version)
+    if !ok && flags & VerifyNullFail != 0 && len(sig) > 0 {
+      return ErrNullFail
+    }
+    st.pop()
+    st.pop()
+    st.push(boolBytes(ok))
+    if op.Code == OPCHECKSIGVERIFY {
+      if !ok {
+        return ErrCheckSigVerify
+      }
+      st.pop()
+    }
+  case OPCHECKSIGADD:
+    //OP_CHECKSIGADD is only defined in tapscript; elsewhere it is an unknown op code
+    if version != sigVersionTapscript {
+      return ErrBadOpcode
+    }
+    if err := need(3); err != nil {
+      return err
+    }
+    sig, key := st.top(-3), st.top(-1)
+    n, err := number(st.top(-2), flags, 4)
+    if err != nil {
+      return err
+    }
+    ok, err := c.checkTapscriptSig(sig, key, flags)
+    if err != nil {
+      return err
+    }
+    st.pop()
+    st.pop()
+    st.pop()
+    st.push(NumberBytes(n + boolNumber(ok)))
+  case OPCHECKMULTISIG, OPCHECKMULTISIGVERIFY:
+    if version == sigVersionTapscript {
+      return ErrTapscriptCheckMultisig
+    }
+    return checkMultisig(st, op, s, *codeHash, opCount, flags, c, version)
+  default:
+    return ErrBadOpcode
+  }
+  return nil
+}
+
+//discourageNop runs an op code reserved for soft forks as the no op it is until one gives it a meaning, failing it
+//under DISCOURAGE_UPGRADABLE_NOPS. OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY are such op codes where their
+//rules are not enforced.
+func discourageNop(flags Flags) (error) {
+  if flags & VerifyDiscourageUpgradableNops != 0 {
+    return ErrDiscourageUpgradableNops
+  }
+  return nil
+}
+
+//boolNumber returns 1 for true and 0 for false
+func boolNumber(v bool) (int64) {
+  if v {
+    return 1
+  }
+  return 0
+}
+
+//checkMultisig runs OP_CHECKMULTISIG, which pops a key count, the keys, a signature count, the signatures and, by an
+//off by one in the first version, one more element that BIP147 later required to be empty. Signatures must match keys
+//in order.
+func checkMultisig(st *stack, op Op, s []byte, codeHash int, opCount *int, flags Flags, c *Checker, version sigVersion) (error) {
+  i := 1
+  if len(*st) < i {
+    return ErrInvalidStackOperation
+  }
+  keys, err := number(st.top(-i), flags, 4)
+  if err != nil {
+    return err
+  }
+  if keys < 0 || keys > MaxPubKeysPerMultisig {
+    return ErrPubKeyCount
+  }
+  *opCount += int(keys)
+  if *opCount > MaxOpsPerScript {
+    return ErrOpCount
+  }
+  i++
+  key := i
+  //keysLeft counts the key elements still to be popped, which NULLFAIL does not apply to
+  keysLeft := int(keys) + 2
+  i += int(keys)
+  if len(*st) < i {
+    return ErrInvalidStackOperation
+  }
+  sigs, err := number(st.top(-i), flags, 4)
+  if err != nil {
+    return err
+  }
+  if sigs < 0 || sigs > keys {
+    return ErrSigCount
+  }
+  i++
+  sig := i
+  i += int(sigs)
+  if len(*st) < i {
+    return ErrInvalidStackOperation
+  }
+
+  scriptCode := s[codeHash:]
+  for k := 0; k < int(sigs); k++ {
+    if version == sigVersionBase {
+      var found int
+      scriptCode, found = FindAndDelete(scriptCode, st.top(-sig-k))
+      if found > 0 && flags & VerifyConstScriptCode != 0 {
+        return ErrSigFindAndDelete
+      }
+    }
+  }
+
+  success := true
+  for success && sigs > 0 {
+    signature, pubKey := st.top(-sig), st.top(-key)
+    if err := checkSignatureEncoding(signature, flags); err != nil {
+      return err
+    }
+    if err := checkPubKeyEncoding(pubKey, flags, version); err != nil {
+      return err
+    }
+    if c.checkECDSA(signature, pubKey, scriptCode, version) {
+      sig++
+      sigs--
+    }
+    key++
+    keys--
+    if sigs > keys {
+      success = false
+    }
+  }
+
+  for ; i > 1; i-- {
+    if !success && flags & VerifyNullFail != 0 && keysLeft == 0 && len(st.top(-1)) > 0 {
+      return ErrNullFail
+    }
+    if keysLeft > 0 {
+      keysLeft--
+    }
+    st.pop()
+  }
+  if len(*st) < 1 {
+    return ErrInvalidStackOperation
+  }
+  if flags & VerifyNullDummy != 0 && len(st.top(-1)) > 0 {
+    return ErrSigNullDummy
+  }
+  st.pop()
+  st.push(boolBytes(success))
+  if op.Code == OPCHECKMULTISIGVERIFY {
+    if !success {
+      return ErrCheckMultisigVerify
+    }
+    st.pop()
+  }
+  return nil
+}
@@ -0,0 +1,99 @@
+package script
+
+//op codes, named as in bitcoind without the underscores
+const (
+  OP0 = 0x00
+  OPPUSHDATA1 = 0x4c
+  OPPUSHDATA2 = 0x4d
+  OPPUSHDATA4 = 0x4e
+  OP1NEGATE = 0x4f
+  OPRESERVED = 0x50
+  OP1 = 0x51
+  OP16 = 0x60
+  OPNOP = 0x61
+  OPVER = 0x62
+  OPIF = 0x63
+  OPNOTIF = 0x64
+  OPVERIF = 0x65
+  OPVERNOTIF = 0x66
+  OPELSE = 0x67
+  OPENDIF = 0x68
+  OPVERIFY = 0x69
+  OPRETURN = 0x6a
+  OPTOALTSTACK = 0x6b
+  OPFROMALTSTACK = 0x6c
+  OP2DROP = 0x6d
+  OP2DUP = 0x6e
+  OP3DUP = 0x6f
+  OP2OVER = 0x70
+  OP2ROT = 0x71
+  OP2SWAP = 0x72
+  OPIFDUP = 0x73
+  OPDEPTH = 0x74
+  OPDROP = 0x75
+  OPDUP = 0x76
+  OPNIP = 0x77
+  OPOVER = 0x78
+  OPPICK = 0x79
+  OPROLL = 0x7a
+  OPROT = 0x7b
+  OPSWAP = 0x7c
+  OPTUCK = 0x7d
+  OPCAT = 0x7e
+  OPSUBSTR = 0x7f
+  OPLEFT = 0x80
+  OPRIGHT = 0x81
+  OPSIZE = 0x82
+  OPINVERT = 0x83
+  OPAND = 0x84
+  OPOR = 0x85
+  OPXOR = 0x86
+  OPEQUAL = 0x87
+  OPEQUALVERIFY = 0x88
+  OPRESERVED1 = 0x89
+  OPRESERVED2 = 0x8a
+  OP1ADD = 0x8b
+  OP1SUB = 0x8c
+  OP2MUL = 0x8d
+  OP2DIV = 0x8e
+  OPNEGATE = 0x8f
+  OPABS = 0x90
+  OPNOT = 0x91
+  OP0NOTEQUAL = 0x92
+  OPADD = 0x93
+  OPSUB = 0x94
+  OPMUL = 0x95
+  OPDIV = 0x96
+  OPMOD = 0x97
+  OPLSHIFT = 0x98
+  OPRSHIFT = 0x99
+  OPBOOLAND = 0x9a
+  OPBOOLOR = 0x9b
+  OPNUMEQUAL = 0x9c
+  OPNUMEQUALVERIFY = 0x9d
+  OPNUMNOTEQUAL = 0x9e
+  OPLESSTHAN = 0x9f
+  OPGREATERTHAN = 0xa0
+  OPLESSTHANOREQUAL = 0xa1
+  OPGREATERTHANOREQUAL = 0xa2
+  OPMIN = 0xa3
+  OPMAX = 0xa4
+  OPWITHIN = 0xa5
+  OPRIPEMD160 = 0xa6
+  OPSHA1 = 0xa7
+  OPSHA256 = 0xa8
+  OPHASH160 = 0xa9
+  OPHASH256 = 0xaa
+  OPCODESEPARATOR = 0xab
+  OPCHECKSIG = 0xac
+  OPCHECKSIGVERIFY = 0xad
+  OPCHECKMULTISIG = 0xae
+  OPCHECKMULTISIGVERIFY = 0xaf
+  OPNOP1 = 0xb0
+  OPCHECKLOCKTIMEVERIFY = 0xb1
+  OPCHECKSEQUENCEVERIFY = 0xb2
+  OPNOP4 = 0xb3
+  OPNOP10 = 0xb9
+  OPCHECKSIGADD = 0xba
+  OPINVALIDOPCODE = 0xff
+)
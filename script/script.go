@@ -0,0 +1,144 @@
+package script
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+//ErrTruncatedPush is returned when a push runs past the end of the script
+var ErrTruncatedPush = errors.New("script: push runs past the end of the script")
+//ErrNumberTooLong is returned when a script number is longer than allowed
+var ErrNumberTooLong = errors.New("script: number too long")
+//ErrNonMinimalNumber is returned when a script number has needless trailing zero bytes
+var ErrNonMinimalNumber = errors.New("script: number not minimally encoded")
+
+//Op is a single instruction of a script. Data holds the bytes pushed by push op codes and points into the script.
+type Op struct {
+  Code byte
+  Data []byte
+  //Offset is the position of the op code in the script
+  Offset int
+}
+
+//IsPush reports whether o pushes data, counting OP_0, but not the small integer op codes
+func (o Op) IsPush() (bool) {
+  return o.Code <= OPPUSHDATA4
+}
+
+//SmallInt returns the value OP_1NEGATE and OP_1 to OP_16 push, and whether o is one of them
+func (o Op) SmallInt() (int, bool) {
+  switch {
+  case o.Code == OP1NEGATE:
+    return -1, true
+  case o.Code >= OP1 && o.Code <= OP16:
+    return int(o.Code - OP1 + 1), true
+  }
+  return 0, false
+}
+
+//Parse splits s into its instructions. When a push runs past the end of s, the instructions before it are returned
+//with ErrTruncatedPush.
+func Parse(s []byte) ([]Op, error) {
+  var ops []Op
+  for pos := 0; pos < len(s); {
+    op, next, err := Next(s, pos)
+    if err != nil {
+      return ops, err
+    }
+    ops = append(ops, op)
+    pos = next
+  }
+  return ops, nil
+}
+
+//Next reads the instruction at pos and returns it with the position of the one after it
+func Next(s []byte, pos int) (Op, int, error) {
+  op := Op{Code: s[pos], Offset: pos}
+  pos++
+  var n int
+  switch {
+  case op.Code < OPPUSHDATA1:
+    n = int(op.Code)
+  case op.Code == OPPUSHDATA1:
+    if len(s) - pos < 1 {
+      return op, len(s), ErrTruncatedPush
+    }
+    n = int(s[pos])
+    pos++
+  case op.Code == OPPUSHDATA2:
+    if len(s) - pos < 2 {
+      return op, len(s), ErrTruncatedPush
+    }
+    n = int(binary.LittleEndian.Uint16(s[pos:]))
+    pos += 2
+  case op.Code == OPPUSHDATA4:
+    if len(s) - pos < 4 {
+      return op, len(s), ErrTruncatedPush
+    }
+    length := binary.LittleEndian.Uint32(s[pos:])
+    pos += 4
+    if uint64(length) > uint64(len(s) - pos) {
+      return op, len(s), ErrTruncatedPush
+    }
+    n = int(length)
+  default:
+    return op, pos, nil
+  }
+  if n > len(s) - pos {
+    return op, len(s), ErrTruncatedPush
+  }
+  op.Data = s[pos:pos+n]
+  return op, pos + n, nil
+}
+
+//Number decodes a script number: little endian, with the sign in the top bit of the last byte. Numbers longer than
+//maxLength bytes are rejected, as are numbers with needless trailing zero bytes when minimal is set.
+func Number(b []byte, maxLength int, minimal bool) (int64, error) {
+  if len(b) > maxLength {
+    return 0, ErrNumberTooLong
+  }
+  if len(b) == 0 {
+    return 0, nil
+  }
+  //a last byte of 0x00 or 0x80 is only needed when the byte before it has its top bit set
+  if minimal && b[len(b)-1] & 0x7f == 0 && (len(b) == 1 || b[len(b)-2] & 0x80 == 0) {
+    return 0, ErrNonMinimalNumber
+  }
+  var n int64
+  for i, v := range b {
+    n |= int64(v) << (8 * i)
+  }
+  last := len(b) - 1
+  if b[last] & 0x80 != 0 {
+    return -(n &^ (int64(0x80) << (8 * last))), nil
+  }
+  return n, nil
+}
+
+//NumberBytes encodes n as a minimal script number
+func NumberBytes(n int64) ([]byte) {
+  if n == 0 {
+    return nil
+  }
+  negative := n < 0
+  abs := uint64(n)
+  if negative {
+    abs = uint64(-n)
+  }
+  var b []byte
+  for abs > 0 {
+    b = append(b, byte(abs))
+    abs >>= 8
+  }
+  //the top bit holds the sign, so a magnitude using it needs another byte
+  if b[len(b)-1] & 0x80 != 0 {
+    if negative {
+      b = append(b, 0x80)
+    } else {
+      b = append(b, 0x00)
+    }
+  } else if negative {
+    b[len(b)-1] |= 0x80
+  }
+  return b
+}
@@ -0,0 +1,98 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestParse(t *testing.T) {
+  s := []byte{OP0, 0x02, 0xaa, 0xbb, OPPUSHDATA1, 0x01, 0xcc, OPPUSHDATA2, 0x01, 0x00, 0xdd, OPPUSHDATA4, 0x01, 0x00, 0x00, 0x00, 0xee, OP16, OPRETURN}
+  ops, err := Parse(s)
+  if err != nil || len(ops) != 7 {
+    t.Fatalf("Parse returned %d ops, %v", len(ops), err)
+  }
+  data := []string{"", "aabb", "cc", "dd", "ee"}
+  for i, d := range data {
+    if !ops[i].IsPush() || string(ops[i].Data) != string(mustHex(d)) {
+      t.Errorf("op %d is %x pushing %x, want a push of %s", i, ops[i].Code, ops[i].Data, d)
+    }
+  }
+  if n, ok := ops[5].SmallInt(); !ok || n != 16 || ops[5].IsPush() || ops[6].Code != OPRETURN || ops[6].Offset != len(s) - 1 {
+    t.Errorf("last ops %+v", ops[5:])
+  }
+  for _, bad := range [][]byte{{0x02, 0xaa}, {OPPUSHDATA1}, {OPPUSHDATA2, 0x01}, {OPPUSHDATA4, 0xff, 0xff, 0xff, 0xff, 0x00}} {
+    if _, err := Parse(bad); err != ErrTruncatedPush {
+      t.Errorf("Parse(%x) returned %v, want ErrTruncatedPush", bad, err)
+    }
+  }
+}
+
+func TestNumber(t *testing.T) {
+  tests := []struct {
+    b string
+    n int64
+    err error
+  }{
+    {"", 0, nil},
+    {"01", 1, nil},
+    {"81", -1, nil},
+    {"ff00", 255, nil},
+    {"ff80", -255, nil},
+    {"5b7a03", 227931, nil},
+    {"00", 0, ErrNonMinimalNumber},
+    {"80", 0, ErrNonMinimalNumber},
+    {"0100", 0, ErrNonMinimalNumber},
+    {"0000000001", 0, ErrNumberTooLong},
+  }
+  for _, test := range tests {
+    n, err := Number(mustHex(test.b), 4, true)
+    if n != test.n || err != test.err {
+      t.Errorf("Number(%s) = %d, %v; want %d, %v", test.b, n, err, test.n, test.err)
+    }
+  }
+}
+
+func mustHex(s string) ([]byte) {
+  b := make([]byte, len(s) / 2)
+  for i := range b {
+    var v byte
+    for _, c := range s[2*i:2*i+2] {
+      v <<= 4
+      switch {
+      case c >= '0' && c <= '9':
+        v |= byte(c - '0')
+      default:
+        v |= byte(c - 'a' + 10)
+      }
+    }
+    b[i] = v
+  }
+  return b
+}
+
+func TestClassify(t *testing.T) {
+  key := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+  tests := []struct {
+    hex string
+    kind string
+  }{
+    {"21" + key + "ac", PubKey},
+    {"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", PubKeyHash},
+    {"a914751e76e8199196d454941c45d1b3a323f1433bd687", ScriptHash},
+    {"5121" + key + "51ae", Multisig},
+    {"0014751e76e8199196d454941c45d1b3a323f1433bd6", WitnessPubKeyHash},
+    {"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", WitnessScriptHash},
+    {"5120" + key[2:], Taproot},
+    {"6002751e", WitnessUnknown},
+    {"6a0474657374", NullData},
+    {"6a", NullData},
+    //a version 0 program of neither length, a key that is neither form and the empty script
+    {"0015751e76e8199196d454941c45d1b3a323f1433bd600", NonStandard},
+    {"2105" + key[2:] + "ac", NonStandard},
+    {"", NonStandard},
+  }
+  for _, test := range tests {
+    if got := Classify(mustHex(test.hex)); got != test.kind {
+      t.Errorf("Classify(%s) = %s, want %s", test.hex, got, test.kind)
+    }
+  }
+}
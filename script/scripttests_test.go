@@ -0,0 +1,272 @@
+package script
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+)
+
+//scriptErrors maps the error names of bitcoind's script test data to the errors they stand for
+var scriptErrors = map[string][]error{
+  "OK": {nil},
+  "EVAL_FALSE": {ErrEvalFalse},
+  "OP_RETURN": {ErrOpReturn},
+  "SCRIPT_SIZE": {ErrScriptSize},
+  "PUSH_SIZE": {ErrPushSize},
+  "OP_COUNT": {ErrOpCount},
+  "STACK_SIZE": {ErrStackSize},
+  "SIG_COUNT": {ErrSigCount},
+  "PUBKEY_COUNT": {ErrPubKeyCount},
+  "VERIFY": {ErrVerify},
+  "EQUALVERIFY": {ErrEqualVerify},
+  "CHECKMULTISIGVERIFY": {ErrCheckMultisigVerify},
+  "CHECKSIGVERIFY": {ErrCheckSigVerify},
+  "NUMEQUALVERIFY": {ErrNumEqualVerify},
+  "BAD_OPCODE": {ErrBadOpcode},
+  "DISABLED_OPCODE": {ErrDisabledOpcode},
+  "INVALID_STACK_OPERATION": {ErrInvalidStackOperation},
+  "INVALID_ALTSTACK_OPERATION": {ErrInvalidAltStackOperation},
+  "UNBALANCED_CONDITIONAL": {ErrUnbalancedConditional},
+  "NEGATIVE_LOCKTIME": {ErrNegativeLockTime},
+  "UNSATISFIED_LOCKTIME": {ErrUnsatisfiedLockTime},
+  "SIG_HASHTYPE": {ErrSigHashType},
+  "SIG_DER": {ErrSigDER},
+  "MINIMALDATA": {ErrMinimalData},
+  "SIG_PUSHONLY": {ErrSigPushOnly},
+  "SIG_HIGH_S": {ErrSigHighS},
+  "SIG_NULLDUMMY": {ErrSigNullDummy},
+  "PUBKEYTYPE": {ErrPubKeyType},
+  "CLEANSTACK": {ErrCleanStack},
+  "MINIMALIF": {ErrMinimalIf},
+  "NULLFAIL": {ErrNullFail},
+  "DISCOURAGE_UPGRADABLE_NOPS": {ErrDiscourageUpgradableNops},
+  "OP_CODESEPARATOR": {ErrOpCodeSeparator},
+  "SIG_FINDANDDELETE": {ErrSigFindAndDelete},
+  //bitcoind reports script number failures, which it raises as exceptions, as unknown errors
+  "UNKNOWN_ERROR": {ErrNumberTooLong, ErrNonMinimalNumber},
+  "WITNESS_PROGRAM_WRONG_LENGTH": {ErrWitnessProgramWrongLength},
+  "WITNESS_PROGRAM_WITNESS_EMPTY": {ErrWitnessProgramWitnessEmpty},
+  "WITNESS_PROGRAM_MISMATCH": {ErrWitnessProgramMismatch},
+  "WITNESS_MALLEATED": {ErrWitnessMalleated},
+  "WITNESS_MALLEATED_P2SH": {ErrWitnessMalleatedP2SH},
+  "WITNESS_UNEXPECTED": {ErrWitnessUnexpected},
+  "WITNESS_PUBKEYTYPE": {ErrWitnessPubKeyType},
+  "DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": {ErrDiscourageUpgradableWitnessProgram},
+  "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION": {ErrDiscourageUpgradableTaprootVersion},
+  "DISCOURAGE_OP_SUCCESS": {ErrDiscourageOpSuccess},
+  "DISCOURAGE_UPGRADABLE_PUBKEYTYPE": {ErrDiscourageUpgradablePubKeyType},
+  "SCHNORR_SIG_SIZE": {ErrSchnorrSigSize},
+  "SCHNORR_SIG_HASHTYPE": {ErrSchnorrSigHashType},
+  "SCHNORR_SIG": {ErrSchnorrSig},
+  "TAPROOT_WRONG_CONTROL_SIZE": {ErrTaprootWrongControlSize},
+  "TAPSCRIPT_VALIDATION_WEIGHT": {ErrTapscriptValidationWeight},
+  "TAPSCRIPT_CHECKMULTISIG": {ErrTapscriptCheckMultisig},
+  "TAPSCRIPT_MINIMALIF": {ErrTapscriptMinimalIf},
+  "TAPSCRIPT_EMPTY_PUBKEY": {ErrTapscriptEmptyPubKey},
+}
+
+//opNames maps the names bitcoind's test data uses for op codes, with or without their OP_ prefix
+var opNames = map[string]byte{
+  "0": OP0, "FALSE": OP0, "PUSHDATA1": OPPUSHDATA1, "PUSHDATA2": OPPUSHDATA2, "PUSHDATA4": OPPUSHDATA4,
+  "1NEGATE": OP1NEGATE, "RESERVED": OPRESERVED, "TRUE": OP1, "NOP2": OPCHECKLOCKTIMEVERIFY, "NOP3": OPCHECKSEQUENCEVERIFY,
+  "INVALIDOPCODE": OPINVALIDOPCODE,
+}
+
+func init() {
+  //the op codes from OP_NOP to OP_CHECKSIGADD are contiguous
+  names := strings.Fields(`NOP VER IF NOTIF VERIF VERNOTIF ELSE ENDIF VERIFY RETURN TOALTSTACK FROMALTSTACK 2DROP 2DUP 3DUP
+    2OVER 2ROT 2SWAP IFDUP DEPTH DROP DUP NIP OVER PICK ROLL ROT SWAP TUCK CAT SUBSTR LEFT RIGHT SIZE INVERT AND OR XOR EQUAL
+    EQUALVERIFY RESERVED1 RESERVED2 1ADD 1SUB 2MUL 2DIV NEGATE ABS NOT 0NOTEQUAL ADD SUB MUL DIV MOD LSHIFT RSHIFT BOOLAND
+    BOOLOR NUMEQUAL NUMEQUALVERIFY NUMNOTEQUAL LESSTHAN GREATERTHAN LESSTHANOREQUAL GREATERTHANOREQUAL MIN MAX WITHIN
+    RIPEMD160 SHA1 SHA256 HASH160 HASH256 CODESEPARATOR CHECKSIG CHECKSIGVERIFY CHECKMULTISIG CHECKMULTISIGVERIFY NOP1
+    CHECKLOCKTIMEVERIFY CHECKSEQUENCEVERIFY NOP4 NOP5 NOP6 NOP7 NOP8 NOP9 NOP10 CHECKSIGADD`)
+  for i, name := range names {
+    opNames[name] = OPNOP + byte(i)
+  }
+  for n := 1; n <= 16; n++ {
+    opNames[strconv.Itoa(n)] = OP1 + byte(n - 1)
+  }
+}
+
+//parseAsm reads the script notation of bitcoind's test data: decimal numbers, 0x prefixed raw bytes, quoted strings
+//to push and op code names
+func parseAsm(s string) ([]byte, error) {
+  var b []byte
+  for _, w := range strings.Fields(s) {
+    if n, err := strconv.ParseInt(w, 10, 64); err == nil {
+      switch {
+      case n == -1:
+        b = append(b, OP1NEGATE)
+      case n == 0:
+        b = append(b, OP0)
+      case n >= 1 && n <= 16:
+        b = append(b, OP1 + byte(n - 1))
+      default:
+        b = append(b, PushData(NumberBytes(n))...)
+      }
+      continue
+    }
+    if strings.HasPrefix(w, "0x") && len(w) > 2 {
+      raw, err := hex.DecodeString(w[2:])
+      if err != nil {
+        return nil, err
+      }
+      b = append(b, raw...)
+      continue
+    }
+    if len(w) >= 2 && w[0] == '\'' && w[len(w)-1] == '\'' {
+      b = append(b, PushData([]byte(w[1:len(w)-1]))...)
+      continue
+    }
+    code, ok := opNames[strings.TrimPrefix(w, "OP_")]
+    if !ok {
+      return nil, fmt.Errorf("unknown word %q", w)
+    }
+    b = append(b, code)
+  }
+  return b, nil
+}
+
+//spendingTransaction builds the pair of transactions bitcoind's script tests run in: one paying value to
+//scriptPubKey, and one spending it with scriptSig and witness
+func spendingTransaction(scriptSig []byte, scriptPubKey []byte, witness [][]byte, value uint64) (*block.Transaction) {
+  credit := block.Transaction{
+    TransactionVersionNumber: 1,
+    Inputs: []block.Input{{TransactionIndex: 0xffffffff, InputScript: []byte{OP0, OP0}, SequenceNumber: SequenceFinal}},
+    Outputs: []block.Output{{OutputValue: value, ChallengeScript: scriptPubKey}},
+  }
+  return &block.Transaction{
+    TransactionVersionNumber: 1,
+    Inputs: []block.Input{{TransactionHash: btchashing.DoubleSha256(blockserializer.SerializeTransactionNoWitness(&credit)),
+      InputScript: scriptSig, SequenceNumber: SequenceFinal, Witness: witness}},
+    Outputs: []block.Output{{OutputValue: value}},
+  }
+}
+
+//readWitness reads the witness of an entry, its elements in hex followed by the amount spent in BTC
+func readWitness(entry []interface{}) ([][]byte, uint64, error) {
+  if len(entry) == 0 {
+    return nil, 0, fmt.Errorf("witness without an amount")
+  }
+  amount, ok := entry[len(entry)-1].(float64)
+  if !ok {
+    return nil, 0, fmt.Errorf("witness amount %v is not a number", entry[len(entry)-1])
+  }
+  var witness [][]byte
+  for _, e := range entry[:len(entry)-1] {
+    s, _ := e.(string)
+    item, err := hex.DecodeString(s)
+    if err != nil {
+      return nil, 0, err
+    }
+    witness = append(witness, item)
+  }
+  return witness, uint64(math.Round(amount * 1e8)), nil
+}
+
+//scriptTestFiles are the files TestScripts runs: bitcoind's src/test/data/script_tests.json, as vendored by btcd
+//before taproot, and cases written for this repository in the same layout
+var scriptTestFiles = []string{"testdata/core/script_tests.json", "testdata/extra_script_tests.json"}
+
+//scriptTestExceptions lists, by file and entry index, the entries whose expected error this package deliberately does
+//not return, with the error it returns instead. The vendored copy of bitcoind's file predates taproot, when a version 0
+//witness script leaving other than one element failed with EVAL_FALSE; bitcoind has since reported CLEANSTACK, as
+//this package does.
+var scriptTestExceptions = map[string]map[int]error{
+  "testdata/core/script_tests.json": {
+    1185: ErrCleanStack, 1186: ErrCleanStack, 1190: ErrCleanStack, 1195: ErrCleanStack, 1196: ErrCleanStack,
+    1197: ErrCleanStack, 1200: ErrCleanStack, 1211: ErrCleanStack, 1212: ErrCleanStack, 1216: ErrCleanStack,
+    1221: ErrCleanStack, 1222: ErrCleanStack, 1223: ErrCleanStack, 1226: ErrCleanStack,
+  },
+}
+
+//TestScripts runs every entry of scriptTestFiles. An entry with a flag or an error this package does not know fails
+//the test, as does one it cannot read, and one in scriptTestExceptions must return the error listed there.
+func TestScripts(t *testing.T) {
+  for _, path := range scriptTestFiles {
+    t.Run(path, func(t *testing.T) {
+      runScriptTests(t, path)
+    })
+  }
+}
+
+func runScriptTests(t *testing.T, path string) {
+  raw, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var tests [][]interface{}
+  err = json.Unmarshal(raw, &tests)
+  if err != nil {
+    t.Fatal(err)
+  }
+  exceptions := scriptTestExceptions[path]
+  run := 0
+  for i, test := range tests {
+    if len(test) == 1 {
+      continue
+    }
+    var witness [][]byte
+    var amount uint64
+    if entry, ok := test[0].([]interface{}); ok {
+      var err error
+      witness, amount, err = readWitness(entry)
+      if err != nil {
+        t.Errorf("entry %d: witness: %v", i, err)
+        continue
+      }
+      test = test[1:]
+    }
+    if len(test) < 4 {
+      t.Errorf("entry %d is malformed: %v", i, test)
+      continue
+    }
+    fields := make([]string, 4)
+    for f := range fields {
+      fields[f], _ = test[f].(string)
+    }
+    flags, err := ParseFlags(fields[2])
+    if err != nil {
+      t.Errorf("entry %d: %v", i, err)
+      continue
+    }
+    want, known := scriptErrors[fields[3]]
+    if !known {
+      t.Errorf("entry %d: unknown script error %s", i, fields[3])
+      continue
+    }
+    scriptSig, err := parseAsm(fields[0])
+    if err != nil {
+      t.Errorf("entry %d: scriptSig: %v", i, err)
+      continue
+    }
+    scriptPubKey, err := parseAsm(fields[1])
+    if err != nil {
+      t.Errorf("entry %d: scriptPubKey: %v", i, err)
+      continue
+    }
+    tx := spendingTransaction(scriptSig, scriptPubKey, witness, amount)
+    got := VerifyScript(scriptSig, scriptPubKey, flags, &Checker{Tx: tx, Prevouts: []Prevout{{Value: amount, Script: scriptPubKey}}})
+    if e, ok := exceptions[i]; ok {
+      want = []error{e}
+    }
+    matched := false
+    for _, w := range want {
+      matched = matched || errors.Is(got, w) || (got == nil && w == nil)
+    }
+    if !matched {
+      t.Errorf("entry %d %v: got %v, want %s", i, test, got, fields[3])
+    }
+    run++
+  }
+  t.Logf("%d script tests run, %d of them exceptions", run, len(exceptions))
+}
@@ -0,0 +1,316 @@
+package script
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/secp256k1"
+)
+
+//one is the value bitcoind returns, and signatures sign, for an input index past the inputs, or a SIGHASH_SINGLE
+//signature on an input with no output at its index. Signing it signs nothing about the transaction.
+var one = block.Hash{0x01}
+
+//LegacySignatureHash returns the hash a signature in a pre-segwit script signs for input index of tx. scriptCode is
+//the script being run from just after its last executed OP_CODESEPARATOR, with the signature already removed from it.
+func LegacySignatureHash(tx *block.Transaction, index int, scriptCode []byte, hashType uint32) (block.Hash) {
+  if index >= len(tx.Inputs) {
+    return one
+  }
+  base := hashType & 0x1f
+  if base == SigHashSingle && index >= len(tx.Outputs) {
+    return one
+  }
+  anyoneCanPay := hashType & SigHashAnyoneCanPay != 0
+  b := binary.LittleEndian.AppendUint32(nil, tx.TransactionVersionNumber)
+  if anyoneCanPay {
+    b = blockserializer.AppendCompactSize(b, 1)
+  } else {
+    b = blockserializer.AppendCompactSize(b, uint64(len(tx.Inputs)))
+  }
+  for i := range tx.Inputs {
+    if anyoneCanPay && i != index {
+      continue
+    }
+    in := &tx.Inputs[i]
+    b = append(b, in.TransactionHash[:]...)
+    b = binary.LittleEndian.AppendUint32(b, in.TransactionIndex)
+    if i == index {
+      b = appendScriptCode(b, scriptCode)
+    } else {
+      b = append(b, 0)
+    }
+    if i != index && (base == SigHashNone || base == SigHashSingle) {
+      b = binary.LittleEndian.AppendUint32(b, 0)
+    } else {
+      b = binary.LittleEndian.AppendUint32(b, in.SequenceNumber)
+    }
+  }
+  outputs := len(tx.Outputs)
+  switch base {
+  case SigHashNone:
+    outputs = 0
+  case SigHashSingle:
+    outputs = index + 1
+  }
+  b = blockserializer.AppendCompactSize(b, uint64(outputs))
+  for o := 0; o < outputs; o++ {
+    if base == SigHashSingle && o != index {
+      //the outputs before the signed one are blanked to a value of -1 and an empty script
+      b = binary.LittleEndian.AppendUint64(b, 0xffffffffffffffff)
+      b = append(b, 0)
+      continue
+    }
+    b = binary.LittleEndian.AppendUint64(b, tx.Outputs[o].OutputValue)
+    b = blockserializer.AppendCompactSize(b, uint64(len(tx.Outputs[o].ChallengeScript)))
+    b = append(b, tx.Outputs[o].ChallengeScript...)
+  }
+  b = binary.LittleEndian.AppendUint32(b, tx.TransactionLockTime)
+  b = binary.LittleEndian.AppendUint32(b, hashType)
+  return btchashing.DoubleSha256(b)
+}
+
+//SigHashes holds the hashes over a whole transaction that segwit signature hashes share between inputs, so each
+//input hashes a fixed amount rather than the whole transaction again
+type SigHashes struct {
+  //HashPrevouts, HashSequence and HashOutputs are the double SHA256 hashes of BIP143
+  HashPrevouts block.Hash
+  HashSequence block.Hash
+  HashOutputs block.Hash
+  //SHAPrevouts, SHAAmounts, SHAScriptPubKeys, SHASequences and SHAOutputs are the single SHA256 hashes of BIP341.
+  //The amounts and scripts are those of the spent outputs, and are only set when every one is known.
+  SHAPrevouts block.Hash
+  SHAAmounts block.Hash
+  SHAScriptPubKeys block.Hash
+  SHASequences block.Hash
+  SHAOutputs block.Hash
+  //Taproot reports whether the spent outputs were all known, which taproot signature hashes need
+  Taproot bool
+}
+
+//NewSigHashes computes the shared signature hashes of tx, which spends prevouts
+func NewSigHashes(tx *block.Transaction, prevouts []Prevout) (*SigHashes) {
+  var outpoints, sequences, outputs, amounts, scripts []byte
+  for i := range tx.Inputs {
+    in := &tx.Inputs[i]
+    outpoints = append(outpoints, in.TransactionHash[:]...)
+    outpoints = binary.LittleEndian.AppendUint32(outpoints, in.TransactionIndex)
+    sequences = binary.LittleEndian.AppendUint32(sequences, in.SequenceNumber)
+  }
+  for o := range tx.Outputs {
+    outputs = appendOutput(outputs, &tx.Outputs[o])
+  }
+  h := &SigHashes{
+    HashPrevouts: btchashing.DoubleSha256(outpoints),
+    HashSequence: btchashing.DoubleSha256(sequences),
+    HashOutputs: btchashing.DoubleSha256(outputs),
+    SHAPrevouts: sha256.Sum256(outpoints),
+    SHASequences: sha256.Sum256(sequences),
+    SHAOutputs: sha256.Sum256(outputs),
+    Taproot: len(prevouts) == len(tx.Inputs),
+  }
+  for i := 0; h.Taproot && i < len(prevouts); i++ {
+    if prevouts[i].Script == nil {
+      h.Taproot = false
+    }
+    amounts = binary.LittleEndian.AppendUint64(amounts, prevouts[i].Value)
+    scripts = blockserializer.AppendCompactSize(scripts, uint64(len(prevouts[i].Script)))
+    scripts = append(scripts, prevouts[i].Script...)
+  }
+  if h.Taproot {
+    h.SHAAmounts = sha256.Sum256(amounts)
+    h.SHAScriptPubKeys = sha256.Sum256(scripts)
+  }
+  return h
+}
+
+//appendOutput appends an output's value and its script preceded by its length
+func appendOutput(b []byte, out *block.Output) ([]byte) {
+  b = binary.LittleEndian.AppendUint64(b, out.OutputValue)
+  b = blockserializer.AppendCompactSize(b, uint64(len(out.ChallengeScript)))
+  return append(b, out.ChallengeScript...)
+}
+
+//WitnessV0SignatureHash returns the BIP143 hash a signature in a version 0 witness program signs for input index of
+//tx, which spends amount. scriptCode is the script being run from just after its last executed OP_CODESEPARATOR,
+//which for pay to witness public key hash is the equivalent pay to public key hash script. h may be nil.
+func WitnessV0SignatureHash(tx *block.Transaction, index int, scriptCode []byte, amount uint64, hashType uint32, h *SigHashes) (block.Hash) {
+  if h == nil {
+    h = NewSigHashes(tx, nil)
+  }
+  base := hashType & 0x1f
+  anyoneCanPay := hashType & SigHashAnyoneCanPay != 0
+  var prevouts, sequences, outputs block.Hash
+  if !anyoneCanPay {
+    prevouts = h.HashPrevouts
+    if base != SigHashSingle && base != SigHashNone {
+      sequences = h.HashSequence
+    }
+  }
+  if base != SigHashSingle && base != SigHashNone {
+    outputs = h.HashOutputs
+  } else if base == SigHashSingle && index < len(tx.Outputs) {
+    outputs = btchashing.DoubleSha256(appendOutput(nil, &tx.Outputs[index]))
+  }
+  in := &tx.Inputs[index]
+  b := binary.LittleEndian.AppendUint32(nil, tx.TransactionVersionNumber)
+  b = append(b, prevouts[:]...)
+  b = append(b, sequences[:]...)
+  b = append(b, in.TransactionHash[:]...)
+  b = binary.LittleEndian.AppendUint32(b, in.TransactionIndex)
+  b = blockserializer.AppendCompactSize(b, uint64(len(scriptCode)))
+  b = append(b, scriptCode...)
+  b = binary.LittleEndian.AppendUint64(b, amount)
+  b = binary.LittleEndian.AppendUint32(b, in.SequenceNumber)
+  b = append(b, outputs[:]...)
+  b = binary.LittleEndian.AppendUint32(b, tx.TransactionLockTime)
+  b = binary.LittleEndian.AppendUint32(b, hashType)
+  return btchashing.DoubleSha256(b)
+}
+
+//TapscriptPath is what a taproot signature hash commits to for a script path spend: the leaf being run and the
+//position of the last OP_CODESEPARATOR executed in it, counted in op codes, or 0xffffffff for none
+type TapscriptPath struct {
+  LeafHash block.Hash
+  CodeSeparator uint32
+}
+
+//TaprootSignatureHash returns the BIP341 hash a Schnorr signature signs for input index of tx, with hashType 0 for
+//SIGHASH_DEFAULT. annex is the input's annex, nil for none, and path is nil for a key path spend. It returns
+//ErrSigHashType for a hash type taproot does not define or SIGHASH_SINGLE without a matching output, and
+//ErrMissingPrevout unless h holds every spent output.
+func TaprootSignatureHash(tx *block.Transaction, index int, hashType byte, h *SigHashes, prevouts []Prevout, annex []byte,
+  path *TapscriptPath) (block.Hash, error) {
+  if !h.Taproot {
+    return block.Hash{}, ErrMissingPrevout
+  }
+  if hashType > SigHashSingle && (hashType < SigHashAnyoneCanPay | SigHashAll || hashType > SigHashAnyoneCanPay | SigHashSingle) {
+    return block.Hash{}, ErrSigHashType
+  }
+  output := hashType & 0x03
+  if hashType == SigHashDefault {
+    output = SigHashAll
+  }
+  anyoneCanPay := hashType & SigHashAnyoneCanPay != 0
+  if output == SigHashSingle && index >= len(tx.Outputs) {
+    return block.Hash{}, ErrSigHashType
+  }
+  //the epoch, 0, comes first
+  b := []byte{0x00, hashType}
+  b = binary.LittleEndian.AppendUint32(b, tx.TransactionVersionNumber)
+  b = binary.LittleEndian.AppendUint32(b, tx.TransactionLockTime)
+  if !anyoneCanPay {
+    b = append(b, h.SHAPrevouts[:]...)
+    b = append(b, h.SHAAmounts[:]...)
+    b = append(b, h.SHAScriptPubKeys[:]...)
+    b = append(b, h.SHASequences[:]...)
+  }
+  if output == SigHashAll {
+    b = append(b, h.SHAOutputs[:]...)
+  }
+  var spendType byte
+  if annex != nil {
+    spendType |= 1
+  }
+  if path != nil {
+    spendType |= 2
+  }
+  b = append(b, spendType)
+  if anyoneCanPay {
+    in := &tx.Inputs[index]
+    b = append(b, in.TransactionHash[:]...)
+    b = binary.LittleEndian.AppendUint32(b, in.TransactionIndex)
+    b = binary.LittleEndian.AppendUint64(b, prevouts[index].Value)
+    b = blockserializer.AppendCompactSize(b, uint64(len(prevouts[index].Script)))
+    b = append(b, prevouts[index].Script...)
+    b = binary.LittleEndian.AppendUint32(b, in.SequenceNumber)
+  } else {
+    b = binary.LittleEndian.AppendUint32(b, uint32(index))
+  }
+  if annex != nil {
+    sum := sha256.Sum256(append(blockserializer.AppendCompactSize(nil, uint64(len(annex))), annex...))
+    b = append(b, sum[:]...)
+  }
+  if output == SigHashSingle {
+    sum := sha256.Sum256(appendOutput(nil, &tx.Outputs[index]))
+    b = append(b, sum[:]...)
+  }
+  if path != nil {
+    b = append(b, path.LeafHash[:]...)
+    //the key version, 0 for BIP340 keys
+    b = append(b, 0x00)
+    b = binary.LittleEndian.AppendUint32(b, path.CodeSeparator)
+  }
+  return secp256k1.TaggedHash("TapSighash", b), nil
+}
+
+//appendScriptCode appends scriptCode preceded by its length with its OP_CODESEPARATORs left out. Bytes after a push
+//that runs past the end are kept.
+func appendScriptCode(b []byte, scriptCode []byte) ([]byte) {
+  var separators []int
+  for pos := 0; pos < len(scriptCode); {
+    op, next, err := Next(scriptCode, pos)
+    if err != nil {
+      break
+    }
+    if op.Code == OPCODESEPARATOR {
+      separators = append(separators, pos)
+    }
+    pos = next
+  }
+  b = blockserializer.AppendCompactSize(b, uint64(len(scriptCode) - len(separators)))
+  start := 0
+  for _, s := range separators {
+    b = append(b, scriptCode[start:s]...)
+    start = s + 1
+  }
+  return append(b, scriptCode[start:]...)
+}
+
+//FindAndDelete returns s with every push of exactly the bytes of sig, at an instruction boundary, removed, along with
+//the number removed. Legacy scripts sign their scriptCode with their own signatures taken out this way.
+func FindAndDelete(s []byte, sig []byte) ([]byte, int) {
+  target := PushData(sig)
+  found := 0
+  var result []byte
+  pos, kept := 0, 0
+  for {
+    result = append(result, s[kept:pos]...)
+    for len(s) - pos >= len(target) && string(s[pos:pos+len(target)]) == string(target) {
+      pos += len(target)
+      found++
+    }
+    kept = pos
+    if pos >= len(s) {
+      break
+    }
+    _, next, err := Next(s, pos)
+    if err != nil {
+      break
+    }
+    pos = next
+  }
+  if found == 0 {
+    return s, 0
+  }
+  return append(result, s[kept:]...), found
+}
+
+//PushData returns the script that pushes data with the smallest push op code, or OP_0 for no data
+func PushData(data []byte) ([]byte) {
+  n := len(data)
+  var b []byte
+  switch {
+  case n < OPPUSHDATA1:
+    b = []byte{byte(n)}
+  case n <= 0xff:
+    b = []byte{OPPUSHDATA1, byte(n)}
+  case n <= 0xffff:
+    b = binary.LittleEndian.AppendUint16([]byte{OPPUSHDATA2}, uint16(n))
+  default:
+    b = binary.LittleEndian.AppendUint32([]byte{OPPUSHDATA4}, uint32(n))
+  }
+  return append(b, data...)
+}
@@ -0,0 +1,167 @@
+package script
+
+import (
+    "errors"
+)
+
+//ErrBadSignature is returned when a signature cannot be read
+var ErrBadSignature = errors.New("script: malformed signature")
+
+//signature hash types, which follow each signature and select the parts of the transaction it signs
+const (
+  SigHashDefault = 0x00
+  SigHashAll = 0x01
+  SigHashNone = 0x02
+  SigHashSingle = 0x03
+  SigHashAnyoneCanPay = 0x80
+)
+
+//Signature is an ECDSA or BIP340 Schnorr signature along with its hash type
+type Signature struct {
+  //R and S are big endian without leading zeros. Schnorr signatures keep R as the 32 byte x coordinate.
+  R []byte
+  S []byte
+  HashType byte
+  //Strict reports whether an ECDSA signature is DER encoded as strictly as BIP66 requires
+  Strict bool
+  Schnorr bool
+}
+
+//HashTypeName returns the name of a hash type such as ALL or SINGLE|ANYONECANPAY
+func HashTypeName(t byte) (string) {
+  var name string
+  switch t &^ SigHashAnyoneCanPay {
+  case SigHashDefault:
+    name = "DEFAULT"
+  case SigHashAll:
+    name = "ALL"
+  case SigHashNone:
+    name = "NONE"
+  case SigHashSingle:
+    name = "SINGLE"
+  default:
+    name = "UNKNOWN"
+  }
+  if t & SigHashAnyoneCanPay != 0 {
+    name += "|ANYONECANPAY"
+  }
+  return name
+}
+
+//ParseSignature reads a pushed ECDSA signature: DER followed by the hash type byte. Like bitcoind, which accepted
+//whatever OpenSSL parsed before BIP66, it allows long form lengths, padded integers and trailing bytes, and reports
+//whether the encoding is strict in the Signature.
+func ParseSignature(b []byte) (Signature, error) {
+  if len(b) < 1 {
+    return Signature{}, ErrBadSignature
+  }
+  sig := Signature{HashType: b[len(b)-1], Strict: IsStrictDER(b)}
+  der := b[:len(b)-1]
+  pos := 0
+  if pos >= len(der) || der[pos] != 0x30 {
+    return Signature{}, ErrBadSignature
+  }
+  pos++
+  //the length of the sequence is not checked against the signature
+  _, pos, ok := derLength(der, pos)
+  if !ok {
+    return Signature{}, ErrBadSignature
+  }
+  sig.R, pos, ok = derInteger(der, pos)
+  if !ok {
+    return Signature{}, ErrBadSignature
+  }
+  sig.S, _, ok = derInteger(der, pos)
+  if !ok {
+    return Signature{}, ErrBadSignature
+  }
+  return sig, nil
+}
+
+//derLength reads a DER length at pos, in short or long form
+func derLength(der []byte, pos int) (int, int, bool) {
+  if pos >= len(der) {
+    return 0, pos, false
+  }
+  n := int(der[pos])
+  pos++
+  if n & 0x80 == 0 {
+    return n, pos, true
+  }
+  size := n & 0x7f
+  if size > len(der) - pos {
+    return 0, pos, false
+  }
+  for size > 0 && der[pos] == 0 {
+    pos++
+    size--
+  }
+  if size > 4 {
+    return 0, pos, false
+  }
+  n = 0
+  for ; size > 0; size-- {
+    n = n << 8 | int(der[pos])
+    pos++
+  }
+  return n, pos, true
+}
+
+//derInteger reads a DER integer at pos and returns its value without leading zeros
+func derInteger(der []byte, pos int) ([]byte, int, bool) {
+  if pos >= len(der) || der[pos] != 0x02 {
+    return nil, pos, false
+  }
+  n, pos, ok := derLength(der, pos + 1)
+  if !ok || n > len(der) - pos {
+    return nil, pos, false
+  }
+  v := der[pos:pos+n]
+  for len(v) > 0 && v[0] == 0 {
+    v = v[1:]
+  }
+  return v, pos + n, true
+}
+
+//IsStrictDER reports whether a pushed signature, hash type included, is encoded as BIP66 requires
+func IsStrictDER(sig []byte) (bool) {
+  if len(sig) < 9 || len(sig) > 73 || sig[0] != 0x30 || int(sig[1]) != len(sig) - 3 {
+    return false
+  }
+  lenR := int(sig[3])
+  if 5 + lenR >= len(sig) {
+    return false
+  }
+  lenS := int(sig[5+lenR])
+  if lenR + lenS + 7 != len(sig) {
+    return false
+  }
+  if sig[2] != 0x02 || lenR == 0 || sig[4] & 0x80 != 0 || (lenR > 1 && sig[4] == 0 && sig[5] & 0x80 == 0) {
+    return false
+  }
+  s := 6 + lenR
+  if sig[s-2] != 0x02 || lenS == 0 || sig[s] & 0x80 != 0 || (lenS > 1 && sig[s] == 0 && sig[s+1] & 0x80 == 0) {
+    return false
+  }
+  return true
+}
+
+//ParseSchnorrSignature reads a BIP340 signature from a witness: 64 bytes, or 65 with an explicit hash type other than
+//SIGHASH_DEFAULT
+func ParseSchnorrSignature(b []byte) (Signature, error) {
+  sig := Signature{Strict: true, Schnorr: true}
+  switch {
+  case len(b) == 64:
+  case len(b) == 65 && b[64] != SigHashDefault:
+    sig.HashType = b[64]
+  default:
+    return Signature{}, ErrBadSignature
+  }
+  sig.R, sig.S = b[:32], b[32:64]
+  return sig, nil
+}
+
+//IsPublicKey reports whether b has the length and prefix of a compressed or uncompressed public key
+func IsPublicKey(b []byte) (bool) {
+  return (len(b) == 33 && (b[0] == 0x02 || b[0] == 0x03)) || (len(b) == 65 && b[0] == 0x04)
+}
@@ -0,0 +1,84 @@
+package script
+
+//SigOpCount counts the signature operations in s as bitcoind does. OP_CHECKSIG counts one and OP_CHECKMULTISIG
+//counts MaxPubKeysPerMultisig, or with accurate set the key count pushed by OP_1 to OP_16 just before it. Counting
+//stops at a truncated push.
+func SigOpCount(s []byte, accurate bool) (int) {
+  ops, _ := Parse(s)
+  n := 0
+  last := byte(OPINVALIDOPCODE)
+  for _, op := range ops {
+    switch op.Code {
+    case OPCHECKSIG, OPCHECKSIGVERIFY:
+      n++
+    case OPCHECKMULTISIG, OPCHECKMULTISIGVERIFY:
+      if accurate && last >= OP1 && last <= OP16 {
+        n += int(last - OP1 + 1)
+      } else {
+        n += MaxPubKeysPerMultisig
+      }
+    }
+    last = op.Code
+  }
+  return n
+}
+
+//lastPush returns the data of the last push in s, and false when s is empty or holds anything but pushes
+func lastPush(s []byte) ([]byte, bool) {
+  ops, err := Parse(s)
+  if err != nil || len(ops) == 0 {
+    return nil, false
+  }
+  for _, op := range ops {
+    if op.Code > OP16 {
+      return nil, false
+    }
+  }
+  return ops[len(ops)-1].Data, true
+}
+
+//P2SHSigOpCount accurately counts the signature operations of the redeem script scriptSig reveals when it spends a
+//pay to script hash scriptPubKey, and returns zero for other scripts
+func P2SHSigOpCount(scriptSig []byte, scriptPubKey []byte) (int) {
+  if !IsPayToScriptHash(scriptPubKey) {
+    return 0
+  }
+  redeem, ok := lastPush(scriptSig)
+  if !ok {
+    return 0
+  }
+  return SigOpCount(redeem, true)
+}
+
+//WitnessSigOpCount counts the signature operations of a witness program spend, native or nested in pay to script
+//hash: one for a version 0 key hash and those of the witness script for a version 0 script hash. Taproot spends are
+//limited by their validation weight instead and count none.
+func WitnessSigOpCount(scriptSig []byte, scriptPubKey []byte, witness [][]byte, flags Flags) (int) {
+  if flags & VerifyWitness == 0 {
+    return 0
+  }
+  if version, program, ok := WitnessProgram(scriptPubKey); ok {
+    return witnessSigOps(version, program, witness)
+  }
+  if IsPayToScriptHash(scriptPubKey) {
+    if redeem, ok := lastPush(scriptSig); ok {
+      if version, program, ok := WitnessProgram(redeem); ok {
+        return witnessSigOps(version, program, witness)
+      }
+    }
+  }
+  return 0
+}
+
+func witnessSigOps(version int, program []byte, witness [][]byte) (int) {
+  if version != 0 {
+    return 0
+  }
+  if len(program) == 20 {
+    return 1
+  }
+  if len(program) == 32 && len(witness) > 0 {
+    return SigOpCount(witness[len(witness)-1], true)
+  }
+  return 0
+}
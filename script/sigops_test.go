@@ -0,0 +1,63 @@
+package script
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "testing"
+)
+
+func TestSigOpCount(t *testing.T) {
+  key := bytes.Repeat([]byte{2}, 33)
+  twoOfThree := append([]byte{OP1 + 1}, PushData(key)...)
+  twoOfThree = append(twoOfThree, PushData(key)...)
+  twoOfThree = append(twoOfThree, PushData(key)...)
+  twoOfThree = append(twoOfThree, OP1 + 2, OPCHECKMULTISIG)
+  tests := []struct {
+    name string
+    s []byte
+    legacy int
+    accurate int
+  }{
+    {"p2pkh", []byte{OPDUP, OPHASH160, 0x14, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, OPEQUALVERIFY, OPCHECKSIG}, 1, 1},
+    {"2 of 3 multisig", twoOfThree, 20, 3},
+    {"multisig without a key count", []byte{OPCHECKMULTISIGVERIFY}, 20, 20},
+    {"pushed op codes", PushData([]byte{OPCHECKSIG, OPCHECKSIG}), 0, 0},
+    {"truncated push", []byte{OPCHECKSIG, OPPUSHDATA1, 5, OPCHECKSIG}, 1, 1},
+  }
+  for _, test := range tests {
+    if got := SigOpCount(test.s, false); got != test.legacy {
+      t.Errorf("%s: SigOpCount(false) = %d, want %d", test.name, got, test.legacy)
+    }
+    if got := SigOpCount(test.s, true); got != test.accurate {
+      t.Errorf("%s: SigOpCount(true) = %d, want %d", test.name, got, test.accurate)
+    }
+  }
+
+  p2sh := append([]byte{OPHASH160, 20}, append(make([]byte, 20), OPEQUAL)...)
+  if got := P2SHSigOpCount(append([]byte{OP0}, PushData(twoOfThree)...), p2sh); got != 3 {
+    t.Errorf("P2SHSigOpCount of a 2 of 3 redeem script = %d, want 3", got)
+  }
+  if got := P2SHSigOpCount([]byte{OPCHECKSIG}, p2sh); got != 0 {
+    t.Errorf("P2SHSigOpCount of a script that is not push only = %d, want 0", got)
+  }
+  if got := P2SHSigOpCount(PushData(twoOfThree), twoOfThree); got != 0 {
+    t.Errorf("P2SHSigOpCount of a bare multisig = %d, want 0", got)
+  }
+
+  p2wpkh := append([]byte{OP0, 20}, make([]byte, 20)...)
+  scriptHash := sha256.Sum256(twoOfThree)
+  p2wsh := append([]byte{OP0, 32}, scriptHash[:]...)
+  witnessFlags := VerifyP2SH | VerifyWitness
+  if got := WitnessSigOpCount(nil, p2wpkh, [][]byte{{}, key}, witnessFlags); got != 1 {
+    t.Errorf("WitnessSigOpCount of p2wpkh = %d, want 1", got)
+  }
+  if got := WitnessSigOpCount(nil, p2wsh, [][]byte{{}, {}, twoOfThree}, witnessFlags); got != 3 {
+    t.Errorf("WitnessSigOpCount of p2wsh = %d, want 3", got)
+  }
+  if got := WitnessSigOpCount(PushData(p2wpkh), p2sh, [][]byte{{}, key}, witnessFlags); got != 1 {
+    t.Errorf("WitnessSigOpCount of p2sh-p2wpkh = %d, want 1", got)
+  }
+  if got := WitnessSigOpCount(nil, p2wpkh, [][]byte{{}, key}, VerifyP2SH); got != 0 {
+    t.Errorf("WitnessSigOpCount without segwit = %d, want 0", got)
+  }
+}
@@ -0,0 +1,85 @@
+package script
+
+//output script types, the one vocabulary output scripts are classified by throughout
+const (
+  PubKey = "p2pk"
+  PubKeyHash = "p2pkh"
+  ScriptHash = "p2sh"
+  Multisig = "multisig"
+  WitnessPubKeyHash = "p2wpkh"
+  WitnessScriptHash = "p2wsh"
+  Taproot = "p2tr"
+  WitnessUnknown = "witness_unknown"
+  //NullData is an OP_RETURN output, which carries data rather than paying anyone
+  NullData = "nulldata"
+  NonStandard = "nonstandard"
+)
+
+//Classify returns the type of an output script
+func Classify(s []byte) (string) {
+  switch {
+  case len(s) > 0 && s[0] == OPRETURN:
+    return NullData
+  case (len(s) == 35 || len(s) == 67) && int(s[0]) == len(s) - 2 && s[len(s)-1] == OPCHECKSIG && IsPublicKey(s[1:len(s)-1]):
+    return PubKey
+  case len(s) == 25 && s[0] == OPDUP && s[1] == OPHASH160 && s[2] == 20 && s[23] == OPEQUALVERIFY && s[24] == OPCHECKSIG:
+    return PubKeyHash
+  case len(s) == 23 && s[0] == OPHASH160 && s[1] == 20 && s[22] == OPEQUAL:
+    return ScriptHash
+  }
+  if version, program, ok := WitnessProgram(s); ok {
+    switch {
+    case version == 0 && len(program) == 20:
+      return WitnessPubKeyHash
+    case version == 0 && len(program) == 32:
+      return WitnessScriptHash
+    case version == 1 && len(program) == 32:
+      return Taproot
+    case version == 0:
+      return NonStandard
+    }
+    return WitnessUnknown
+  }
+  if _, _, ok := ParseMultisig(s); ok {
+    return Multisig
+  }
+  return NonStandard
+}
+
+//WitnessProgram returns the version and program of a BIP141 witness program: a version op code followed by a single
+//push of 2 to 40 bytes
+func WitnessProgram(s []byte) (int, []byte, bool) {
+  if len(s) < 4 || len(s) > 42 || int(s[1]) != len(s) - 2 {
+    return 0, nil, false
+  }
+  if s[0] == OP0 {
+    return 0, s[2:], true
+  }
+  if s[0] >= OP1 && s[0] <= OP16 {
+    return int(s[0] - OP1 + 1), s[2:], true
+  }
+  return 0, nil, false
+}
+
+//ParseMultisig reads a script of the form OP_m <public keys> OP_n OP_CHECKMULTISIG and returns the number of
+//signatures it requires and its keys, each of which must be a push of 33 or 65 bytes
+func ParseMultisig(s []byte) (int, [][]byte, bool) {
+  ops, err := Parse(s)
+  if err != nil || len(ops) < 4 || ops[len(ops)-1].Code != OPCHECKMULTISIG {
+    return 0, nil, false
+  }
+  m, ok := ops[0].SmallInt()
+  n, ok2 := ops[len(ops)-2].SmallInt()
+  keys := ops[1:len(ops)-2]
+  if !ok || !ok2 || m < 1 || m > n || n != len(keys) {
+    return 0, nil, false
+  }
+  ret := make([][]byte, 0, n)
+  for _, k := range keys {
+    if k.Code != 33 && k.Code != 65 {
+      return 0, nil, false
+    }
+    ret = append(ret, k.Data)
+  }
+  return m, ret, true
+}
@@ -0,0 +1,76 @@
+package script
+
+import (
+    "math/big"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/secp256k1"
+)
+
+//taproot constants of BIP341 and BIP342
+const (
+  //LeafVersionTapscript is the leaf version of BIP342 scripts
+  LeafVersionTapscript = 0xc0
+  //leafMask takes the leaf version out of the first byte of a control block, whose low bit is the output key's parity
+  leafMask = 0xfe
+  //AnnexTag starts the last witness element of a taproot spend that carries an annex
+  AnnexTag = 0x50
+  controlBaseSize = 33
+  controlNodeSize = 32
+  controlMaxNodes = 128
+  //validationWeightPerSigOp is the witness weight each signature checked in tapscript uses up, and
+  //validationWeightOffset the weight every script path spend starts with beyond its witness
+  validationWeightPerSigOp = 50
+  validationWeightOffset = 50
+)
+
+//TapLeafHash returns the hash of a script tree leaf with its leaf version
+func TapLeafHash(version byte, s []byte) (block.Hash) {
+  b := blockserializer.AppendCompactSize([]byte{version}, uint64(len(s)))
+  return secp256k1.TaggedHash("TapLeaf", b, s)
+}
+
+//TapBranchHash returns the hash of the branch joining two nodes of a script tree, which are hashed in byte order
+func TapBranchHash(a block.Hash, b block.Hash) (block.Hash) {
+  if string(b[:]) < string(a[:]) {
+    a, b = b, a
+  }
+  return secp256k1.TaggedHash("TapBranch", a[:], b[:])
+}
+
+//TaprootOutputKey returns the x only output key that commits to the x only internal key and the root of its script
+//tree, nil for a key with no scripts, along with the parity of its y coordinate
+func TaprootOutputKey(internal []byte, merkleRoot []byte) ([]byte, byte, error) {
+  point, err := secp256k1.ParseXOnlyPublicKey(internal)
+  if err != nil {
+    return nil, 0, err
+  }
+  tweak := secp256k1.TaggedHash("TapTweak", internal, merkleRoot)
+  t := new(big.Int).SetBytes(tweak[:])
+  if t.Cmp(secp256k1.N) >= 0 {
+    return nil, 0, secp256k1.ErrBadPublicKey
+  }
+  output := secp256k1.Add(point, secp256k1.ScalarBaseMult(t))
+  if output.Infinity() {
+    return nil, 0, secp256k1.ErrBadPublicKey
+  }
+  return output.XOnly(), byte(output.Y.Bit(0)), nil
+}
+
+//verifyTaprootCommitment reports whether control, a control block of valid size, proves the leaf with hash leaf is
+//in the script tree program commits to
+func verifyTaprootCommitment(control []byte, program []byte, leaf block.Hash) (bool) {
+  k := leaf
+  for node := controlBaseSize; node < len(control); node += controlNodeSize {
+    k = TapBranchHash(k, block.Hash(control[node:node+controlNodeSize]))
+  }
+  output, parity, err := TaprootOutputKey(control[1:controlBaseSize], k[:])
+  return err == nil && string(output) == string(program) && parity == control[0] & 1
+}
+
+//IsOpSuccess reports whether an op code is one of BIP342's OP_SUCCESSx, which make a tapscript succeed wherever
+//they appear so later soft forks can give them meaning
+func IsOpSuccess(code byte) (bool) {
+  return code == 80 || code == 98 || (code >= 126 && code <= 129) || (code >= 131 && code <= 134) ||
+    (code >= 137 && code <= 138) || (code >= 141 && code <= 142) || (code >= 149 && code <= 153) || (code >= 187 && code <= 254)
+}
@@ -0,0 +1,512 @@
+package script_test
+
+import (
+    "bytes"
+    "encoding/hex"
+    "encoding/json"
+    "math/big"
+    "os"
+    "testing"
+    "github.com/tgebhart/goparsebtc/bech32"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/secp256k1"
+)
+
+func TestTaprootOutputKey(t *testing.T) {
+  //the first two scriptPubKey vectors of BIP341: a key with no scripts and one with a single leaf
+  leaf := script.TapLeafHash(script.LeafVersionTapscript, chaintest.MustHex("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac"))
+  tests := []struct {
+    internal string
+    root []byte
+    output string
+    address string
+  }{
+    {"d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d", nil,
+      "53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343", "bc1p2wsldez5mud2yam29q22wgfh9439spgduvct83k3pm50fcxa5dps59h4z5"},
+    {"187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27", leaf[:],
+      "147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3", "bc1pz37fc4cn9ah8anwm4xqqhvxygjf9rjf2resrw8h8w4tmvcs0863sa2e586"},
+  }
+  for _, test := range tests {
+    output, _, err := script.TaprootOutputKey(chaintest.MustHex(test.internal), test.root)
+    if err != nil || hex.EncodeToString(output) != test.output {
+      t.Errorf("TaprootOutputKey(%s) = %x, %v, want %s", test.internal, output, err, test.output)
+      continue
+    }
+    if address, _ := bech32.SegwitAddress("bc", 1, output); address != test.address {
+      t.Errorf("output key %s has address %s, want %s", test.output, address, test.address)
+    }
+  }
+}
+
+//tapKey is a private key with its x only public key
+type tapKey struct {
+  d *big.Int
+  pub []byte
+}
+
+func newTapKey(d int64) (tapKey) {
+  k := big.NewInt(d)
+  return tapKey{k, secp256k1.ScalarBaseMult(k).XOnly()}
+}
+
+//tweak returns the key that signs for the output key committing to k and merkleRoot
+func (k tapKey) tweak(merkleRoot []byte) (tapKey) {
+  d := new(big.Int).Set(k.d)
+  if secp256k1.ScalarBaseMult(d).Y.Bit(0) == 1 {
+    d.Sub(secp256k1.N, d)
+  }
+  t := secp256k1.TaggedHash("TapTweak", k.pub, merkleRoot)
+  d.Add(d, new(big.Int).SetBytes(t[:]))
+  d.Mod(d, secp256k1.N)
+  return tapKey{d, secp256k1.ScalarBaseMult(d).XOnly()}
+}
+
+//sign returns k's signature of input index of tx, with the hash type appended unless it is SIGHASH_DEFAULT
+func (k tapKey) sign(t *testing.T, tx *block.Transaction, index int, prevouts []script.Prevout, hashType byte, annex []byte,
+  path *script.TapscriptPath) ([]byte) {
+  hash, err := script.TaprootSignatureHash(tx, index, hashType, script.NewSigHashes(tx, prevouts), prevouts, annex, path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  sig := secp256k1.SignSchnorr(k.d, hash[:], make([]byte, 32))
+  if hashType != script.SigHashDefault {
+    sig = append(sig, hashType)
+  }
+  return sig
+}
+
+func payToTaproot(output []byte) ([]byte) {
+  return append([]byte{script.OP1, 32}, output...)
+}
+
+func TestTaprootKeyPath(t *testing.T) {
+  internal := newTapKey(4242)
+  signer := internal.tweak(nil)
+  output, _, err := script.TaprootOutputKey(internal.pub, nil)
+  if err != nil || !bytes.Equal(output, signer.pub) {
+    t.Fatalf("tweaked private key does not match the output key: %v", err)
+  }
+  tx := spendOf(2, 2)
+  prevouts := []script.Prevout{{Value: 5000, Script: payToTaproot(output)}, {Value: 7000, Script: chaintest.OpTrue}}
+
+  for _, hashType := range []byte{script.SigHashDefault, script.SigHashAll, script.SigHashSingle | script.SigHashAnyoneCanPay} {
+    tx.Inputs[0].Witness = [][]byte{signer.sign(t, tx, 0, prevouts, hashType, nil, nil)}
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != nil {
+      t.Errorf("key path with hash type %#x: %v", hashType, err)
+    }
+  }
+  //taproot signatures commit to the amounts and scripts of every spent output
+  tx.Inputs[0].Witness = [][]byte{signer.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, nil)}
+  prevouts[1].Value++
+  if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != script.ErrSchnorrSig {
+    t.Errorf("key path after changing another spent amount returned %v", err)
+  }
+  prevouts[1].Value--
+  if err := script.VerifyInput(tx, 0, prevouts[:1], witnessFlags); err != script.ErrMissingPrevout {
+    t.Errorf("key path without every spent output returned %v", err)
+  }
+  //before taproot the output is anyone can spend
+  tx.Inputs[0].Witness = [][]byte{make([]byte, 64)}
+  if err := script.VerifyInput(tx, 0, prevouts, witnessFlags &^ script.VerifyTaproot); err != nil {
+    t.Errorf("taproot output without VerifyTaproot: %v", err)
+  }
+
+  sig := signer.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, nil)
+  failures := []struct {
+    name string
+    witness [][]byte
+    want error
+  }{
+    {"no witness", nil, script.ErrWitnessProgramWitnessEmpty},
+    {"short signature", [][]byte{sig[:63]}, script.ErrSchnorrSigSize},
+    {"explicit SIGHASH_DEFAULT", [][]byte{append(append([]byte{}, sig...), 0x00)}, script.ErrSchnorrSigHashType},
+    {"undefined hash type", [][]byte{append(append([]byte{}, sig...), 0x04)}, script.ErrSchnorrSigHashType},
+    //an annex is signed, so a signature made without one fails with one
+    {"annex", [][]byte{sig, {script.AnnexTag, 1}}, script.ErrSchnorrSig},
+  }
+  for _, f := range failures {
+    tx.Inputs[0].Witness = f.witness
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != f.want {
+      t.Errorf("key path with %s returned %v, want %v", f.name, err, f.want)
+    }
+  }
+  annex := []byte{script.AnnexTag, 1}
+  tx.Inputs[0].Witness = [][]byte{signer.sign(t, tx, 0, prevouts, script.SigHashDefault, annex, nil), annex}
+  if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != nil {
+    t.Errorf("key path with a signed annex: %v", err)
+  }
+  //SIGHASH_SINGLE needs an output at the input's index
+  tx.Outputs = tx.Outputs[:0]
+  if _, err := script.TaprootSignatureHash(tx, 0, script.SigHashSingle, script.NewSigHashes(tx, prevouts), prevouts, nil, nil); err != script.ErrSigHashType {
+    t.Errorf("SIGHASH_SINGLE without an output returned %v", err)
+  }
+}
+
+func TestTaprootScriptPath(t *testing.T) {
+  internal, alice, bob := newTapKey(1), newTapKey(2), newTapKey(3)
+  checksig := append(script.PushData(alice.pub), script.OPCHECKSIG)
+  //a 2 of 2 with OP_CHECKSIGADD, as tapscript has no OP_CHECKMULTISIG
+  checksigadd := append(append(append(script.PushData(alice.pub), script.OPCHECKSIG), script.PushData(bob.pub)...), script.OPCHECKSIGADD, script.OP1 + 1, script.OPNUMEQUAL)
+  success := []byte{script.OP0, 0x50}
+  multisig := []byte{script.OP0, script.OP0, script.OP0, script.OPCHECKMULTISIG}
+  separator := append(append([]byte{script.OPCODESEPARATOR}, script.PushData(alice.pub)...), script.OPCHECKSIG)
+  leaves := [][]byte{checksig, checksigadd, success, multisig, separator}
+
+  //a tree of the leaves in a row, each branch joining the next leaf to the branch before it
+  hashes := make([]block.Hash, len(leaves))
+  for i, l := range leaves {
+    hashes[i] = script.TapLeafHash(script.LeafVersionTapscript, l)
+  }
+  root := hashes[0]
+  for _, h := range hashes[1:] {
+    root = script.TapBranchHash(root, h)
+  }
+  output, parity, err := script.TaprootOutputKey(internal.pub, root[:])
+  if err != nil {
+    t.Fatal(err)
+  }
+  control := func(leaf int) ([]byte) {
+    c := append([]byte{script.LeafVersionTapscript | parity}, internal.pub...)
+    if leaf == 0 {
+      c = append(c, hashes[1][:]...)
+    } else {
+      branch := hashes[0]
+      for _, h := range hashes[1:leaf] {
+        branch = script.TapBranchHash(branch, h)
+      }
+      c = append(c, branch[:]...)
+    }
+    for _, h := range hashes[max(leaf, 1) + 1:] {
+      c = append(c, h[:]...)
+    }
+    return c
+  }
+
+  tx := spendOf(1, 1)
+  prevouts := []script.Prevout{{Value: 9000, Script: payToTaproot(output)}}
+  path := func(leaf int) (*script.TapscriptPath) {
+    return &script.TapscriptPath{LeafHash: hashes[leaf], CodeSeparator: 0xffffffff}
+  }
+  aliceSig := alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, path(0))
+  tests := []struct {
+    name string
+    witness [][]byte
+    want error
+  }{
+    {"OP_CHECKSIG", [][]byte{aliceSig, checksig, control(0)}, nil},
+    {"OP_CHECKSIG with an empty signature", [][]byte{nil, checksig, control(0)}, script.ErrEvalFalse},
+    {"OP_CHECKSIG with a signature for another leaf", [][]byte{alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, path(1)), checksig, control(0)}, script.ErrSchnorrSig},
+    {"OP_CHECKSIGADD", [][]byte{bob.sign(t, tx, 0, prevouts, script.SigHashAll, nil, path(1)), alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, path(1)), checksigadd, control(1)}, nil},
+    {"OP_CHECKSIGADD with one signature", [][]byte{nil, alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, path(1)), checksigadd, control(1)}, script.ErrEvalFalse},
+    {"OP_SUCCESS", [][]byte{success, control(2)}, nil},
+    {"OP_CHECKMULTISIG", [][]byte{multisig, control(3)}, script.ErrTapscriptCheckMultisig},
+    //the signature commits to the position of the last OP_CODESEPARATOR executed, the first op code here
+    {"OP_CODESEPARATOR", [][]byte{alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, &script.TapscriptPath{LeafHash: hashes[4], CodeSeparator: 0}), separator, control(4)}, nil},
+    {"OP_CODESEPARATOR unsigned", [][]byte{alice.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, path(4)), separator, control(4)}, script.ErrSchnorrSig},
+    {"another leaf's script", [][]byte{aliceSig, checksig, control(1)}, script.ErrWitnessProgramMismatch},
+    {"the wrong parity", [][]byte{aliceSig, checksig, append([]byte{script.LeafVersionTapscript | parity ^ 1}, control(0)[1:]...)}, script.ErrWitnessProgramMismatch},
+    {"a short control block", [][]byte{aliceSig, checksig, control(0)[:40]}, script.ErrTaprootWrongControlSize},
+  }
+  for _, test := range tests {
+    tx.Inputs[0].Witness = test.witness
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != test.want {
+      t.Errorf("script path with %s returned %v, want %v", test.name, err, test.want)
+    }
+  }
+  tx.Inputs[0].Witness = [][]byte{success, control(2)}
+  if err := script.VerifyInput(tx, 0, prevouts, witnessFlags | script.VerifyDiscourageOpSuccess); err != script.ErrDiscourageOpSuccess {
+    t.Errorf("OP_SUCCESS under DISCOURAGE_OP_SUCCESS returned %v", err)
+  }
+}
+
+func TestTapscriptMinimalIf(t *testing.T) {
+  internal := newTapKey(5)
+  leaf := []byte{script.OPIF, script.OP1, script.OPELSE, script.OP1, script.OPENDIF}
+  hash := script.TapLeafHash(script.LeafVersionTapscript, leaf)
+  output, parity, _ := script.TaprootOutputKey(internal.pub, hash[:])
+  control := append([]byte{script.LeafVersionTapscript | parity}, internal.pub...)
+  tx := spendOf(1, 1)
+  prevouts := []script.Prevout{{Value: 1, Script: payToTaproot(output)}}
+  for _, arg := range [][]byte{{}, {1}} {
+    tx.Inputs[0].Witness = [][]byte{arg, leaf, control}
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != nil {
+      t.Errorf("OP_IF of %x: %v", arg, err)
+    }
+  }
+  for _, arg := range [][]byte{{2}, {1, 0}, {0}} {
+    tx.Inputs[0].Witness = [][]byte{arg, leaf, control}
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != script.ErrTapscriptMinimalIf {
+      t.Errorf("OP_IF of %x returned %v, want ErrTapscriptMinimalIf", arg, err)
+    }
+  }
+}
+
+func TestWitnessV0(t *testing.T) {
+  k1, k2 := newKey(31), newKey(32)
+  cat := func(parts ...[]byte) ([]byte) {
+    return bytes.Join(parts, nil)
+  }
+  sign := func(k key, tx *block.Transaction, scriptCode []byte, amount uint64) ([]byte) {
+    hash := script.WitnessV0SignatureHash(tx, 0, scriptCode, amount, script.SigHashAll, nil)
+    r, s := secp256k1.SignECDSA(k.d, hash[:])
+    return append(der(r, s), script.SigHashAll)
+  }
+  tx := spendOf(1, 1)
+
+  //pay to witness script hash 2 of 2, and the same nested in pay to script hash
+  witnessScript := multisig(2, k1, k2)
+  program := sha256Sum(witnessScript)
+  p2wsh := append([]byte{script.OP0, 32}, program...)
+  witness := [][]byte{nil, sign(k1, tx, witnessScript, 1000), sign(k2, tx, witnessScript, 1000), witnessScript}
+  tx.Inputs[0].Witness = witness
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 1000, Script: p2wsh}}, witnessFlags); err != nil {
+    t.Errorf("P2WSH: %v", err)
+  }
+  nested := append(append([]byte{script.OPHASH160, 20}, btcHash160(p2wsh)...), script.OPEQUAL)
+  tx.Inputs[0].InputScript = script.PushData(p2wsh)
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 1000, Script: nested}}, witnessFlags); err != nil {
+    t.Errorf("P2SH-P2WSH: %v", err)
+  }
+  tx.Inputs[0].InputScript = cat([]byte{script.OP0}, script.PushData(p2wsh))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 1000, Script: nested}}, witnessFlags); err != script.ErrWitnessMalleatedP2SH {
+    t.Errorf("P2SH-P2WSH with more than the redeem script returned %v", err)
+  }
+  tx.Inputs[0].InputScript = nil
+
+  //pay to witness public key hash, whose witness is a signature and the key
+  p2wpkh := append([]byte{script.OP0, 20}, btcHash160(k1.pub)...)
+  keyHash := payToPubKeyHash(k1.pub)
+  tx.Inputs[0].Witness = [][]byte{sign(k1, tx, keyHash, 500), k1.pub}
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 500, Script: p2wpkh}}, witnessFlags); err != nil {
+    t.Errorf("P2WPKH: %v", err)
+  }
+
+  failures := []struct {
+    name string
+    inputScript []byte
+    witness [][]byte
+    prevout []byte
+    want error
+  }{
+    {"an empty P2WSH witness", nil, nil, p2wsh, script.ErrWitnessProgramWitnessEmpty},
+    {"another witness script", nil, [][]byte{nil, witnessScript[1:]}, p2wsh, script.ErrWitnessProgramMismatch},
+    {"a P2WPKH witness of three elements", nil, [][]byte{nil, nil, k1.pub}, p2wpkh, script.ErrWitnessProgramMismatch},
+    {"an input script", []byte{script.OP1}, witness, p2wsh, script.ErrWitnessMalleated},
+    {"a witness on a legacy output", nil, [][]byte{{1}}, chaintest.OpTrue, script.ErrWitnessUnexpected},
+    {"a 21 byte version 0 program", nil, [][]byte{{1}}, append([]byte{script.OP0, 21}, bytes.Repeat([]byte{1}, 21)...), script.ErrWitnessProgramWrongLength},
+    {"an oversized witness element", nil, [][]byte{make([]byte, 521), {script.OP1}}, append([]byte{script.OP0, 32}, sha256Sum([]byte{script.OP1})...), script.ErrPushSize},
+    {"a dirty witness stack", nil, [][]byte{{1}, {script.OP1}}, append([]byte{script.OP0, 32}, sha256Sum([]byte{script.OP1})...), script.ErrCleanStack},
+    {"a non-minimal OP_IF argument", nil, [][]byte{{2}, {script.OPIF, script.OP1, script.OPENDIF}},
+      append([]byte{script.OP0, 32}, sha256Sum([]byte{script.OPIF, script.OP1, script.OPENDIF})...), script.ErrMinimalIf},
+  }
+  for _, f := range failures {
+    tx.Inputs[0].InputScript, tx.Inputs[0].Witness = f.inputScript, f.witness
+    if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 1000, Script: f.prevout}}, witnessFlags); err != f.want {
+      t.Errorf("%s returned %v, want %v", f.name, err, f.want)
+    }
+  }
+
+  //uncompressed keys are valid in P2WPKH by consensus but not under WITNESS_PUBKEYTYPE
+  u := key{k1.d, append([]byte{0x04}, append(secp256k1.ScalarBaseMult(k1.d).X.FillBytes(make([]byte, 32)), secp256k1.ScalarBaseMult(k1.d).Y.FillBytes(make([]byte, 32))...)...)}
+  p2wpkh = append([]byte{script.OP0, 20}, btcHash160(u.pub)...)
+  tx.Inputs[0].Witness = [][]byte{sign(u, tx, payToPubKeyHash(u.pub), 500), u.pub}
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 500, Script: p2wpkh}}, witnessFlags &^ script.VerifyWitnessPubKeyType); err != nil {
+    t.Errorf("P2WPKH with an uncompressed key: %v", err)
+  }
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Value: 500, Script: p2wpkh}}, witnessFlags); err != script.ErrWitnessPubKeyType {
+    t.Errorf("P2WPKH with an uncompressed key under WITNESS_PUBKEYTYPE returned %v", err)
+  }
+}
+
+//bip341Vectors is the layout of BIP341's wallet-test-vectors.json
+type bip341Vectors struct {
+  ScriptPubKey []struct {
+    Given struct {
+      InternalPubkey string
+      ScriptTree json.RawMessage
+    }
+    Intermediary struct {
+      TweakedPubkey string
+    }
+    Expected struct {
+      ScriptPubKey string
+      Bip350Address string
+      ScriptPathControlBlocks []string
+    }
+  }
+  KeyPathSpending []struct {
+    Given struct {
+      RawUnsignedTx string
+      UtxosSpent []struct {
+        ScriptPubKey string
+        AmountSats uint64
+      }
+    }
+    Intermediary struct {
+      HashAmounts string
+      HashOutputs string
+      HashPrevouts string
+      HashScriptPubkeys string
+      HashSequences string
+    }
+    InputSpending []struct {
+      Given struct {
+        TxinIndex int
+        HashType byte
+      }
+      Intermediary struct {
+        SigHash string
+      }
+      Expected struct {
+        Witness []string
+      }
+    }
+  }
+}
+
+//tapLeaf is a leaf of a script tree read from the vectors, with the hashes from it up to the root
+type tapLeaf struct {
+  id int
+  hash block.Hash
+  path []byte
+}
+
+//readTree returns the root of a script tree in the layout of the vectors, a leaf object or a pair of trees, and its leaves
+func readTree(t *testing.T, raw json.RawMessage) (block.Hash, []tapLeaf) {
+  var pair []json.RawMessage
+  if json.Unmarshal(raw, &pair) == nil {
+    left, leftLeaves := readTree(t, pair[0])
+    right, rightLeaves := readTree(t, pair[1])
+    for i := range leftLeaves {
+      leftLeaves[i].path = append(leftLeaves[i].path, right[:]...)
+    }
+    for i := range rightLeaves {
+      rightLeaves[i].path = append(rightLeaves[i].path, left[:]...)
+    }
+    return script.TapBranchHash(left, right), append(leftLeaves, rightLeaves...)
+  }
+  var leaf struct {
+    ID int
+    Script string
+    LeafVersion byte
+  }
+  if err := json.Unmarshal(raw, &leaf); err != nil {
+    t.Fatal(err)
+  }
+  h := script.TapLeafHash(leaf.LeafVersion, chaintest.MustHex(leaf.Script))
+  return h, []tapLeaf{{leaf.ID, h, []byte{leaf.LeafVersion}}}
+}
+
+//bip341VectorsFile is where BIP341's bip-0341/wallet-test-vectors.json is vendored
+const bip341VectorsFile = "testdata/bip341/wallet-test-vectors.json"
+
+//TestBIP341Vectors runs every vector of bip341VectorsFile. Until the file is committed the test is skipped, loudly;
+//TestTaprootOutputKey holds the first two of its output keys in the meantime.
+func TestBIP341Vectors(t *testing.T) {
+  raw, err := os.ReadFile(bip341VectorsFile)
+  if os.IsNotExist(err) {
+    t.Skipf("%s is not vendored yet; copy bip-0341/wallet-test-vectors.json from the BIPs repository there", bip341VectorsFile)
+  }
+  if err != nil {
+    t.Fatal(err)
+  }
+  var v bip341Vectors
+  if err := json.Unmarshal(raw, &v); err != nil {
+    t.Fatal(err)
+  }
+
+  for n, test := range v.ScriptPubKey {
+    internal := chaintest.MustHex(test.Given.InternalPubkey)
+    var root []byte
+    var leaves []tapLeaf
+    if string(test.Given.ScriptTree) != "null" && len(test.Given.ScriptTree) > 0 {
+      h, l := readTree(t, test.Given.ScriptTree)
+      root, leaves = h[:], l
+    }
+    output, parity, err := script.TaprootOutputKey(internal, root)
+    if err != nil || hex.EncodeToString(output) != test.Intermediary.TweakedPubkey {
+      t.Errorf("scriptPubKey %d: output key %x, %v, want %s", n, output, err, test.Intermediary.TweakedPubkey)
+      continue
+    }
+    if got := hex.EncodeToString(payToTaproot(output)); got != test.Expected.ScriptPubKey {
+      t.Errorf("scriptPubKey %d: script %s, want %s", n, got, test.Expected.ScriptPubKey)
+    }
+    if address, _ := bech32.SegwitAddress("bc", 1, output); address != test.Expected.Bip350Address {
+      t.Errorf("scriptPubKey %d: address %s, want %s", n, address, test.Expected.Bip350Address)
+    }
+    for _, leaf := range leaves {
+      //the leaf version byte carries the parity of the output key
+      control := append(append([]byte{leaf.path[0] | parity}, internal...), leaf.path[1:]...)
+      if leaf.id < len(test.Expected.ScriptPathControlBlocks) && hex.EncodeToString(control) != test.Expected.ScriptPathControlBlocks[leaf.id] {
+        t.Errorf("scriptPubKey %d: leaf %d has control block %x, want %s", n, leaf.id, control, test.Expected.ScriptPathControlBlocks[leaf.id])
+      }
+    }
+  }
+
+  for _, test := range v.KeyPathSpending {
+    var tx block.Transaction
+    if _, err := blockchainbuilder.DecodeTransactionBytes(chaintest.MustHex(test.Given.RawUnsignedTx), &tx, blockchainbuilder.DefaultDecodeOptions); err != nil {
+      t.Fatal(err)
+    }
+    var prevouts []script.Prevout
+    for _, u := range test.Given.UtxosSpent {
+      prevouts = append(prevouts, script.Prevout{Value: u.AmountSats, Script: chaintest.MustHex(u.ScriptPubKey)})
+    }
+    h := script.NewSigHashes(&tx, prevouts)
+    for name, got := range map[string][]byte{
+      test.Intermediary.HashAmounts: h.SHAAmounts[:], test.Intermediary.HashOutputs: h.SHAOutputs[:],
+      test.Intermediary.HashPrevouts: h.SHAPrevouts[:], test.Intermediary.HashScriptPubkeys: h.SHAScriptPubKeys[:],
+      test.Intermediary.HashSequences: h.SHASequences[:],
+    } {
+      if hex.EncodeToString(got) != name {
+        t.Errorf("shared hash %x, want %s", got, name)
+      }
+    }
+    for _, in := range test.InputSpending {
+      i := in.Given.TxinIndex
+      hash, err := script.TaprootSignatureHash(&tx, i, in.Given.HashType, h, prevouts, nil, nil)
+      if err != nil || hex.EncodeToString(hash[:]) != in.Intermediary.SigHash {
+        t.Errorf("input %d: signature hash %x, %v, want %s", i, hash, err, in.Intermediary.SigHash)
+        continue
+      }
+      var witness [][]byte
+      for _, w := range in.Expected.Witness {
+        witness = append(witness, chaintest.MustHex(w))
+      }
+      tx.Inputs[i].Witness = witness
+      if err := script.VerifyInput(&tx, i, prevouts, witnessFlags); err != nil {
+        t.Errorf("input %d: %v", i, err)
+      }
+    }
+  }
+}
+
+func TestTapscriptValidationWeight(t *testing.T) {
+  internal, signer := newTapKey(6), newTapKey(7)
+  //each check of a signature uses up 50 of a budget of the witness size plus 50, and each repeat adds 35 bytes
+  build := func(checks int) ([]byte) {
+    var leaf []byte
+    for i := 1; i < checks; i++ {
+      leaf = append(append(append(leaf, script.OPDUP), script.PushData(signer.pub)...), script.OPCHECKSIGVERIFY)
+    }
+    return append(append(leaf, script.PushData(signer.pub)...), script.OPCHECKSIG)
+  }
+  for _, test := range []struct {
+    checks int
+    want error
+  }{{4, nil}, {20, script.ErrTapscriptValidationWeight}} {
+    leaf := build(test.checks)
+    hash := script.TapLeafHash(script.LeafVersionTapscript, leaf)
+    output, parity, _ := script.TaprootOutputKey(internal.pub, hash[:])
+    tx := spendOf(1, 1)
+    prevouts := []script.Prevout{{Value: 1, Script: payToTaproot(output)}}
+    sig := signer.sign(t, tx, 0, prevouts, script.SigHashDefault, nil, &script.TapscriptPath{LeafHash: hash, CodeSeparator: 0xffffffff})
+    tx.Inputs[0].Witness = [][]byte{sig, leaf, append([]byte{script.LeafVersionTapscript | parity}, internal.pub...)}
+    if err := script.VerifyInput(tx, 0, prevouts, witnessFlags); err != test.want {
+      t.Errorf("%d signature checks returned %v, want %v", test.checks, err, test.want)
+    }
+  }
+}
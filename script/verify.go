@@ -0,0 +1,362 @@
+package script
+
+import (
+    "crypto/sha256"
+    "errors"
+    "math/big"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockserializer"
+    "github.com/tgebhart/goparsebtc/secp256k1"
+)
+
+//ErrMissingPrevout is returned when an input is verified without the output it spends
+var ErrMissingPrevout = errors.New("script: spent output not known")
+
+//Prevout is the output an input spends: its value and the script that locks it
+type Prevout struct {
+  Value uint64
+  Script []byte
+}
+
+//Checker checks signatures and lock times against one input of a transaction
+type Checker struct {
+  Tx *block.Transaction
+  Input int
+  //Prevouts holds the output each input of Tx spends
+  Prevouts []Prevout
+  //Hashes holds the signature hashes segwit inputs of Tx share; nil computes them when first needed
+  Hashes *SigHashes
+
+  //annex, tapscript and weightLeft are the state of the taproot spend being verified: its annex, the leaf being run
+  //and the signature validation weight it has left
+  annex []byte
+  tapscript *TapscriptPath
+  weightLeft int64
+}
+
+//hashes returns the shared signature hashes of the transaction
+func (c *Checker) hashes() (*SigHashes) {
+  if c.Hashes == nil {
+    c.Hashes = NewSigHashes(c.Tx, c.Prevouts)
+  }
+  return c.Hashes
+}
+
+//checkECDSA reports whether sig, with its hash type as the last byte, signs the transaction for key. A key or
+//signature that does not parse fails the check rather than the script.
+func (c *Checker) checkECDSA(sig []byte, key []byte, scriptCode []byte, version sigVersion) (bool) {
+  if len(sig) == 0 {
+    return false
+  }
+  point, err := secp256k1.ParsePublicKey(key)
+  if err != nil {
+    return false
+  }
+  parsed, err := ParseSignature(sig)
+  if err != nil || len(parsed.R) > 32 || len(parsed.S) > 32 {
+    return false
+  }
+  hashType := uint32(sig[len(sig)-1])
+  var hash block.Hash
+  if version == sigVersionWitnessV0 {
+    hash = WitnessV0SignatureHash(c.Tx, c.Input, scriptCode, c.Prevouts[c.Input].Value, hashType, c.hashes())
+  } else {
+    hash = LegacySignatureHash(c.Tx, c.Input, scriptCode, hashType)
+  }
+  return secp256k1.VerifyECDSA(point, hash[:], new(big.Int).SetBytes(parsed.R), new(big.Int).SetBytes(parsed.S))
+}
+
+//checkSchnorr checks a BIP340 signature of the input's taproot signature hash, with the hash type appended unless it
+//is SIGHASH_DEFAULT, for the x only key
+func (c *Checker) checkSchnorr(sig []byte, key []byte) (error) {
+  if len(sig) != 64 && len(sig) != 65 {
+    return ErrSchnorrSigSize
+  }
+  hashType := byte(SigHashDefault)
+  if len(sig) == 65 {
+    hashType = sig[64]
+    if hashType == SigHashDefault {
+      return ErrSchnorrSigHashType
+    }
+    sig = sig[:64]
+  }
+  hash, err := TaprootSignatureHash(c.Tx, c.Input, hashType, c.hashes(), c.Prevouts, c.annex, c.tapscript)
+  if err == ErrSigHashType {
+    return ErrSchnorrSigHashType
+  }
+  if err != nil {
+    return err
+  }
+  if !secp256k1.VerifySchnorr(key, hash[:], sig) {
+    return ErrSchnorrSig
+  }
+  return nil
+}
+
+//checkTapscriptSig runs the signature check of OP_CHECKSIG, OP_CHECKSIGVERIFY and OP_CHECKSIGADD in tapscript. An
+//empty signature fails the check; any other signature that does not verify fails the script. Keys that are not 32
+//bytes are left to future soft forks and pass.
+func (c *Checker) checkTapscriptSig(sig []byte, key []byte, flags Flags) (bool, error) {
+  if len(sig) > 0 {
+    c.weightLeft -= validationWeightPerSigOp
+    if c.weightLeft < 0 {
+      return false, ErrTapscriptValidationWeight
+    }
+  }
+  switch {
+  case len(key) == 0:
+    return false, ErrTapscriptEmptyPubKey
+  case len(key) == 32:
+    if len(sig) > 0 {
+      if err := c.checkSchnorr(sig, key); err != nil {
+        return false, err
+      }
+    }
+  case flags & VerifyDiscourageUpgradablePubKeyType != 0:
+    return false, ErrDiscourageUpgradablePubKeyType
+  }
+  return len(sig) > 0, nil
+}
+
+//checkLockTime reports whether the transaction's lock time has reached lockTime, of the same kind, height or time
+func (c *Checker) checkLockTime(lockTime int64) (bool) {
+  txLockTime := int64(c.Tx.TransactionLockTime)
+  if (txLockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+    return false
+  }
+  if lockTime > txLockTime {
+    return false
+  }
+  //a final input would let the transaction be mined whatever its lock time
+  return c.Tx.Inputs[c.Input].SequenceNumber != SequenceFinal
+}
+
+//checkSequence reports whether the input's BIP68 relative lock time has reached sequence, of the same kind
+func (c *Checker) checkSequence(sequence int64) (bool) {
+  txSequence := int64(c.Tx.Inputs[c.Input].SequenceNumber)
+  if c.Tx.TransactionVersionNumber < 2 || txSequence & SequenceDisableFlag != 0 {
+    return false
+  }
+  mask := int64(SequenceTypeFlag | SequenceMask)
+  txMasked, masked := txSequence & mask, sequence & mask
+  if (txMasked < SequenceTypeFlag) != (masked < SequenceTypeFlag) {
+    return false
+  }
+  return masked <= txMasked
+}
+
+//isLowS reports whether a signature's S is at most half the curve order
+func isLowS(s []byte) (bool) {
+  return secp256k1.IsLowS(new(big.Int).SetBytes(s))
+}
+
+//VerifyScript runs an input script and then the output script it spends, and for pay to script hash outputs the
+//redeem script, as bitcoind's VerifyScript does. Under VerifyWitness, outputs and redeem scripts that are witness
+//programs are verified against the input's witness.
+func VerifyScript(scriptSig []byte, scriptPubKey []byte, flags Flags, c *Checker) (error) {
+  witness := c.Tx.Inputs[c.Input].Witness
+  if flags & VerifySigPushOnly != 0 && !IsPushOnly(scriptSig) {
+    return ErrSigPushOnly
+  }
+  var st stack
+  err := eval(&st, scriptSig, flags, c, sigVersionBase)
+  if err != nil {
+    return err
+  }
+  stackCopy := append(stack(nil), st...)
+  err = eval(&st, scriptPubKey, flags, c, sigVersionBase)
+  if err != nil {
+    return err
+  }
+  if len(st) == 0 || !CastToBool(st.top(-1)) {
+    return ErrEvalFalse
+  }
+  hadWitness := false
+  if version, program, ok := WitnessProgram(scriptPubKey); ok && flags & VerifyWitness != 0 {
+    hadWitness = true
+    if len(scriptSig) != 0 {
+      return ErrWitnessMalleated
+    }
+    err = verifyWitnessProgram(witness, version, program, flags, c, false)
+    if err != nil {
+      return err
+    }
+    //the witness leaves a single true element behind, so CLEANSTACK passes
+    st = st[:1]
+  }
+  if flags & VerifyP2SH != 0 && IsPayToScriptHash(scriptPubKey) {
+    if !IsPushOnly(scriptSig) {
+      return ErrSigPushOnly
+    }
+    st = stackCopy
+    redeem := st.pop()
+    err = eval(&st, redeem, flags, c, sigVersionBase)
+    if err != nil {
+      return err
+    }
+    if len(st) == 0 || !CastToBool(st.top(-1)) {
+      return ErrEvalFalse
+    }
+    if version, program, ok := WitnessProgram(redeem); ok && flags & VerifyWitness != 0 {
+      hadWitness = true
+      //the input script must be the push of the redeem script alone, so the witness cannot be malleated through it
+      if string(scriptSig) != string(PushData(redeem)) {
+        return ErrWitnessMalleatedP2SH
+      }
+      err = verifyWitnessProgram(witness, version, program, flags, c, true)
+      if err != nil {
+        return err
+      }
+      st = st[:1]
+    }
+  }
+  if flags & VerifyCleanStack != 0 && len(st) != 1 {
+    return ErrCleanStack
+  }
+  if flags & VerifyWitness != 0 && !hadWitness && len(witness) > 0 {
+    return ErrWitnessUnexpected
+  }
+  return nil
+}
+
+//verifyWitnessProgram verifies witness against a witness program of version, which p2sh says was nested in a pay
+//to script hash output
+func verifyWitnessProgram(witness [][]byte, version int, program []byte, flags Flags, c *Checker, p2sh bool) (error) {
+  st := stack(append([][]byte(nil), witness...))
+  switch {
+  case version == 0 && len(program) == 32:
+    if len(st) == 0 {
+      return ErrWitnessProgramWitnessEmpty
+    }
+    witnessScript := st.pop()
+    if sha256.Sum256(witnessScript) != block.Hash(program) {
+      return ErrWitnessProgramMismatch
+    }
+    return executeWitnessScript(st, witnessScript, flags, c, sigVersionWitnessV0)
+  case version == 0 && len(program) == 20:
+    if len(st) != 2 {
+      return ErrWitnessProgramMismatch
+    }
+    //a key hash program runs the pay to public key hash script of the same hash
+    keyHash := append(append([]byte{OPDUP, OPHASH160, 20}, program...), OPEQUALVERIFY, OPCHECKSIG)
+    return executeWitnessScript(st, keyHash, flags, c, sigVersionWitnessV0)
+  case version == 0:
+    return ErrWitnessProgramWrongLength
+  case version == 1 && len(program) == 32 && !p2sh:
+    if flags & VerifyTaproot == 0 {
+      return nil
+    }
+    return verifyTaproot(st, witness, program, flags, c)
+  }
+  if flags & VerifyDiscourageUpgradableWitnessProgram != 0 {
+    return ErrDiscourageUpgradableWitnessProgram
+  }
+  return nil
+}
+
+//verifyTaproot verifies a taproot spend: a signature for the output key, or a script with a control block proving
+//it is a leaf of the key's script tree
+func verifyTaproot(st stack, witness [][]byte, program []byte, flags Flags, c *Checker) (error) {
+  if len(st) == 0 {
+    return ErrWitnessProgramWitnessEmpty
+  }
+  if len(st) >= 2 && len(st.top(-1)) > 0 && st.top(-1)[0] == AnnexTag {
+    c.annex = st.pop()
+  }
+  if len(st) == 1 {
+    return c.checkSchnorr(st[0], program)
+  }
+  control, leaf := st.pop(), st.pop()
+  if len(control) < controlBaseSize || (len(control) - controlBaseSize) % controlNodeSize != 0 ||
+    len(control) > controlBaseSize + controlNodeSize * controlMaxNodes {
+    return ErrTaprootWrongControlSize
+  }
+  leafHash := TapLeafHash(control[0] & leafMask, leaf)
+  if !verifyTaprootCommitment(control, program, leafHash) {
+    return ErrWitnessProgramMismatch
+  }
+  if control[0] & leafMask == LeafVersionTapscript {
+    c.tapscript = &TapscriptPath{LeafHash: leafHash, CodeSeparator: 0xffffffff}
+    c.weightLeft = int64(witnessSize(witness)) + validationWeightOffset
+    return executeWitnessScript(st, leaf, flags, c, sigVersionTapscript)
+  }
+  if flags & VerifyDiscourageUpgradableTaprootVersion != 0 {
+    return ErrDiscourageUpgradableTaprootVersion
+  }
+  return nil
+}
+
+//witnessSize returns the serialized size of a witness: its element count and each element behind its length
+func witnessSize(witness [][]byte) (int) {
+  n := blockserializer.CompactSizeLength(uint64(len(witness)))
+  for _, item := range witness {
+    n += blockserializer.CompactSizeLength(uint64(len(item))) + len(item)
+  }
+  return n
+}
+
+//executeWitnessScript runs a witness script on the rest of the witness, which must leave exactly one true element
+func executeWitnessScript(st stack, s []byte, flags Flags, c *Checker, version sigVersion) (error) {
+  if version == sigVersionTapscript {
+    //an OP_SUCCESSx anywhere makes the script succeed before anything else is checked, but only if every op code
+    //before it parses
+    for pos := 0; pos < len(s); {
+      op, next, err := Next(s, pos)
+      if err != nil {
+        return ErrBadOpcode
+      }
+      if IsOpSuccess(op.Code) {
+        if flags & VerifyDiscourageOpSuccess != 0 {
+          return ErrDiscourageOpSuccess
+        }
+        return nil
+      }
+      pos = next
+    }
+    if len(st) > MaxStackSize {
+      return ErrStackSize
+    }
+  }
+  for _, item := range st {
+    if len(item) > MaxElementSize {
+      return ErrPushSize
+    }
+  }
+  err := eval(&st, s, flags, c, version)
+  if err != nil {
+    return err
+  }
+  if len(st) != 1 {
+    return ErrCleanStack
+  }
+  if !CastToBool(st[0]) {
+    return ErrEvalFalse
+  }
+  return nil
+}
+
+//VerifyInput verifies input index of tx, which spends prevouts[index]
+func VerifyInput(tx *block.Transaction, index int, prevouts []Prevout, flags Flags) (error) {
+  if index >= len(prevouts) || prevouts[index].Script == nil {
+    return ErrMissingPrevout
+  }
+  c := &Checker{Tx: tx, Input: index, Prevouts: prevouts}
+  return VerifyScript(tx.Inputs[index].InputScript, prevouts[index].Script, flags, c)
+}
+
+//VerifyTransaction verifies every input of tx and returns the result of each, nil where the input is valid. The
+//signature hashes segwit inputs share are computed once for the transaction.
+func VerifyTransaction(tx *block.Transaction, prevouts []Prevout, flags Flags) ([]error) {
+  results := make([]error, len(tx.Inputs))
+  var hashes *SigHashes
+  for i := range tx.Inputs {
+    if i >= len(prevouts) || prevouts[i].Script == nil {
+      results[i] = ErrMissingPrevout
+      continue
+    }
+    c := &Checker{Tx: tx, Input: i, Prevouts: prevouts, Hashes: hashes}
+    results[i] = VerifyScript(tx.Inputs[i].InputScript, prevouts[i].Script, flags, c)
+    hashes = c.Hashes
+  }
+  return results
+}
@@ -0,0 +1,292 @@
+package script_test
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "errors"
+    "math/big"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/secp256k1"
+)
+
+//legacyFlags are the rules a legacy spend meets today
+const legacyFlags = script.VerifyP2SH | script.VerifyStrictEncoding | script.VerifyDERSignatures | script.VerifyLowS |
+  script.VerifyNullDummy | script.VerifyNullFail | script.VerifyCheckLockTime | script.VerifyCheckSequence
+
+//witnessFlags adds segwit and taproot to legacyFlags
+const witnessFlags = legacyFlags | script.VerifyWitness | script.VerifyTaproot | script.VerifyWitnessPubKeyType | script.VerifyMinimalIf
+
+func decode(t *testing.T, raw string) (*block.Transaction) {
+  var tx block.Transaction
+  _, err := blockchainbuilder.DecodeTransactionBytes(chaintest.MustHex(raw), &tx, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return &tx
+}
+
+func TestVerifyKnownTransactions(t *testing.T) {
+  tx := decode(t, chaintest.Tx170Hex)
+  prevouts := []script.Prevout{{Value: 50e8, Script: chaintest.MustHex(chaintest.Block9CoinbaseScript)}}
+  if results := script.VerifyTransaction(tx, prevouts, legacyFlags); results[0] != nil {
+    t.Errorf("block 170: %v", results[0])
+  }
+  tx.Outputs[0].OutputValue++
+  if err := script.VerifyInput(tx, 0, prevouts, legacyFlags &^ script.VerifyNullFail); err != script.ErrEvalFalse {
+    t.Errorf("block 170 with a changed output returned %v, want ErrEvalFalse", err)
+  }
+  if err := script.VerifyInput(tx, 0, prevouts, legacyFlags); err != script.ErrNullFail {
+    t.Errorf("block 170 with a changed output under NULLFAIL returned %v, want ErrNullFail", err)
+  }
+  if err := script.VerifyInput(tx, 0, nil, legacyFlags); err != script.ErrMissingPrevout {
+    t.Errorf("verifying without the prevout returned %v", err)
+  }
+
+  //the first input of the BIP143 example spends an ordinary P2PK output
+  tx = decode(t, chaintest.BIP143P2WPKHHex)
+  prevouts = []script.Prevout{{Value: 625000000, Script: chaintest.MustHex("2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac")}}
+  if err := script.VerifyInput(tx, 0, prevouts, legacyFlags); err != nil {
+    t.Errorf("BIP143 P2PK input: %v", err)
+  }
+  //and its second a P2WPKH output, signed with the BIP143 signature hash
+  prevouts = append(prevouts, script.Prevout{Value: 600000000, Script: chaintest.MustHex("00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1")})
+  for i, err := range script.VerifyTransaction(tx, prevouts, witnessFlags) {
+    if err != nil {
+      t.Errorf("BIP143 input %d: %v", i, err)
+    }
+  }
+  prevouts[1].Value++
+  if err := script.VerifyInput(tx, 1, prevouts, witnessFlags &^ script.VerifyNullFail); err != script.ErrEvalFalse {
+    t.Errorf("BIP143 P2WPKH input with the wrong amount returned %v", err)
+  }
+}
+
+//key is a private key with its compressed public key
+type key struct {
+  d *big.Int
+  pub []byte
+}
+
+func newKey(d int64) (key) {
+  k := big.NewInt(d)
+  return key{k, secp256k1.ScalarBaseMult(k).Compressed()}
+}
+
+//der encodes r and s as a DER signature
+func der(r *big.Int, s *big.Int) ([]byte) {
+  integer := func(n *big.Int) ([]byte) {
+    b := n.Bytes()
+    if b[0] & 0x80 != 0 {
+      b = append([]byte{0}, b...)
+    }
+    return append([]byte{0x02, byte(len(b))}, b...)
+  }
+  body := append(integer(r), integer(s)...)
+  return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+//sign returns k's signature of input index of tx, which runs scriptCode, with the hash type appended
+func (k key) sign(tx *block.Transaction, index int, scriptCode []byte, hashType byte) ([]byte) {
+  hash := script.LegacySignatureHash(tx, index, scriptCode, uint32(hashType))
+  r, s := secp256k1.SignECDSA(k.d, hash[:])
+  return append(der(r, s), hashType)
+}
+
+func payToPubKeyHash(pub []byte) ([]byte) {
+  return append(append([]byte{script.OPDUP, script.OPHASH160, 20}, btchashing.Hash160(pub)...), script.OPEQUALVERIFY, script.OPCHECKSIG)
+}
+
+func multisig(m int, keys ...key) ([]byte) {
+  s := []byte{script.OP1 + byte(m - 1)}
+  for _, k := range keys {
+    s = append(s, script.PushData(k.pub)...)
+  }
+  return append(s, script.OP1 + byte(len(keys) - 1), script.OPCHECKMULTISIG)
+}
+
+func spendOf(inputs int, outputs int) (*block.Transaction) {
+  var ins []block.Input
+  for i := 0; i < inputs; i++ {
+    ins = append(ins, chaintest.In(block.Hash{byte(i + 1)}, uint32(i)))
+  }
+  var outs []block.Output
+  for o := 0; o < outputs; o++ {
+    outs = append(outs, chaintest.Out(uint64(o + 1) * 1000, chaintest.OpTrue))
+  }
+  tx := chaintest.Tx(ins, outs...)
+  return &tx
+}
+
+func TestVerifySignatures(t *testing.T) {
+  k1, k2, k3 := newKey(1001), newKey(1002), newKey(1003)
+  cat := func(parts ...[]byte) ([]byte) {
+    return bytes.Join(parts, nil)
+  }
+
+  //pay to public key hash
+  tx := spendOf(1, 1)
+  prevout := payToPubKeyHash(k1.pub)
+  tx.Inputs[0].InputScript = cat(script.PushData(k1.sign(tx, 0, prevout, script.SigHashAll)), script.PushData(k1.pub))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags); err != nil {
+    t.Errorf("P2PKH: %v", err)
+  }
+  tx.Inputs[0].InputScript = cat(script.PushData(k2.sign(tx, 0, prevout, script.SigHashAll)), script.PushData(k2.pub))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags); err != script.ErrEqualVerify {
+    t.Errorf("P2PKH with another key returned %v", err)
+  }
+
+  //pay to script hash 2 of 3 multisig, which needs its signatures in the order of the keys
+  redeem := multisig(2, k1, k2, k3)
+  prevout = append(append([]byte{script.OPHASH160, 20}, btchashing.Hash160(redeem)...), script.OPEQUAL)
+  sig1, sig3 := k1.sign(tx, 0, redeem, script.SigHashAll), k3.sign(tx, 0, redeem, script.SigHashAll)
+  tx.Inputs[0].InputScript = cat([]byte{script.OP0}, script.PushData(sig1), script.PushData(sig3), script.PushData(redeem))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags); err != nil {
+    t.Errorf("P2SH multisig: %v", err)
+  }
+  tx.Inputs[0].InputScript = cat([]byte{script.OP0}, script.PushData(sig3), script.PushData(sig1), script.PushData(redeem))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags &^ script.VerifyNullFail); err != script.ErrEvalFalse {
+    t.Errorf("P2SH multisig with signatures out of order returned %v", err)
+  }
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags); err != script.ErrNullFail {
+    t.Errorf("P2SH multisig with signatures out of order under NULLFAIL returned %v", err)
+  }
+  //the redeem script only runs under BIP16
+  tx.Inputs[0].InputScript = cat([]byte{script.OP0}, script.PushData(redeem))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, script.VerifyNone); err != nil {
+    t.Errorf("P2SH before BIP16: %v", err)
+  }
+
+  //bare 1 of 2 multisig with uncompressed keys
+  u2 := key{k2.d, append(append([]byte{0x04}, secp256k1.ScalarBaseMult(k2.d).X.FillBytes(make([]byte, 32))...),
+    secp256k1.ScalarBaseMult(k2.d).Y.FillBytes(make([]byte, 32))...)}
+  prevout = multisig(1, k1, u2)
+  tx.Inputs[0].InputScript = cat([]byte{script.OP0}, script.PushData(u2.sign(tx, 0, prevout, script.SigHashAll)))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: prevout}}, legacyFlags); err != nil {
+    t.Errorf("bare multisig: %v", err)
+  }
+}
+
+func TestSignatureHashTypes(t *testing.T) {
+  k := newKey(7)
+  prevout := payToPubKeyHash(k.pub)
+  prevouts := []script.Prevout{{Script: prevout}, {Script: prevout}}
+
+  //SIGHASH_SINGLE on an input with no output at its index signs the number one rather than the transaction
+  tx := spendOf(2, 1)
+  if h := script.LegacySignatureHash(tx, 1, prevout, script.SigHashSingle); h != (block.Hash{1}) {
+    t.Fatalf("SIGHASH_SINGLE without a matching output hashed to %s", h)
+  }
+  tx.Inputs[1].InputScript = append(script.PushData(k.sign(tx, 1, prevout, script.SigHashSingle)), script.PushData(k.pub)...)
+  if err := script.VerifyInput(tx, 1, prevouts, legacyFlags); err != nil {
+    t.Errorf("SIGHASH_SINGLE bug: %v", err)
+  }
+  //so the signature stays valid whatever the transaction becomes
+  other := spendOf(3, 1)
+  other.Inputs[1].InputScript = tx.Inputs[1].InputScript
+  if err := script.VerifyInput(other, 1, append(prevouts, prevouts[0]), legacyFlags); err != nil {
+    t.Errorf("SIGHASH_SINGLE bug signature moved to another transaction: %v", err)
+  }
+
+  //SIGHASH_SINGLE signs only the output at its index
+  tx = spendOf(2, 2)
+  tx.Inputs[1].InputScript = append(script.PushData(k.sign(tx, 1, prevout, script.SigHashSingle)), script.PushData(k.pub)...)
+  tx.Outputs[0].OutputValue++
+  tx.Inputs[0].SequenceNumber = 5
+  if err := script.VerifyInput(tx, 1, prevouts, legacyFlags); err != nil {
+    t.Errorf("SIGHASH_SINGLE after changing another output and sequence: %v", err)
+  }
+  tx.Outputs[1].OutputValue++
+  if err := script.VerifyInput(tx, 1, prevouts, legacyFlags &^ script.VerifyNullFail); err != script.ErrEvalFalse {
+    t.Errorf("SIGHASH_SINGLE after changing its output returned %v", err)
+  }
+
+  //SIGHASH_NONE|SIGHASH_ANYONECANPAY signs only its own input
+  tx = spendOf(1, 1)
+  tx.Inputs[0].InputScript = append(script.PushData(k.sign(tx, 0, prevout, script.SigHashNone | script.SigHashAnyoneCanPay)), script.PushData(k.pub)...)
+  tx.Inputs = append(tx.Inputs, chaintest.In(block.Hash{9}, 9))
+  tx.Outputs = nil
+  if err := script.VerifyInput(tx, 0, prevouts, legacyFlags); err != nil {
+    t.Errorf("SIGHASH_NONE|SIGHASH_ANYONECANPAY after changing the transaction: %v", err)
+  }
+}
+
+func TestSignatureEncoding(t *testing.T) {
+  k := newKey(99)
+  prevout := append(script.PushData(k.pub), script.OPCHECKSIG)
+  prevouts := []script.Prevout{{Script: prevout}}
+  tx := spendOf(1, 1)
+  hash := script.LegacySignatureHash(tx, 0, prevout, script.SigHashAll)
+  r, s := secp256k1.SignECDSA(k.d, hash[:])
+
+  //high S is valid by consensus but not under LOW_S
+  high := append(der(r, new(big.Int).Sub(secp256k1.N, s)), script.SigHashAll)
+  tx.Inputs[0].InputScript = script.PushData(high)
+  if err := script.VerifyInput(tx, 0, prevouts, script.VerifyDERSignatures); err != nil {
+    t.Errorf("high S: %v", err)
+  }
+  if err := script.VerifyInput(tx, 0, prevouts, script.VerifyLowS); err != script.ErrSigHighS {
+    t.Errorf("high S under LOW_S returned %v", err)
+  }
+
+  //a padded R was valid until BIP66
+  strict := der(r, s)
+  padded := append([]byte{0x30, strict[1] + 1, 0x02, strict[3] + 1, 0x00}, strict[4:]...)
+  tx.Inputs[0].InputScript = script.PushData(append(padded, script.SigHashAll))
+  if err := script.VerifyInput(tx, 0, prevouts, script.VerifyNone); err != nil {
+    t.Errorf("padded R: %v", err)
+  }
+  if err := script.VerifyInput(tx, 0, prevouts, script.VerifyDERSignatures); err != script.ErrSigDER {
+    t.Errorf("padded R under DERSIG returned %v", err)
+  }
+
+  //a signature signs the script from after the last OP_CODESEPARATOR executed
+  separated := append(append(script.PushData(k.pub), script.OPCODESEPARATOR), script.OPCHECKSIG)
+  tx.Inputs[0].InputScript = script.PushData(k.sign(tx, 0, []byte{script.OPCHECKSIG}, script.SigHashAll))
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: separated}}, legacyFlags); err != nil {
+    t.Errorf("OP_CODESEPARATOR: %v", err)
+  }
+  if err := script.VerifyInput(tx, 0, []script.Prevout{{Script: separated}}, legacyFlags | script.VerifyConstScriptCode); !errors.Is(err, script.ErrOpCodeSeparator) {
+    t.Errorf("OP_CODESEPARATOR under CONST_SCRIPTCODE returned %v", err)
+  }
+}
+
+func TestFindAndDelete(t *testing.T) {
+  sig := []byte{0xaa, 0xbb}
+  tests := []struct {
+    s string
+    want string
+    found int
+  }{
+    {"02aabb02aabb51", "51", 2},
+    {"0302aabb02aabb", "0302aabb", 1},
+    //a match inside another push is left alone, but one starting where an instruction does is removed
+    {"03aa02aabb", "03aa02aabb", 0},
+    {"5102aabb", "51", 1},
+    {"02aabb4c", "4c", 1},
+    {"4c02aabb", "4c02aabb", 0},
+  }
+  for _, test := range tests {
+    got, found := script.FindAndDelete(chaintest.MustHex(test.s), sig)
+    if found != test.found || !bytes.Equal(got, chaintest.MustHex(test.want)) {
+      t.Errorf("FindAndDelete(%s) = %x, %d, want %s, %d", test.s, got, found, test.want, test.found)
+    }
+  }
+  //an empty signature removes OP_0s
+  if got, found := script.FindAndDelete([]byte{script.OP0, script.OP1, script.OP0}, nil); found != 2 || !bytes.Equal(got, []byte{script.OP1}) {
+    t.Errorf("FindAndDelete of an empty signature = %x, %d", got, found)
+  }
+}
+
+func sha256Sum(b []byte) ([]byte) {
+  sum := sha256.Sum256(b)
+  return sum[:]
+}
+
+func btcHash160(b []byte) ([]byte) {
+  return btchashing.Hash160(b)
+}
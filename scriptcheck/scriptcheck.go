@@ -0,0 +1,129 @@
+package scriptcheck
+
+import (
+    "sync"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/spend"
+)
+
+//Flags returns the script rules the block at height with hash is checked under on the active network, as bitcoind
+//chooses them: BIP16, segwit and taproot for every block but two, then strict DER signatures,
+//OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY and the empty multisig dummy from their activation heights
+func Flags(height int, hash block.Hash) (script.Flags) {
+  p := network.Active
+  var flags script.Flags
+  switch hash {
+  case p.BIP16Exception:
+  case p.TaprootException:
+    flags |= script.VerifyP2SH | script.VerifyWitness
+  default:
+    flags |= script.VerifyP2SH | script.VerifyWitness | script.VerifyTaproot
+  }
+  if height >= p.BIP66Height {
+    flags |= script.VerifyDERSignatures
+  }
+  if height >= p.BIP65Height {
+    flags |= script.VerifyCheckLockTime
+  }
+  if height >= p.CSVHeight {
+    flags |= script.VerifyCheckSequence
+  }
+  if height >= p.SegwitHeight {
+    flags |= script.VerifyNullDummy
+  }
+  return flags
+}
+
+//Result is the outcome of verifying one input of a main chain block
+type Result struct {
+  Height int `json:"height"`
+  TxID block.Hash `json:"txid"`
+  Input int `json:"input"`
+  //Type is the kind of output the input spends, as spend.Analyze names it
+  Type string `json:"type"`
+  Value uint64 `json:"value"`
+  //Err is why the input is invalid, nil when its scripts verify
+  Err error `json:"-"`
+}
+
+//Checker is a chainstate.Index verifying the scripts and witnesses of every input a block spends against the coins
+//the UTXO set gave up for them
+type Checker struct {
+  //Check selects the heights whose blocks are verified; nil verifies every block
+  Check func(height int) (bool)
+  //Report is called with the result of each input verified, in the order the block spends them
+  Report func(Result)
+  //Workers is how many transactions of a block are verified at once; below one verifies them in turn
+  Workers int
+
+  //Inputs and Failed count the inputs verified and those that failed
+  Inputs int
+  Failed int
+}
+
+//ConnectBlock verifies the inputs of b from the coins in undo
+func (c *Checker) ConnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  if c.Check != nil && !c.Check(height) {
+    return nil
+  }
+  flags := Flags(height, b.BlockHash)
+  //each transaction verifies into its own stretch of results, starting where its spends start in undo
+  results := make([]Result, len(undo.Spent))
+  starts := make([]int, len(b.Transactions))
+  n := 0
+  for t := 1; t < len(b.Transactions); t++ {
+    starts[t] = n
+    n += len(b.Transactions[t].Inputs)
+  }
+  verify := func(t int) {
+    tx := &b.Transactions[t]
+    prevouts := make([]script.Prevout, len(tx.Inputs))
+    for i := range tx.Inputs {
+      coin := undo.Spent[starts[t] + i].Coin
+      prevouts[i] = script.Prevout{Value: coin.Value, Script: coin.Script}
+    }
+    for i, err := range script.VerifyTransaction(tx, prevouts, flags) {
+      results[starts[t] + i] = Result{height, tx.TransactionHash, i, spend.Analyze(&tx.Inputs[i], prevouts[i].Script).Type, prevouts[i].Value, err}
+    }
+  }
+  if c.Workers > 1 {
+    var wg sync.WaitGroup
+    next := make(chan int)
+    for w := 0; w < c.Workers; w++ {
+      wg.Add(1)
+      go func() {
+        defer wg.Done()
+        for t := range next {
+          verify(t)
+        }
+      }()
+    }
+    for t := 1; t < len(b.Transactions); t++ {
+      next <- t
+    }
+    close(next)
+    wg.Wait()
+  } else {
+    for t := 1; t < len(b.Transactions); t++ {
+      verify(t)
+    }
+  }
+  for _, r := range results {
+    c.Inputs++
+    if r.Err != nil {
+      c.Failed++
+    }
+    if c.Report != nil {
+      c.Report(r)
+    }
+  }
+  return nil
+}
+
+//DisconnectBlock does nothing: results are reported as blocks connect
+func (c *Checker) DisconnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  return nil
+}
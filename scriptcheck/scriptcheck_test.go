@@ -0,0 +1,74 @@
+package scriptcheck_test
+
+import (
+    "errors"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/scriptcheck"
+)
+
+func TestFlags(t *testing.T) {
+  main := network.MainNet
+  network.Active = &main
+  defer func() { network.Active = &network.MainNet }()
+  tests := []struct {
+    height int
+    hash block.Hash
+    want script.Flags
+  }{
+    {1, block.Hash{}, script.VerifyP2SH | script.VerifyWitness | script.VerifyTaproot},
+    {170060, main.BIP16Exception, script.VerifyNone},
+    {363725, block.Hash{}, script.VerifyP2SH | script.VerifyWitness | script.VerifyTaproot | script.VerifyDERSignatures},
+    {419328, block.Hash{}, script.VerifyP2SH | script.VerifyWitness | script.VerifyTaproot | script.VerifyDERSignatures |
+      script.VerifyCheckLockTime | script.VerifyCheckSequence},
+    {692261, main.TaprootException, script.VerifyP2SH | script.VerifyWitness | script.VerifyDERSignatures |
+      script.VerifyCheckLockTime | script.VerifyCheckSequence | script.VerifyNullDummy},
+  }
+  for _, test := range tests {
+    if got := scriptcheck.Flags(test.height, test.hash); got != test.want {
+      t.Errorf("Flags(%d, %s) = %b, want %b", test.height, test.hash, got, test.want)
+    }
+  }
+}
+
+func TestChecker(t *testing.T) {
+  for _, workers := range []int{0, 4} {
+    c := chaintest.NewChain()
+    c.Extend(2, "")
+    //the coinbases pay to OP_TRUE, which an empty script spends; the second spend's output pays to OP_FALSE, which
+    //nothing can spend
+    good := chaintest.Tx([]block.Input{chaintest.In(c.Order[1].Transactions[0].TransactionHash, 0)}, chaintest.Out(1, []byte{script.OP0}))
+    other := chaintest.Tx([]block.Input{chaintest.In(c.Order[2].Transactions[0].TransactionHash, 0)}, chaintest.Out(1, chaintest.OpTrue))
+    c.Mine(c.Tip, "", 0, good, other)
+    bad := chaintest.Tx([]block.Input{chaintest.In(other.TransactionHash, 0), chaintest.In(good.TransactionHash, 0)}, chaintest.Out(1, chaintest.OpTrue))
+    c.Mine(c.Tip, "", 0, bad)
+
+    var results []scriptcheck.Result
+    checker := &scriptcheck.Checker{Workers: workers, Report: func(r scriptcheck.Result) {
+      results = append(results, r)
+    }}
+    s := chainstate.New(checker)
+    for h, b := range c.Order {
+      err := s.ConnectBlock(h, b)
+      if err != nil {
+        t.Fatal(err)
+      }
+    }
+    if checker.Inputs != 4 || checker.Failed != 1 || len(results) != 4 {
+      t.Fatalf("%d workers: checked %d inputs with %d failures and %d results, want 4, 1 and 4", workers, checker.Inputs, checker.Failed, len(results))
+    }
+    for i, r := range results[:3] {
+      if r.Err != nil {
+        t.Errorf("%d workers: result %d failed: %v", workers, i, r.Err)
+      }
+    }
+    last := results[3]
+    if last.Height != 4 || last.TxID != bad.TransactionHash || last.Input != 1 || last.Value != 1 || !errors.Is(last.Err, script.ErrEvalFalse) {
+      t.Errorf("%d workers: last result %+v, want input 1 of %s at height 4 failing with ErrEvalFalse", workers, last, bad.TransactionHash)
+    }
+  }
+}
@@ -0,0 +1,86 @@
+package secp256k1
+
+import (
+    "crypto/sha256"
+    "math/big"
+)
+
+//TaggedHash returns the BIP340 tagged hash of the concatenation of parts: SHA256(SHA256(tag) || SHA256(tag) || parts)
+func TaggedHash(tag string, parts ...[]byte) ([32]byte) {
+  tagHash := sha256.Sum256([]byte(tag))
+  h := sha256.New()
+  h.Write(tagHash[:])
+  h.Write(tagHash[:])
+  for _, p := range parts {
+    h.Write(p)
+  }
+  var sum [32]byte
+  h.Sum(sum[:0])
+  return sum
+}
+
+//ParseXOnlyPublicKey reads the 32 byte x only key of BIP340, the point with that x and an even y
+func ParseXOnlyPublicKey(b []byte) (Point, error) {
+  if len(b) != 32 {
+    return Point{}, ErrBadPublicKey
+  }
+  return LiftX(new(big.Int).SetBytes(b))
+}
+
+//XOnly returns the 32 byte x coordinate of p, its BIP340 encoding
+func (p Point) XOnly() ([]byte) {
+  return p.X.FillBytes(make([]byte, 32))
+}
+
+//challenge returns the BIP340 challenge e for the nonce x coordinate r, the x only key and the message
+func challenge(r []byte, key []byte, msg []byte) (*big.Int) {
+  e := TaggedHash("BIP0340/challenge", r, key, msg)
+  return new(big.Int).Mod(new(big.Int).SetBytes(e[:]), N)
+}
+
+//VerifySchnorr reports whether the 64 byte sig is a BIP340 signature of msg for the 32 byte x only key
+func VerifySchnorr(key []byte, msg []byte, sig []byte) (bool) {
+  if len(sig) != 64 {
+    return false
+  }
+  point, err := ParseXOnlyPublicKey(key)
+  if err != nil {
+    return false
+  }
+  r := new(big.Int).SetBytes(sig[:32])
+  s := new(big.Int).SetBytes(sig[32:])
+  if r.Cmp(P) >= 0 || s.Cmp(N) >= 0 {
+    return false
+  }
+  e := challenge(sig[:32], key, msg)
+  //R = sG - eP
+  R := DoubleScalarMult(s, G, new(big.Int).Sub(N, e), point)
+  return !R.Infinity() && R.Y.Bit(0) == 0 && R.X.Cmp(r) == 0
+}
+
+//SignSchnorr returns the BIP340 signature of msg with the private key d and the 32 bytes of auxiliary randomness aux.
+//It exists to build test transactions.
+func SignSchnorr(d *big.Int, msg []byte, aux []byte) ([]byte) {
+  point := ScalarBaseMult(d)
+  if point.Y.Bit(0) == 1 {
+    d = new(big.Int).Sub(N, d)
+  }
+  key := point.XOnly()
+  t := d.FillBytes(make([]byte, 32))
+  mask := TaggedHash("BIP0340/aux", aux)
+  for i := range t {
+    t[i] ^= mask[i]
+  }
+  nonce := TaggedHash("BIP0340/nonce", t, key, msg)
+  k := new(big.Int).Mod(new(big.Int).SetBytes(nonce[:]), N)
+  R := ScalarBaseMult(k)
+  if R.Y.Bit(0) == 1 {
+    k.Sub(N, k)
+  }
+  r := R.XOnly()
+  s := challenge(r, key, msg)
+  s.Mul(s, d)
+  s.Add(s, k)
+  s.Mod(s, N)
+  return append(r, s.FillBytes(make([]byte, 32))...)
+}
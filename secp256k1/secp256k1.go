@@ -0,0 +1,338 @@
+package secp256k1
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "errors"
+    "math/big"
+)
+
+//ErrBadPublicKey is returned when bytes do not encode a point on the curve
+var ErrBadPublicKey = errors.New("secp256k1: invalid public key")
+
+//curve parameters: y² = x³ + 7 over the field of P, with the group of order N generated by G
+var (
+  P = fromHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+  N = fromHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+  G = Point{X: fromHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+    Y: fromHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")}
+)
+
+//halfN is N / 2, the largest S a low S signature has
+var halfN = new(big.Int).Rsh(N, 1)
+
+func fromHex(s string) (*big.Int) {
+  n, ok := new(big.Int).SetString(s, 16)
+  if !ok {
+    panic("secp256k1: bad constant " + s)
+  }
+  return n
+}
+
+//Point is a point on the curve in affine coordinates. The point at infinity has nil coordinates.
+type Point struct {
+  X *big.Int
+  Y *big.Int
+}
+
+//Infinity reports whether p is the point at infinity
+func (p Point) Infinity() (bool) {
+  return p.X == nil
+}
+
+//Compressed returns the 33 byte encoding of p
+func (p Point) Compressed() ([]byte) {
+  b := make([]byte, 33)
+  b[0] = 0x02 + byte(p.Y.Bit(0))
+  p.X.FillBytes(b[1:])
+  return b
+}
+
+//IsOnCurve reports whether x and y satisfy the curve equation and lie in the field
+func IsOnCurve(x *big.Int, y *big.Int) (bool) {
+  if x.Sign() < 0 || x.Cmp(P) >= 0 || y.Sign() < 0 || y.Cmp(P) >= 0 {
+    return false
+  }
+  lhs := new(big.Int).Mul(y, y)
+  lhs.Mod(lhs, P)
+  return lhs.Cmp(curveY2(x)) == 0
+}
+
+//curveY2 returns x³ + 7 mod P
+func curveY2(x *big.Int) (*big.Int) {
+  rhs := new(big.Int).Mul(x, x)
+  rhs.Mul(rhs, x)
+  rhs.Add(rhs, big.NewInt(7))
+  return rhs.Mod(rhs, P)
+}
+
+//LiftX returns the point with x coordinate x and an even y, as BIP340 does for x only keys
+func LiftX(x *big.Int) (Point, error) {
+  if x.Sign() < 0 || x.Cmp(P) >= 0 {
+    return Point{}, ErrBadPublicKey
+  }
+  y2 := curveY2(x)
+  //P is 3 mod 4, so a square root is y2^((P+1)/4)
+  y := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(P, big.NewInt(1)), 2), P)
+  if new(big.Int).Mod(new(big.Int).Mul(y, y), P).Cmp(y2) != 0 {
+    return Point{}, ErrBadPublicKey
+  }
+  if y.Bit(0) == 1 {
+    y.Sub(P, y)
+  }
+  return Point{X: new(big.Int).Set(x), Y: y}, nil
+}
+
+//ParsePublicKey reads a compressed key (0x02 or 0x03 and x), an uncompressed key (0x04, x and y) or a hybrid key
+//(0x06 or 0x07, x and y), which consensus accepts as OpenSSL did
+func ParsePublicKey(b []byte) (Point, error) {
+  switch {
+  case len(b) == 33 && (b[0] == 0x02 || b[0] == 0x03):
+    p, err := LiftX(new(big.Int).SetBytes(b[1:]))
+    if err != nil {
+      return Point{}, err
+    }
+    if b[0] == 0x03 {
+      p.Y.Sub(P, p.Y)
+    }
+    return p, nil
+  case len(b) == 65 && (b[0] == 0x04 || b[0] == 0x06 || b[0] == 0x07):
+    p := Point{X: new(big.Int).SetBytes(b[1:33]), Y: new(big.Int).SetBytes(b[33:])}
+    if !IsOnCurve(p.X, p.Y) || (b[0] != 0x04 && uint(b[0] & 1) != p.Y.Bit(0)) {
+      return Point{}, ErrBadPublicKey
+    }
+    return p, nil
+  }
+  return Point{}, ErrBadPublicKey
+}
+
+//jacobian is a point in Jacobian coordinates, x = X/Z² and y = Y/Z³. Z is zero at infinity.
+type jacobian struct {
+  x, y, z *big.Int
+}
+
+func toJacobian(p Point) (jacobian) {
+  if p.Infinity() {
+    return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+  }
+  return jacobian{new(big.Int).Set(p.X), new(big.Int).Set(p.Y), big.NewInt(1)}
+}
+
+func (j jacobian) affine() (Point) {
+  if j.z.Sign() == 0 {
+    return Point{}
+  }
+  zinv := new(big.Int).ModInverse(j.z, P)
+  zinv2 := new(big.Int).Mul(zinv, zinv)
+  x := new(big.Int).Mul(j.x, zinv2)
+  x.Mod(x, P)
+  y := zinv2.Mul(zinv2, zinv)
+  y.Mul(y, j.y)
+  y.Mod(y, P)
+  return Point{X: x, Y: y}
+}
+
+//mod reduces n into the field
+func mod(n *big.Int) (*big.Int) {
+  return n.Mod(n, P)
+}
+
+//double returns 2j, by the dbl-2009-l formulas for curves with a = 0
+func (j jacobian) double() (jacobian) {
+  if j.z.Sign() == 0 || j.y.Sign() == 0 {
+    return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+  }
+  a := mod(new(big.Int).Mul(j.x, j.x))
+  b := mod(new(big.Int).Mul(j.y, j.y))
+  c := mod(new(big.Int).Mul(b, b))
+  d := new(big.Int).Add(j.x, b)
+  d = mod(d.Mul(d, d))
+  d.Sub(d, a)
+  d.Sub(d, c)
+  d = mod(d.Lsh(d, 1))
+  e := new(big.Int).Mul(a, big.NewInt(3))
+  f := mod(new(big.Int).Mul(e, e))
+  x3 := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+  mod(x3)
+  y3 := new(big.Int).Sub(d, x3)
+  y3.Mul(y3, e)
+  y3.Sub(y3, new(big.Int).Lsh(c, 3))
+  mod(y3)
+  z3 := new(big.Int).Mul(j.y, j.z)
+  mod(z3.Lsh(z3, 1))
+  return jacobian{x3, y3, z3}
+}
+
+//add returns j + k, by the add-2007-bl formulas
+func (j jacobian) add(k jacobian) (jacobian) {
+  if j.z.Sign() == 0 {
+    return k
+  }
+  if k.z.Sign() == 0 {
+    return j
+  }
+  z1z1 := mod(new(big.Int).Mul(j.z, j.z))
+  z2z2 := mod(new(big.Int).Mul(k.z, k.z))
+  u1 := mod(new(big.Int).Mul(j.x, z2z2))
+  u2 := mod(new(big.Int).Mul(k.x, z1z1))
+  s1 := new(big.Int).Mul(j.y, k.z)
+  s1 = mod(s1.Mul(s1, z2z2))
+  s2 := new(big.Int).Mul(k.y, j.z)
+  s2 = mod(s2.Mul(s2, z1z1))
+  h := mod(new(big.Int).Sub(u2, u1))
+  r := mod(new(big.Int).Sub(s2, s1))
+  if h.Sign() == 0 {
+    if r.Sign() == 0 {
+      return j.double()
+    }
+    return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+  }
+  i := new(big.Int).Lsh(h, 1)
+  i = mod(i.Mul(i, i))
+  jj := mod(new(big.Int).Mul(h, i))
+  r.Lsh(r, 1)
+  v := mod(new(big.Int).Mul(u1, i))
+  x3 := new(big.Int).Mul(r, r)
+  x3.Sub(x3, jj)
+  x3.Sub(x3, new(big.Int).Lsh(v, 1))
+  mod(x3)
+  y3 := new(big.Int).Sub(v, x3)
+  y3.Mul(y3, r)
+  y3.Sub(y3, new(big.Int).Lsh(new(big.Int).Mul(s1, jj), 1))
+  mod(y3)
+  z3 := new(big.Int).Add(j.z, k.z)
+  z3.Mul(z3, z3)
+  z3.Sub(z3, z1z1)
+  z3.Sub(z3, z2z2)
+  z3.Mul(z3, h)
+  mod(z3)
+  return jacobian{x3, y3, z3}
+}
+
+//Add returns p + q
+func Add(p Point, q Point) (Point) {
+  return toJacobian(p).add(toJacobian(q)).affine()
+}
+
+//Negate returns -p
+func Negate(p Point) (Point) {
+  if p.Infinity() {
+    return p
+  }
+  return Point{X: new(big.Int).Set(p.X), Y: new(big.Int).Sub(P, p.Y)}
+}
+
+//ScalarMult returns k·p
+func ScalarMult(p Point, k *big.Int) (Point) {
+  return DoubleScalarMult(k, p, new(big.Int), G)
+}
+
+//ScalarBaseMult returns k·G
+func ScalarBaseMult(k *big.Int) (Point) {
+  return ScalarMult(G, k)
+}
+
+//DoubleScalarMult returns a·p + b·q, reading the bits of both scalars at once
+func DoubleScalarMult(a *big.Int, p Point, b *big.Int, q Point) (Point) {
+  jp, jq := toJacobian(p), toJacobian(q)
+  both := jp.add(jq)
+  ka, kb := new(big.Int).Mod(a, N), new(big.Int).Mod(b, N)
+  acc := toJacobian(Point{})
+  for i := max(ka.BitLen(), kb.BitLen()) - 1; i >= 0; i-- {
+    acc = acc.double()
+    switch ka.Bit(i) << 1 | kb.Bit(i) {
+    case 3:
+      acc = acc.add(both)
+    case 2:
+      acc = acc.add(jp)
+    case 1:
+      acc = acc.add(jq)
+    }
+  }
+  return acc.affine()
+}
+
+//VerifyECDSA reports whether r and s sign the 32 byte hash for key. High S values are accepted, as consensus accepts them.
+func VerifyECDSA(key Point, hash []byte, r *big.Int, s *big.Int) (bool) {
+  if r.Sign() <= 0 || r.Cmp(N) >= 0 || s.Sign() <= 0 || s.Cmp(N) >= 0 || key.Infinity() {
+    return false
+  }
+  e := new(big.Int).SetBytes(hash)
+  w := new(big.Int).ModInverse(s, N)
+  u1 := e.Mul(e, w)
+  u1.Mod(u1, N)
+  u2 := w.Mul(r, w)
+  u2.Mod(u2, N)
+  point := DoubleScalarMult(u1, G, u2, key)
+  if point.Infinity() {
+    return false
+  }
+  return new(big.Int).Mod(point.X, N).Cmp(r) == 0
+}
+
+//IsLowS reports whether s is at most N/2, as BIP62 and standardness require
+func IsLowS(s *big.Int) (bool) {
+  return s.Cmp(halfN) <= 0
+}
+
+//SignECDSA signs the 32 byte hash with the private key d, with the nonce of RFC 6979, and returns a low S signature.
+//It exists to build test transactions.
+func SignECDSA(d *big.Int, hash []byte) (*big.Int, *big.Int) {
+  e := new(big.Int).SetBytes(hash)
+  for generate := rfc6979(d, hash); ; {
+    k := generate()
+    point := ScalarBaseMult(k)
+    r := new(big.Int).Mod(point.X, N)
+    if r.Sign() == 0 {
+      continue
+    }
+    s := new(big.Int).Mul(r, d)
+    s.Add(s, e)
+    s.Mul(s, new(big.Int).ModInverse(k, N))
+    s.Mod(s, N)
+    if s.Sign() == 0 {
+      continue
+    }
+    if !IsLowS(s) {
+      s.Sub(N, s)
+    }
+    return r, s
+  }
+}
+
+//rfc6979 returns a generator of the deterministic nonces of RFC 6979 with HMAC-SHA256
+func rfc6979(d *big.Int, hash []byte) (func() (*big.Int)) {
+  x := make([]byte, 32)
+  d.FillBytes(x)
+  h := make([]byte, 32)
+  new(big.Int).Mod(new(big.Int).SetBytes(hash), N).FillBytes(h)
+  v := make([]byte, 32)
+  k := make([]byte, 32)
+  for i := range v {
+    v[i] = 0x01
+  }
+  mac := func(key []byte, parts ...[]byte) ([]byte) {
+    m := hmac.New(sha256.New, key)
+    for _, p := range parts {
+      m.Write(p)
+    }
+    return m.Sum(nil)
+  }
+  k = mac(k, v, []byte{0x00}, x, h)
+  v = mac(k, v)
+  k = mac(k, v, []byte{0x01}, x, h)
+  v = mac(k, v)
+  return func() (*big.Int) {
+    for {
+      v = mac(k, v)
+      candidate := new(big.Int).SetBytes(v)
+      if candidate.Sign() > 0 && candidate.Cmp(N) < 0 {
+        k = mac(k, v, []byte{0x00})
+        v = mac(k, v)
+        return candidate
+      }
+      k = mac(k, v, []byte{0x00})
+      v = mac(k, v)
+    }
+  }
+}
@@ -0,0 +1,116 @@
+package secp256k1
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "math/big"
+    "testing"
+)
+
+func TestPointArithmetic(t *testing.T) {
+  two := ScalarBaseMult(big.NewInt(2))
+  if two.X.Cmp(fromHex("c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5")) != 0 ||
+    two.Y.Cmp(fromHex("1ae168fea63dc339a3c58419466ceaeef7f632653266d0e1236431a950cfe52a")) != 0 {
+    t.Errorf("2G is %x, %x", two.X, two.Y)
+  }
+  if p := Add(G, G); p.X.Cmp(two.X) != 0 || p.Y.Cmp(two.Y) != 0 {
+    t.Errorf("G + G is not 2G")
+  }
+  if !Add(G, Negate(G)).Infinity() || ScalarBaseMult(new(big.Int).Sub(N, big.NewInt(1))).X.Cmp(G.X) != 0 {
+    t.Errorf("G - G or (N-1)G is wrong")
+  }
+  three := DoubleScalarMult(big.NewInt(1), G, big.NewInt(1), two)
+  if !IsOnCurve(three.X, three.Y) || three.X.Cmp(ScalarBaseMult(big.NewInt(3)).X) != 0 {
+    t.Errorf("G + 2G is not 3G")
+  }
+}
+
+func TestParsePublicKey(t *testing.T) {
+  k := ScalarBaseMult(big.NewInt(12345))
+  for _, b := range [][]byte{k.Compressed(), append(append([]byte{0x04}, k.X.FillBytes(make([]byte, 32))...), k.Y.FillBytes(make([]byte, 32))...)} {
+    p, err := ParsePublicKey(b)
+    if err != nil || p.X.Cmp(k.X) != 0 || p.Y.Cmp(k.Y) != 0 {
+      t.Errorf("ParsePublicKey(%x) = %v, %v", b, p, err)
+    }
+  }
+  hybrid := append(append([]byte{0x06 + byte(k.Y.Bit(0))}, k.X.FillBytes(make([]byte, 32))...), k.Y.FillBytes(make([]byte, 32))...)
+  if _, err := ParsePublicKey(hybrid); err != nil {
+    t.Errorf("hybrid key rejected: %v", err)
+  }
+  hybrid[0] ^= 1
+  if _, err := ParsePublicKey(hybrid); err != ErrBadPublicKey {
+    t.Errorf("hybrid key with the wrong parity accepted")
+  }
+  //x = 5 has no point on the curve
+  bad := make([]byte, 33)
+  bad[0], bad[32] = 0x02, 0x05
+  if _, err := ParsePublicKey(bad); err != ErrBadPublicKey {
+    t.Errorf("key off the curve accepted")
+  }
+}
+
+func TestECDSA(t *testing.T) {
+  //the widely used RFC 6979 vector for private key 1 and the message "Satoshi Nakamoto"
+  hash := sha256.Sum256([]byte("Satoshi Nakamoto"))
+  r, s := SignECDSA(big.NewInt(1), hash[:])
+  if hex.EncodeToString(r.Bytes()) != "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8" ||
+    hex.EncodeToString(s.Bytes()) != "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5" {
+    t.Errorf("signature %x, %x", r, s)
+  }
+  if !VerifyECDSA(G, hash[:], r, s) {
+    t.Errorf("signature does not verify")
+  }
+  //consensus accepts the high S form of a signature
+  if !VerifyECDSA(G, hash[:], r, new(big.Int).Sub(N, s)) || IsLowS(new(big.Int).Sub(N, s)) {
+    t.Errorf("high S signature rejected or reported as low S")
+  }
+  hash[0] ^= 1
+  if VerifyECDSA(G, hash[:], r, s) || VerifyECDSA(ScalarBaseMult(big.NewInt(2)), hash[:], r, s) || VerifyECDSA(G, hash[:], N, s) {
+    t.Errorf("signature verifies for the wrong message, key or r")
+  }
+}
+
+func TestSchnorr(t *testing.T) {
+  //the first two signing vectors of BIP340
+  vectors := []struct {
+    key string
+    pub string
+    aux string
+    msg string
+    sig string
+  }{
+    {"03", "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+      "0000000000000000000000000000000000000000000000000000000000000000",
+      "0000000000000000000000000000000000000000000000000000000000000000",
+      "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0"},
+    {"b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef", "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+      "0000000000000000000000000000000000000000000000000000000000000001",
+      "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+      "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a"},
+  }
+  for _, v := range vectors {
+    d := fromHex(v.key)
+    pub, _ := hex.DecodeString(v.pub)
+    aux, _ := hex.DecodeString(v.aux)
+    msg, _ := hex.DecodeString(v.msg)
+    if got := hex.EncodeToString(ScalarBaseMult(d).XOnly()); got != v.pub {
+      t.Errorf("key %s has x only key %s, want %s", v.key, got, v.pub)
+    }
+    sig := SignSchnorr(d, msg, aux)
+    if hex.EncodeToString(sig) != v.sig {
+      t.Errorf("key %s signed %x, want %s", v.key, sig, v.sig)
+    }
+    if !VerifySchnorr(pub, msg, sig) {
+      t.Errorf("signature of key %s does not verify", v.key)
+    }
+    msg[0] ^= 1
+    if VerifySchnorr(pub, msg, sig) {
+      t.Errorf("signature of key %s verifies for another message", v.key)
+    }
+  }
+  //an x coordinate with no point on the curve is not a key
+  bad, _ := hex.DecodeString("eefdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34")
+  if _, err := ParseXOnlyPublicKey(bad); err != ErrBadPublicKey {
+    t.Errorf("ParseXOnlyPublicKey of a point off the curve returned %v", err)
+  }
+}
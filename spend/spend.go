@@ -0,0 +1,319 @@
+package spend
+
+import (
+    "crypto/sha256"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/btchashing"
+    "github.com/tgebhart/goparsebtc/script"
+)
+
+//spend types beyond the script types of package script, which name the output an input spends: the coinbase input,
+//the script a pay to script hash output wraps and the path a taproot output is spent by
+const (
+  Coinbase = "coinbase"
+  P2SHMultisig = script.ScriptHash + "-" + script.Multisig
+  P2SHP2WPKH = script.ScriptHash + "-" + script.WitnessPubKeyHash
+  P2SHP2WSH = script.ScriptHash + "-" + script.WitnessScriptHash
+  P2TRKeyPath = script.Taproot + "-keypath"
+  P2TRScriptPath = script.Taproot + "-scriptpath"
+)
+
+//annexTag starts the optional last witness item of a taproot spend
+const annexTag = 0x50
+
+//Input holds what the script and witness of an input reveal about the output it spends
+type Input struct {
+  //Type is the script type of the spent output, or one of the spend types above
+  Type string
+  Signatures []script.Signature
+  //PublicKeys holds the keys of a multisig script, or the keys found in another redeem, witness or leaf script
+  PublicKeys [][]byte
+  //Required is the number of signatures a multisig script requires
+  Required int
+  RedeemScript []byte
+  WitnessScript []byte
+  //ControlBlock and Annex are set for taproot script path spends
+  ControlBlock []byte
+  Annex []byte
+  //PublicKey is the key that signed a single key spend
+  PublicKey []byte
+  //Address is the address of the spent output, where it can be recovered
+  Address string
+}
+
+//Analyze reads the script and witness of in. prevout is the output script it spends, or nil when it is not known,
+//in which case the spend type is inferred from the shape of the script and witness, and pay to public key spends
+//recover no key.
+func Analyze(in *block.Input, prevout []byte) (Input) {
+  var a Input
+  if in.TransactionHash == (block.Hash{}) && in.TransactionIndex == 0xffffffff {
+    a.Type = Coinbase
+    return a
+  }
+  kind := ""
+  if prevout != nil {
+    kind = script.Classify(prevout)
+  }
+  ops, err := script.Parse(in.InputScript)
+  pushOnly := err == nil
+  for _, op := range ops {
+    if op.Code > script.OP16 {
+      pushOnly = false
+    }
+  }
+  native := len(in.InputScript) == 0 && len(in.Witness) > 0
+  switch {
+  case kind == script.Taproot || (kind == "" && native && isTaproot(in.Witness)):
+    a.taproot(in.Witness)
+  case kind == script.WitnessPubKeyHash || kind == script.WitnessScriptHash || (kind == "" && native):
+    a.witness(in.Witness, kind == script.WitnessPubKeyHash || (kind == "" && isWitnessPubKeyHash(in.Witness)))
+  case !pushOnly:
+    a.Type = script.NonStandard
+    a.collect(ops)
+  case (kind == script.ScriptHash || kind == "") && len(ops) == 1 && len(in.Witness) > 0 && isNestedProgram(ops[0].Data):
+    a.RedeemScript = ops[0].Data
+    a.witness(in.Witness, len(a.RedeemScript) == 22)
+    a.Type = map[string]string{script.WitnessPubKeyHash: P2SHP2WPKH, script.WitnessScriptHash: P2SHP2WSH}[a.Type]
+  case kind == script.PubKey:
+    a.Type = script.PubKey
+    a.PublicKey = prevout[1:len(prevout)-1]
+    a.collect(ops)
+  case kind == script.PubKeyHash:
+    a.Type = script.PubKeyHash
+    a.collect(ops)
+    if len(ops) == 2 {
+      a.PublicKey = ops[1].Data
+    }
+  case kind == script.Multisig:
+    a.Type = script.Multisig
+    a.Required, a.PublicKeys, _ = script.ParseMultisig(prevout)
+    a.collect(ops)
+  case kind == script.ScriptHash && len(ops) > 0:
+    a.redeem(ops)
+  case kind == "":
+    a.infer(ops)
+  default:
+    a.Type = script.NonStandard
+    a.collect(ops)
+  }
+  a.address(prevout)
+  return a
+}
+
+//Transaction analyzes every input of tx. prevouts holds the output script each input spends and may be nil, as may
+//any of its scripts.
+func Transaction(tx *block.Transaction, prevouts [][]byte) ([]Input) {
+  ret := make([]Input, len(tx.Inputs))
+  for i := range tx.Inputs {
+    var prevout []byte
+    if i < len(prevouts) {
+      prevout = prevouts[i]
+    }
+    ret[i] = Analyze(&tx.Inputs[i], prevout)
+  }
+  return ret
+}
+
+//infer classifies a push only script whose spent output is unknown
+func (a *Input) infer(ops []script.Op) {
+  last := len(ops) - 1
+  switch {
+  case len(ops) == 1 && isSignature(ops[0].Data):
+    a.Type = script.PubKey
+    a.collect(ops)
+  case len(ops) == 2 && isSignature(ops[0].Data) && script.IsPublicKey(ops[1].Data):
+    a.Type = script.PubKeyHash
+    a.collect(ops)
+    a.PublicKey = ops[1].Data
+  case len(ops) >= 2 && ops[0].Code == script.OP0 && allSignatures(ops[1:]):
+    a.Type = script.Multisig
+    a.collect(ops)
+  case len(ops) >= 2 && isScript(ops[last].Data):
+    a.redeem(ops)
+  default:
+    a.Type = script.NonStandard
+    a.collect(ops)
+  }
+}
+
+//redeem reads a pay to script hash spend, whose last push is the redeem script
+func (a *Input) redeem(ops []script.Op) {
+  a.RedeemScript = ops[len(ops)-1].Data
+  a.Type = script.ScriptHash
+  a.script(a.RedeemScript, ops[:len(ops)-1])
+  if a.Required > 0 {
+    a.Type = P2SHMultisig
+  }
+}
+
+//script reads the keys of a redeem or witness script and the signatures among the items that satisfy it
+func (a *Input) script(s []byte, items []script.Op) {
+  a.collect(items)
+  if m, keys, ok := script.ParseMultisig(s); ok {
+    a.Required, a.PublicKeys = m, keys
+    return
+  }
+  ops, _ := script.Parse(s)
+  for _, op := range ops {
+    if script.IsPublicKey(op.Data) {
+      a.PublicKeys = append(a.PublicKeys, op.Data)
+    }
+  }
+  if len(a.PublicKeys) == 1 {
+    a.PublicKey = a.PublicKeys[0]
+  }
+}
+
+//witness reads a version 0 witness, which spends a key hash when keyHash is set and a script hash otherwise
+func (a *Input) witness(items [][]byte, keyHash bool) {
+  if keyHash {
+    a.Type = script.WitnessPubKeyHash
+    a.collect(pushes(items))
+    if len(items) == 2 {
+      a.PublicKey = items[1]
+    }
+    return
+  }
+  a.Type = script.WitnessScriptHash
+  if len(items) == 0 {
+    return
+  }
+  a.WitnessScript = items[len(items)-1]
+  a.script(a.WitnessScript, pushes(items[:len(items)-1]))
+}
+
+//taproot reads a witness version 1 witness: a single signature for a key path spend, or a leaf script and control
+//block for a script path spend, either followed by an annex
+func (a *Input) taproot(items [][]byte) {
+  if len(items) >= 2 && len(items[len(items)-1]) > 0 && items[len(items)-1][0] == annexTag {
+    a.Annex = items[len(items)-1]
+    items = items[:len(items)-1]
+  }
+  if len(items) == 1 {
+    a.Type = P2TRKeyPath
+    if sig, err := script.ParseSchnorrSignature(items[0]); err == nil {
+      a.Signatures = append(a.Signatures, sig)
+    }
+    return
+  }
+  a.Type = P2TRScriptPath
+  if len(items) < 2 {
+    return
+  }
+  a.ControlBlock = items[len(items)-1]
+  a.WitnessScript = items[len(items)-2]
+  for _, item := range items[:len(items)-2] {
+    if sig, err := script.ParseSchnorrSignature(item); err == nil {
+      a.Signatures = append(a.Signatures, sig)
+    }
+  }
+  ops, _ := script.Parse(a.WitnessScript)
+  for _, op := range ops {
+    if len(op.Data) == 32 {
+      a.PublicKeys = append(a.PublicKeys, op.Data)
+    }
+  }
+}
+
+//collect keeps the signatures and public keys pushed by ops
+func (a *Input) collect(ops []script.Op) {
+  for _, op := range ops {
+    if script.IsPublicKey(op.Data) {
+      continue
+    }
+    if sig, err := script.ParseSignature(op.Data); err == nil {
+      a.Signatures = append(a.Signatures, sig)
+    }
+  }
+}
+
+//address sets the address of the spent output from prevout when it is known, and otherwise from the key or script
+//the spend reveals
+func (a *Input) address(prevout []byte) {
+  var addr block.Address
+  if version, program, ok := script.WitnessProgram(prevout); ok {
+    btchashing.WitnessProgramToAddress(version, program, &addr)
+    a.Address = addr.Address
+    return
+  }
+  switch a.Type {
+  case script.PubKey, script.PubKeyHash:
+    if a.PublicKey != nil {
+      btchashing.BitcoinRipeMD160ToAddress(btchashing.Hash160(a.PublicKey), &addr)
+    }
+  case script.ScriptHash, P2SHMultisig, P2SHP2WPKH, P2SHP2WSH:
+    btchashing.BitcoinScriptHashToAddress(btchashing.Hash160(a.RedeemScript), &addr)
+  case script.WitnessPubKeyHash:
+    btchashing.WitnessProgramToAddress(0, btchashing.Hash160(a.PublicKey), &addr)
+  case script.WitnessScriptHash:
+    sum := sha256.Sum256(a.WitnessScript)
+    btchashing.WitnessProgramToAddress(0, sum[:], &addr)
+  }
+  a.Address = addr.Address
+}
+
+//pushes returns witness items as the pushes of a script
+func pushes(items [][]byte) ([]script.Op) {
+  ops := make([]script.Op, len(items))
+  for i, item := range items {
+    ops[i].Data = item
+  }
+  return ops
+}
+
+//isSignature reports whether b reads as a pushed ECDSA signature
+func isSignature(b []byte) (bool) {
+  _, err := script.ParseSignature(b)
+  return err == nil
+}
+
+//allSignatures reports whether every op pushes an ECDSA signature
+func allSignatures(ops []script.Op) (bool) {
+  for _, op := range ops {
+    if !isSignature(op.Data) {
+      return false
+    }
+  }
+  return true
+}
+
+//isScript reports whether b parses as a script with an op code other than pushes, as a redeem script does
+func isScript(b []byte) (bool) {
+  ops, err := script.Parse(b)
+  if err != nil {
+    return false
+  }
+  for _, op := range ops {
+    if op.Code > script.OP16 {
+      return true
+    }
+  }
+  return false
+}
+
+//isNestedProgram reports whether a redeem script is a version 0 witness program
+func isNestedProgram(redeem []byte) (bool) {
+  version, program, ok := script.WitnessProgram(redeem)
+  return ok && version == 0 && (len(program) == 20 || len(program) == 32)
+}
+
+//isWitnessPubKeyHash reports whether a witness has the signature and compressed key of a P2WPKH spend
+func isWitnessPubKeyHash(items [][]byte) (bool) {
+  return len(items) == 2 && len(items[1]) == 33 && script.IsPublicKey(items[1]) && isSignature(items[0])
+}
+
+//isTaproot reports whether a witness has the shape of a taproot spend: a lone Schnorr signature, or a leaf script
+//followed by a control block, either followed by an annex
+func isTaproot(items [][]byte) (bool) {
+  if len(items) >= 2 && len(items[len(items)-1]) > 0 && items[len(items)-1][0] == annexTag {
+    items = items[:len(items)-1]
+  }
+  if len(items) == 1 {
+    return len(items[0]) == 64 || len(items[0]) == 65
+  }
+  if len(items) < 2 {
+    return false
+  }
+  control := items[len(items)-1]
+  return len(control) >= 33 && (len(control) - 33) % 32 == 0 && (len(control) - 33) / 32 <= 128 && control[0] & 0xfe == 0xc0
+}
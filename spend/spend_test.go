@@ -0,0 +1,130 @@
+package spend_test
+
+import (
+    "bytes"
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockchainbuilder"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/script"
+    "github.com/tgebhart/goparsebtc/spend"
+)
+
+func decode(t *testing.T, raw string) (*block.Transaction) {
+  var tx block.Transaction
+  _, err := blockchainbuilder.DecodeTransactionBytes(chaintest.MustHex(raw), &tx, blockchainbuilder.DefaultDecodeOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return &tx
+}
+
+//push returns the script op pushing b
+func push(b []byte) ([]byte) {
+  if len(b) < script.OPPUSHDATA1 {
+    return append([]byte{byte(len(b))}, b...)
+  }
+  return append([]byte{script.OPPUSHDATA1, byte(len(b))}, b...)
+}
+
+func TestKnownTransactions(t *testing.T) {
+  tx := decode(t, chaintest.Tx170Hex)
+  prevout := chaintest.MustHex(chaintest.Block9CoinbaseScript)
+  a := spend.Analyze(&tx.Inputs[0], prevout)
+  if a.Type != script.PubKey || !bytes.Equal(a.PublicKey, prevout[1:66]) || a.Address != "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S" {
+    t.Errorf("block 170 spend analyzed as %+v", a)
+  }
+  if len(a.Signatures) != 1 || a.Signatures[0].HashType != script.SigHashAll || !a.Signatures[0].Strict || len(a.Signatures[0].R) != 32 {
+    t.Errorf("block 170 signatures %+v", a.Signatures)
+  }
+  //without the spent output the key of a pay to public key spend is unknown
+  if a = spend.Analyze(&tx.Inputs[0], nil); a.Type != script.PubKey || a.PublicKey != nil || a.Address != "" {
+    t.Errorf("block 170 spend without its prevout analyzed as %+v", a)
+  }
+
+  tx = decode(t, chaintest.BIP143P2WPKHHex)
+  inputs := spend.Transaction(tx, nil)
+  if inputs[0].Type != script.PubKey || inputs[1].Type != script.WitnessPubKeyHash || !bytes.Equal(inputs[1].PublicKey, tx.Inputs[1].Witness[1]) {
+    t.Errorf("BIP143 inputs analyzed as %+v", inputs)
+  }
+  if len(inputs[1].Signatures) != 1 || inputs[1].Signatures[0].HashType != script.SigHashAll || inputs[1].Address[:4] != "bc1q" {
+    t.Errorf("BIP143 P2WPKH input analyzed as %+v", inputs[1])
+  }
+}
+
+func TestSpendTypes(t *testing.T) {
+  //a real signature, from block 170, and keys of the right form
+  sig := chaintest.MustHex(chaintest.Tx170Hex)[43:114]
+  k1 := append([]byte{0x02}, bytes.Repeat([]byte{0x11}, 32)...)
+  k2 := append([]byte{0x03}, bytes.Repeat([]byte{0x22}, 32)...)
+  k3 := append([]byte{0x02}, bytes.Repeat([]byte{0x33}, 32)...)
+  redeem := append(append(append(append([]byte{script.OP1 + 1}, push(k1)...), push(k2)...), push(k3)...), script.OP1 + 2, script.OPCHECKMULTISIG)
+  keyHash := chaintest.MustHex("adfce54f529b2154e3c361bbe3f7d41db0635717")
+  schnorr := bytes.Repeat([]byte{0x55}, 64)
+  leaf := append(append([]byte{0x20}, bytes.Repeat([]byte{0x44}, 32)...), script.OPCHECKSIG)
+  control := append([]byte{0xc0}, bytes.Repeat([]byte{0x66}, 64)...)
+  taproot := append([]byte{script.OP1, 0x20}, bytes.Repeat([]byte{0x44}, 32)...)
+  cat := func(parts ...[]byte) ([]byte) {
+    return bytes.Join(parts, nil)
+  }
+
+  tests := []struct {
+    name string
+    scriptSig []byte
+    witness [][]byte
+    prevout []byte
+    spendType string
+    signatures int
+    required int
+    address string
+  }{
+    {"p2pkh", cat(push(sig), push(k1)), nil, nil, script.PubKeyHash, 1, 0, "1Grxrh4z458DEdd3VVS6D5ASSyt8ydPaLe"},
+    {"p2sh multisig", cat([]byte{script.OP0}, push(sig), push(sig), push(redeem)), nil, nil, spend.P2SHMultisig, 2, 2, "3DwVU1AqBJdCQ2FgNcq8im1UYFGA4xVsPf"},
+    {"bare multisig", cat([]byte{script.OP0}, push(sig)), nil, nil, script.Multisig, 1, 0, ""},
+    {"bare multisig with prevout", cat([]byte{script.OP0}, push(sig), push(sig)), nil, redeem, script.Multisig, 2, 2, ""},
+    {"p2sh-p2wpkh", push(cat([]byte{script.OP0, 20}, keyHash)), [][]byte{sig, k1}, nil, spend.P2SHP2WPKH, 1, 0, "33omYBLg1nTDLfMic7vWYVPYe185gnteL3"},
+    {"p2wpkh", nil, [][]byte{sig, k1}, nil, script.WitnessPubKeyHash, 1, 0, "bc1q4h7w2n6jnvs4fc7rvxa78a75rkcxx4cha6sptp"},
+    {"p2wsh multisig", nil, [][]byte{{}, sig, sig, redeem}, nil, script.WitnessScriptHash, 2, 2, "bc1qxrkryq96y7mmy3t44gavc2gahsxcughj5v9g5tj0q7j82fu5958qlfqzgn"},
+    {"p2tr key path", nil, [][]byte{schnorr}, nil, spend.P2TRKeyPath, 1, 0, ""},
+    {"p2tr key path with prevout", nil, [][]byte{append(schnorr, script.SigHashSingle)}, taproot, spend.P2TRKeyPath, 1, 0, "bc1pg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zq8ss0kf"},
+    {"p2tr script path with annex", nil, [][]byte{schnorr, leaf, control, {0x50, 0x00}}, nil, spend.P2TRScriptPath, 1, 0, ""},
+    {"non push", []byte{script.OPDUP}, nil, nil, script.NonStandard, 0, 0, ""},
+    {"coinbase", nil, nil, nil, spend.Coinbase, 0, 0, ""},
+  }
+  for _, test := range tests {
+    in := chaintest.In(block.Hash{1}, 0)
+    if test.spendType == spend.Coinbase {
+      in = chaintest.Coinbase(chaintest.HeightScript(1, ""))
+    } else {
+      in.InputScript = test.scriptSig
+    }
+    in.Witness = test.witness
+    a := spend.Analyze(&in, test.prevout)
+    if a.Type != test.spendType || len(a.Signatures) != test.signatures || a.Required != test.required || a.Address != test.address {
+      t.Errorf("%s analyzed as %s with %d signatures, %d required and address %q, want %s, %d, %d and %q", test.name, a.Type,
+        len(a.Signatures), a.Required, a.Address, test.spendType, test.signatures, test.required, test.address)
+    }
+  }
+}
+
+func TestParseSignature(t *testing.T) {
+  sig := chaintest.MustHex(chaintest.Tx170Hex)[43:114]
+  parsed, err := script.ParseSignature(sig)
+  if err != nil || !parsed.Strict || parsed.HashType != script.SigHashAll || script.HashTypeName(parsed.HashType | script.SigHashAnyoneCanPay) != "ALL|ANYONECANPAY" {
+    t.Fatalf("parsed %+v, %v", parsed, err)
+  }
+  //a padded R is accepted as bitcoind accepted it before BIP66, but is not strict
+  padded := append([]byte{0x30, sig[1] + 1, 0x02, sig[3] + 1, 0x00}, sig[4:]...)
+  lax, err := script.ParseSignature(padded)
+  if err != nil || lax.Strict || !bytes.Equal(lax.R, parsed.R) || !bytes.Equal(lax.S, parsed.S) {
+    t.Errorf("padded signature parsed as %+v, %v", lax, err)
+  }
+  for _, bad := range [][]byte{nil, {0x01}, sig[:10], append([]byte{0x31}, sig[1:]...)} {
+    if _, err := script.ParseSignature(bad); err == nil {
+      t.Errorf("ParseSignature(%x) succeeded", bad)
+    }
+  }
+  if _, err := script.ParseSchnorrSignature(append(bytes.Repeat([]byte{1}, 64), script.SigHashDefault)); err != script.ErrBadSignature {
+    t.Errorf("65 byte Schnorr signature with the default hash type accepted")
+  }
+}
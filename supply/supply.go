@@ -0,0 +1,208 @@
+package supply
+
+import (
+    "fmt"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/blockvalidation"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/network"
+)
+
+//Coin is the number of satoshis in a bitcoin
+const Coin = 100000000
+
+//InitialSubsidy is the subsidy of the blocks before the first halving
+const InitialSubsidy = 50 * Coin
+
+//BurnAddresses are addresses widely used to destroy coins, whose keys nobody can hold: the all zero hash160, the
+//Bitcoin Eater address and Counterparty's proof of burn address
+var BurnAddresses = []string{
+  "1111111111111111111114oLvT2",
+  "1BitcoinEaterAddressDontSendf59kuE",
+  "1CounterpartyXXXXXXXXXXXXXXXUWLpVr",
+}
+
+//Subsidy returns the number of new satoshis a block at height may claim on the active network
+func Subsidy(height int) (uint64) {
+  halvings := height / network.Active.SubsidyHalvingInterval
+  if halvings >= 64 {
+    return 0
+  }
+  return InitialSubsidy >> uint(halvings)
+}
+
+//Era is a stretch of blocks with the same subsidy
+type Era struct {
+  Height int `json:"height"`
+  Subsidy uint64 `json:"subsidy"`
+  //Supply is the most satoshis that can exist once every block before the era has claimed its full subsidy
+  Supply uint64 `json:"supply"`
+}
+
+//Schedule returns the eras of the active network, up to the first with no subsidy
+func Schedule() ([]Era) {
+  var eras []Era
+  var supply uint64
+  interval := network.Active.SubsidyHalvingInterval
+  for height := 0; ; height += interval {
+    subsidy := Subsidy(height)
+    eras = append(eras, Era{height, subsidy, supply})
+    if subsidy == 0 {
+      return eras
+    }
+    supply += subsidy * uint64(interval)
+  }
+}
+
+//MaxSupply returns the most satoshis that can be issued up to and including height if every block claims its subsidy
+func MaxSupply(height int) (uint64) {
+  var supply uint64
+  interval := network.Active.SubsidyHalvingInterval
+  for start := 0; start <= height; start += interval {
+    end := min(start + interval - 1, height)
+    supply += Subsidy(start) * uint64(end - start + 1)
+  }
+  return supply
+}
+
+//BlockSupply accounts for the coins a main chain block issued and made unspendable
+type BlockSupply struct {
+  Height int `json:"height"`
+  BlockHash block.Hash `json:"block_hash"`
+  Subsidy uint64 `json:"subsidy"`
+  Fees uint64 `json:"fees"`
+  //Claimed is the value of the coinbase outputs
+  Claimed uint64 `json:"claimed"`
+  //Unclaimed is the part of the subsidy and fees the coinbase left unclaimed, which is never issued
+  Unclaimed uint64 `json:"unclaimed"`
+  //Unspendable is the value the block put in outputs that can never be spent, together with the unspent coins it
+  //overwrote by repeating their txid before BIP30
+  Unspendable uint64 `json:"unspendable"`
+  //Supply is the number of satoshis issued up to and including this block
+  Supply uint64 `json:"supply"`
+  //Circulating is Supply less every unspendable output up to and including this block
+  Circulating uint64 `json:"circulating"`
+}
+
+//Issued returns the satoshis the block created: what its coinbase claimed beyond the fees it collected
+func (b *BlockSupply) Issued() (uint64) {
+  return b.Claimed - b.Fees
+}
+
+//Tracker accounts for the supply block by block. It is a chainstate.Index, as fees need the values of spent coins,
+//and it rolls back with the chain state across reorgs.
+type Tracker struct {
+  //BurnAddresses holds the addresses whose outputs count as unspendable
+  BurnAddresses map[string]bool
+  blocks []BlockSupply
+}
+
+//NewTracker returns a tracker counting outputs to BurnAddresses as unspendable
+func NewTracker() (*Tracker) {
+  t := &Tracker{BurnAddresses: make(map[string]bool)}
+  for _, a := range BurnAddresses {
+    t.BurnAddresses[a] = true
+  }
+  return t
+}
+
+//At returns the accounts of the main chain block at height
+func (t *Tracker) At(height int) (BlockSupply, bool) {
+  if height < 0 || height >= len(t.blocks) {
+    return BlockSupply{}, false
+  }
+  return t.blocks[height], true
+}
+
+//Height returns the height of the last block connected, or -1
+func (t *Tracker) Height() (int) {
+  return len(t.blocks) - 1
+}
+
+//UnderClaimed returns the blocks whose coinbase claimed less than their subsidy and fees, in height order
+func (t *Tracker) UnderClaimed() ([]BlockSupply) {
+  var found []BlockSupply
+  for _, b := range t.blocks {
+    if b.Unclaimed > 0 {
+      found = append(found, b)
+    }
+  }
+  return found
+}
+
+func (t *Tracker) ConnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  if height != len(t.blocks) {
+    return fmt.Errorf("supply: block %s connected at height %d after height %d", b.BlockHash, height, len(t.blocks) - 1)
+  }
+  s := BlockSupply{Height: height, BlockHash: b.BlockHash, Subsidy: Subsidy(height)}
+  var spent, paid uint64
+  for _, c := range undo.Spent {
+    spent += c.Coin.Value
+  }
+  for i := range b.Transactions {
+    for j := range b.Transactions[i].Outputs {
+      out := &b.Transactions[i].Outputs[j]
+      if i == 0 {
+        s.Claimed += out.OutputValue
+      } else {
+        paid += out.OutputValue
+      }
+      if t.unspendable(out.ChallengeScript) {
+        s.Unspendable += out.OutputValue
+      }
+    }
+  }
+  for _, c := range undo.Overwritten {
+    if !t.unspendable(c.Coin.Script) {
+      s.Unspendable += c.Coin.Value
+    }
+  }
+  if spent < paid {
+    return fmt.Errorf("supply: block %s at height %d pays %d from inputs worth %d", b.BlockHash, height, paid, spent)
+  }
+  s.Fees = spent - paid
+  if s.Claimed < s.Fees {
+    return fmt.Errorf("supply: block %s at height %d claims %d of %d in fees", b.BlockHash, height, s.Claimed, s.Fees)
+  }
+  if owed := s.Subsidy + s.Fees; s.Claimed < owed {
+    s.Unclaimed = owed - s.Claimed
+  }
+  if height == 0 {
+    //the genesis coinbase was never added to the UTXO set
+    s.Unspendable = s.Claimed
+  }
+  if height > 0 {
+    last := t.blocks[height-1]
+    s.Supply, s.Circulating = last.Supply, last.Circulating
+  }
+  s.Supply += s.Issued()
+  s.Circulating += s.Issued() - s.Unspendable
+  t.blocks = append(t.blocks, s)
+  return nil
+}
+
+func (t *Tracker) DisconnectBlock(height int, b *block.Block, undo *chainstate.BlockUndo) (error) {
+  if height != len(t.blocks) - 1 || t.blocks[height].BlockHash != b.BlockHash {
+    return fmt.Errorf("supply: block %s at height %d is not the tip", b.BlockHash, height)
+  }
+  t.blocks = t.blocks[:height]
+  return nil
+}
+
+//unspendable reports whether an output script can never be spent or pays a burn address
+func (t *Tracker) unspendable(script []byte) (bool) {
+  if chainstate.Unspendable(script) {
+    return true
+  }
+  if len(t.BurnAddresses) == 0 {
+    return false
+  }
+  out := block.Output{ChallengeScript: script}
+  blockvalidation.ParseOutputScript(&out)
+  for _, a := range out.Addresses {
+    if t.BurnAddresses[a.Address] {
+      return true
+    }
+  }
+  return false
+}
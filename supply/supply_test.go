@@ -0,0 +1,149 @@
+package supply_test
+
+import (
+    "testing"
+    "github.com/tgebhart/goparsebtc/block"
+    "github.com/tgebhart/goparsebtc/chainstate"
+    "github.com/tgebhart/goparsebtc/chaintest"
+    "github.com/tgebhart/goparsebtc/network"
+    "github.com/tgebhart/goparsebtc/supply"
+)
+
+func TestSubsidy(t *testing.T) {
+  tests := []struct {
+    height int
+    subsidy uint64
+  }{
+    {0, 5000000000},
+    {209999, 5000000000},
+    {210000, 2500000000},
+    {420000, 1250000000},
+    {630000, 625000000},
+    {840000, 312500000},
+    {32 * 210000, 1},
+    {33 * 210000, 0},
+    {64 * 210000, 0},
+  }
+  for _, test := range tests {
+    if got := supply.Subsidy(test.height); got != test.subsidy {
+      t.Errorf("Subsidy(%d) = %d, want %d", test.height, got, test.subsidy)
+    }
+  }
+  //the well known limit of 20999999.9769 bitcoin
+  if got := supply.MaxSupply(100000000); got != 2099999997690000 {
+    t.Errorf("MaxSupply = %d, want 2099999997690000", got)
+  }
+  if got := supply.MaxSupply(209999); got != 210000 * 5000000000 {
+    t.Errorf("MaxSupply(209999) = %d", got)
+  }
+  eras := supply.Schedule()
+  last := eras[len(eras)-1]
+  if len(eras) != 34 || last.Height != 33 * 210000 || last.Subsidy != 0 || last.Supply != 2099999997690000 || eras[1].Supply != 210000 * 5000000000 {
+    t.Errorf("%d eras ending %+v", len(eras), last)
+  }
+
+  network.Active = &network.RegTest
+  defer func() { network.Active = &network.MainNet }()
+  if supply.Subsidy(149) != 5000000000 || supply.Subsidy(150) != 2500000000 {
+    t.Errorf("regtest halves at %d, want 150", network.Active.SubsidyHalvingInterval)
+  }
+}
+
+//payTo returns a pay to public key hash script for hash160
+func payTo(hash160 []byte) ([]byte) {
+  return append(append([]byte{0x76, 0xa9, 0x14}, hash160...), 0x88, 0xac)
+}
+
+func TestTracker(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(1, "")
+  coinbase := c.Order[1].Transactions[0].TransactionHash
+  //a fee of 1000, 7000 burned to the zero hash160 and 500 in an OP_RETURN output
+  pay := chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)},
+    chaintest.Out(chaintest.Subsidy - 8500, chaintest.OpTrue), chaintest.Out(7000, payTo(make([]byte, 20))), chaintest.Out(500, []byte{0x6a}))
+  full := c.Mine(c.Tip, "", 1000, pay)
+  //a coinbase claiming 1 satoshi less than the subsidy
+  under := c.Mine(c.Tip, "", 0)
+  under.Transactions[0].Outputs[0].OutputValue--
+  tracker := supply.NewTracker()
+  s := chainstate.New(tracker)
+  blocks := []*block.Block{c.Order[0], c.Order[1], full, under}
+  for h, b := range blocks {
+    err := s.ConnectBlock(h, b)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  want := []supply.BlockSupply{
+    {Height: 0, Subsidy: chaintest.Subsidy, Claimed: chaintest.Subsidy, Unspendable: chaintest.Subsidy, Supply: chaintest.Subsidy},
+    {Height: 1, Subsidy: chaintest.Subsidy, Claimed: chaintest.Subsidy, Supply: 2 * chaintest.Subsidy, Circulating: chaintest.Subsidy},
+    {Height: 2, Subsidy: chaintest.Subsidy, Fees: 1000, Claimed: chaintest.Subsidy + 1000, Unspendable: 7500, Supply: 3 * chaintest.Subsidy, Circulating: 2 * chaintest.Subsidy - 7500},
+    {Height: 3, Subsidy: chaintest.Subsidy, Claimed: chaintest.Subsidy - 1, Unclaimed: 1, Supply: 4 * chaintest.Subsidy - 1, Circulating: 3 * chaintest.Subsidy - 7501},
+  }
+  for h, w := range want {
+    got, ok := tracker.At(h)
+    w.BlockHash = blocks[h].BlockHash
+    if !ok || got != w {
+      t.Errorf("height %d: %+v, want %+v", h, got, w)
+    }
+  }
+  if u := tracker.UnderClaimed(); len(u) != 1 || u[0].Height != 3 {
+    t.Errorf("under-claimed blocks %+v, want height 3", u)
+  }
+
+  //a reorg takes the tip's accounts with it
+  err := s.DisconnectBlock(3, under)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := tracker.At(3); ok || tracker.Height() != 2 || len(tracker.UnderClaimed()) != 0 {
+    t.Errorf("tip still accounted for after it was disconnected")
+  }
+  if err := tracker.DisconnectBlock(1, c.Order[1], &chainstate.BlockUndo{}); err == nil {
+    t.Errorf("disconnecting below the tip succeeded")
+  }
+}
+
+func TestTrackerSegwitBurn(t *testing.T) {
+  c := chaintest.NewChain()
+  c.Extend(1, "")
+  coinbase := c.Order[1].Transactions[0].TransactionHash
+  //the BIP173 pay to witness public key hash example, taken as a burn address, and a taproot output that is not one
+  p2wpkh := chaintest.MustHex("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+  p2tr := chaintest.MustHex("512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+  pay := chaintest.Tx([]block.Input{chaintest.In(coinbase, 0)}, chaintest.Out(3000, p2wpkh), chaintest.Out(chaintest.Subsidy - 3000, p2tr))
+  c.Mine(c.Tip, "", 0, pay)
+  tracker := supply.NewTracker()
+  tracker.BurnAddresses["bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"] = true
+  s := chainstate.New(tracker)
+  for h, b := range c.Order {
+    if err := s.ConnectBlock(h, b); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if got, _ := tracker.At(2); got.Unspendable != 3000 {
+    t.Errorf("%d unspendable, want the 3000 paid to the burn address", got.Unspendable)
+  }
+}
+
+func TestTrackerDuplicateCoinbase(t *testing.T) {
+  //blocks 1 and 3 share a coinbase, as blocks 91812 and 91842 did, so the coin of block 1 is lost
+  c := chaintest.NewChain()
+  coinbase := chaintest.Tx([]block.Input{chaintest.Coinbase([]byte("/dup/"))}, chaintest.Out(chaintest.Subsidy, chaintest.OpTrue))
+  c.MineCoinbase(c.Tip, coinbase)
+  c.Extend(1, "")
+  c.MineCoinbase(c.Tip, coinbase)
+  tracker := supply.NewTracker()
+  s := chainstate.New(tracker)
+  for h, b := range c.Order {
+    err := s.ConnectBlock(h, b)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  got, _ := tracker.At(3)
+  if got.Unspendable != chaintest.Subsidy || got.Supply != 4 * chaintest.Subsidy || got.Circulating != s.UTXO.Total() {
+    t.Errorf("%+v, want the overwritten coinbase unspendable and %d circulating as in the UTXO set", got, s.UTXO.Total())
+  }
+}
@@ -80,7 +80,7 @@ func testBlockUpload(reference string) {
     }
   }
 
-  if b.BlockHash != "" {
+  if !b.BlockHash.IsZero() {
     err = blockchainreader.MapBlockToDBlock(&b, &d)
     if err != nil {
       fmt.Println("MapBlockToDBlock: ", err)